@@ -0,0 +1,65 @@
+// apps/backend/cmd/createadmin/main.go
+//
+// createadmin membuat akun admin pertama. Akun admin tidak bisa dibuat lewat
+// endpoint /register.
+//
+//	DB_SOURCE=... ADMIN_PASSWORD=... go run ./cmd/createadmin -name "Admin" -email admin@example.com
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/trifur/rekamedchain/backend/internal/database"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	name := flag.String("name", "Administrator", "nama admin")
+	email := flag.String("email", "", "email admin")
+	flag.Parse()
+
+	// Password dibaca dari env agar tidak tersimpan di riwayat shell.
+	password := os.Getenv("ADMIN_PASSWORD")
+	if *email == "" || len(password) < 8 {
+		log.Fatal("Gunakan -email dan isi ADMIN_PASSWORD (minimal 8 karakter)")
+	}
+
+	dbURL := os.Getenv("DB_SOURCE")
+	if dbURL == "" {
+		log.Fatal("DB_SOURCE belum diatur")
+	}
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("Koneksi DB gagal: %v", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatalf("Gagal memproses password: %v", err)
+	}
+
+	userRepo := repository.NewPostgresUserRepository(db)
+	userID, err := userRepo.CreateUser(ctx, &domain.User{
+		Name:               *name,
+		Email:              *email,
+		HashedPassword:     string(hashedPassword),
+		Role:               domain.RoleAdmin,
+		VerificationStatus: domain.VerificationApproved,
+	})
+	if err != nil {
+		log.Fatalf("Gagal membuat admin: %v", err)
+	}
+	if err := userRepo.MarkEmailVerified(ctx, userID); err != nil {
+		log.Fatalf("Gagal memverifikasi email admin: %v", err)
+	}
+
+	log.Printf("Admin %s dibuat dengan ID %s", *email, userID)
+}
@@ -6,10 +6,14 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/trifur/rekamedchain/backend/internal/auth"
 	"github.com/trifur/rekamedchain/backend/internal/blockchain"
 	"github.com/trifur/rekamedchain/backend/internal/config"
 	"github.com/trifur/rekamedchain/backend/internal/database"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
 	"github.com/trifur/rekamedchain/backend/internal/router"
+	"github.com/trifur/rekamedchain/backend/internal/terminology"
 )
 
 func main() {
@@ -27,6 +31,17 @@ func main() {
 	defer db.Close()
 	log.Println("DB connected!")
 
+	// Sinkronkan katalog ICD-10 bawaan agar autocomplete dan validasi diagnosis memakai data terbaru.
+	icd10Codes, err := terminology.ICD10Codes()
+	if err != nil {
+		log.Fatalf("Gagal membaca katalog ICD-10: %v", err)
+	}
+	changed, err := repository.NewPostgresTerminologyRepository(db).SyncICD10(context.Background(), icd10Codes)
+	if err != nil {
+		log.Fatalf("Gagal menyinkronkan katalog ICD-10: %v", err)
+	}
+	log.Printf("Katalog ICD-10: %d kode, %d ditambahkan/diperbarui", len(icd10Codes), changed)
+
 	// --- TAMBAHKAN BLOK BARU INI ---
 	// 3. Buat Koneksi ke Blockchain
 	bcClient, err := blockchain.NewBlockchainClient(cfg.HardhatURL, cfg.LedgerContractAddress, cfg.SignerPrivateKey)
@@ -35,10 +50,24 @@ func main() {
 	}
 	// --- AKHIR BLOK BARU ---
 
-	// 4. Inisialisasi Router (sekarang dengan blockchain client)
-	appRouter := router.NewRouter(db, cfg.IPFS_API, cfg.IPFS_Gateway, cfg.JWTKey, cfg.EncryptionKey, bcClient)
+	// 4. Siapkan penandatangan token (Ed25519 dengan key ID untuk rotasi)
+	tokenIssuer, err := auth.NewTokenIssuer(cfg.JWTSigningKeyID, cfg.JWTSigningKey, cfg.JWTVerificationKeys, cfg.JWTIssuer, cfg.JWTAudience)
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan kunci JWT: %v", err)
+	}
+
+	// 5. Siapkan pengirim email (SMTP untuk produksi, log untuk pengembangan lokal)
+	var mailer mail.Mailer
+	if cfg.MailDriver == "smtp" {
+		mailer = mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	} else {
+		mailer = mail.NewLogMailer(cfg.MailLogDir, cfg.MailFrom)
+	}
+
+	// 6. Inisialisasi Router (sekarang dengan blockchain client)
+	appRouter := router.NewRouter(db, cfg, tokenIssuer, mailer, bcClient)
 
-	// 5. Jalankan HTTP Server
+	// 7. Jalankan HTTP Server
 	log.Printf("Backend server is starting on %s", cfg.ServerAddress)
 	if err := http.ListenAndServe(cfg.ServerAddress, appRouter); err != nil {
 		log.Fatal("Server start error: ", err)
@@ -0,0 +1,195 @@
+// apps/backend/cmd/oidcstub/main.go
+//
+// oidcstub adalah penyedia identitas OIDC tiruan untuk pengembangan dan
+// pengujian lokal login tenaga kesehatan. Setiap permintaan /authorize langsung
+// disetujui sebagai satu pengguna tetap, lalu browser diarahkan kembali dengan code.
+//
+//	go run ./cmd/oidcstub -email dokter@rs.local -name "dr. Stub" -mfa
+//
+// Backend dijalankan dengan:
+//
+//	OIDC_PROVIDERS=stub OIDC_STUB_ISSUER=http://localhost:9000 OIDC_STUB_CLIENT_ID=rekamedchain
+//
+// Klaim amr "mfa" dari -mfa hanya diakui bila OIDC_STUB_TRUST_MFA=true.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "stub-1"
+
+// authorization is what the stub remembers between /authorize and /token.
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "alamat listen")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer yang diumumkan")
+	clientID := flag.String("client-id", "rekamedchain", "client_id yang diterima")
+	subject := flag.String("sub", "stub-user-1", "subject pengguna")
+	email := flag.String("email", "dokter@rs.local", "email pengguna")
+	name := flag.String("name", "dr. Stub", "nama pengguna")
+	mfa := flag.Bool("mfa", false, "sertakan \"mfa\" pada klaim amr")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Gagal membuat kunci RSA: %v", err)
+	}
+
+	var mu sync.Mutex
+	codes := make(map[string]authorization)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                *issuer,
+			"authorization_endpoint":                *issuer + "/authorize",
+			"token_endpoint":                        *issuer + "/token",
+			"jwks_uri":                              *issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": keyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != *clientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "invalid authorization request", http.StatusBadRequest)
+			return
+		}
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil || redirect.Scheme == "" {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+
+		code := randomString()
+		mu.Lock()
+		codes[code] = authorization{
+			clientID:      q.Get("client_id"),
+			redirectURI:   q.Get("redirect_uri"),
+			codeChallenge: q.Get("code_challenge"),
+			nonce:         q.Get("nonce"),
+		}
+		mu.Unlock()
+
+		params := redirect.Query()
+		params.Set("code", code)
+		params.Set("state", q.Get("state"))
+		redirect.RawQuery = params.Encode()
+		log.Printf("Menyetujui login %s, mengarahkan ke %s", *email, redirect.Host+redirect.Path)
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		requestClientID := r.PostForm.Get("client_id")
+		if user, _, ok := r.BasicAuth(); ok {
+			requestClientID, _ = url.QueryUnescape(user)
+		}
+
+		mu.Lock()
+		auth, ok := codes[r.PostForm.Get("code")]
+		delete(codes, r.PostForm.Get("code"))
+		mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		switch {
+		case !ok, r.PostForm.Get("grant_type") != "authorization_code":
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		case requestClientID != auth.clientID, r.PostForm.Get("redirect_uri") != auth.redirectURI:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "client or redirect mismatch"})
+			return
+		case base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+
+		amr := []string{"pwd"}
+		if *mfa {
+			amr = append(amr, "mfa")
+		}
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            *issuer,
+			"sub":            *subject,
+			"aud":            auth.clientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(5 * time.Minute).Unix(),
+			"nonce":          auth.nonce,
+			"email":          *email,
+			"email_verified": true,
+			"name":           *name,
+			"amr":            amr,
+		})
+		token.Header["kid"] = keyID
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": randomString(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+
+	log.Printf("Stub OIDC IdP berjalan di %s (issuer %s)", *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Gagal membuat nilai acak: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,113 @@
+// apps/backend/cmd/reindex/main.go
+//
+// reindex membangun indeks pencarian (indeks buta) untuk rekam medis yang
+// dibuat sebelum pencarian tersedia. Gunakan -all setelah BLIND_INDEX_KEY
+// diganti agar semua rekam medis diindeks ulang dengan kunci baru.
+//
+//	DB_SOURCE=... ENCRYPTION_KEY=... BLIND_INDEX_KEY=... go run ./cmd/reindex [-all]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/trifur/rekamedchain/backend/internal/config"
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/database"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"github.com/trifur/rekamedchain/backend/internal/search"
+)
+
+func main() {
+	all := flag.Bool("all", false, "indeks ulang semua rekam medis, bukan hanya yang belum diindeks")
+	batchSize := flag.Int("batch", 200, "jumlah rekam medis per batch")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Gagal memuat konfigurasi: %v", err)
+	}
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Koneksi DB gagal: %v", err)
+	}
+	defer db.Close()
+
+	recordRepo := repository.NewPostgresRecordRepository(db)
+	indexed, failed := 0, 0
+	afterID := ""
+	for {
+		records, err := recordRepo.ListRecordsForIndexing(ctx, afterID, *batchSize, *all)
+		if err != nil {
+			log.Fatalf("Gagal mengambil rekam medis: %v", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for i := range records {
+			record := &records[i]
+			afterID = record.ID
+			if !decryptForIndexing(record, cfg.EncryptionKey) {
+				// Indeks dari isi yang tidak lengkap akan membuat rekam medis tidak
+				// ditemukan, jadi rekam medis ini dibiarkan belum terindeks dan
+				// dicoba lagi pada run berikutnya.
+				log.Printf("Isi rekam medis %s gagal didekripsi, dilewati", record.ID)
+				if err := recordRepo.ClearSearchIndexed(ctx, record.ID); err != nil {
+					log.Fatalf("Gagal menandai rekam medis %s belum terindeks: %v", record.ID, err)
+				}
+				failed++
+				continue
+			}
+
+			for j := range record.Diagnoses {
+				if record.Diagnoses[j].Code != "" {
+					record.Diagnoses[j].CodeIndex = crypto.BlindIndex(record.Diagnoses[j].Code, cfg.BlindIndexKey)
+				}
+			}
+			record.SearchIndex = search.Indexes(search.RecordTerms(record.Diagnosis, record.Notes, record.ClinicalContent), cfg.BlindIndexKey)
+			if err := recordRepo.UpdateSearchIndex(ctx, record); err != nil {
+				log.Fatalf("Gagal menyimpan indeks rekam medis %s: %v", record.ID, err)
+			}
+			indexed++
+		}
+		log.Printf("%d rekam medis diindeks", indexed)
+	}
+
+	log.Printf("Selesai: %d rekam medis diindeks, %d gagal didekripsi dan akan dicoba lagi", indexed, failed)
+}
+
+// decryptForIndexing decrypts the fields that feed the search index in place.
+// The result reports whether all fields could be decrypted.
+func decryptForIndexing(record *domain.MedicalRecord, key []byte) bool {
+	ok := true
+	decrypt := func(field *string) {
+		plaintext, err := crypto.Decrypt(*field, key)
+		if err != nil {
+			plaintext, ok = "", false
+		}
+		*field = plaintext
+	}
+
+	decrypt(&record.Diagnosis)
+	decrypt(&record.Notes)
+	for i := range record.Diagnoses {
+		decrypt(&record.Diagnoses[i].Code)
+		decrypt(&record.Diagnoses[i].Description)
+	}
+	for i := range record.Medications {
+		decrypt(&record.Medications[i].Name)
+	}
+	for i := range record.Allergies {
+		decrypt(&record.Allergies[i].Substance)
+	}
+	for i := range record.Procedures {
+		decrypt(&record.Procedures[i].Name)
+		decrypt(&record.Procedures[i].Code)
+	}
+	return ok
+}
@@ -1 +1,129 @@
 package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MFAAudience is the audience of the short-lived token handed out between the
+// password step and the second-factor step of a login. AuthMiddleware only
+// accepts the access token audience, so this token cannot be used on the API.
+const MFAAudience = "rekamedchain-mfa"
+
+// TokenIssuer signs tokens with the current Ed25519 key and verifies tokens
+// against every key that is still trusted, selected by the "kid" header.
+// Keeping retired public keys in the verification set lets us rotate the
+// signing key without logging everyone out.
+type TokenIssuer struct {
+	signingKeyID string
+	signingKey   ed25519.PrivateKey
+	verifyKeys   map[string]ed25519.PublicKey
+	issuer       string
+	audience     string
+}
+
+// JWK is a single public key in JSON Web Key format (RFC 8037 for Ed25519).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	X         string `json:"x"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewTokenIssuer creates a TokenIssuer. previousKeys holds the public keys of
+// retired signing keys that must still be accepted until their tokens expire.
+func NewTokenIssuer(signingKeyID string, signingKey ed25519.PrivateKey, previousKeys map[string]ed25519.PublicKey, issuer, audience string) (*TokenIssuer, error) {
+	if signingKeyID == "" {
+		return nil, fmt.Errorf("signing key id is required")
+	}
+	if len(signingKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signing key must be an Ed25519 private key")
+	}
+
+	verifyKeys := make(map[string]ed25519.PublicKey, len(previousKeys)+1)
+	for kid, key := range previousKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("verification key %q is not an Ed25519 public key", kid)
+		}
+		verifyKeys[kid] = key
+	}
+	verifyKeys[signingKeyID] = signingKey.Public().(ed25519.PublicKey)
+
+	return &TokenIssuer{
+		signingKeyID: signingKeyID,
+		signingKey:   signingKey,
+		verifyKeys:   verifyKeys,
+		issuer:       issuer,
+		audience:     audience,
+	}, nil
+}
+
+// Issuer returns the value placed in and required from the "iss" claim.
+func (t *TokenIssuer) Issuer() string {
+	return t.issuer
+}
+
+// Audience returns the audience of access tokens.
+func (t *TokenIssuer) Audience() string {
+	return t.audience
+}
+
+// Sign signs the claims with the current signing key.
+func (t *TokenIssuer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = t.signingKeyID
+	return token.SignedString(t.signingKey)
+}
+
+// Parse verifies the token signature, algorithm, issuer, expiry and the given
+// audience, then fills claims.
+func (t *TokenIssuer) Parse(tokenString string, claims jwt.Claims, audience string) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	return err
+}
+
+// ParseAccessToken is Parse with the access token audience.
+func (t *TokenIssuer) ParseAccessToken(tokenString string, claims jwt.Claims) error {
+	return t.Parse(tokenString, claims, t.audience)
+}
+
+// JWKS returns every trusted verification key in JWK Set format.
+func (t *TokenIssuer) JWKS() JWKS {
+	keys := make([]JWK, 0, len(t.verifyKeys))
+	for _, kid := range slices.Sorted(maps.Keys(t.verifyKeys)) {
+		key := t.verifyKeys[kid]
+		keys = append(keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		})
+	}
+	return JWKS{Keys: keys}
+}
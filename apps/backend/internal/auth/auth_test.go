@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testClaims(audience string) *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    "rekamedchain",
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func TestTokenIssuerSignsWithKeyID(t *testing.T) {
+	issuer, err := NewTokenIssuer("key-2", newTestKey(t), nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issuer.Sign(testClaims("rekamedchain-api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := parsed.Header["kid"]; kid != "key-2" {
+		t.Errorf("kid = %v, want key-2", kid)
+	}
+	if alg := parsed.Header["alg"]; alg != "EdDSA" {
+		t.Errorf("alg = %v, want EdDSA", alg)
+	}
+	if err := issuer.ParseAccessToken(token, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("ParseAccessToken: %v", err)
+	}
+}
+
+func TestTokenIssuerAcceptsRetiredKeyDuringRotation(t *testing.T) {
+	oldKey := newTestKey(t)
+	oldIssuer, err := NewTokenIssuer("key-1", oldKey, nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := oldIssuer.Sign(testClaims("rekamedchain-api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retired := map[string]ed25519.PublicKey{"key-1": oldKey.Public().(ed25519.PublicKey)}
+	rotated, err := NewTokenIssuer("key-2", newTestKey(t), retired, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rotated.ParseAccessToken(token, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("token signed with retired key rejected: %v", err)
+	}
+
+	withoutOld, err := NewTokenIssuer("key-2", newTestKey(t), nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := withoutOld.ParseAccessToken(token, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("token signed with a key that is no longer trusted was accepted")
+	}
+}
+
+func TestTokenIssuerRejectsForgedTokens(t *testing.T) {
+	key := newTestKey(t)
+	issuer, err := NewTokenIssuer("key-1", key, nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kunci lain dengan kid yang sama.
+	forger, err := NewTokenIssuer("key-1", newTestKey(t), nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := forger.Sign(testClaims("rekamedchain-api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 dengan kunci publik sebagai rahasia (serangan algorithm confusion).
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims("rekamedchain-api"))
+	hmacToken.Header["kid"] = "key-1"
+	confused, err := hmacToken.SignedString([]byte(key.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknownKid, err := issuer.Sign(testClaims("rekamedchain-api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(unknownKid, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"key-9","typ":"JWT"}`))
+	unknownKid = header + "." + parts[1] + "." + parts[2]
+
+	mfaToken, err := issuer.Sign(testClaims(MFAAudience))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{
+		"other key, same kid": forged,
+		"hs256 confusion":     confused,
+		"unknown kid":         unknownKid,
+		"mfa audience":        mfaToken,
+	} {
+		if err := issuer.ParseAccessToken(token, &jwt.RegisteredClaims{}); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWKSPublishesEveryTrustedKey(t *testing.T) {
+	current := newTestKey(t)
+	retired := newTestKey(t).Public().(ed25519.PublicKey)
+	issuer, err := NewTokenIssuer("key-2", current, map[string]ed25519.PublicKey{"key-1": retired}, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := issuer.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(jwks.Keys))
+	}
+	want := map[string]ed25519.PublicKey{"key-1": retired, "key-2": current.Public().(ed25519.PublicKey)}
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != "EdDSA" || jwk.Use != "sig" {
+			t.Errorf("%s: unexpected key metadata %+v", jwk.KeyID, jwk)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || !ed25519.PublicKey(x).Equal(want[jwk.KeyID]) {
+			t.Errorf("%s: published key does not match", jwk.KeyID)
+		}
+	}
+}
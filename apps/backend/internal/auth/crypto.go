@@ -2,8 +2,14 @@ package auth
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -22,3 +28,136 @@ func PublicKeyToHex(privateKey *ecdsa.PrivateKey) string {
 	publicKeyBytes := crypto.FromECDSAPub(&privateKey.PublicKey)
 	return hex.EncodeToString(publicKeyBytes)
 }
+
+// PublicKeyFromPrivateHex derives the hex public key of a hex-encoded private key.
+func PublicKeyFromPrivateHex(privateKeyHex string) (string, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+	return PublicKeyToHex(privateKey), nil
+}
+
+// NormalizePublicKeyHex validates an uncompressed secp256k1 public key and
+// returns it in the lowercase, unprefixed form stored in the database.
+func NormalizePublicKeyHex(publicKeyHex string) (string, error) {
+	publicKeyBytes, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(publicKeyHex), "0x"))
+	if err != nil {
+		return "", fmt.Errorf("public key is not valid hex: %w", err)
+	}
+	publicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	return hex.EncodeToString(crypto.FromECDSAPub(publicKey)), nil
+}
+
+// KeyRotationMessage builds the exact text that both the old and the new key
+// sign to replace a user's public key.
+func KeyRotationMessage(userID, newPublicKeyHex string) string {
+	return fmt.Sprintf("RekamedChain key rotation: user %s new key %s", userID, newPublicKeyHex)
+}
+
+// ConsentMessage builds the canonical text a patient signs to grant, deny or
+// revoke a consent request. Every field is always present, in this order, so
+// the backend and the wallet produce byte-identical messages. expiresAt is
+// written in UTC with second precision, or "never".
+func ConsentMessage(action, requestID, patientID, doctorID, scope string, expiresAt *time.Time, nonce string) string {
+	expiry := "never"
+	if expiresAt != nil {
+		expiry = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return strings.Join([]string{
+		"RekamedChain consent",
+		"action: " + action,
+		"request_id: " + requestID,
+		"patient_id: " + patientID,
+		"doctor_id: " + doctorID,
+		"scope: " + scope,
+		"expires_at: " + expiry,
+		"nonce: " + nonce,
+	}, "\n")
+}
+
+// LoginChallengeMessage builds the exact text a client must sign to answer a
+// passwordless login challenge.
+func LoginChallengeMessage(nonce string) string {
+	return "RekamedChain login challenge: " + nonce
+}
+
+// GenerateNonce returns a random 32-byte value encoded as a hex string.
+func GenerateNonce() (string, error) {
+	return randomHex(32)
+}
+
+// GenerateOpaqueToken returns a random token suitable for refresh tokens and
+// other bearer secrets that are only ever stored hashed.
+func GenerateOpaqueToken() (string, error) {
+	return randomHex(32)
+}
+
+// APIKeyPrefix marks API keys so they can be told apart from JWTs in the
+// Authorization header and recognised by secret scanners.
+const APIKeyPrefix = "rmc_"
+
+// GenerateAPIKey returns a new service account API key. Like other bearer
+// secrets it is only ever stored hashed.
+func GenerateAPIKey() (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + secret, nil
+}
+
+// HashToken returns the hex SHA-256 digest of an opaque token for storage.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RandomUUID returns a random version 4 UUID string.
+func RandomUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// VerifySignature checks that signatureHex is a signature of message made by the
+// private key belonging to publicKeyHex. The message is hashed the same way as
+// Ethereum's personal_sign (EIP-191), which is what the mobile wallet produces.
+func VerifySignature(publicKeyHex, message, signatureHex string) (bool, error) {
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
+	if err != nil {
+		return false, fmt.Errorf("signature is not valid hex: %w", err)
+	}
+	if len(signature) != crypto.SignatureLength {
+		return false, fmt.Errorf("signature must be %d bytes", crypto.SignatureLength)
+	}
+
+	// Wallet libraries use 27/28 as recovery id, go-ethereum expects 0/1.
+	if signature[crypto.RecoveryIDOffset] >= 27 {
+		signature[crypto.RecoveryIDOffset] -= 27
+	}
+
+	recovered, err := crypto.SigToPub(accounts.TextHash([]byte(message)), signature)
+	if err != nil {
+		return false, err
+	}
+
+	recoveredHex := hex.EncodeToString(crypto.FromECDSAPub(recovered))
+	return strings.EqualFold(recoveredHex, strings.TrimPrefix(publicKeyHex, "0x")), nil
+}
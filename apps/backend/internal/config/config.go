@@ -1,21 +1,64 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"log"
+	"net"
 	"os"
+	"strings"
 )
 
+// AppEnvDevelopment enables conveniences that must never run in production,
+// such as an ephemeral JWT signing key.
+const AppEnvDevelopment = "development"
+
 // Config holds all configuration for the application.
 type Config struct {
+	AppEnv                string
 	DatabaseURL           string
 	IPFS_API              string
 	IPFS_Gateway          string
-	JWTKey                []byte
+	JWTSigningKeyID       string
+	JWTSigningKey         ed25519.PrivateKey
+	JWTVerificationKeys   map[string]ed25519.PublicKey
+	JWTIssuer             string
+	JWTAudience           string
 	EncryptionKey         []byte
+	BlindIndexKey         []byte
 	ServerAddress         string
 	HardhatURL            string
 	LedgerContractAddress string
 	SignerPrivateKey      string
+	AppBaseURL            string
+	MailDriver            string
+	MailFrom              string
+	MailLogDir            string
+	SMTPHost              string
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	OIDCProviders         map[string]OIDCProvider
+	// TrustedProxies are the reverse proxies allowed to set X-Forwarded-For.
+	TrustedProxies []*net.IPNet
+}
+
+// OIDCProvider configures login through a hospital's OpenID Connect identity provider.
+type OIDCProvider struct {
+	ID           string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// FacilityID is assigned to staff accounts provisioned through this provider.
+	FacilityID string
+	// Role is given to provisioned accounts and must be a clinical staff role.
+	Role string
+	// TrustMFA accepts an "mfa" amr claim from this IdP in place of our own
+	// TOTP step. Off unless the hospital's IdP is known to enforce MFA.
+	TrustMFA bool
 }
 
 // Load populates a Config struct from environment variables.
@@ -35,9 +78,53 @@ func Load() (*Config, error) {
 		ipfsGateway = "http://ipfs:8080"
 	}
 
-	jwtKey := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtKey) == 0 {
-		jwtKey = []byte("kunci_rahasia_super_aman_jangan_ditiru")
+	// APP_ENV "development" hanya untuk mesin lokal; selain itu dianggap produksi
+	// dan semua kunci rahasia wajib diisi.
+	appEnv := os.Getenv("APP_ENV")
+	if appEnv == "" {
+		appEnv = "production"
+	}
+
+	// JWT_SIGNING_KEY adalah seed Ed25519 (32 byte) dalam base64. Tanpa nilai ini
+	// server hanya mau jalan di mode pengembangan, dengan kunci acak sementara.
+	var jwtSigningKey ed25519.PrivateKey
+	if encoded := os.Getenv("JWT_SIGNING_KEY"); encoded != "" {
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY must be a base64 encoded 32-byte Ed25519 seed")
+		}
+		jwtSigningKey = ed25519.NewKeyFromSeed(seed)
+	} else if appEnv == AppEnvDevelopment {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate ephemeral JWT signing key: %w", err)
+		}
+		jwtSigningKey = key
+		log.Println("PERINGATAN: JWT_SIGNING_KEY kosong, memakai kunci acak sementara. Semua token tidak berlaku lagi setelah server dimulai ulang. JANGAN dipakai di produksi.")
+	} else {
+		return nil, fmt.Errorf("JWT_SIGNING_KEY is required unless APP_ENV=%s", AppEnvDevelopment)
+	}
+
+	jwtSigningKeyID := os.Getenv("JWT_SIGNING_KEY_ID")
+	if jwtSigningKeyID == "" {
+		jwtSigningKeyID = "dev-1"
+	}
+
+	// JWT_VERIFICATION_KEYS berisi kunci publik lama yang masih diterima saat rotasi,
+	// dengan format "kid:base64_public_key,kid2:base64_public_key".
+	jwtVerificationKeys, err := parseVerificationKeys(os.Getenv("JWT_VERIFICATION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "rekamedchain"
+	}
+
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "rekamedchain-api"
 	}
 
 	encryptionKey := []byte(os.Getenv("ENCRYPTION_KEY"))
@@ -48,6 +135,20 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("ENCRYPTION_KEY must be 32 bytes long")
 	}
 
+	// BLIND_INDEX_KEY adalah kunci HMAC untuk indeks pencarian data terenkripsi.
+	// Mengganti kunci ini mengharuskan indeks dibangun ulang. Kunci bawaan hanya
+	// untuk pengembangan: siapa pun yang mengetahuinya dapat menebak isi indeks.
+	blindIndexKey := []byte(os.Getenv("BLIND_INDEX_KEY"))
+	if len(blindIndexKey) == 0 {
+		if appEnv != AppEnvDevelopment {
+			return nil, fmt.Errorf("BLIND_INDEX_KEY is required unless APP_ENV=%s", AppEnvDevelopment)
+		}
+		blindIndexKey = []byte("kunci_indeks_buta_pengembangan_32")
+	}
+	if len(blindIndexKey) < 32 {
+		return nil, fmt.Errorf("BLIND_INDEX_KEY must be at least 32 bytes long")
+	}
+
 	serverAddress := os.Getenv("SERVER_ADDRESS")
 	if serverAddress == "" {
 		serverAddress = ":8080"
@@ -71,15 +172,161 @@ func Load() (*Config, error) {
 		ledgerContractAddress = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
 	}
 
+	// URL frontend yang dipakai untuk membuat tautan di email (verifikasi, reset password).
+	appBaseURL := os.Getenv("APP_BASE_URL")
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
+
+	// MAIL_DRIVER "smtp" mengirim email sungguhan; "log" (default) hanya menulis ke log/berkas.
+	mailDriver := os.Getenv("MAIL_DRIVER")
+	if mailDriver == "" {
+		mailDriver = "log"
+	}
+	if mailDriver != "log" && mailDriver != "smtp" {
+		return nil, fmt.Errorf("MAIL_DRIVER must be either \"log\" or \"smtp\"")
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "RekamedChain <no-reply@rekamedchain.local>"
+	}
+
+	smtpHost := os.Getenv("SMTP_HOST")
+	if mailDriver == "smtp" && smtpHost == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required when MAIL_DRIVER is smtp")
+	}
+
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+
+	// OIDC_PROVIDERS berisi ID penyedia identitas rumah sakit, mis. "rsud-a,rs-b".
+	oidcProviders, err := loadOIDCProviders(os.Getenv("OIDC_PROVIDERS"), appBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// TRUSTED_PROXIES berisi CIDR atau IP reverse proxy, mis. "10.0.0.0/8,172.18.0.2".
+	// Tanpa nilai ini header X-Forwarded-For diabaikan dan alamat koneksi yang dipakai.
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
+		AppEnv:                appEnv,
 		DatabaseURL:           dbURL,
 		IPFS_API:              ipfsAPI,
 		IPFS_Gateway:          ipfsGateway,
-		JWTKey:                jwtKey,
+		JWTSigningKeyID:       jwtSigningKeyID,
+		JWTSigningKey:         jwtSigningKey,
+		JWTVerificationKeys:   jwtVerificationKeys,
+		JWTIssuer:             jwtIssuer,
+		JWTAudience:           jwtAudience,
 		EncryptionKey:         encryptionKey,
+		BlindIndexKey:         blindIndexKey,
 		ServerAddress:         serverAddress,
 		HardhatURL:            hardhatURL,
 		LedgerContractAddress: ledgerContractAddress,
 		SignerPrivateKey:      signerPrivateKey,
+		AppBaseURL:            appBaseURL,
+		MailDriver:            mailDriver,
+		MailFrom:              mailFrom,
+		MailLogDir:            os.Getenv("MAIL_LOG_DIR"),
+		SMTPHost:              smtpHost,
+		SMTPPort:              smtpPort,
+		SMTPUsername:          os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:          os.Getenv("SMTP_PASSWORD"),
+		OIDCProviders:         oidcProviders,
+		TrustedProxies:        trustedProxies,
 	}, nil
 }
+
+// parseVerificationKeys parses a "kid:base64_public_key" comma separated list.
+func parseVerificationKeys(value string) (map[string]ed25519.PublicKey, error) {
+	keys := make(map[string]ed25519.PublicKey)
+	if value == "" {
+		return keys, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		kid, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || kid == "" {
+			return nil, fmt.Errorf("JWT_VERIFICATION_KEYS entry %q must look like kid:base64_public_key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWT_VERIFICATION_KEYS entry %q is not a base64 Ed25519 public key", kid)
+		}
+		keys[kid] = ed25519.PublicKey(key)
+	}
+	return keys, nil
+}
+
+// parseTrustedProxies parses a comma separated list of CIDRs or single IPs.
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP address or CIDR", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP address or CIDR", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// loadOIDCProviders reads the settings of every provider listed in
+// OIDC_PROVIDERS from OIDC_<ID>_* variables, where <ID> is upper-cased and
+// dashes become underscores.
+func loadOIDCProviders(value, appBaseURL string) (map[string]OIDCProvider, error) {
+	providers := make(map[string]OIDCProvider)
+	if value == "" {
+		return providers, nil
+	}
+
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		provider := OIDCProvider{
+			ID:           id,
+			IssuerURL:    strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			FacilityID:   os.Getenv(prefix + "FACILITY_ID"),
+			Role:         os.Getenv(prefix + "ROLE"),
+			TrustMFA:     os.Getenv(prefix+"TRUST_MFA") == "true",
+		}
+		if id == "" || provider.IssuerURL == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", id, prefix, prefix)
+		}
+		// Halaman frontend menerima code dan state lalu meneruskannya ke backend.
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = appBaseURL + "/auth/oidc/" + id + "/callback"
+		}
+		if provider.Role == "" {
+			provider.Role = "doctor"
+		}
+		providers[id] = provider
+	}
+	return providers, nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestLoadRequiresJWTSigningKeyOutsideDevelopment(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEY", "")
+	for _, env := range []string{"", "production", "staging"} {
+		t.Setenv("APP_ENV", env)
+		if _, err := Load(); err == nil {
+			t.Errorf("APP_ENV=%q: Load succeeded without JWT_SIGNING_KEY", env)
+		}
+	}
+}
+
+func TestLoadGeneratesEphemeralKeyInDevelopment(t *testing.T) {
+	t.Setenv("APP_ENV", AppEnvDevelopment)
+	t.Setenv("JWT_SIGNING_KEY", "")
+
+	first, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.JWTSigningKey.Equal(second.JWTSigningKey) {
+		t.Error("development signing key is not random")
+	}
+}
+
+func TestLoadUsesConfiguredJWTSigningKey(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("JWT_SIGNING_KEY", base64.StdEncoding.EncodeToString(seed))
+	t.Setenv("BLIND_INDEX_KEY", "kunci_indeks_buta_produksi_uji_32")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.JWTSigningKey.Equal(ed25519.NewKeyFromSeed(seed)) {
+		t.Error("configured signing key not used")
+	}
+}
+
+func TestLoadRequiresBlindIndexKeyOutsideDevelopment(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SIGNING_KEY", base64.StdEncoding.EncodeToString(seed))
+	t.Setenv("BLIND_INDEX_KEY", "")
+
+	t.Setenv("APP_ENV", "production")
+	if _, err := Load(); err == nil {
+		t.Error("Load succeeded in production without BLIND_INDEX_KEY")
+	}
+
+	t.Setenv("APP_ENV", AppEnvDevelopment)
+	if _, err := Load(); err != nil {
+		t.Errorf("development must fall back to the built-in key: %v", err)
+	}
+}
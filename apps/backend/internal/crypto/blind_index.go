@@ -0,0 +1,17 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// BlindIndex menghasilkan HMAC-SHA256 (hex) dari value dengan kunci terpisah
+// dari kunci enkripsi. Nilai yang sama selalu menghasilkan indeks yang sama,
+// sehingga kolom terenkripsi dapat dicocokkan tanpa didekripsi.
+// Normalisasi value (huruf besar/kecil, spasi) menjadi tanggung jawab pemanggil.
+func BlindIndex(value string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameter Argon2id untuk menurunkan kunci dari passphrase (rekomendasi OWASP).
+const (
+	argon2Time    uint32 = 3
+	argon2Memory  uint32 = 64 * 1024
+	argon2Threads uint8  = 2
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+)
+
+// Batas parameter Argon2id yang diterima dari blob tersimpan. Blob berasal dari
+// database atau klien, jadi parameter di luar batas ini ditolak agar tidak bisa
+// dipakai untuk menghabiskan memori/CPU server atau melemahkan kunci.
+const (
+	argon2MinTime    uint32 = 1
+	argon2MaxTime    uint32 = 10
+	argon2MinMemory  uint32 = 19 * 1024
+	argon2MaxMemory  uint32 = 256 * 1024
+	argon2MinThreads uint8  = 1
+	argon2MaxThreads uint8  = 16
+	argon2MaxSaltLen        = 64
+)
+
+// SealWithPassphrase mengenkripsi plaintext dengan kunci AES-256 yang diturunkan
+// dari passphrase menggunakan Argon2id. Parameter dan salt ikut disimpan di hasil
+// dengan format: argon2id$m=...,t=...,p=...$<salt hex>$<ciphertext hex>.
+func SealWithPassphrase(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	ciphertext, err := Encrypt(plaintext, key)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("argon2id$m=%d,t=%d,p=%d$%s$%s",
+		argon2Memory, argon2Time, argon2Threads, hex.EncodeToString(salt), ciphertext), nil
+}
+
+// OpenWithPassphrase membuka hasil SealWithPassphrase. Passphrase yang salah
+// menghasilkan error karena tag AES-GCM tidak cocok.
+func OpenWithPassphrase(sealed, passphrase string) (string, error) {
+	parts := strings.Split(sealed, "$")
+	if len(parts) != 4 || parts[0] != "argon2id" {
+		return "", fmt.Errorf("unsupported sealed format")
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return "", fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if time < argon2MinTime || time > argon2MaxTime ||
+		memory < argon2MinMemory || memory > argon2MaxMemory ||
+		threads < argon2MinThreads || threads > argon2MaxThreads {
+		return "", fmt.Errorf("argon2 parameters out of range: m=%d,t=%d,p=%d", memory, time, threads)
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %w", err)
+	}
+	if len(salt) < argon2SaltLen || len(salt) > argon2MaxSaltLen {
+		return "", fmt.Errorf("invalid salt length: %d", len(salt))
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, argon2KeyLen)
+	return Decrypt(parts[3], key)
+}
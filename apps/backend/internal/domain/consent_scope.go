@@ -0,0 +1,162 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Record content categories a consent can be limited to.
+const (
+	ScopeCategoryDiagnoses   = "diagnoses" // free-text and coded diagnoses
+	ScopeCategoryNotes       = "notes"     // clinical notes and amendment reasons
+	ScopeCategoryVitals      = "vitals"
+	ScopeCategoryMedications = "medications"
+	ScopeCategoryAllergies   = "allergies"
+	ScopeCategoryProcedures  = "procedures"
+)
+
+// ScopeCategories lists the valid consent scope categories.
+var ScopeCategories = []string{ScopeCategoryDiagnoses, ScopeCategoryNotes, ScopeCategoryVitals, ScopeCategoryMedications, ScopeCategoryAllergies, ScopeCategoryProcedures}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ConsentScope is the parsed form of a consent's data_scope, which is either
+// a JSON object such as {"categories":["vitals"],"attachments":false} or, for
+// grants signed before scopes were structured, a free label such as "all".
+// Free labels keep what patients agreed to when they signed such a grant:
+// reading every record, but not writing them.
+//
+// Every limit that is left out is unrestricted, and the limits combine: a
+// record is visible when it matches all of them.
+type ConsentScope struct {
+	// All grants every record in full; it cannot be combined with limits.
+	All bool `json:"all,omitempty"`
+	// Categories limits which parts of a record are returned. Empty means all.
+	Categories []string `json:"categories,omitempty"`
+	// From and To (inclusive) limit records by when they were first written.
+	// Both accept RFC3339 or a date (YYYY-MM-DD, UTC); a date in To covers
+	// that whole day.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// RecordIDs limits access to these records, in any of their versions.
+	RecordIDs []string `json:"record_ids,omitempty"`
+	// Attachments controls whether attachments are returned; nil means yes.
+	Attachments *bool `json:"attachments,omitempty"`
+	// Write lets the doctor add and amend records for the patient.
+	Write bool `json:"write,omitempty"`
+	// FacilitySystems lets the integration systems (service accounts) of the
+	// doctor's facility use this grant too. Without it a service account has
+	// no access to the patient.
+	FacilitySystems bool `json:"facility_systems,omitempty"`
+}
+
+// ParseConsentScope parses and validates a stored or submitted data_scope.
+func ParseConsentScope(raw string) (ConsentScope, error) {
+	var scope ConsentScope
+	if !strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		scope.All = true
+		return scope, nil
+	}
+	// from dan to dibaca sebagai teks dulu agar tanggal tanpa jam juga diterima.
+	var written struct {
+		ConsentScope
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&written); err != nil {
+		return scope, err
+	}
+	scope = written.ConsentScope
+	var err error
+	if scope.From, err = parseScopeBound("from", written.From, false); err != nil {
+		return scope, err
+	}
+	if scope.To, err = parseScopeBound("to", written.To, true); err != nil {
+		return scope, err
+	}
+
+	if scope.All && scope.limitsRecords() {
+		return scope, errors.New(`"all" cannot be combined with categories, dates, record_ids or attachments`)
+	}
+	for _, category := range scope.Categories {
+		if !slices.Contains(ScopeCategories, category) {
+			return scope, fmt.Errorf("unknown category %q, expected one of %s", category, strings.Join(ScopeCategories, ", "))
+		}
+	}
+	for _, id := range scope.RecordIDs {
+		if !uuidPattern.MatchString(id) {
+			return scope, fmt.Errorf("record_ids: %q is not a record ID", id)
+		}
+	}
+	if scope.From != nil && scope.To != nil && scope.To.Before(*scope.From) {
+		return scope, errors.New("to must not be before from")
+	}
+	return scope, nil
+}
+
+// parseScopeBound parses the from or to of a scope. A date in to is moved to
+// the last microsecond of that day, the finest time PostgreSQL stores, so
+// that comparing with <= includes the whole day.
+func parseScopeBound(name, value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC3339 time", name)
+	}
+	if endOfDay {
+		date = date.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return &date, nil
+}
+
+// limitsRecords reports whether any limit on what can be read is set.
+func (s ConsentScope) limitsRecords() bool {
+	return len(s.Categories) > 0 || s.From != nil || s.To != nil || len(s.RecordIDs) > 0 || s.Attachments != nil
+}
+
+// Unrestricted reports whether the scope grants every record in full.
+func (s ConsentScope) Unrestricted() bool {
+	return s.All || !s.limitsRecords()
+}
+
+// AllowsCategory reports whether the given part of a record may be returned.
+func (s ConsentScope) AllowsCategory(category string) bool {
+	return len(s.Categories) == 0 || slices.Contains(s.Categories, category)
+}
+
+// AllowsAttachments reports whether attachments may be returned.
+func (s ConsentScope) AllowsAttachments() bool {
+	return s.Attachments == nil || *s.Attachments
+}
+
+// AllowsRecord reports whether a record is visible, given when its first
+// version was written and the IDs of its versions.
+func (s ConsentScope) AllowsRecord(firstWrittenAt time.Time, versionIDs ...string) bool {
+	if s.From != nil && firstWrittenAt.Before(*s.From) {
+		return false
+	}
+	if s.To != nil && firstWrittenAt.After(*s.To) {
+		return false
+	}
+	if len(s.RecordIDs) == 0 {
+		return true
+	}
+	for _, id := range versionIDs {
+		if slices.ContainsFunc(s.RecordIDs, func(allowed string) bool { return strings.EqualFold(allowed, id) }) {
+			return true
+		}
+	}
+	return false
+}
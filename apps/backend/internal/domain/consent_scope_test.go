@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseConsentScopeIncludesTheWholeToDate(t *testing.T) {
+	scope, err := ParseConsentScope(`{"from":"2024-12-01","to":"2024-12-31"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		written time.Time
+		allowed bool
+	}{
+		{time.Date(2024, 11, 30, 23, 59, 59, 0, time.UTC), false},
+		{time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 12, 31, 9, 30, 0, 0, time.UTC), true},
+		{time.Date(2024, 12, 31, 23, 59, 59, 999999000, time.UTC), true},
+		{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range cases {
+		if got := scope.AllowsRecord(tc.written); got != tc.allowed {
+			t.Errorf("record written %s: allowed = %v, want %v", tc.written, got, tc.allowed)
+		}
+	}
+
+	exact, err := ParseConsentScope(`{"to":"2024-12-31T12:00:00Z"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exact.AllowsRecord(time.Date(2024, 12, 31, 12, 0, 1, 0, time.UTC)) {
+		t.Error("a to with a time must stay an exact bound")
+	}
+
+	for _, raw := range []string{`{"to":"31-12-2024"}`, `{"from":"2025-01-01","to":"2024-12-31"}`, `{"until":"2024-12-31"}`} {
+		if _, err := ParseConsentScope(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
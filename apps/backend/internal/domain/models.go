@@ -6,20 +6,95 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// User represents a user in the system (patient or doctor)
+// User roles. The full list, and the permissions of each role, live in the roles table.
+const (
+	RolePatient    = "patient"
+	RoleDoctor     = "doctor"
+	RoleNurse      = "nurse"
+	RoleLabStaff   = "lab_staff"
+	RolePharmacist = "pharmacist"
+	RoleAdmin      = "admin"
+	// RoleService is carried by requests authenticated with an API key. It is
+	// not a users row; the key's scopes are its permissions.
+	RoleService = "service"
+)
+
+// Permissions checked by middleware.RequirePermission. They are seeded in the
+// permissions table and granted to roles through role_permissions.
+const (
+	PermPatientsSearch     = "patients:search"
+	PermPatientsRead       = "patients:read"
+	PermConsentRequest     = "consent:request"
+	PermRecordsRead        = "records:read"
+	PermRecordsWrite       = "records:write"
+	PermVitalsWrite        = "vitals:write"
+	PermLabResultsWrite    = "lab_results:write"
+	PermPrescriptionsRead  = "prescriptions:read"
+	PermPrescriptionsWrite = "prescriptions:write"
+	PermFilesUpload        = "files:upload"
+	PermLedgerRead         = "ledger:read"
+	PermAuditRead          = "audit:read"
+	PermStaffVerify        = "staff:verify"
+	PermAccountsUnlock     = "accounts:unlock"
+	PermDelegationsManage  = "delegations:manage"
+	PermBreakGlassUse      = "break_glass:use"
+	PermBreakGlassReview   = "break_glass:review"
+	PermServiceAccounts    = "service_accounts:manage"
+	PermFacilitiesManage   = "facilities:manage"
+)
+
+// ServiceScopes are the permissions that may be granted to an API key.
+// Consent-gated reads and administrative permissions stay with human users.
+var ServiceScopes = []string{
+	PermPatientsSearch,
+	PermPatientsRead,
+	PermRecordsWrite,
+	PermVitalsWrite,
+	PermLabResultsWrite,
+	PermPrescriptionsWrite,
+	PermFilesUpload,
+}
+
+// Role describes a user role and the permissions granted to it.
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// ClinicalStaff roles need admin-approved credentials and follow the facility MFA policy.
+	ClinicalStaff bool     `json:"clinical_staff"`
+	Permissions   []string `json:"permissions"`
+}
+
+// Verification states of a clinical staff member's credentials (STR/SIP).
+const (
+	VerificationPending  = "pending"
+	VerificationApproved = "approved"
+	VerificationRejected = "rejected"
+)
+
+// User represents a user in the system (patient, clinical staff or admin)
 type User struct {
-	ID                  string    `json:"id"`
-	Name                string    `json:"name"`
-	Email               string    `json:"email"`
-	Role                string    `json:"role"`
-	NIP                 string    `json:"nip,omitempty"`
-	Phone               string    `json:"phone,omitempty"`
-	Specialization      string    `json:"specialization,omitempty"`
-	HashedPassword      string    `json:"-"`
-	PublicKey           string    `json:"-"`
-	PrivateKeyEncrypted string    `json:"-"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	NIP            string `json:"nip,omitempty"`
+	STRNumber      string `json:"str_number,omitempty"`
+	SIPNumber      string `json:"sip_number,omitempty"`
+	Phone          string `json:"phone,omitempty"`
+	Specialization string `json:"specialization,omitempty"`
+	FacilityID     string `json:"facility_id,omitempty"`
+	// RequestedFacilityID is the facility named at registration. It becomes
+	// FacilityID only when an admin approves the staff member's credentials.
+	RequestedFacilityID string     `json:"requested_facility_id,omitempty"`
+	EmailVerified       bool       `json:"email_verified"`
+	VerificationStatus  string     `json:"verification_status,omitempty"`
+	VerificationNote    string     `json:"verification_note,omitempty"`
+	VerifiedAt          *time.Time `json:"verified_at,omitempty"`
+	HashedPassword      string     `json:"-"`
+	PublicKey           string     `json:"-"`
+	PrivateKeyEncrypted string     `json:"-"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 // PublicUser is a safe representation of a user for public-facing search results.
@@ -38,8 +113,12 @@ type UserProfile struct {
 	Role           string `json:"role"`
 	FormattedID    string `json:"formatted_id"`
 	NIP            string `json:"nip,omitempty"`
+	STRNumber      string `json:"str_number,omitempty"`
+	SIPNumber      string `json:"sip_number,omitempty"`
 	Phone          string `json:"phone,omitempty"`
 	Specialization string `json:"specialization,omitempty"`
+	// VerificationStatus is only set for clinical staff.
+	VerificationStatus string `json:"verification_status,omitempty"`
 }
 
 // RegisterPayload defiens the structures for the registration request.
@@ -49,8 +128,87 @@ type RegisterPayload struct {
 	Password       string `json:"password"`
 	Role           string `json:"role"`
 	NIP            string `json:"nip"`
+	STRNumber      string `json:"str_number"`
+	SIPNumber      string `json:"sip_number"`
 	Phone          string `json:"phone"`
 	Specialization string `json:"specialization"`
+	FacilityID     string `json:"facility_id"`
+	// KeyBackupPassphrase opts in to server-side escrow of the generated private key.
+	KeyBackupPassphrase string `json:"key_backup_passphrase,omitempty"`
+}
+
+// VerificationDecisionPayload defines the structure for an admin's decision on staff credentials.
+// On approval, FacilityID sets the facility the staff member belongs to; it
+// defaults to the facility they asked for at registration.
+type VerificationDecisionPayload struct {
+	Note       string `json:"note"`
+	FacilityID string `json:"facility_id"`
+}
+
+// Facility is a hospital or clinic that staff and service accounts belong to.
+type Facility struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	RequireDoctorMFA bool      `json:"require_doctor_mfa"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// FacilityMFAPolicyPayload defines the structure for changing a facility's MFA policy.
+type FacilityMFAPolicyPayload struct {
+	RequireDoctorMFA *bool `json:"require_doctor_mfa"`
+}
+
+// EmailPayload defines the structure for requests that only carry an email address.
+type EmailPayload struct {
+	Email string `json:"email"`
+}
+
+// TokenPayload defines the structure for confirming a one-time token.
+type TokenPayload struct {
+	Token string `json:"token"`
+}
+
+// ResetPasswordPayload defines the structure for setting a new password with a reset token.
+type ResetPasswordPayload struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// PasswordPayload defines the structure for actions that require re-entering the account password.
+type PasswordPayload struct {
+	Password string `json:"password"`
+}
+
+// KeyBackupPayload defines the structure for escrowing a private key.
+type KeyBackupPayload struct {
+	PrivateKey string `json:"private_key"`
+	Passphrase string `json:"passphrase"`
+}
+
+// KeyRestorePayload defines the structure for restoring an escrowed private key.
+type KeyRestorePayload struct {
+	Token      string `json:"token"`
+	Passphrase string `json:"passphrase"`
+}
+
+// UserKey is one entry in a user's public key history.
+type UserKey struct {
+	ID             string     `json:"id"`
+	PublicKey      string     `json:"public_key"`
+	ValidFrom      time.Time  `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	RotationMethod string     `json:"rotation_method,omitempty"`
+}
+
+// KeyRotationPayload defines the structure for replacing a user's public key.
+// The caller proves the change either with a signature from the current key
+// or, when that key is lost, with a recovery token sent by email.
+type KeyRotationPayload struct {
+	NewPublicKey    string `json:"new_public_key"`
+	NewKeySignature string `json:"new_key_signature"`
+	OldKeySignature string `json:"old_key_signature,omitempty"`
+	RecoveryToken   string `json:"recovery_token,omitempty"`
 }
 
 // LoginPayload defines the structure for the login request.
@@ -59,14 +217,117 @@ type LoginPayload struct {
 	Password string `json:"password"`
 }
 
+// OIDCCallbackPayload carries the authorization code and state the IdP sent back to the frontend.
+type OIDCCallbackPayload struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// AuthChallenge is a one-time nonce issued for passwordless login.
+type AuthChallenge struct {
+	ID        string    `json:"challenge_id"`
+	UserID    string    `json:"-"`
+	Nonce     string    `json:"nonce"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ChallengePayload defines the structure for requesting a login challenge.
+type ChallengePayload struct {
+	Email string `json:"email"`
+}
+
+// VerifyChallengePayload defines the structure for answering a login challenge.
+type VerifyChallengePayload struct {
+	ChallengeID string `json:"challenge_id"`
+	Signature   string `json:"signature"`
+}
+
 // Claims defines the JWT claims structure.
 type Claims struct {
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// MFA is true when this session completed a second factor.
+	MFA bool `json:"mfa,omitempty"`
+	// MFARequired is true when the user's facility requires a second factor.
+	MFARequired bool `json:"mfa_required,omitempty"`
+	// EmailVerified is false until the user confirms their email address.
+	EmailVerified bool `json:"email_verified"`
+	// VerificationStatus carries the credential review state of clinical staff.
+	VerificationStatus string `json:"verification_status,omitempty"`
+	// Permissions are resolved from the user's role at login and on refresh.
+	// Clinical staff whose credentials are not approved get none.
+	Permissions []string `json:"permissions,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MFAClaims is carried by the short-lived token issued between the password
+// step and the TOTP step of a doctor login.
+type MFAClaims struct {
 	UserID string `json:"user_id"`
-	Name   string `json:"name"`
-	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
+// MFASettings holds a user's second-factor state and the policy that applies to them.
+type MFASettings struct {
+	Enabled         bool
+	SecretEncrypted string
+	LastUsedStep    int64
+	Required        bool
+}
+
+// MFACodePayload defines the structure for submitting a TOTP code.
+type MFACodePayload struct {
+	Code string `json:"code"`
+}
+
+// MFALoginPayload defines the structure for the second step of a doctor login.
+type MFALoginPayload struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// Session represents a logged-in device holding a refresh token.
+type Session struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	Current     bool       `json:"current"`
+	MFAVerified bool       `json:"mfa_verified"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// LoginEvent records a single login attempt, successful or not.
+type LoginEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Email     string    `json:"-"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginState holds the failed-attempt counters used for lockout and delays.
+type LoginState struct {
+	FailedCount  int
+	LastFailedAt *time.Time
+	LockedUntil  *time.Time
+}
+
+// RefreshPayload defines the structure for exchanging a refresh token.
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // MedicalRecord represents a single medical record entry.
 type MedicalRecord struct {
 	ID            string    `json:"id"`
@@ -76,6 +337,70 @@ type MedicalRecord struct {
 	Notes         string    `json:"notes"`
 	AttachmentCID string    `json:"attachment_cid"`
 	CreatedAt     time.Time `json:"created_at"`
+	// RecordGroupID is shared by every version of the same record.
+	RecordGroupID     string     `json:"record_group_id"`
+	Version           int        `json:"version"`
+	PreviousVersionID string     `json:"previous_version_id,omitempty"`
+	SupersededAt      *time.Time `json:"superseded_at,omitempty"`
+	AmendmentReason   string     `json:"amendment_reason,omitempty"`
+	AuthorID          string     `json:"author_id,omitempty"`
+	DataHash          string     `json:"data_hash,omitempty"`
+	TxHash            string     `json:"tx_hash,omitempty"`
+	// HistoryURL points to the version history of the record.
+	HistoryURL string `json:"history_url,omitempty"`
+	// SearchIndex holds the blind indexes of the record's search terms.
+	SearchIndex []string `json:"-"`
+	// DoctorID links to the authoring doctor; empty for service account records.
+	DoctorID string `json:"doctor_id,omitempty"`
+	// Doctor is the author's current profile. DoctorName keeps the name at the time of writing.
+	Doctor *DoctorProfile `json:"doctor,omitempty"`
+	// ContentRestricted is set when some or all of the clinical content was
+	// withheld, because the requester no longer has access to the patient or
+	// the patient's consent does not cover it.
+	ContentRestricted bool `json:"content_restricted,omitempty"`
+	// Attachments lists the files of this version. AttachmentCID is only set
+	// on records written before multiple attachments were supported.
+	Attachments []RecordAttachment `json:"attachments,omitempty"`
+	// EncounterID links the record to the visit it was written in, if any.
+	EncounterID string `json:"encounter_id,omitempty"`
+	ClinicalContent
+}
+
+// RecordAttachment describes a file attached to a record version. The file
+// itself is stored in IPFS under CID; SHA256 lets readers check its integrity.
+type RecordAttachment struct {
+	ID         string    `json:"id,omitempty"`
+	CID        string    `json:"cid"`
+	Filename   string    `json:"filename"`
+	MIMEType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	UploadedBy string    `json:"uploaded_by,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// DataHash and TxHash are only set on files attached directly to an
+	// encounter; files of a record are covered by the record's own hash.
+	DataHash string `json:"data_hash,omitempty"`
+	TxHash   string `json:"tx_hash,omitempty"`
+}
+
+// UploadedFile is what the server recorded about a file when it was uploaded
+// to IPFS. Attachments take their type, size and SHA256 from it.
+type UploadedFile struct {
+	CID        string    `json:"cid"`
+	MIMEType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	UploadedBy string    `json:"-"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// DoctorProfile is the public profile of a doctor embedded in records.
+type DoctorProfile struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Specialization string `json:"specialization,omitempty"`
+	FacilityID     string `json:"facility_id,omitempty"`
+	FacilityName   string `json:"facility_name,omitempty"`
 }
 
 // CreateRecordPayload  defines the structure for creating a new medical record.
@@ -83,13 +408,287 @@ type CreateRecordPayload struct {
 	PatientID     string `json:"patient_id"`
 	Diagnosis     string `json:"diagnosis"`
 	Notes         string `json:"notes"`
-	AttachmentCID string `json:"attachment_cid"`
+	AttachmentCID string `json:"attachment_cid"` // Deprecated: use Attachments
+	// Attachments lists uploaded files by CID and file name; type, size,
+	// SHA256, uploader and time are taken from the server's upload record.
+	Attachments []RecordAttachment `json:"attachments"`
+	// EncounterID optionally places the record in an open encounter of the patient.
+	EncounterID string `json:"encounter_id"`
+	ClinicalContent
+}
+
+// VitalsPayload defines the structure for recording vital signs, e.g. by a nurse.
+// The vitals are stored as a record without diagnoses or medications.
+type VitalsPayload struct {
+	PatientID   string      `json:"patient_id"`
+	EncounterID string      `json:"encounter_id"`
+	Notes       string      `json:"notes"`
+	Vitals      []VitalSign `json:"vitals"`
+}
+
+// LabResultPayload defines the structure for uploading laboratory results.
+// The result files are uploaded first and attached here by CID.
+type LabResultPayload struct {
+	PatientID   string             `json:"patient_id"`
+	EncounterID string             `json:"encounter_id"`
+	Notes       string             `json:"notes"`
+	Attachments []RecordAttachment `json:"attachments"`
+}
+
+// AmendRecordPayload defines the structure for correcting a medical record.
+// The amendment replaces the content of the record as a new version.
+type AmendRecordPayload struct {
+	Diagnosis     string `json:"diagnosis"`
+	Notes         string `json:"notes"`
+	AttachmentCID string `json:"attachment_cid"` // Deprecated: use Attachments
+	Reason        string `json:"reason"`
+	// Attachments replaces the attachment list of the previous version.
+	Attachments []RecordAttachment `json:"attachments"`
+	ClinicalContent
+}
+
+// Sort orders of a record listing.
+const (
+	RecordSortNewest = "newest"
+	RecordSortOldest = "oldest"
+)
+
+// RecordFilter narrows and pages a patient's record listing. Zero values mean
+// no filter. Cursor is the position after which the page starts.
+type RecordFilter struct {
+	From               *time.Time
+	To                 *time.Time
+	DoctorID           string
+	EncounterID        string
+	DiagnosisCodeIndex string
+	HasAttachment      *bool
+	// TermIndexes are blind indexes of search terms; a record must contain all of them.
+	TermIndexes []string
+	// Scope limits the listing to the records a consent covers; nil for the patient.
+	Scope  *ConsentScope
+	Sort   string
+	Cursor *RecordCursor
+	Limit  int
+}
+
+// RecordCursor identifies the last record of a page.
+type RecordCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// RecordPage is one page of a record listing. Total counts every record that
+// matches the filter, not only this page.
+type RecordPage struct {
+	Items      []MedicalRecord `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Total      int             `json:"total"`
+}
+
+// Encounter types.
+const (
+	EncounterOutpatient  = "outpatient"
+	EncounterInpatient   = "inpatient"
+	EncounterTeleconsult = "teleconsult"
+)
+
+// Encounter states.
+const (
+	EncounterOpen   = "open"
+	EncounterClosed = "closed"
+)
+
+// Encounter is a visit (outpatient, inpatient stay or teleconsult) that
+// groups the records, prescriptions and attachments produced during it.
+type Encounter struct {
+	ID                string         `json:"id"`
+	PatientID         string         `json:"patient_id"`
+	Type              string         `json:"type"`
+	Status            string         `json:"status"`
+	FacilityID        string         `json:"facility_id"`
+	FacilityName      string         `json:"facility_name"`
+	AttendingDoctorID string         `json:"attending_doctor_id"`
+	AttendingDoctor   *DoctorProfile `json:"attending_doctor,omitempty"`
+	Reason            string         `json:"reason,omitempty"`
+	StartedAt         time.Time      `json:"started_at"`
+	EndedAt           *time.Time     `json:"ended_at,omitempty"`
+	OpenedBy          string         `json:"-"`
+	// Records, Prescriptions and Attachments (files attached to the
+	// encounter itself rather than to a record) are filled for timelines.
+	Records       []MedicalRecord    `json:"records"`
+	Prescriptions []Prescription     `json:"prescriptions"`
+	Attachments   []RecordAttachment `json:"attachments"`
+	// ContentRestricted is set when part of the encounter was withheld
+	// because the patient's consent does not cover it.
+	ContentRestricted bool `json:"content_restricted,omitempty"`
+}
+
+// OpenEncounterPayload defines the structure for opening an encounter.
+// FacilityID defaults to the attending doctor's facility; AttendingDoctorID
+// defaults to the caller and is required for service accounts.
+type OpenEncounterPayload struct {
+	PatientID         string     `json:"patient_id"`
+	Type              string     `json:"type"`
+	FacilityID        string     `json:"facility_id"`
+	AttendingDoctorID string     `json:"attending_doctor_id"`
+	Reason            string     `json:"reason"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+}
+
+// EncounterParticipantPayload defines the structure for adding a clinician
+// to an encounter.
+type EncounterParticipantPayload struct {
+	ParticipantID string `json:"participant_id"`
+}
+
+// EncounterAttachmentsPayload defines the structure for attaching files to an encounter.
+type EncounterAttachmentsPayload struct {
+	Attachments []RecordAttachment `json:"attachments"`
+}
+
+// EncounterPage is one page of a patient's encounter timeline, newest first.
+type EncounterPage struct {
+	Items      []Encounter `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Prescription is a set of medications prescribed during an encounter.
+type Prescription struct {
+	ID             string       `json:"id"`
+	EncounterID    string       `json:"encounter_id"`
+	PatientID      string       `json:"patient_id"`
+	PrescriberID   string       `json:"prescriber_id"`
+	PrescriberName string       `json:"prescriber_name"`
+	Items          []Medication `json:"items"`
+	Notes          string       `json:"notes,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	DataHash       string       `json:"data_hash,omitempty"`
+	TxHash         string       `json:"tx_hash,omitempty"`
+}
+
+// PrescriptionPage is one page of a patient's prescriptions, newest first.
+type PrescriptionPage struct {
+	Items      []Prescription `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// PrescriptionPayload defines the structure for writing a prescription.
+type PrescriptionPayload struct {
+	Items []Medication `json:"items"`
+	Notes string       `json:"notes"`
+}
+
+// ClinicalContent is the structured part of a record version. Each entry is
+// stored in its own table; free-text and code fields are encrypted at rest.
+type ClinicalContent struct {
+	Vitals      []VitalSign       `json:"vitals,omitempty"`
+	Diagnoses   []RecordDiagnosis `json:"diagnoses,omitempty"`
+	Medications []Medication      `json:"medications,omitempty"`
+	Allergies   []Allergy         `json:"allergies,omitempty"`
+	Procedures  []Procedure       `json:"procedures,omitempty"`
+}
+
+// IsEmpty reports whether no structured entries were given.
+func (c ClinicalContent) IsEmpty() bool {
+	return len(c.Vitals) == 0 && len(c.Diagnoses) == 0 && len(c.Medications) == 0 && len(c.Allergies) == 0 && len(c.Procedures) == 0
+}
+
+// Vital sign types.
+const (
+	VitalBloodPressure    = "blood_pressure"
+	VitalHeartRate        = "heart_rate"
+	VitalRespiratoryRate  = "respiratory_rate"
+	VitalTemperature      = "temperature"
+	VitalOxygenSaturation = "oxygen_saturation"
+	VitalWeight           = "weight"
+	VitalHeight           = "height"
+)
+
+// VitalUnits maps each vital sign type to the unit it is recorded in.
+var VitalUnits = map[string]string{
+	VitalBloodPressure:    "mmHg",
+	VitalHeartRate:        "bpm",
+	VitalRespiratoryRate:  "/min",
+	VitalTemperature:      "°C",
+	VitalOxygenSaturation: "%",
+	VitalWeight:           "kg",
+	VitalHeight:           "cm",
+}
+
+// VitalSign is one measurement. Value is text so blood pressure can be given
+// as "120/80"; every other type is a single number.
+type VitalSign struct {
+	ID         string     `json:"id,omitempty"`
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Unit       string     `json:"unit"`
+	MeasuredAt *time.Time `json:"measured_at,omitempty"`
+}
+
+// RecordDiagnosis is an ICD-10 coded diagnosis. A record has exactly one
+// primary diagnosis when it has any.
+type RecordDiagnosis struct {
+	ID          string `json:"id,omitempty"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+	// CodeIndex is the blind index of Code, used to filter records by diagnosis.
+	CodeIndex string `json:"-"`
+	// Uncatalogued is set when Code is a well-formed ICD-10 code that is not in
+	// the bundled catalog, so only its format was checked.
+	Uncatalogued bool `json:"uncatalogued,omitempty"`
+}
+
+// ICD10Code is an entry of the ICD-10 catalog. Display is the name in the
+// language the client asked for.
+type ICD10Code struct {
+	Code    string `json:"code"`
+	NameEN  string `json:"name_en"`
+	NameID  string `json:"name_id"`
+	Display string `json:"display,omitempty"`
+}
+
+// Medication routes.
+var MedicationRoutes = []string{"oral", "sublingual", "topical", "inhalation", "rectal", "iv", "im", "sc", "other"}
+
+// Medication is one medication entry on a record.
+type Medication struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Dose      string `json:"dose"`
+	Route     string `json:"route"`
+	Frequency string `json:"frequency"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// Allergy severities.
+const (
+	AllergyMild     = "mild"
+	AllergyModerate = "moderate"
+	AllergySevere   = "severe"
+)
+
+// Allergy is a known allergy noted on a record.
+type Allergy struct {
+	ID        string `json:"id,omitempty"`
+	Substance string `json:"substance"`
+	Reaction  string `json:"reaction,omitempty"`
+	Severity  string `json:"severity"`
+}
+
+// Procedure is a procedure performed during the visit.
+type Procedure struct {
+	ID          string     `json:"id,omitempty"`
+	Name        string     `json:"name"`
+	Code        string     `json:"code,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+	PerformedAt *time.Time `json:"performed_at,omitempty"`
 }
 
 // ConsentRequest represents a request for data access from a doctor to patient.
 type ConsentRequest struct {
 	ID          string     `json:"id"`
-	DoctorID    string     `json:"doctor_id,omitempty"`
+	DoctorID    string     `json:"doctor_id"`
 	DoctorName  string     `json:"doctor_name"`
 	PatientID   string     `json:"patient_id"`
 	PatientName string     `json:"patient_name"`
@@ -101,14 +700,203 @@ type ConsentRequest struct {
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
+// Sources of a doctor's or system's access to a patient's records.
+const (
+	AccessSourceConsent    = "consent"
+	AccessSourceBreakGlass = "break_glass"
+)
+
+// PatientAccess is the one grant an accessor currently uses for a patient:
+// an active break-glass session, which reads everything, or else the most
+// recently updated granted and unexpired consent. BreakGlassSessionID is set
+// for break-glass access so each read can be audited against the session.
+type PatientAccess struct {
+	PatientID           string
+	Source              string
+	DataScope           string
+	BreakGlassSessionID string
+}
+
+// Delegation scopes: what a guardian may do on behalf of a dependent.
+const (
+	DelegationScopeRecords = "records" // view records and access logs
+	DelegationScopeConsent = "consent" // answer and revoke consent requests
+	DelegationScopeFull    = "full"
+)
+
+// Delegation states.
+const (
+	DelegationPending = "pending"
+	DelegationActive  = "active"
+	DelegationRevoked = "revoked"
+)
+
+// Delegation lets a guardian account act on behalf of a dependent patient.
+type Delegation struct {
+	ID            string     `json:"id"`
+	GuardianID    string     `json:"guardian_id"`
+	GuardianName  string     `json:"guardian_name"`
+	DependentID   string     `json:"dependent_id"`
+	DependentName string     `json:"dependent_name"`
+	Scope         string     `json:"scope"`
+	Relationship  string     `json:"relationship"`
+	Status        string     `json:"status"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+	CreatedBy     string     `json:"created_by"`
+	AcceptedAt    *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// DelegationPayload defines the structure for a patient inviting a guardian.
+type DelegationPayload struct {
+	GuardianEmail string     `json:"guardian_email"`
+	Scope         string     `json:"scope"`
+	Relationship  string     `json:"relationship"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+}
+
+// AdminDelegationPayload defines the structure for an admin creating an
+// already-active delegation, e.g. for a minor who cannot accept it themselves.
+type AdminDelegationPayload struct {
+	GuardianID   string     `json:"guardian_id"`
+	DependentID  string     `json:"dependent_id"`
+	Scope        string     `json:"scope"`
+	Relationship string     `json:"relationship"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+}
+
+// ServiceAccount is a machine identity owned by a facility, e.g. a hospital information system.
+type ServiceAccount struct {
+	ID          string    `json:"id"`
+	FacilityID  string    `json:"facility_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIKey describes an API key of a service account. The key itself is only
+// shown once, at creation.
+type APIKey struct {
+	ID                 string `json:"id"`
+	ServiceAccountID   string `json:"service_account_id"`
+	ServiceAccountName string `json:"service_account_name,omitempty"`
+	// FacilityID is the facility of the key's service account.
+	FacilityID         string     `json:"-"`
+	Prefix             string     `json:"prefix"`
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// ServiceAccountPayload defines the structure for creating a service account.
+type ServiceAccountPayload struct {
+	FacilityID  string `json:"facility_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// APIKeyPayload defines the structure for issuing an API key.
+type APIKeyPayload struct {
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+}
+
+// Break-glass review outcomes.
+const (
+	BreakGlassReviewPending   = "pending"
+	BreakGlassReviewConfirmed = "confirmed"
+	BreakGlassReviewMisuse    = "misuse"
+)
+
+// BreakGlassSession is a time-boxed emergency read access opened by a doctor
+// without the patient's consent. Every session is reviewed by an admin.
+type BreakGlassSession struct {
+	ID           string     `json:"id"`
+	DoctorID     string     `json:"doctor_id"`
+	DoctorName   string     `json:"doctor_name"`
+	PatientID    string     `json:"patient_id"`
+	PatientName  string     `json:"patient_name"`
+	Reason       string     `json:"reason"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	ReviewStatus string     `json:"review_status"`
+	ReviewNote   string     `json:"review_note,omitempty"`
+	ReviewedBy   *string    `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// AccessCount is how many patient data requests were served under the session.
+	AccessCount int `json:"access_count"`
+}
+
+// BreakGlassAccess is one request for patient data served under a break-glass session.
+type BreakGlassAccess struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	DoctorID   string    `json:"doctor_id"`
+	PatientID  string    `json:"patient_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// BreakGlassPayload defines the structure for opening emergency access.
+type BreakGlassPayload struct {
+	Reason string `json:"reason"`
+}
+
+// BreakGlassReviewPayload defines the structure for an admin's review of a break-glass session.
+type BreakGlassReviewPayload struct {
+	Note string `json:"note"`
+}
+
+// Consent actions a patient signs.
+const (
+	ConsentActionGrant  = "grant"
+	ConsentActionDeny   = "deny"
+	ConsentActionRevoke = "revoke"
+)
+
 type GrantConsentPayload struct {
 	Duration  string `json:"duration"`   // e.g., "24h", "permanent"
-	DataScope string `json:"data_scope"` // e.g., "all"
+	DataScope string `json:"data_scope"` // a ConsentScope as JSON, e.g. {"all":true}
+	// ExpiresAt is part of the signed message; nil means the grant does not expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Nonce     string     `json:"nonce"`
+	Signature string     `json:"signature"`
+}
+
+// SignedConsentPayload defines the structure for signed deny and revoke actions.
+type SignedConsentPayload struct {
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+// ConsentSignature is a stored, independently verifiable signature over a consent decision.
+type ConsentSignature struct {
+	ID               string    `json:"id"`
+	ConsentRequestID string    `json:"consent_request_id"`
+	Action           string    `json:"action"`
+	SignerID         string    `json:"signer_id"`
+	Message          string    `json:"message"`
+	Signature        string    `json:"signature"`
+	PublicKey        string    `json:"public_key"`
+	Nonce            string    `json:"nonce"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Valid is computed when the signature is re-verified on read.
+	Valid bool `json:"valid"`
 }
 
 // ConsentRequestPayload defines the structure for initiating a consent request.
+// DataScope is the access the doctor asks for, as a ConsentScope in JSON; the
+// patient may grant it or sign a narrower scope.
 type ConsentRequestPayload struct {
 	PatientID string `json:"patient_id"`
+	DataScope string `json:"data_scope"`
 }
 
 // LedgerBlock represents a single block in the simulated blochchain ledger.
@@ -120,6 +908,32 @@ type LedgerBlock struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// Record write actions and their outcomes, kept in the patient's audit log.
+const (
+	RecordWriteCreate = "create"
+	RecordWriteAmend  = "amend"
+
+	WriteOutcomeSuccess  = "success"
+	WriteOutcomeDenied   = "denied"   // no treatment relationship with the patient
+	WriteOutcomeRejected = "rejected" // invalid request
+	WriteOutcomeFailed   = "failed"   // server-side error
+	// WriteOutcomeUnanchored means the record was stored but its hash could
+	// not be recorded on the blockchain.
+	WriteOutcomeUnanchored = "unanchored"
+)
+
+// RecordWriteAttempt is one attempt by staff or a service to write a record
+// for a patient, whether or not it succeeded.
+type RecordWriteAttempt struct {
+	PatientID string
+	ActorID   string
+	ActorName string
+	Action    string
+	RecordID  string
+	Outcome   string
+	Detail    string
+}
+
 // AccessLog represents a single entry in the data access log.
 type AccessLog struct {
 	DoctorName      string    `json:"doctor_name"`
@@ -127,4 +941,8 @@ type AccessLog struct {
 	RecordDiagnosis string    `json:"record_diagnosis"`
 	Timestamp       time.Time `json:"timestamp"`
 	Status          string    `json:"status"`
+	// RecordWrittenAt and RecordVersionIDs identify the record an entry is
+	// about, so entries can be limited to a consent scope. Nil otherwise.
+	RecordWrittenAt  *time.Time `json:"-"`
+	RecordVersionIDs []string   `json:"-"`
 }
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// emailVerificationTTL is how long an email verification link stays valid.
+	emailVerificationTTL = 24 * time.Hour
+	// passwordResetTTL is how long a password reset link stays valid.
+	passwordResetTTL = time.Hour
+	// minPasswordLength and maxPasswordLength bound every password a user sets.
+	minPasswordLength = 8
+	// maxPasswordLength is bcrypt's input limit; longer passwords would be rejected by bcrypt.
+	maxPasswordLength = 72
+)
+
+// AccountHandler handles registration, email verification and password reset.
+type AccountHandler struct {
+	userRepo    repository.UserRepository
+	tokenRepo   repository.UserTokenRepository
+	sessionRepo repository.SessionRepository
+	roleRepo    repository.RoleRepository
+	keyRepo     repository.KeyRepository
+	mailer      mail.Mailer
+	appBaseURL  string
+	// encryptionKey is the server key used as the outer layer of key escrow.
+	encryptionKey []byte
+}
+
+// NewAccountHandler creates a new instance of AccountHandler.
+func NewAccountHandler(userRepo repository.UserRepository, tokenRepo repository.UserTokenRepository, sessionRepo repository.SessionRepository, roleRepo repository.RoleRepository, keyRepo repository.KeyRepository, mailer mail.Mailer, appBaseURL string, encryptionKey []byte) *AccountHandler {
+	return &AccountHandler{
+		userRepo:      userRepo,
+		tokenRepo:     tokenRepo,
+		sessionRepo:   sessionRepo,
+		roleRepo:      roleRepo,
+		keyRepo:       keyRepo,
+		mailer:        mailer,
+		appBaseURL:    appBaseURL,
+		encryptionKey: encryptionKey,
+	}
+}
+
+// Register handles the user registration process.
+func (h *AccountHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var payload domain.RegisterPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	// Semua role boleh mendaftar sendiri kecuali admin; akun admin dibuat lewat cmd/createadmin.
+	role, err := h.roleRepo.GetRole(r.Context(), payload.Role)
+	if err != nil || role.Name == domain.RoleAdmin {
+		http.Error(w, "Role tidak valid", http.StatusBadRequest)
+		return
+	}
+	if payload.KeyBackupPassphrase != "" && len(payload.KeyBackupPassphrase) < minPassphraseLength {
+		http.Error(w, fmt.Sprintf("Passphrase backup kunci minimal %d karakter", minPassphraseLength), http.StatusBadRequest)
+		return
+	}
+
+	verificationStatus := domain.VerificationApproved
+	if role.ClinicalStaff {
+		if strings.TrimSpace(payload.STRNumber) == "" || strings.TrimSpace(payload.SIPNumber) == "" {
+			http.Error(w, "Nomor STR dan SIP wajib diisi untuk pendaftaran tenaga kesehatan", http.StatusBadRequest)
+			return
+		}
+		// Tenaga kesehatan baru belum bisa mengakses data pasien sampai kredensialnya disetujui admin.
+		verificationStatus = domain.VerificationPending
+	}
+	if msg := passwordPolicyViolation(payload.Password); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Gagal memproses password", http.StatusInternalServerError)
+		return
+	}
+
+	privateKey, err := auth.GenerateKeyPair()
+	if err != nil {
+		http.Error(w, "Gagal membuat kunci kriptografi", http.StatusInternalServerError)
+		return
+	}
+	privateKeyHex := auth.PrivateKeyToHex(privateKey)
+	publicKeyHex := auth.PublicKeyToHex(privateKey)
+
+	newUser := &domain.User{
+		Name:               payload.Name,
+		Email:              payload.Email,
+		HashedPassword:     string(hashedPassword),
+		Role:               role.Name,
+		PublicKey:          publicKeyHex,
+		NIP:                payload.NIP,
+		STRNumber:          strings.TrimSpace(payload.STRNumber),
+		SIPNumber:          strings.TrimSpace(payload.SIPNumber),
+		Phone:              payload.Phone,
+		Specialization:     payload.Specialization,
+		FacilityID:         payload.FacilityID,
+		VerificationStatus: verificationStatus,
+	}
+	// Fasilitas dokter baru berlaku setelah disetujui admin; sebelum itu hanya permintaan.
+	if payload.Role == domain.RoleDoctor {
+		newUser.FacilityID = ""
+		newUser.RequestedFacilityID = payload.FacilityID
+	}
+
+	userID, err := h.userRepo.CreateUser(r.Context(), newUser)
+	if err != nil {
+		log.Printf("Gagal menyimpan user: %v", err)
+		http.Error(w, "Gagal menyimpan user, mungkin email atau NIP sudah terdaftar?", http.StatusInternalServerError)
+		return
+	}
+	newUser.ID = userID
+
+	// Escrow kunci bersifat opt-in; jika gagal, pengguna masih bisa melakukan backup lewat /keys/backup.
+	keyBackedUp := false
+	if payload.KeyBackupPassphrase != "" {
+		if err := escrowOnRegister(r.Context(), h.keyRepo, userID, privateKeyHex, payload.KeyBackupPassphrase, h.encryptionKey); err != nil {
+			log.Printf("Gagal menyimpan backup kunci user %s: %v", userID, err)
+		} else {
+			keyBackedUp = true
+		}
+	}
+
+	// Kegagalan kirim email tidak membatalkan registrasi; pengguna bisa meminta ulang.
+	if err := h.sendVerificationEmail(r.Context(), newUser); err != nil {
+		log.Printf("Gagal mengirim email verifikasi ke user %s: %v", userID, err)
+	}
+
+	message := "Registrasi berhasil. Silakan cek email Anda untuk verifikasi."
+	if verificationStatus == domain.VerificationPending {
+		message = "Registrasi berhasil. Silakan cek email Anda untuk verifikasi; akun Anda akan aktif setelah STR/SIP diverifikasi admin."
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":             message,
+		"userID":              userID,
+		"private_key":         privateKeyHex,
+		"verification_status": verificationStatus,
+		"key_backed_up":       keyBackedUp,
+	})
+}
+
+// HandleRequestEmailVerification sends a new verification link to the logged-in user.
+func (h *AccountHandler) HandleRequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email sudah terverifikasi", http.StatusConflict)
+		return
+	}
+
+	if err := h.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("Gagal mengirim email verifikasi ke user %s: %v", userID, err)
+		http.Error(w, "Gagal mengirim email verifikasi", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email verifikasi telah dikirim",
+	})
+}
+
+// HandleConfirmEmailVerification marks the email as verified using the token from the link.
+func (h *AccountHandler) HandleConfirmEmailVerification(w http.ResponseWriter, r *http.Request) {
+	var payload domain.TokenPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.tokenRepo.ConsumeToken(r.Context(), repository.TokenPurposeEmailVerification, auth.HashToken(payload.Token))
+	if err != nil {
+		http.Error(w, "Token verifikasi tidak valid atau sudah kedaluwarsa", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userRepo.MarkEmailVerified(r.Context(), userID); err != nil {
+		log.Printf("Gagal memverifikasi email user %s: %v", userID, err)
+		http.Error(w, "Gagal memverifikasi email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email berhasil diverifikasi. Silakan perbarui sesi Anda.",
+	})
+}
+
+// HandleForgotPassword emails a password reset link. It always answers the same
+// way so that it cannot be used to find out which emails are registered.
+func (h *AccountHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload domain.EmailPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Email == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	if user, err := h.userRepo.GetUserByEmail(r.Context(), payload.Email); err == nil {
+		if err := h.sendPasswordResetEmail(r.Context(), user); err != nil {
+			log.Printf("Gagal mengirim email reset password ke user %s: %v", user.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Jika email terdaftar, tautan reset password telah dikirim",
+	})
+}
+
+// HandleResetPassword sets a new password using a reset token and logs the
+// user out of every device.
+func (h *AccountHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload domain.ResetPasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if msg := passwordPolicyViolation(payload.NewPassword); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.tokenRepo.ConsumeToken(r.Context(), repository.TokenPurposePasswordReset, auth.HashToken(payload.Token))
+	if err != nil {
+		http.Error(w, "Token reset tidak valid atau sudah kedaluwarsa", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Gagal memproses password", http.StatusInternalServerError)
+		return
+	}
+	if err := h.userRepo.UpdatePassword(r.Context(), userID, string(hashedPassword)); err != nil {
+		log.Printf("Gagal memperbarui password user %s: %v", userID, err)
+		http.Error(w, "Gagal memperbarui password", http.StatusInternalServerError)
+		return
+	}
+
+	// Link reset juga membuktikan kepemilikan email.
+	if err := h.userRepo.MarkEmailVerified(r.Context(), userID); err != nil {
+		log.Printf("Gagal memverifikasi email user %s: %v", userID, err)
+	}
+	if _, err := h.sessionRepo.RevokeAllSessions(r.Context(), userID); err != nil {
+		log.Printf("Gagal mencabut sesi user %s setelah reset password: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password berhasil diperbarui. Silakan login kembali.",
+	})
+}
+
+// sendVerificationEmail issues a verification token and emails its link.
+func (h *AccountHandler) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := h.issueToken(ctx, user.ID, repository.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verifikasi email akun RekamedChain",
+		Body: fmt.Sprintf("Halo %s,\n\nKlik tautan berikut untuk memverifikasi email Anda:\n%s/verify-email?token=%s\n\nTautan berlaku selama 24 jam.",
+			user.Name, h.appBaseURL, token),
+	})
+}
+
+// sendPasswordResetEmail issues a reset token and emails its link.
+func (h *AccountHandler) sendPasswordResetEmail(ctx context.Context, user *domain.User) error {
+	token, err := h.issueToken(ctx, user.ID, repository.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset password akun RekamedChain",
+		Body: fmt.Sprintf("Halo %s,\n\nKlik tautan berikut untuk membuat password baru:\n%s/reset-password?token=%s\n\nTautan berlaku selama 1 jam. Abaikan email ini jika Anda tidak memintanya.",
+			user.Name, h.appBaseURL, token),
+	})
+}
+
+// issueToken creates a one-time token and stores only its hash.
+func (h *AccountHandler) issueToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := h.tokenRepo.CreateToken(ctx, userID, purpose, auth.HashToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// passwordPolicyViolation returns why password is not acceptable, or "" if it is.
+// Registration and password reset share this policy.
+func passwordPolicyViolation(password string) string {
+	if len(password) < minPasswordLength {
+		return fmt.Sprintf("Password minimal %d karakter", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Sprintf("Password maksimal %d byte", maxPasswordLength)
+	}
+	if strings.TrimSpace(password) == "" {
+		return "Password tidak boleh hanya berisi spasi"
+	}
+	if strings.EqualFold(password, strings.Repeat(password[:1], len(password))) {
+		return "Password terlalu lemah"
+	}
+	return ""
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+// AdminHandler handles administrator actions: reviewing clinical staff
+// credentials, managing facility policy and lifting account lockouts.
+type AdminHandler struct {
+	userRepo     repository.UserRepository
+	roleRepo     repository.RoleRepository
+	sessionRepo  repository.SessionRepository
+	loginRepo    repository.LoginRepository
+	facilityRepo repository.FacilityRepository
+	mailer       mail.Mailer
+}
+
+// NewAdminHandler creates a new instance of AdminHandler.
+func NewAdminHandler(userRepo repository.UserRepository, roleRepo repository.RoleRepository, sessionRepo repository.SessionRepository, loginRepo repository.LoginRepository, facilityRepo repository.FacilityRepository, mailer mail.Mailer) *AdminHandler {
+	return &AdminHandler{
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		sessionRepo:  sessionRepo,
+		loginRepo:    loginRepo,
+		facilityRepo: facilityRepo,
+		mailer:       mailer,
+	}
+}
+
+// HandleListStaff lists clinical staff by verification status (default: pending).
+func (h *AdminHandler) HandleListStaff(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = domain.VerificationPending
+	}
+	if status != domain.VerificationPending && status != domain.VerificationApproved && status != domain.VerificationRejected {
+		http.Error(w, "Status tidak valid: pilih 'pending', 'approved' atau 'rejected'", http.StatusBadRequest)
+		return
+	}
+
+	staff, err := h.userRepo.GetStaffByVerificationStatus(r.Context(), status)
+	if err != nil {
+		log.Printf("Gagal mengambil daftar tenaga kesehatan (%s): %v", status, err)
+		http.Error(w, "Gagal mengambil daftar tenaga kesehatan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(staff)
+}
+
+// HandleGetStaff returns the NIP/STR/SIP details of a single staff member for review.
+func (h *AdminHandler) HandleGetStaff(w http.ResponseWriter, r *http.Request) {
+	staffID := r.PathValue("staff_id")
+
+	user, err := h.userRepo.GetUserByID(r.Context(), staffID)
+	if err != nil {
+		http.Error(w, "Tenaga kesehatan tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	role, err := h.roleRepo.GetRole(r.Context(), user.Role)
+	if err != nil || !role.ClinicalStaff {
+		http.Error(w, "Tenaga kesehatan tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// HandleApproveStaff approves a staff member's credentials. Their permissions
+// take effect on their next login or token refresh.
+func (h *AdminHandler) HandleApproveStaff(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, domain.VerificationApproved)
+}
+
+// HandleRejectStaff rejects a staff member's credentials and ends their sessions.
+func (h *AdminHandler) HandleRejectStaff(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, domain.VerificationRejected)
+}
+
+// decide records an approval or rejection and notifies the staff member by email.
+func (h *AdminHandler) decide(w http.ResponseWriter, r *http.Request, status string) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID admin dari token", http.StatusInternalServerError)
+		return
+	}
+	staffID := r.PathValue("staff_id")
+
+	var payload domain.VerificationDecisionPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if status == domain.VerificationRejected && payload.Note == "" {
+		http.Error(w, "Alasan penolakan (note) wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	if status == domain.VerificationRejected {
+		payload.FacilityID = ""
+	}
+
+	updated, err := h.userRepo.SetStaffVerification(r.Context(), staffID, status, payload.Note, adminID, payload.FacilityID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // fasilitas tidak ada atau bukan UUID
+		http.Error(w, "Fasilitas tidak ditemukan", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal memperbarui verifikasi tenaga kesehatan %s: %v", staffID, err)
+		http.Error(w, "Gagal memperbarui status verifikasi", http.StatusInternalServerError)
+		return
+	}
+	if updated == 0 {
+		http.Error(w, "Tenaga kesehatan tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	// Token akses yang sudah terbit masih membawa status lama, jadi sesi akun yang ditolak dicabut.
+	if status == domain.VerificationRejected {
+		if _, err := h.sessionRepo.RevokeAllSessions(r.Context(), staffID); err != nil {
+			log.Printf("Gagal mencabut sesi tenaga kesehatan %s: %v", staffID, err)
+		}
+	}
+
+	if staff, err := h.userRepo.GetUserByID(r.Context(), staffID); err == nil {
+		if err := h.mailer.Send(r.Context(), verificationDecisionEmail(staff)); err != nil {
+			log.Printf("Gagal mengirim email keputusan verifikasi ke %s: %v", staffID, err)
+		}
+	}
+
+	log.Printf("Admin %s mengubah status verifikasi %s menjadi %s", adminID, staffID, status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":             "Status verifikasi berhasil diperbarui",
+		"verification_status": status,
+	})
+}
+
+// HandleListRoles lists every role with the permissions granted to it.
+func (h *AdminHandler) HandleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleRepo.ListRoles(r.Context())
+	if err != nil {
+		log.Printf("Gagal mengambil daftar role: %v", err)
+		http.Error(w, "Gagal mengambil daftar role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// HandleListFacilities lists every facility with its MFA policy.
+func (h *AdminHandler) HandleListFacilities(w http.ResponseWriter, r *http.Request) {
+	facilities, err := h.facilityRepo.ListFacilities(r.Context())
+	if err != nil {
+		log.Printf("Gagal mengambil daftar fasilitas: %v", err)
+		http.Error(w, "Gagal mengambil daftar fasilitas", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(facilities)
+}
+
+// HandleSetMFAPolicy turns the require_doctor_mfa policy of a facility on or off.
+func (h *AdminHandler) HandleSetMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	facilityID := r.PathValue("facility_id")
+
+	var payload domain.FacilityMFAPolicyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if payload.RequireDoctorMFA == nil {
+		http.Error(w, "require_doctor_mfa wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	facility, err := h.facilityRepo.SetRequireDoctorMFA(r.Context(), facilityID, *payload.RequireDoctorMFA)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == "22P02") {
+		http.Error(w, "Fasilitas tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal memperbarui kebijakan MFA fasilitas %s: %v", facilityID, err)
+		http.Error(w, "Gagal memperbarui kebijakan MFA", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %s mengubah require_doctor_mfa fasilitas %s menjadi %t", adminID, facilityID, facility.RequireDoctorMFA)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(facility)
+}
+
+// HandleUnlockAccount lifts a brute-force lockout before it expires.
+func (h *AdminHandler) HandleUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("user_id")
+
+	updated, err := h.loginRepo.UnlockAccount(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal membuka kunci akun %s: %v", userID, err)
+		http.Error(w, "Gagal membuka kunci akun", http.StatusInternalServerError)
+		return
+	}
+	if updated == 0 {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Kunci akun berhasil dibuka",
+	})
+}
+
+// verificationDecisionEmail builds the notification sent after a credential review.
+func verificationDecisionEmail(staff *domain.User) mail.Message {
+	if staff.VerificationStatus == domain.VerificationApproved {
+		return mail.Message{
+			To:      staff.Email,
+			Subject: "Kredensial Anda telah disetujui",
+			Body:    fmt.Sprintf("Halo %s,\n\nSTR/SIP Anda telah diverifikasi. Silakan login kembali untuk mulai menggunakan RekamedChain.", staff.Name),
+		}
+	}
+	return mail.Message{
+		To:      staff.Email,
+		Subject: "Kredensial Anda ditolak",
+		Body:    fmt.Sprintf("Halo %s,\n\nVerifikasi STR/SIP Anda ditolak dengan alasan:\n%s\n\nHubungi admin fasilitas Anda untuk informasi lebih lanjut.", staff.Name, staff.VerificationNote),
+	}
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+const (
+	maxRecordAttachments = 20
+	maxAttachmentSize    = 10 << 20 // 10 MiB, batas POST /upload
+	maxFilenameLength    = 255
+)
+
+// cidPattern matches an IPFS CIDv0 ("Qm...") or a base32 CIDv1 ("b...").
+var cidPattern = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{58,})$`)
+
+// resolveAttachments checks the attachment list of a record or encounter and
+// completes it in place. The client only names each file by CID and file
+// name: type, size and SHA256 come from the server's record of the upload by
+// uploaderID, and a file carried over from the version being amended keeps
+// the metadata stored with that version.
+func (h *RecordHandler) resolveAttachments(w http.ResponseWriter, r *http.Request, attachments []domain.RecordAttachment, uploaderID string, carried []domain.RecordAttachment) bool {
+	if len(attachments) > maxRecordAttachments {
+		http.Error(w, fmt.Sprintf("Maksimal %d lampiran per rekam medis", maxRecordAttachments), http.StatusBadRequest)
+		return false
+	}
+	if len(attachments) == 0 {
+		return true
+	}
+
+	cids := make([]string, len(attachments))
+	seenCIDs := make(map[string]bool, len(attachments))
+	for i := range attachments {
+		a := &attachments[i]
+		a.CID = strings.TrimSpace(a.CID)
+		if !cidPattern.MatchString(a.CID) {
+			http.Error(w, fmt.Sprintf("attachments[%d]: CID '%s' tidak valid", i, a.CID), http.StatusBadRequest)
+			return false
+		}
+		if seenCIDs[a.CID] {
+			http.Error(w, fmt.Sprintf("attachments[%d]: berkas %s dilampirkan lebih dari sekali", i, a.CID), http.StatusBadRequest)
+			return false
+		}
+		seenCIDs[a.CID] = true
+		cids[i] = a.CID
+
+		a.Filename = strings.TrimSpace(a.Filename)
+		if !validFilename(a.Filename) {
+			http.Error(w, fmt.Sprintf("attachments[%d]: nama berkas wajib diisi, maksimal %d karakter, tanpa garis miring", i, maxFilenameLength), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	uploads, err := h.uploadRepo.GetUploads(r.Context(), uploaderID, cids)
+	if err != nil {
+		log.Printf("Gagal mengambil metadata berkas unggahan: %v", err)
+		http.Error(w, "Gagal memverifikasi lampiran", http.StatusInternalServerError)
+		return false
+	}
+	previous := make(map[string]domain.RecordAttachment, len(carried))
+	for _, a := range carried {
+		previous[a.CID] = a
+	}
+
+	for i := range attachments {
+		a := &attachments[i]
+		var stored domain.RecordAttachment
+		if kept, ok := previous[a.CID]; ok {
+			stored = kept
+		} else if upload, ok := uploads[a.CID]; ok {
+			stored = domain.RecordAttachment{
+				MIMEType:   upload.MIMEType,
+				Size:       upload.Size,
+				SHA256:     upload.SHA256,
+				UploadedBy: uploaderID,
+				UploadedAt: upload.UploadedAt.UTC().Truncate(time.Second),
+			}
+		} else {
+			http.Error(w, fmt.Sprintf("attachments[%d]: berkas %s belum diunggah melalui /upload oleh akun ini", i, a.CID), http.StatusBadRequest)
+			return false
+		}
+
+		// Hash dari klien boleh dikirim sebagai pemeriksaan, tetapi tidak pernah dipakai.
+		if claimed := strings.ToLower(strings.TrimSpace(a.SHA256)); claimed != "" && claimed != stored.SHA256 {
+			http.Error(w, fmt.Sprintf("attachments[%d]: sha256 tidak sesuai dengan berkas yang diunggah", i), http.StatusBadRequest)
+			return false
+		}
+
+		a.ID, a.DataHash, a.TxHash = "", "", ""
+		a.MIMEType = stored.MIMEType
+		a.Size = stored.Size
+		a.SHA256 = stored.SHA256
+		a.UploadedBy = stored.UploadedBy
+		a.UploadedAt = stored.UploadedAt
+	}
+	return true
+}
+
+// validFilename reports whether name is a plain file name without path
+// separators or control characters.
+func validFilename(name string) bool {
+	if name == "" || len(name) > maxFilenameLength || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\' || unicode.IsControl(r)
+	})
+}
+
+// encryptAttachments encrypts the file names of attachments in place.
+func encryptAttachments(attachments []domain.RecordAttachment, key []byte) error {
+	for i := range attachments {
+		encrypted, err := crypto.Encrypt(attachments[i].Filename, key)
+		if err != nil {
+			return err
+		}
+		attachments[i].Filename = encrypted
+	}
+	return nil
+}
+
+// decryptAttachments reverses encryptAttachments, marking names that cannot be decrypted.
+func (h *RecordHandler) decryptAttachments(attachments []domain.RecordAttachment) {
+	for i := range attachments {
+		attachments[i].Filename = h.decryptOrMark(attachments[i].Filename)
+	}
+}
+
+// attachmentsHashInput serialises the stored attachment list in a fixed
+// order for the record hash, so a swapped or altered file is detectable.
+func attachmentsHashInput(attachments []domain.RecordAttachment) string {
+	var b strings.Builder
+	for _, a := range attachments {
+		fmt.Fprintf(&b, "|attachment|%s|%s|%s|%d|%s|%s|%s", a.CID, a.Filename, a.MIMEType, a.Size, a.SHA256, a.UploadedBy, hashTime(&a.UploadedAt))
+	}
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	testUploaderID = "c0ffee00-0000-4000-8000-000000000001"
+	testUploadCID  = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	otherUploadCID = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+)
+
+type fakeUploadRepo struct {
+	repository.UploadRepository
+	uploads []domain.UploadedFile
+}
+
+func (f *fakeUploadRepo) GetUploads(ctx context.Context, uploaderID string, cids []string) (map[string]domain.UploadedFile, error) {
+	found := make(map[string]domain.UploadedFile)
+	for _, u := range f.uploads {
+		for _, cid := range cids {
+			if u.CID == cid && u.UploadedBy == uploaderID {
+				found[cid] = u
+			}
+		}
+	}
+	return found, nil
+}
+
+func newAttachmentTest() *RecordHandler {
+	return &RecordHandler{uploadRepo: &fakeUploadRepo{uploads: []domain.UploadedFile{{
+		CID:        testUploadCID,
+		MIMEType:   "application/pdf",
+		Size:       2048,
+		SHA256:     strings.Repeat("ab", 32),
+		UploadedBy: testUploaderID,
+		UploadedAt: time.Date(2026, 1, 2, 3, 4, 5, 600, time.UTC),
+	}}}}
+}
+
+func resolve(h *RecordHandler, attachments []domain.RecordAttachment, uploaderID string, carried []domain.RecordAttachment) (*httptest.ResponseRecorder, bool) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/records", nil)
+	return w, h.resolveAttachments(w, r, attachments, uploaderID, carried)
+}
+
+func TestResolveAttachmentsUsesServerComputedMetadata(t *testing.T) {
+	h := newAttachmentTest()
+	// Metadata dari klien diabaikan; hanya CID dan nama berkas yang dipakai.
+	attachments := []domain.RecordAttachment{{CID: testUploadCID, Filename: " lab.pdf ", MIMEType: "text/plain", Size: 1, UploadedBy: "orang-lain"}}
+	if w, ok := resolve(h, attachments, testUploaderID, nil); !ok {
+		t.Fatalf("rejected: %d %s", w.Code, w.Body)
+	}
+	got := attachments[0]
+	want := domain.RecordAttachment{
+		CID:        testUploadCID,
+		Filename:   "lab.pdf",
+		MIMEType:   "application/pdf",
+		Size:       2048,
+		SHA256:     strings.Repeat("ab", 32),
+		UploadedBy: testUploaderID,
+		UploadedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if got != want {
+		t.Fatalf("attachment = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveAttachmentsRejectsFilesNotUploadedByWriter(t *testing.T) {
+	h := newAttachmentTest()
+	cases := map[string]struct {
+		attachment domain.RecordAttachment
+		uploaderID string
+	}{
+		"unknown cid":       {domain.RecordAttachment{CID: otherUploadCID, Filename: "a.pdf"}, testUploaderID},
+		"other uploader":    {domain.RecordAttachment{CID: testUploadCID, Filename: "a.pdf"}, "c0ffee00-0000-4000-8000-000000000002"},
+		"mismatched sha256": {domain.RecordAttachment{CID: testUploadCID, Filename: "a.pdf", SHA256: strings.Repeat("cd", 32)}, testUploaderID},
+		"invalid cid":       {domain.RecordAttachment{CID: "bukan-cid", Filename: "a.pdf"}, testUploaderID},
+		"path in filename":  {domain.RecordAttachment{CID: testUploadCID, Filename: "../a.pdf"}, testUploaderID},
+	}
+	for name, tc := range cases {
+		w, ok := resolve(h, []domain.RecordAttachment{tc.attachment}, tc.uploaderID, nil)
+		if ok || w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got ok=%v status %d, want 400", name, ok, w.Code)
+		}
+	}
+}
+
+func TestResolveAttachmentsKeepsMetadataOfCarriedFiles(t *testing.T) {
+	h := newAttachmentTest()
+	// Lampiran versi sebelumnya (mis. dari sebelum metadata unggahan disimpan) tetap boleh dibawa.
+	carried := domain.RecordAttachment{
+		ID:         "lama",
+		CID:        otherUploadCID,
+		Filename:   "terenkripsi",
+		MIMEType:   "image/png",
+		Size:       99,
+		SHA256:     strings.Repeat("ef", 32),
+		UploadedBy: "c0ffee00-0000-4000-8000-000000000003",
+		UploadedAt: time.Date(2025, 5, 6, 7, 8, 9, 0, time.UTC),
+	}
+	attachments := []domain.RecordAttachment{{CID: otherUploadCID, Filename: "foto.png"}}
+	if w, ok := resolve(h, attachments, testUploaderID, []domain.RecordAttachment{carried}); !ok {
+		t.Fatalf("rejected: %d %s", w.Code, w.Body)
+	}
+	want := carried
+	want.ID, want.Filename = "", "foto.png"
+	if attachments[0] != want {
+		t.Fatalf("attachment = %+v, want %+v", attachments[0], want)
+	}
+}
+
+func TestDescribeUploadHashesWholeFileAndSniffsType(t *testing.T) {
+	content := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte{'x'}, 4096)...)
+	file := bytes.NewReader(content)
+	upload, err := describeUpload(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+	if upload.SHA256 != hex.EncodeToString(digest[:]) || upload.Size != int64(len(content)) || upload.MIMEType != "application/pdf" {
+		t.Fatalf("upload = %+v", upload)
+	}
+	if pos, _ := file.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Fatalf("file not rewound for the IPFS upload, at %d", pos)
+	}
+
+	small, err := describeUpload(bytes.NewReader([]byte("halo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.Size != 4 || small.MIMEType != "text/plain" {
+		t.Fatalf("small upload = %+v", small)
+	}
+}
@@ -2,169 +2,590 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/trifur/rekamedchain/backend/internal/auth"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
 	"github.com/trifur/rekamedchain/backend/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthHandler handles authentication-related HTTP requests.
 type AuthHandler struct {
-	userRepo repository.UserRepository
-	jwtKey   []byte
+	userRepo      repository.UserRepository
+	challengeRepo repository.ChallengeRepository
+	sessionRepo   repository.SessionRepository
+	mfaRepo       repository.MFARepository
+	loginRepo     repository.LoginRepository
+	roleRepo      repository.RoleRepository
+	tokenIssuer   *auth.TokenIssuer
+	encryptionKey []byte
+	// trustedProxies are the reverse proxies whose X-Forwarded-For is believed.
+	trustedProxies []*net.IPNet
 }
 
+const (
+	// challengeTTL is how long a passwordless login challenge stays valid.
+	challengeTTL = 5 * time.Minute
+	// accessTokenTTL is kept short because access tokens cannot be recalled once issued.
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL is how long a session survives without being refreshed.
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// mfaTokenTTL is how long the user has to enter their TOTP code after the first login step.
+	mfaTokenTTL = 5 * time.Minute
+)
+
 // NewAuthHandler creates a new instance of AuthHandler.
-func NewAuthHandler(userRepo repository.UserRepository, jwtKey []byte) *AuthHandler {
+func NewAuthHandler(userRepo repository.UserRepository, challengeRepo repository.ChallengeRepository, sessionRepo repository.SessionRepository, mfaRepo repository.MFARepository, loginRepo repository.LoginRepository, roleRepo repository.RoleRepository, tokenIssuer *auth.TokenIssuer, encryptionKey []byte, trustedProxies []*net.IPNet) *AuthHandler {
 	return &AuthHandler{
-		userRepo: userRepo,
-		jwtKey:   jwtKey,
+		userRepo:       userRepo,
+		challengeRepo:  challengeRepo,
+		sessionRepo:    sessionRepo,
+		mfaRepo:        mfaRepo,
+		loginRepo:      loginRepo,
+		roleRepo:       roleRepo,
+		tokenIssuer:    tokenIssuer,
+		encryptionKey:  encryptionKey,
+		trustedProxies: trustedProxies,
 	}
 }
 
-// Register handles the user registration process.
-func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var payload domain.RegisterPayload
+// DoctorLogin handles the login process for doctors and other clinical staff
+// (nurses, lab staff, pharmacists).
+func (h *AuthHandler) DoctorLogin(w http.ResponseWriter, r *http.Request) {
+	var payload domain.LoginPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "Gagal memproses password", http.StatusInternalServerError)
+	if h.ipBlocked(w, r) {
 		return
 	}
 
-	// Logika untuk menentukan role (pasien atau dokter)
-	role := payload.Role
-	if role != "patient" {
-		role = "doctor"
+	user, err := h.userRepo.GetDoctorByEmail(r.Context(), payload.Email)
+	if err != nil {
+		h.recordLoginFailure(r, payload.Email, nil, "unknown_account")
+		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
+		return
 	}
 
-	privateKey, err := auth.GenerateKeyPair()
-	if err != nil {
-		http.Error(w, "Gagal membuat kunci kriptografi", http.StatusInternalServerError)
+	if h.accountBlocked(w, r, user.ID) {
 		return
 	}
-	privateKeyHex := auth.PrivateKeyToHex(privateKey)
-	publicKeyHex := auth.PublicKeyToHex(privateKey)
 
-	newUser := &domain.User{
-		Name:           payload.Name,
-		Email:          payload.Email,
-		HashedPassword: string(hashedPassword),
-		Role:           role,
-		PublicKey:      publicKeyHex,
-		NIP:            payload.NIP,
-		Phone:          payload.Phone,
-		Specialization: payload.Specialization,
+	// VALIDASI 1: Pastikan role adalah tenaga kesehatan (dokter, perawat, lab, apoteker)
+	role, err := h.roleRepo.GetRole(r.Context(), user.Role)
+	if err != nil || !role.ClinicalStaff {
+		http.Error(w, "Akses ditolak. Akun ini bukan akun tenaga kesehatan.", http.StatusForbidden)
+		return
 	}
 
-	userID, err := h.userRepo.CreateUser(r.Context(), newUser)
+	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(payload.Password))
 	if err != nil {
-		log.Printf("Gagal menyimpan user: %v", err)
-		http.Error(w, "Gagal menyimpan user, mungkin email atau NIP sudah terdaftar?", http.StatusInternalServerError)
+		h.recordLoginFailure(r, payload.Email, user, "invalid_password")
+		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":     "Registrasi berhasil",
-		"userID":      userID,
-		"private_key": privateKeyHex,
-	})
+	// Lanjutkan membuat token jika semua validasi lolos
+	h.completeLogin(w, r, user)
 }
 
-// DoctorLogin handles the login process specifically for doctors.
-func (h *AuthHandler) DoctorLogin(w http.ResponseWriter, r *http.Request) {
+// PatientLogin handles the login process specifically for patients.
+func (h *AuthHandler) PatientLogin(w http.ResponseWriter, r *http.Request) {
 	var payload domain.LoginPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
 		return
 	}
 
-	user, err := h.userRepo.GetDoctorByEmail(r.Context(), payload.Email)
+	if h.ipBlocked(w, r) {
+		return
+	}
+
+	user, err := h.userRepo.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil {
+		h.recordLoginFailure(r, payload.Email, nil, "unknown_account")
 		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
 		return
 	}
 
-	// VALIDASI 1: Pastikan role adalah 'doctor'
-	if user.Role != "doctor" {
-		http.Error(w, "Akses ditolak. Akun ini bukan akun dokter.", http.StatusForbidden)
+	if h.accountBlocked(w, r, user.ID) {
+		return
+	}
+
+	// VALIDASI 2: Pastikan role adalah 'patient'
+	if user.Role != domain.RolePatient {
+		http.Error(w, "Akses ditolak. Akun ini bukan akun pasien.", http.StatusForbidden)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(payload.Password))
 	if err != nil {
+		h.recordLoginFailure(r, payload.Email, user, "invalid_password")
 		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
 		return
 	}
 
 	// Lanjutkan membuat token jika semua validasi lolos
-	h.createAndSendToken(w, user)
+	h.completeLogin(w, r, user)
 }
 
-// PatientLogin handles the login process specifically for patients.
-func (h *AuthHandler) PatientLogin(w http.ResponseWriter, r *http.Request) {
+// AdminLogin handles the login process for administrators.
+func (h *AuthHandler) AdminLogin(w http.ResponseWriter, r *http.Request) {
 	var payload domain.LoginPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
 		return
 	}
 
+	if h.ipBlocked(w, r) {
+		return
+	}
+
 	user, err := h.userRepo.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil {
+		h.recordLoginFailure(r, payload.Email, nil, "unknown_account")
 		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
 		return
 	}
 
-	// VALIDASI 2: Pastikan role adalah 'patient'
-	if user.Role != "patient" {
-		http.Error(w, "Akses ditolak. Akun ini bukan akun pasien.", http.StatusForbidden)
+	if h.accountBlocked(w, r, user.ID) {
+		return
+	}
+
+	if user.Role != domain.RoleAdmin {
+		http.Error(w, "Akses ditolak. Akun ini bukan akun admin.", http.StatusForbidden)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(payload.Password))
 	if err != nil {
+		h.recordLoginFailure(r, payload.Email, user, "invalid_password")
 		http.Error(w, "Email atau password salah", http.StatusUnauthorized)
 		return
 	}
 
-	// Lanjutkan membuat token jika semua validasi lolos
-	h.createAndSendToken(w, user)
+	h.completeLogin(w, r, user)
 }
 
-// Helper function to avoid code duplication for creating and sending tokens.
-func (h *AuthHandler) createAndSendToken(w http.ResponseWriter, user *domain.User) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &domain.Claims{
+// RequestChallenge issues a one-time nonce that the user must sign with their private key.
+func (h *AuthHandler) RequestChallenge(w http.ResponseWriter, r *http.Request) {
+	var payload domain.ChallengePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByEmail(r.Context(), payload.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Gagal mengambil user untuk challenge: %v", err)
+		http.Error(w, "Gagal membuat challenge", http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		http.Error(w, "Gagal membuat challenge", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(challengeTTL)
+	var challengeID string
+	if user == nil {
+		// Email tidak terdaftar: kirim challenge palsu dengan bentuk yang sama agar
+		// keberadaan akun tidak bisa ditebak. Verifikasinya selalu gagal.
+		challengeID, err = auth.RandomUUID()
+	} else {
+		challengeID, err = h.challengeRepo.CreateChallenge(r.Context(), user.ID, nonce, expiresAt)
+	}
+	if err != nil {
+		log.Printf("Gagal menyimpan challenge: %v", err)
+		http.Error(w, "Gagal membuat challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(domain.AuthChallenge{
+		ID:        challengeID,
+		Nonce:     nonce,
+		Message:   auth.LoginChallengeMessage(nonce),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// VerifyChallenge checks the signed challenge against the user's stored public key
+// and issues a token when the signature is valid.
+func (h *AuthHandler) VerifyChallenge(w http.ResponseWriter, r *http.Request) {
+	var payload domain.VerifyChallengePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	// Semua kegagalan memakai pesan yang sama agar challenge palsu untuk email
+	// yang tidak terdaftar tidak bisa dibedakan dari challenge asli.
+	const invalidChallenge = "Challenge atau tanda tangan tidak valid"
+
+	if h.ipBlocked(w, r) {
+		return
+	}
+
+	// Challenge langsung ditandai terpakai, sehingga tanda tangan yang salah tidak bisa dicoba ulang.
+	challenge, err := h.challengeRepo.ConsumeChallenge(r.Context(), payload.ChallengeID)
+	if err != nil {
+		http.Error(w, invalidChallenge, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil || user.PublicKey == "" {
+		http.Error(w, invalidChallenge, http.StatusUnauthorized)
+		return
+	}
+
+	if h.accountBlocked(w, r, user.ID) {
+		return
+	}
+
+	valid, err := auth.VerifySignature(user.PublicKey, auth.LoginChallengeMessage(challenge.Nonce), payload.Signature)
+	if err != nil || !valid {
+		h.recordLoginFailure(r, user.Email, user, "invalid_signature")
+		http.Error(w, invalidChallenge, http.StatusUnauthorized)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// Refresh exchanges a refresh token for a new access token and rotates the refresh token.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var payload domain.RefreshPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.RefreshToken == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	newRefreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+
+	session, err := h.sessionRepo.RotateRefreshToken(r.Context(), auth.HashToken(payload.RefreshToken), auth.HashToken(newRefreshToken), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		http.Error(w, "Refresh token tidak valid atau sesi telah berakhir", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusUnauthorized)
+		return
+	}
+
+	h.sendTokens(w, r, user, session, newRefreshToken)
+}
+
+// Logout revokes the session of the current access token.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	sessionID, okSession := r.Context().Value(middleware.SessionIDKey).(string)
+	if !ok || !okSession {
+		http.Error(w, "Gagal mendapatkan sesi dari token", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.sessionRepo.RevokeSession(r.Context(), sessionID, userID); err != nil {
+		log.Printf("Gagal mencabut sesi %s: %v", sessionID, err)
+		http.Error(w, "Gagal logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logout berhasil",
+	})
+}
+
+// LogoutAll revokes every session of the current user, including this one.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := h.sessionRepo.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mencabut semua sesi user %s: %v", userID, err)
+		http.Error(w, "Gagal logout dari semua perangkat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":          "Berhasil logout dari semua perangkat",
+		"revoked_sessions": revoked,
+	})
+}
+
+// HandleJWKS publishes the public keys used to verify our tokens.
+func (h *AuthHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.tokenIssuer.JWKS())
+}
+
+// DoctorLoginMFA completes a login that was paused for a second factor. It
+// accepts either a current TOTP code or one of the user's recovery codes.
+func (h *AuthHandler) DoctorLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var payload domain.MFALoginPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	claims := &domain.MFAClaims{}
+	if err := h.tokenIssuer.Parse(payload.MFAToken, claims, auth.MFAAudience); err != nil {
+		http.Error(w, "Token MFA tidak valid atau sudah kedaluwarsa", http.StatusUnauthorized)
+		return
+	}
+
+	if h.ipBlocked(w, r) || h.accountBlocked(w, r, claims.UserID) {
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), claims.UserID)
+	if err != nil || !settings.Enabled {
+		http.Error(w, "MFA tidak aktif untuk akun ini", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := verifySecondFactor(r.Context(), h.mfaRepo, h.encryptionKey, claims.UserID, settings, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		log.Printf("Gagal memverifikasi MFA user %s: %v", claims.UserID, err)
+		http.Error(w, "Gagal memverifikasi kode", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		// Kegagalan kode MFA ikut dihitung agar 6 digit TOTP tidak bisa ditebak berulang kali.
+		h.recordLoginFailure(r, user.Email, user, "invalid_mfa_code")
+		http.Error(w, "Kode autentikasi salah", http.StatusUnauthorized)
+		return
+	}
+
+	// Token MFA hanya sekali pakai: setelah berhasil, token yang sama tidak bisa dipakai login lagi.
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		http.Error(w, "Token MFA sudah dipakai atau tidak valid", http.StatusUnauthorized)
+		return
+	}
+	fresh, err := h.mfaRepo.ConsumeMFAToken(r.Context(), claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		log.Printf("Gagal mencatat pemakaian token MFA user %s: %v", claims.UserID, err)
+		http.Error(w, "Gagal memverifikasi kode", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		http.Error(w, "Token MFA sudah dipakai atau tidak valid", http.StatusUnauthorized)
+		return
+	}
+
+	h.createAndSendToken(w, r, user, true)
+}
+
+// completeLogin is called once the first factor succeeded. Users with TOTP
+// enabled receive an MFA token instead of a session.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Gagal mengambil status MFA user %s: %v", user.ID, err)
+		http.Error(w, "Gagal memproses login", http.StatusInternalServerError)
+		return
+	}
+
+	if !settings.Enabled {
+		h.createAndSendToken(w, r, user, false)
+		return
+	}
+
+	tokenID, err := auth.RandomUUID()
+	if err != nil {
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+	mfaToken, err := h.tokenIssuer.Sign(&domain.MFAClaims{
 		UserID: user.ID,
-		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    h.tokenIssuer.Issuer(),
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{auth.MFAAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+		},
+	})
+	if err != nil {
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(mfaTokenTTL.Seconds()),
+	})
+}
+
+// createAndSendToken starts a new session for the user and sends its tokens.
+func (h *AuthHandler) createAndSendToken(w http.ResponseWriter, r *http.Request, user *domain.User, mfaVerified bool) {
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+
+	session := &domain.Session{
+		UserID:      user.ID,
+		UserAgent:   r.UserAgent(),
+		IPAddress:   h.clientIP(r),
+		MFAVerified: mfaVerified,
+		ExpiresAt:   time.Now().Add(refreshTokenTTL),
+	}
+	session.ID, err = h.sessionRepo.CreateSession(r.Context(), session, auth.HashToken(refreshToken))
+	if err != nil {
+		log.Printf("Gagal membuat sesi: %v", err)
+		http.Error(w, "Gagal membuat sesi", http.StatusInternalServerError)
+		return
+	}
+
+	if mfaVerified {
+		h.recordLoginSuccess(r, user, "mfa")
+	} else {
+		h.recordLoginSuccess(r, user, "")
+	}
+
+	h.sendTokens(w, r, user, session, refreshToken)
+}
+
+// sendTokens signs a short-lived access token bound to the session and writes
+// it together with the refresh token.
+func (h *AuthHandler) sendTokens(w http.ResponseWriter, r *http.Request, user *domain.User, session *domain.Session, refreshToken string) {
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Gagal mengambil status MFA user %s: %v", user.ID, err)
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+
+	expirationTime := time.Now().Add(accessTokenTTL)
+	claims := &domain.Claims{
+		UserID:        user.ID,
+		Role:          user.Role,
+		SessionID:     session.ID,
+		MFA:           session.MFAVerified,
+		MFARequired:   settings.Required,
+		EmailVerified: user.EmailVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    h.tokenIssuer.Issuer(),
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{h.tokenIssuer.Audience()},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(h.jwtKey)
+	role, err := h.roleRepo.GetRole(r.Context(), user.Role)
+	if err != nil {
+		log.Printf("Gagal mengambil izin role %s: %v", user.Role, err)
+		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
+		return
+	}
+	// Izin ditanam di token; perubahan role_permissions berlaku saat token diperbarui.
+	claims.Permissions = role.Permissions
+	if role.ClinicalStaff {
+		claims.VerificationStatus = user.VerificationStatus
+		if user.VerificationStatus != domain.VerificationApproved {
+			claims.Permissions = nil
+		}
+	}
+
+	tokenString, err := h.tokenIssuer.Sign(claims)
 	if err != nil {
 		http.Error(w, "Gagal membuat token", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	json.NewEncoder(w).Encode(map[string]any{
 		"token":          tokenString,
+		"expires_in":     int(accessTokenTTL.Seconds()),
+		"refresh_token":  refreshToken,
 		"role":           user.Role,
 		"name":           user.Name,
 		"specialization": user.Specialization,
+		// Fasilitas mewajibkan MFA tetapi akun belum mendaftarkan TOTP.
+		"mfa_enrollment_required": settings.Required && !settings.Enabled,
+		"email_verified":          user.EmailVerified,
+		"verification_status":     claims.VerificationStatus,
+		"permissions":             claims.Permissions,
 	})
 }
+
+// clientIP returns the originating client address. X-Forwarded-For is only
+// honoured when the request comes from a trusted proxy; the address used is
+// the right-most one not added by a trusted proxy, since anything to its left
+// was supplied by the client and can be forged.
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !h.trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether address belongs to a configured trusted proxy.
+func (h *AuthHandler) trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+type fakeChallengeRepo struct {
+	repository.ChallengeRepository
+	consumed int
+}
+
+func (f *fakeChallengeRepo) ConsumeChallenge(ctx context.Context, challengeID string) (*domain.AuthChallenge, error) {
+	f.consumed++
+	return nil, pgx.ErrNoRows
+}
+
+func TestVerifyChallengeIsBlockedForNoisyIPs(t *testing.T) {
+	challenges := &fakeChallengeRepo{}
+	h := NewAuthHandler(&fakeUserRepo{}, challenges, nil, nil, &fakeLoginRepo{ipFailures: maxIPFailures}, &fakeRoleRepo{}, nil, nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/auth/challenge/verify", strings.NewReader(`{"challenge_id":"c1","signature":"0x00"}`))
+	w := httptest.NewRecorder()
+	h.VerifyChallenge(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	// Challenge tidak boleh ikut terpakai oleh permintaan yang diblokir.
+	if challenges.consumed != 0 {
+		t.Fatal("a blocked request consumed the challenge")
+	}
+}
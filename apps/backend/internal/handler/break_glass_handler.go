@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	// breakGlassDuration is how long emergency read access lasts.
+	breakGlassDuration = 4 * time.Hour
+	// minBreakGlassReasonLength forces a real justification instead of a placeholder.
+	minBreakGlassReasonLength = 20
+)
+
+// BreakGlassHandler handles emergency access to a patient's records without
+// consent, and the admin review that must follow every use.
+type BreakGlassHandler struct {
+	breakGlassRepo repository.BreakGlassRepository
+	userRepo       repository.UserRepository
+	mailer         mail.Mailer
+}
+
+// NewBreakGlassHandler creates a new instance of BreakGlassHandler.
+func NewBreakGlassHandler(breakGlassRepo repository.BreakGlassRepository, userRepo repository.UserRepository, mailer mail.Mailer) *BreakGlassHandler {
+	return &BreakGlassHandler{breakGlassRepo: breakGlassRepo, userRepo: userRepo, mailer: mailer}
+}
+
+// HandleOpen opens a time-boxed break-glass session for a patient. The
+// patient is notified by email and the session enters the admin review queue.
+func (h *BreakGlassHandler) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID dokter dari token", http.StatusInternalServerError)
+		return
+	}
+	patientID := r.PathValue("patient_id")
+
+	var payload domain.BreakGlassPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(payload.Reason)
+	if len(reason) < minBreakGlassReasonLength {
+		http.Error(w, fmt.Sprintf("Alasan akses darurat wajib diisi (minimal %d karakter)", minBreakGlassReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	patient, err := h.userRepo.GetUserByID(r.Context(), patientID)
+	if err != nil || patient.Role != domain.RolePatient {
+		http.Error(w, "Pasien tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	expiresAt := time.Now().Add(breakGlassDuration)
+	sessionID, err := h.breakGlassRepo.CreateSession(r.Context(), doctorID, patientID, reason, expiresAt)
+	if err != nil {
+		log.Printf("Gagal membuka akses darurat dokter %s ke pasien %s: %v", doctorID, patientID, err)
+		http.Error(w, "Gagal membuka akses darurat", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[BREAK-GLASS] Dokter %s membuka akses darurat ke pasien %s (sesi %s, berakhir %s): %s",
+		doctorID, patientID, sessionID, expiresAt.Format(time.RFC3339), reason)
+
+	doctorName := doctorID
+	if doctor, err := h.userRepo.GetUserByID(r.Context(), doctorID); err == nil {
+		doctorName = doctor.Name
+	}
+	if err := h.mailer.Send(r.Context(), breakGlassEmail(patient, doctorName, reason, expiresAt)); err != nil {
+		log.Printf("Gagal mengirim notifikasi akses darurat ke pasien %s: %v", patientID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":    "Akses darurat dibuka. Penggunaan ini akan ditinjau admin.",
+		"session_id": sessionID,
+		"expires_at": expiresAt,
+	})
+}
+
+// HandleListForReview lists break-glass sessions by review status (default: pending).
+func (h *BreakGlassHandler) HandleListForReview(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = domain.BreakGlassReviewPending
+	}
+	if status != domain.BreakGlassReviewPending && status != domain.BreakGlassReviewConfirmed && status != domain.BreakGlassReviewMisuse {
+		http.Error(w, "Status tidak valid: pilih 'pending', 'confirmed' atau 'misuse'", http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := h.breakGlassRepo.GetSessionsByReviewStatus(r.Context(), status)
+	if err != nil {
+		log.Printf("Gagal mengambil sesi akses darurat (%s): %v", status, err)
+		http.Error(w, "Gagal mengambil daftar akses darurat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// HandleListAccesses lists what the doctor read under a break-glass session, for the admin review.
+func (h *BreakGlassHandler) HandleListAccesses(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("session_id")
+
+	accesses, err := h.breakGlassRepo.GetSessionAccesses(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("Gagal mengambil riwayat akses sesi darurat %s: %v", sessionID, err)
+		http.Error(w, "Gagal mengambil riwayat akses darurat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accesses)
+}
+
+// HandleConfirm confirms that a break-glass use was justified.
+func (h *BreakGlassHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, domain.BreakGlassReviewConfirmed)
+}
+
+// HandleFlagMisuse flags a break-glass use as misuse and ends it if still running.
+func (h *BreakGlassHandler) HandleFlagMisuse(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, domain.BreakGlassReviewMisuse)
+}
+
+func (h *BreakGlassHandler) review(w http.ResponseWriter, r *http.Request, status string) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID admin dari token", http.StatusInternalServerError)
+		return
+	}
+	sessionID := r.PathValue("session_id")
+
+	var payload domain.BreakGlassReviewPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if status == domain.BreakGlassReviewMisuse && strings.TrimSpace(payload.Note) == "" {
+		http.Error(w, "Catatan (note) wajib diisi untuk penyalahgunaan", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.breakGlassRepo.ReviewSession(r.Context(), sessionID, status, payload.Note, adminID)
+	if err != nil {
+		log.Printf("Gagal meninjau sesi akses darurat %s: %v", sessionID, err)
+		http.Error(w, "Gagal menyimpan hasil tinjauan", http.StatusInternalServerError)
+		return
+	}
+	if updated == 0 {
+		http.Error(w, "Sesi tidak ditemukan atau sudah ditinjau", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[BREAK-GLASS] Admin %s menandai sesi %s sebagai %s", adminID, sessionID, status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":       "Tinjauan akses darurat tersimpan",
+		"review_status": status,
+	})
+}
+
+// breakGlassEmail builds the notification sent to a patient whose records were opened in an emergency.
+func breakGlassEmail(patient *domain.User, doctorName, reason string, expiresAt time.Time) mail.Message {
+	return mail.Message{
+		To:      patient.Email,
+		Subject: "Akses darurat ke rekam medis Anda",
+		Body: fmt.Sprintf("Halo %s,\n\n%s membuka akses darurat ke rekam medis Anda tanpa persetujuan, dengan alasan:\n%s\n\n"+
+			"Akses ini berlaku sampai %s dan akan ditinjau oleh admin. Riwayatnya dapat Anda lihat di log akses.",
+			patient.Name, doctorName, reason, expiresAt.Format("02 Jan 2006 15:04 MST")),
+	}
+}
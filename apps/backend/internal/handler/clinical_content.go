@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// icd10Pattern matches an ICD-10 code such as "J45" or "E11.9".
+var icd10Pattern = regexp.MustCompile(`^[A-Z][0-9]{2}(\.[0-9A-Z]{1,4})?$`)
+
+// bloodPressurePattern matches "systolic/diastolic", e.g. "120/80".
+var bloodPressurePattern = regexp.MustCompile(`^([0-9]{2,3})/([0-9]{2,3})$`)
+
+// vitalRanges are the plausible bounds of each numeric vital sign; values
+// outside them are almost certainly typing errors.
+var vitalRanges = map[string][2]float64{
+	domain.VitalHeartRate:        {20, 300},
+	domain.VitalRespiratoryRate:  {4, 80},
+	domain.VitalTemperature:      {30, 45},
+	domain.VitalOxygenSaturation: {50, 100},
+	domain.VitalWeight:           {0.3, 500},
+	domain.VitalHeight:           {20, 280},
+}
+
+// validateClinicalContent checks the structured entries of a record and
+// normalises them in place (codes upper-cased, default units filled in,
+// timestamps truncated to seconds so the record hash can be recomputed).
+func validateClinicalContent(w http.ResponseWriter, c *domain.ClinicalContent) bool {
+	now := time.Now()
+
+	for i := range c.Vitals {
+		v := &c.Vitals[i]
+		v.Type = strings.TrimSpace(v.Type)
+		unit, ok := domain.VitalUnits[v.Type]
+		if !ok {
+			http.Error(w, fmt.Sprintf("vitals[%d]: jenis tanda vital '%s' tidak dikenal", i, v.Type), http.StatusBadRequest)
+			return false
+		}
+		if v.Unit = strings.TrimSpace(v.Unit); v.Unit == "" {
+			v.Unit = unit
+		} else if v.Unit != unit {
+			http.Error(w, fmt.Sprintf("vitals[%d]: %s harus dicatat dalam satuan %s", i, v.Type, unit), http.StatusBadRequest)
+			return false
+		}
+		value, ok := normalizeVitalValue(v.Type, strings.TrimSpace(v.Value))
+		if !ok {
+			http.Error(w, fmt.Sprintf("vitals[%d]: nilai %s tidak valid atau di luar rentang wajar", i, v.Type), http.StatusBadRequest)
+			return false
+		}
+		v.Value = value
+		if !normalizePastTime(v.MeasuredAt, now) {
+			http.Error(w, fmt.Sprintf("vitals[%d]: measured_at tidak boleh di masa depan", i), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	primaries := 0
+	seenCodes := make(map[string]bool, len(c.Diagnoses))
+	for i := range c.Diagnoses {
+		d := &c.Diagnoses[i]
+		d.Code = strings.ToUpper(strings.TrimSpace(d.Code))
+		d.Description = strings.TrimSpace(d.Description)
+		if !icd10Pattern.MatchString(d.Code) {
+			http.Error(w, fmt.Sprintf("diagnoses[%d]: kode ICD-10 '%s' tidak valid", i, d.Code), http.StatusBadRequest)
+			return false
+		}
+		if seenCodes[d.Code] {
+			http.Error(w, fmt.Sprintf("diagnoses[%d]: kode %s tercantum lebih dari sekali", i, d.Code), http.StatusBadRequest)
+			return false
+		}
+		seenCodes[d.Code] = true
+		if d.Primary {
+			primaries++
+		}
+	}
+	// Satu-satunya diagnosis otomatis menjadi diagnosis utama.
+	if len(c.Diagnoses) == 1 {
+		c.Diagnoses[0].Primary = true
+		primaries = 1
+	}
+	if len(c.Diagnoses) > 0 && primaries != 1 {
+		http.Error(w, "Tepat satu diagnosis harus ditandai sebagai diagnosis utama (primary)", http.StatusBadRequest)
+		return false
+	}
+
+	for i := range c.Medications {
+		m := &c.Medications[i]
+		m.Name, m.Dose, m.Frequency = strings.TrimSpace(m.Name), strings.TrimSpace(m.Dose), strings.TrimSpace(m.Frequency)
+		m.Duration = strings.TrimSpace(m.Duration)
+		m.Route = strings.ToLower(strings.TrimSpace(m.Route))
+		if m.Name == "" || m.Dose == "" || m.Frequency == "" {
+			http.Error(w, fmt.Sprintf("medications[%d]: name, dose dan frequency wajib diisi", i), http.StatusBadRequest)
+			return false
+		}
+		if !slices.Contains(domain.MedicationRoutes, m.Route) {
+			http.Error(w, fmt.Sprintf("medications[%d]: rute '%s' tidak valid, pilih salah satu dari %s", i, m.Route, strings.Join(domain.MedicationRoutes, ", ")), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	for i := range c.Allergies {
+		a := &c.Allergies[i]
+		a.Substance, a.Reaction = strings.TrimSpace(a.Substance), strings.TrimSpace(a.Reaction)
+		a.Severity = strings.ToLower(strings.TrimSpace(a.Severity))
+		if a.Substance == "" {
+			http.Error(w, fmt.Sprintf("allergies[%d]: substance wajib diisi", i), http.StatusBadRequest)
+			return false
+		}
+		if a.Severity != domain.AllergyMild && a.Severity != domain.AllergyModerate && a.Severity != domain.AllergySevere {
+			http.Error(w, fmt.Sprintf("allergies[%d]: severity harus 'mild', 'moderate' atau 'severe'", i), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	for i := range c.Procedures {
+		p := &c.Procedures[i]
+		p.Name, p.Code, p.Notes = strings.TrimSpace(p.Name), strings.ToUpper(strings.TrimSpace(p.Code)), strings.TrimSpace(p.Notes)
+		if p.Name == "" {
+			http.Error(w, fmt.Sprintf("procedures[%d]: name wajib diisi", i), http.StatusBadRequest)
+			return false
+		}
+		if !normalizePastTime(p.PerformedAt, now) {
+			http.Error(w, fmt.Sprintf("procedures[%d]: performed_at tidak boleh di masa depan", i), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// checkDiagnosisCodes looks the diagnosis codes up in the ICD-10 catalog and
+// fills in the Indonesian name when no description was given. The bundled
+// catalog is only a subset of ICD-10, so a well-formed code outside it is
+// accepted and flagged as uncatalogued; it then needs a description.
+func (h *RecordHandler) checkDiagnosisCodes(w http.ResponseWriter, r *http.Request, c *domain.ClinicalContent) bool {
+	if len(c.Diagnoses) == 0 {
+		return true
+	}
+	codes := make([]string, len(c.Diagnoses))
+	for i, d := range c.Diagnoses {
+		codes[i] = d.Code
+	}
+
+	catalog, err := h.terminologyRepo.GetICD10Codes(r.Context(), codes)
+	if err != nil {
+		log.Printf("Gagal memeriksa kode ICD-10: %v", err)
+		http.Error(w, "Gagal memeriksa kode diagnosis", http.StatusInternalServerError)
+		return false
+	}
+	for i := range c.Diagnoses {
+		entry, ok := catalog[c.Diagnoses[i].Code]
+		if !ok {
+			if c.Diagnoses[i].Description == "" {
+				http.Error(w, fmt.Sprintf("diagnoses[%d]: kode %s tidak terdapat dalam katalog ICD-10, description wajib diisi", i, c.Diagnoses[i].Code), http.StatusBadRequest)
+				return false
+			}
+			c.Diagnoses[i].Uncatalogued = true
+			continue
+		}
+		if c.Diagnoses[i].Description == "" {
+			c.Diagnoses[i].Description = entry.NameID
+		}
+	}
+	return true
+}
+
+// normalizeVitalValue parses a vital sign value and returns it in canonical form.
+func normalizeVitalValue(vitalType, value string) (string, bool) {
+	if vitalType == domain.VitalBloodPressure {
+		m := bloodPressurePattern.FindStringSubmatch(value)
+		if m == nil {
+			return "", false
+		}
+		systolic, _ := strconv.Atoi(m[1])
+		diastolic, _ := strconv.Atoi(m[2])
+		if systolic < 40 || systolic > 300 || diastolic < 20 || diastolic >= systolic {
+			return "", false
+		}
+		return fmt.Sprintf("%d/%d", systolic, diastolic), true
+	}
+
+	number, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	bounds := vitalRanges[vitalType]
+	if err != nil || number < bounds[0] || number > bounds[1] {
+		return "", false
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64), true
+}
+
+// normalizePastTime truncates t to seconds in UTC and rejects times in the
+// future, allowing a few minutes of clock skew. A nil t is accepted.
+func normalizePastTime(t *time.Time, now time.Time) bool {
+	if t == nil {
+		return true
+	}
+	*t = t.UTC().Truncate(time.Second)
+	return !t.After(now.Add(5 * time.Minute))
+}
+
+// encryptClinicalContent encrypts the free-text and code fields of c in place.
+// Enumerated fields (types, units, routes, severities) stay readable, and each
+// diagnosis code gets a blind index so records can be filtered by it.
+func encryptClinicalContent(c *domain.ClinicalContent, key, blindIndexKey []byte) error {
+	for i := range c.Diagnoses {
+		c.Diagnoses[i].CodeIndex = crypto.BlindIndex(c.Diagnoses[i].Code, blindIndexKey)
+	}
+
+	var fields []*string
+	for i := range c.Vitals {
+		fields = append(fields, &c.Vitals[i].Value)
+	}
+	for i := range c.Diagnoses {
+		fields = append(fields, &c.Diagnoses[i].Code, &c.Diagnoses[i].Description)
+	}
+	for i := range c.Medications {
+		m := &c.Medications[i]
+		fields = append(fields, &m.Name, &m.Dose, &m.Frequency, &m.Duration)
+	}
+	for i := range c.Allergies {
+		fields = append(fields, &c.Allergies[i].Substance, &c.Allergies[i].Reaction)
+	}
+	for i := range c.Procedures {
+		fields = append(fields, &c.Procedures[i].Name, &c.Procedures[i].Code, &c.Procedures[i].Notes)
+	}
+
+	for _, field := range fields {
+		encrypted, err := crypto.Encrypt(*field, key)
+		if err != nil {
+			return err
+		}
+		*field = encrypted
+	}
+	return nil
+}
+
+// decryptClinicalContent reverses encryptClinicalContent, marking fields that
+// cannot be decrypted.
+func (h *RecordHandler) decryptClinicalContent(c *domain.ClinicalContent) {
+	for i := range c.Vitals {
+		c.Vitals[i].Value = h.decryptOrMark(c.Vitals[i].Value)
+	}
+	for i := range c.Diagnoses {
+		c.Diagnoses[i].Code = h.decryptOrMark(c.Diagnoses[i].Code)
+		c.Diagnoses[i].Description = h.decryptOrMark(c.Diagnoses[i].Description)
+	}
+	for i := range c.Medications {
+		m := &c.Medications[i]
+		m.Name, m.Dose, m.Frequency, m.Duration = h.decryptOrMark(m.Name), h.decryptOrMark(m.Dose), h.decryptOrMark(m.Frequency), h.decryptOrMark(m.Duration)
+	}
+	for i := range c.Allergies {
+		c.Allergies[i].Substance = h.decryptOrMark(c.Allergies[i].Substance)
+		c.Allergies[i].Reaction = h.decryptOrMark(c.Allergies[i].Reaction)
+	}
+	for i := range c.Procedures {
+		p := &c.Procedures[i]
+		p.Name, p.Code, p.Notes = h.decryptOrMark(p.Name), h.decryptOrMark(p.Code), h.decryptOrMark(p.Notes)
+	}
+}
+
+// clinicalHashInput serialises the stored (encrypted) clinical content in a
+// fixed order for the record hash.
+func clinicalHashInput(c domain.ClinicalContent) string {
+	var b strings.Builder
+	for _, v := range c.Vitals {
+		fmt.Fprintf(&b, "|vital|%s|%s|%s|%s", v.Type, v.Value, v.Unit, hashTime(v.MeasuredAt))
+	}
+	for _, d := range c.Diagnoses {
+		fmt.Fprintf(&b, "|diagnosis|%s|%s|%t", d.Code, d.Description, d.Primary)
+	}
+	for _, m := range c.Medications {
+		fmt.Fprintf(&b, "|medication|%s|%s|%s|%s|%s", m.Name, m.Dose, m.Route, m.Frequency, m.Duration)
+	}
+	for _, a := range c.Allergies {
+		fmt.Fprintf(&b, "|allergy|%s|%s|%s", a.Substance, a.Reaction, a.Severity)
+	}
+	for _, p := range c.Procedures {
+		fmt.Fprintf(&b, "|procedure|%s|%s|%s|%s", p.Name, p.Code, p.Notes, hashTime(p.PerformedAt))
+	}
+	return b.String()
+}
+
+func hashTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -2,22 +2,35 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/trifur/rekamedchain/backend/internal/auth"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
 	"github.com/trifur/rekamedchain/backend/internal/middleware"
 	"github.com/trifur/rekamedchain/backend/internal/repository"
 )
 
-// ConsentHandler handles consent-related HTTP requests.
+// Client-chosen nonces must be long enough to be unique and fit the nonce column.
+const (
+	minConsentNonceLength = 16
+	maxConsentNonceLength = 128
+)
+
+// ConsentHandler handles consent-related HTTP requests. Grant, deny and revoke
+// must be signed by the patient's key; the signatures are kept so each
+// decision can be verified again later.
 type ConsentHandler struct {
 	consentRepo repository.ConsentRepository
+	keyRepo     repository.KeyRepository
 }
 
 // NewConsentHandler creates a new instance of ConsentHandler.
-func NewConsentHandler(consentRepo repository.ConsentRepository) *ConsentHandler {
-	return &ConsentHandler{consentRepo: consentRepo}
+func NewConsentHandler(consentRepo repository.ConsentRepository, keyRepo repository.KeyRepository) *ConsentHandler {
+	return &ConsentHandler{consentRepo: consentRepo, keyRepo: keyRepo}
 }
 
 // HandleRequest handles a doctor's request for consent.
@@ -34,7 +47,15 @@ func (h *ConsentHandler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestID, err := h.consentRepo.CreateRequest(r.Context(), doctorID, payload.PatientID)
+	// Cakupan yang diminta hanya usulan; yang berlaku adalah cakupan yang ditandatangani pasien.
+	if payload.DataScope != "" {
+		if _, err := parseSubmittedScope(payload.DataScope); err != nil {
+			http.Error(w, "data_scope tidak valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	requestID, err := h.consentRepo.CreateRequest(r.Context(), doctorID, payload.PatientID, payload.DataScope)
 	if err != nil {
 		log.Printf("Gagal membuat permintaan consent: %v", err)
 		http.Error(w, "Gagal membuat permintaan", http.StatusInternalServerError)
@@ -49,6 +70,16 @@ func (h *ConsentHandler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// parseSubmittedScope validates a data_scope sent by a client. New scopes
+// must be JSON objects, so write access is always asked for and granted
+// explicitly; free labels only survive in grants signed before scopes existed.
+func parseSubmittedScope(raw string) (domain.ConsentScope, error) {
+	if !strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		return domain.ConsentScope{}, errors.New(`harus berupa objek JSON, misalnya {"all":true}`)
+	}
+	return domain.ParseConsentScope(raw)
+}
+
 // HandleGetMyRequests handles fetching consent requests for the logged-in patient.
 func (h *ConsentHandler) HandleGetMyRequests(w http.ResponseWriter, r *http.Request) {
 	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
@@ -67,6 +98,63 @@ func (h *ConsentHandler) HandleGetMyRequests(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(requests)
 }
 
+// HandleGetMessage returns the canonical message the patient must sign for an
+// action on a consent request, with a fresh nonce. For a "24h" grant the
+// expiry is fixed here so the client signs exactly what will be stored.
+func (h *ConsentHandler) HandleGetMessage(w http.ResponseWriter, r *http.Request) {
+	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pasien dari token", http.StatusInternalServerError)
+		return
+	}
+
+	req, ok := h.ownRequest(w, r, patientID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	action := query.Get("action")
+	var scope string
+	var expiresAt *time.Time
+	switch action {
+	case domain.ConsentActionGrant:
+		scope = query.Get("data_scope")
+		if scope == "" {
+			http.Error(w, "data_scope dibutuhkan untuk menyetujui permintaan", http.StatusBadRequest)
+			return
+		}
+		if _, err := parseSubmittedScope(scope); err != nil {
+			http.Error(w, "data_scope tidak valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if query.Get("duration") == "24h" {
+			t := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+			expiresAt = &t
+		}
+	case domain.ConsentActionDeny:
+	case domain.ConsentActionRevoke:
+		scope, expiresAt = req.DataScope, req.ExpiresAt
+	default:
+		http.Error(w, "Action tidak valid: pilih 'grant', 'deny' atau 'revoke'", http.StatusBadRequest)
+		return
+	}
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		http.Error(w, "Gagal membuat nonce", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":    auth.ConsentMessage(action, req.ID, req.PatientID, req.DoctorID, scope, expiresAt, nonce),
+		"nonce":      nonce,
+		"data_scope": scope,
+		"expires_at": expiresAt,
+	})
+}
+
 // HandleGrant handles a patient granting a consent request.
 // This corresponds to the endpoint the mobile app calls `/consent/sign/:request_id`
 // and the web app calls `/consent/grant/:request_id`.
@@ -77,23 +165,51 @@ func (h *ConsentHandler) HandleGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestID := r.PathValue("request_id")
-
 	// Decode payload dari body
 	var payload domain.GrantConsentPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Request body tidak valid (membutuhkan duration dan data_scope)", http.StatusBadRequest)
+		http.Error(w, "Request body tidak valid (membutuhkan duration, data_scope, nonce dan signature)", http.StatusBadRequest)
+		return
+	}
+	if payload.DataScope == "" {
+		http.Error(w, "data_scope dibutuhkan", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseSubmittedScope(payload.DataScope); err != nil {
+		http.Error(w, "data_scope tidak valid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Masa berlaku ikut ditandatangani, jadi server tidak lagi menghitungnya sendiri.
+	if payload.Duration == "permanent" && payload.ExpiresAt != nil {
+		http.Error(w, "Izin permanen tidak boleh memiliki expires_at", http.StatusBadRequest)
+		return
+	}
+	if payload.Duration != "permanent" && payload.ExpiresAt == nil {
+		http.Error(w, "expires_at dibutuhkan untuk izin berjangka", http.StatusBadRequest)
 		return
 	}
+	if payload.ExpiresAt != nil {
+		t := payload.ExpiresAt.UTC().Truncate(time.Second)
+		if !t.After(time.Now()) {
+			http.Error(w, "expires_at harus di masa depan", http.StatusBadRequest)
+			return
+		}
+		payload.ExpiresAt = &t
+	}
 
-	if requestID == "" {
-		http.Error(w, "Request ID dibutuhkan", http.StatusBadRequest)
+	req, ok := h.ownRequest(w, r, patientID)
+	if !ok {
 		return
 	}
 
-	rowsAffected, err := h.consentRepo.GrantConsent(r.Context(), requestID, patientID, payload.Duration, payload.DataScope)
-	if err != nil || rowsAffected == 0 {
-		http.Error(w, "Gagal menyetujui permintaan atau permintaan tidak ditemukan/ sudah diproses", http.StatusNotFound)
+	signed := domain.SignedConsentPayload{Nonce: payload.Nonce, Signature: payload.Signature}
+	sig, ok := h.verifyConsentSignature(w, r, req, domain.ConsentActionGrant, payload.DataScope, payload.ExpiresAt, signed)
+	if !ok {
+		return
+	}
+
+	rowsAffected, err := h.consentRepo.GrantConsent(r.Context(), req.ID, patientID, payload.Duration, payload.DataScope, payload.ExpiresAt, *sig)
+	if !consentUpdated(w, rowsAffected, err, "Gagal menyetujui permintaan atau permintaan tidak ditemukan/ sudah diproses") {
 		return
 	}
 
@@ -110,16 +226,25 @@ func (h *ConsentHandler) HandleDeny(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Gagal mendapatkan ID pasien dari token", http.StatusInternalServerError)
 		return
 	}
-	requestID := r.PathValue("request_id")
 
-	if requestID == "" {
-		http.Error(w, "Request ID dibutuhkan", http.StatusBadRequest)
+	var payload domain.SignedConsentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid (membutuhkan nonce dan signature)", http.StatusBadRequest)
 		return
 	}
 
-	rowsAffected, err := h.consentRepo.DenyConsent(r.Context(), requestID, patientID)
-	if err != nil || rowsAffected == 0 {
-		http.Error(w, "Gagal menolak permintaan atau permintaan tidak ditemukan/sudah diproses", http.StatusNotFound)
+	req, ok := h.ownRequest(w, r, patientID)
+	if !ok {
+		return
+	}
+
+	sig, ok := h.verifyConsentSignature(w, r, req, domain.ConsentActionDeny, "", nil, payload)
+	if !ok {
+		return
+	}
+
+	rowsAffected, err := h.consentRepo.DenyConsent(r.Context(), req.ID, patientID, *sig)
+	if !consentUpdated(w, rowsAffected, err, "Gagal menolak permintaan atau permintaan tidak ditemukan/sudah diproses") {
 		return
 	}
 
@@ -130,22 +255,32 @@ func (h *ConsentHandler) HandleDeny(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleRevoke handles a patient revoking a previously granted consent.
+// The signed message repeats the scope and expiry of the grant being revoked.
 func (h *ConsentHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
 	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok {
 		http.Error(w, "Gagal mendapatkan ID pasien dari token", http.StatusInternalServerError)
 		return
 	}
-	requestID := r.PathValue("request_id")
 
-	if requestID == "" {
-		http.Error(w, "Request ID dibutuhkan", http.StatusBadRequest)
+	var payload domain.SignedConsentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid (membutuhkan nonce dan signature)", http.StatusBadRequest)
+		return
+	}
+
+	req, ok := h.ownRequest(w, r, patientID)
+	if !ok {
+		return
+	}
+
+	sig, ok := h.verifyConsentSignature(w, r, req, domain.ConsentActionRevoke, req.DataScope, req.ExpiresAt, payload)
+	if !ok {
 		return
 	}
 
-	rowsAffected, err := h.consentRepo.RevokeConsent(r.Context(), requestID, patientID)
-	if err != nil || rowsAffected == 0 {
-		http.Error(w, "Gagal mencabut izin atau izin tidak ditemukan/bukan 'granted'", http.StatusNotFound)
+	rowsAffected, err := h.consentRepo.RevokeConsent(r.Context(), req.ID, patientID, *sig)
+	if !consentUpdated(w, rowsAffected, err, "Gagal mencabut izin atau izin tidak ditemukan/bukan 'granted'") {
 		return
 	}
 
@@ -154,3 +289,112 @@ func (h *ConsentHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
 		"message": "Izin akses berhasil dicabut",
 	})
 }
+
+// HandleGetSignatures returns the stored signatures of a consent request to the
+// patient or the requesting doctor, each re-verified against the key that was
+// active for its signer when it was made.
+func (h *ConsentHandler) HandleGetSignatures(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	req, err := h.consentRepo.GetRequestByID(r.Context(), r.PathValue("request_id"))
+	if err != nil || (req.PatientID != userID && req.DoctorID != userID) {
+		http.Error(w, "Permintaan tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	signatures, err := h.consentRepo.GetSignatures(r.Context(), req.ID)
+	if err != nil {
+		log.Printf("Gagal mengambil tanda tangan consent %s: %v", req.ID, err)
+		http.Error(w, "Gagal mengambil tanda tangan", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range signatures {
+		sig := &signatures[i]
+		activeKey, err := h.keyRepo.GetPublicKeyAt(r.Context(), sig.SignerID, sig.CreatedAt)
+		if err != nil || !strings.EqualFold(activeKey, sig.PublicKey) {
+			continue
+		}
+		sig.Valid, _ = auth.VerifySignature(sig.PublicKey, sig.Message, sig.Signature)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signatures)
+}
+
+// ownRequest loads the consent request from the path and checks that it
+// belongs to the patient, writing a 404 otherwise.
+func (h *ConsentHandler) ownRequest(w http.ResponseWriter, r *http.Request, patientID string) (*domain.ConsentRequest, bool) {
+	requestID := r.PathValue("request_id")
+	if requestID == "" {
+		http.Error(w, "Request ID dibutuhkan", http.StatusBadRequest)
+		return nil, false
+	}
+
+	req, err := h.consentRepo.GetRequestByID(r.Context(), requestID)
+	if err != nil || req.PatientID != patientID {
+		http.Error(w, "Permintaan tidak ditemukan", http.StatusNotFound)
+		return nil, false
+	}
+	return req, true
+}
+
+// verifyConsentSignature rebuilds the canonical message for the action and
+// checks the signer's signature over it with their currently active key. The
+// signer is the patient, or the guardian when acting on their behalf.
+func (h *ConsentHandler) verifyConsentSignature(w http.ResponseWriter, r *http.Request, req *domain.ConsentRequest, action, scope string, expiresAt *time.Time, payload domain.SignedConsentPayload) (*domain.ConsentSignature, bool) {
+	if len(payload.Nonce) < minConsentNonceLength || len(payload.Nonce) > maxConsentNonceLength || payload.Signature == "" {
+		http.Error(w, "nonce (16-128 karakter) dan signature dibutuhkan", http.StatusBadRequest)
+		return nil, false
+	}
+
+	signerID := req.PatientID
+	if actorID, ok := r.Context().Value(middleware.ActorIDKey).(string); ok {
+		signerID = actorID
+	}
+
+	publicKey, err := h.keyRepo.GetPublicKeyAt(r.Context(), signerID, time.Now())
+	if err != nil {
+		http.Error(w, "Kunci publik penanda tangan tidak ditemukan", http.StatusBadRequest)
+		return nil, false
+	}
+
+	message := auth.ConsentMessage(action, req.ID, req.PatientID, req.DoctorID, scope, expiresAt, payload.Nonce)
+	valid, err := auth.VerifySignature(publicKey, message, payload.Signature)
+	if err != nil || !valid {
+		http.Error(w, "Tanda tangan tidak valid", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return &domain.ConsentSignature{
+		ConsentRequestID: req.ID,
+		Action:           action,
+		SignerID:         signerID,
+		Message:          message,
+		Signature:        payload.Signature,
+		PublicKey:        publicKey,
+		Nonce:            payload.Nonce,
+	}, true
+}
+
+// consentUpdated maps the result of a signed status change to an HTTP error.
+func consentUpdated(w http.ResponseWriter, rowsAffected int64, err error, notFoundMsg string) bool {
+	if errors.Is(err, repository.ErrNonceReused) {
+		http.Error(w, "Nonce sudah pernah digunakan", http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		log.Printf("Gagal memperbarui status consent: %v", err)
+		http.Error(w, notFoundMsg, http.StatusNotFound)
+		return false
+	}
+	if rowsAffected == 0 {
+		http.Error(w, notFoundMsg, http.StatusNotFound)
+		return false
+	}
+	return true
+}
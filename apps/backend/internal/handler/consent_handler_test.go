@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	testRequestID = "7d1f7c1e-2b4a-4f7e-9a55-0c6f3f1d2e01"
+	testPatientID = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c11"
+	testDoctorID  = "5e2d9a47-1c3b-4b8e-a0d6-7f4c2e9b1a22"
+	testNonce     = "0123456789abcdef0123456789abcdef"
+)
+
+type fakeConsentRepo struct {
+	repository.ConsentRepository
+	request    domain.ConsentRequest
+	signatures []domain.ConsentSignature
+	granted    *domain.ConsentSignature
+	grantScope string
+}
+
+func (f *fakeConsentRepo) GetRequestByID(ctx context.Context, requestID string) (*domain.ConsentRequest, error) {
+	req := f.request
+	return &req, nil
+}
+
+func (f *fakeConsentRepo) GrantConsent(ctx context.Context, requestID, patientID, duration, dataScope string, expiresAt *time.Time, sig domain.ConsentSignature) (int64, error) {
+	f.granted, f.grantScope = &sig, dataScope
+	return 1, nil
+}
+
+func (f *fakeConsentRepo) DenyConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error) {
+	f.granted = &sig
+	return 1, nil
+}
+
+func (f *fakeConsentRepo) RevokeConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error) {
+	f.granted = &sig
+	return 1, nil
+}
+
+func (f *fakeConsentRepo) GetSignatures(ctx context.Context, requestID string) ([]domain.ConsentSignature, error) {
+	return f.signatures, nil
+}
+
+func (f *fakeConsentRepo) GetRequestsByPatientID(ctx context.Context, patientID string) ([]domain.ConsentRequest, error) {
+	return []domain.ConsentRequest{f.request}, nil
+}
+
+type fakeKeyRepo struct {
+	repository.KeyRepository
+	publicKey string
+}
+
+func (f *fakeKeyRepo) GetPublicKeyAt(ctx context.Context, userID string, at time.Time) (string, error) {
+	return f.publicKey, nil
+}
+
+// walletSign signs message the way the mobile wallet does (EIP-191, v = 27/28).
+func walletSign(t *testing.T, key *ecdsa.PrivateKey, message string) string {
+	t.Helper()
+	sig, err := ethcrypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[ethcrypto.RecoveryIDOffset] += 27
+	return "0x" + hex.EncodeToString(sig)
+}
+
+func newConsentTest(t *testing.T) (*ConsentHandler, *fakeConsentRepo, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := auth.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	consents := &fakeConsentRepo{request: domain.ConsentRequest{ID: testRequestID, PatientID: testPatientID, DoctorID: testDoctorID, Status: "pending"}}
+	return NewConsentHandler(consents, &fakeKeyRepo{publicKey: auth.PublicKeyToHex(key)}), consents, key
+}
+
+func consentRequest(method, body string) *http.Request {
+	r := httptest.NewRequest(method, "/consent/"+testRequestID, strings.NewReader(body))
+	r.SetPathValue("request_id", testRequestID)
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, testPatientID))
+}
+
+func TestConsentMessageIsCanonical(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 19, 8, 30, 0, 0, time.FixedZone("WIB", 7*3600))
+	got := auth.ConsentMessage(domain.ConsentActionGrant, testRequestID, testPatientID, testDoctorID, `{"all":true}`, &expiresAt, testNonce)
+	// Harus sama persis dengan buildConsentMessage di aplikasi mobile.
+	want := "RekamedChain consent\n" +
+		"action: grant\n" +
+		"request_id: " + testRequestID + "\n" +
+		"patient_id: " + testPatientID + "\n" +
+		"doctor_id: " + testDoctorID + "\n" +
+		`scope: {"all":true}` + "\n" +
+		"expires_at: 2026-10-19T01:30:00Z\n" +
+		"nonce: " + testNonce
+	if got != want {
+		t.Fatalf("message mismatch:\n%s\nwant:\n%s", got, want)
+	}
+
+	if !strings.Contains(auth.ConsentMessage(domain.ConsentActionDeny, testRequestID, testPatientID, testDoctorID, "", nil, testNonce), "expires_at: never") {
+		t.Fatal("a message without expiry must say never")
+	}
+}
+
+func TestListedRequestRebuildsTheServerMessage(t *testing.T) {
+	h, consents, _ := newConsentTest(t)
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	consents.request.Status, consents.request.DataScope, consents.request.ExpiresAt = "granted", `{"all":true}`, &expiresAt
+
+	w := httptest.NewRecorder()
+	h.HandleGetMyRequests(w, consentRequest(http.MethodGet, ""))
+	// Didekode tanpa tipe Go agar field yang hilang dari JSON tidak tertutupi nilai kosong.
+	var listed []struct {
+		ID        string     `json:"id"`
+		PatientID string     `json:"patient_id"`
+		DoctorID  *string    `json:"doctor_id"`
+		DataScope string     `json:"data_scope"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil || len(listed) != 1 {
+		t.Fatalf("listing: %v, %d items", err, len(listed))
+	}
+	item := listed[0]
+	if item.DoctorID == nil {
+		t.Fatal("listed requests must include doctor_id, which the wallet signs")
+	}
+
+	r := consentRequest(http.MethodGet, "")
+	r.URL.RawQuery = "action=" + domain.ConsentActionRevoke
+	w = httptest.NewRecorder()
+	h.HandleGetMessage(w, r)
+	var prepared struct {
+		Message   string     `json:"message"`
+		Nonce     string     `json:"nonce"`
+		DataScope string     `json:"data_scope"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&prepared); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sama seperti signConsentAction di aplikasi mobile: pesan dibangun ulang dari data daftar permintaan.
+	rebuilt := auth.ConsentMessage(domain.ConsentActionRevoke, item.ID, item.PatientID, *item.DoctorID, prepared.DataScope, prepared.ExpiresAt, prepared.Nonce)
+	if rebuilt != prepared.Message {
+		t.Fatalf("message rebuilt from the listing differs from the server's:\n%s\nwant:\n%s", rebuilt, prepared.Message)
+	}
+}
+
+func TestGrantVerifiesSignatureOverCanonicalMessage(t *testing.T) {
+	scope := `{"categories":["vitals"]}`
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	message := auth.ConsentMessage(domain.ConsentActionGrant, testRequestID, testPatientID, testDoctorID, scope, &expiresAt, testNonce)
+
+	grantBody := func(signedScope string, signature string) string {
+		body, _ := json.Marshal(map[string]any{
+			"duration":   "24h",
+			"data_scope": signedScope,
+			"expires_at": expiresAt,
+			"nonce":      testNonce,
+			"signature":  signature,
+		})
+		return string(body)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		h, consents, key := newConsentTest(t)
+		w := httptest.NewRecorder()
+		h.HandleGrant(w, consentRequest(http.MethodPost, grantBody(scope, walletSign(t, key, message))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if consents.granted == nil || consents.granted.Message != message || consents.grantScope != scope {
+			t.Fatalf("grant not stored with the signed message and scope: %+v", consents.granted)
+		}
+	})
+
+	t.Run("scope differs from the signed one", func(t *testing.T) {
+		h, consents, key := newConsentTest(t)
+		w := httptest.NewRecorder()
+		h.HandleGrant(w, consentRequest(http.MethodPost, grantBody(`{"all":true}`, walletSign(t, key, message))))
+		if w.Code != http.StatusUnauthorized || consents.granted != nil {
+			t.Fatalf("status = %d, want 401 and nothing stored", w.Code)
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		h, consents, _ := newConsentTest(t)
+		other, _ := auth.GenerateKeyPair()
+		w := httptest.NewRecorder()
+		h.HandleGrant(w, consentRequest(http.MethodPost, grantBody(scope, walletSign(t, other, message))))
+		if w.Code != http.StatusUnauthorized || consents.granted != nil {
+			t.Fatalf("status = %d, want 401 and nothing stored", w.Code)
+		}
+	})
+
+	t.Run("legacy message without nonce", func(t *testing.T) {
+		h, consents, key := newConsentTest(t)
+		w := httptest.NewRecorder()
+		body, _ := json.Marshal(map[string]string{"duration": "24h", "signature": walletSign(t, key, testRequestID+"_24h")})
+		h.HandleGrant(w, consentRequest(http.MethodPost, string(body)))
+		if w.Code != http.StatusBadRequest || consents.granted != nil {
+			t.Fatalf("status = %d, want 400 and nothing stored", w.Code)
+		}
+	})
+}
+
+func TestDenyAndRevokeSignTheirOwnAction(t *testing.T) {
+	h, consents, key := newConsentTest(t)
+
+	// Tanda tangan untuk "grant" tidak boleh bisa dipakai untuk menolak.
+	grantMessage := auth.ConsentMessage(domain.ConsentActionGrant, testRequestID, testPatientID, testDoctorID, "", nil, testNonce)
+	body, _ := json.Marshal(domain.SignedConsentPayload{Nonce: testNonce, Signature: walletSign(t, key, grantMessage)})
+	w := httptest.NewRecorder()
+	h.HandleDeny(w, consentRequest(http.MethodPost, string(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("deny with a grant signature: status = %d, want 401", w.Code)
+	}
+
+	denyMessage := auth.ConsentMessage(domain.ConsentActionDeny, testRequestID, testPatientID, testDoctorID, "", nil, testNonce)
+	body, _ = json.Marshal(domain.SignedConsentPayload{Nonce: testNonce, Signature: walletSign(t, key, denyMessage)})
+	w = httptest.NewRecorder()
+	h.HandleDeny(w, consentRequest(http.MethodPost, string(body)))
+	if w.Code != http.StatusOK || consents.granted.Action != domain.ConsentActionDeny {
+		t.Fatalf("deny: status = %d: %s", w.Code, w.Body)
+	}
+
+	// Pencabutan mengulang cakupan dan masa berlaku izin yang dicabut.
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	consents.request.Status, consents.request.DataScope, consents.request.ExpiresAt = "granted", `{"all":true}`, &expiresAt
+	revokeMessage := auth.ConsentMessage(domain.ConsentActionRevoke, testRequestID, testPatientID, testDoctorID, `{"all":true}`, &expiresAt, testNonce)
+	body, _ = json.Marshal(domain.SignedConsentPayload{Nonce: testNonce, Signature: walletSign(t, key, revokeMessage)})
+	w = httptest.NewRecorder()
+	h.HandleRevoke(w, consentRequest(http.MethodPost, string(body)))
+	if w.Code != http.StatusOK || consents.granted.Action != domain.ConsentActionRevoke {
+		t.Fatalf("revoke: status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestGetSignaturesReverifiesStoredSignatures(t *testing.T) {
+	h, consents, key := newConsentTest(t)
+	publicKey := auth.PublicKeyToHex(key)
+	message := auth.ConsentMessage(domain.ConsentActionDeny, testRequestID, testPatientID, testDoctorID, "", nil, testNonce)
+	signature := walletSign(t, key, message)
+	consents.signatures = []domain.ConsentSignature{
+		{SignerID: testPatientID, Message: message, Signature: signature, PublicKey: publicKey},
+		{SignerID: testPatientID, Message: message + " (diubah)", Signature: signature, PublicKey: publicKey},
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleGetSignatures(w, consentRequest(http.MethodGet, ""))
+	var got []domain.ConsentSignature
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Valid || got[1].Valid {
+		t.Fatalf("valid flags = %+v, want [true false]", got)
+	}
+}
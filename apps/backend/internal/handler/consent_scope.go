@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// limitToScope removes the parts of a decrypted record that the consent scope
+// does not cover and flags the record as restricted. A nil scope (the patient
+// reading their own records) leaves the record untouched.
+func limitToScope(record *domain.MedicalRecord, scope *domain.ConsentScope) {
+	if scope == nil || scope.Unrestricted() {
+		return
+	}
+	restricted := false
+	withhold := func(category string, clear func()) {
+		if !scope.AllowsCategory(category) {
+			clear()
+			restricted = true
+		}
+	}
+	withhold(domain.ScopeCategoryDiagnoses, func() { record.Diagnosis, record.Diagnoses = "", nil })
+	withhold(domain.ScopeCategoryNotes, func() { record.Notes, record.AmendmentReason = "", "" })
+	withhold(domain.ScopeCategoryVitals, func() { record.Vitals = nil })
+	withhold(domain.ScopeCategoryMedications, func() { record.Medications = nil })
+	withhold(domain.ScopeCategoryAllergies, func() { record.Allergies = nil })
+	withhold(domain.ScopeCategoryProcedures, func() { record.Procedures = nil })
+	if !scope.AllowsAttachments() {
+		record.AttachmentCID, record.Attachments = "", nil
+		restricted = true
+	}
+	record.ContentRestricted = record.ContentRestricted || restricted
+}
+
+// authoredRecordScope returns the consent scope a doctor reads one of their
+// own records under, given their access to each patient, and whether that
+// scope covers the record at all. The earlier versions of an amended record
+// are only looked up when the scope limits which records it covers.
+func (h *RecordHandler) authoredRecordScope(r *http.Request, record *domain.MedicalRecord, accesses map[string]domain.PatientAccess) (*domain.ConsentScope, bool, error) {
+	access, ok := accesses[record.PatientID]
+	if !ok {
+		return nil, false, nil
+	}
+	scope, err := domain.ParseConsentScope(access.DataScope)
+	if err != nil {
+		// Cakupan yang tidak valid tidak memberi akses, sama seperti di ConsentMiddleware.
+		return nil, false, nil
+	}
+	if scope.From == nil && scope.To == nil && len(scope.RecordIDs) == 0 {
+		return &scope, true, nil
+	}
+
+	firstWrittenAt, versionIDs := record.CreatedAt, []string{record.ID}
+	if record.Version > 1 {
+		history, err := h.recordRepo.GetRecordHistory(r.Context(), record.ID)
+		if err != nil || len(history) == 0 {
+			return nil, false, err
+		}
+		versionIDs = versionIDs[:0]
+		for _, version := range history {
+			versionIDs = append(versionIDs, version.ID)
+		}
+		firstWrittenAt = history[len(history)-1].CreatedAt
+	}
+	return &scope, scope.AllowsRecord(firstWrittenAt, versionIDs...), nil
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+var testEncryptionKey = []byte("kunci_enkripsi_uji_32_byte_pas!!")
+
+type fakeRecordRepo struct {
+	repository.RecordRepository
+	records []domain.MedicalRecord
+	history map[string][]domain.MedicalRecord
+}
+
+func (f *fakeRecordRepo) ListDoctorRecords(ctx context.Context, doctorID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error) {
+	return slices.Clone(f.records), len(f.records), nil
+}
+
+func (f *fakeRecordRepo) GetRecordByID(ctx context.Context, recordID string) (*domain.MedicalRecord, error) {
+	for _, record := range f.records {
+		if record.ID == recordID {
+			return &record, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeRecordRepo) GetRecordHistory(ctx context.Context, recordID string) ([]domain.MedicalRecord, error) {
+	return f.history[recordID], nil
+}
+
+// scopedRecord returns an encrypted record of patientID written at createdAt,
+// with a diagnosis, notes, a vital sign and an attachment.
+func scopedRecord(t *testing.T, id, patientID string, createdAt time.Time) domain.MedicalRecord {
+	t.Helper()
+	record := domain.MedicalRecord{
+		ID:            id,
+		RecordGroupID: id,
+		Version:       1,
+		PatientID:     patientID,
+		CreatedAt:     createdAt,
+		ClinicalContent: domain.ClinicalContent{
+			Vitals: []domain.VitalSign{{Type: "heart_rate", Value: "80", Unit: "/min"}},
+		},
+		Attachments: []domain.RecordAttachment{{CID: testUploadCID, Filename: "lab.pdf"}},
+	}
+	var err error
+	if record.Diagnosis, err = crypto.Encrypt("Hipertensi", testEncryptionKey); err != nil {
+		t.Fatal(err)
+	}
+	if record.Notes, err = crypto.Encrypt("Kontrol rutin", testEncryptionKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptClinicalContent(&record.ClinicalContent, testEncryptionKey, testEncryptionKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptAttachments(record.Attachments, testEncryptionKey); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestLimitToScopeWithholdsCategoriesAndAttachments(t *testing.T) {
+	full := domain.MedicalRecord{
+		Diagnosis:     "Hipertensi",
+		Notes:         "Kontrol rutin",
+		AttachmentCID: testUploadCID,
+		ClinicalContent: domain.ClinicalContent{
+			Vitals:      []domain.VitalSign{{Type: "heart_rate", Value: "80"}},
+			Medications: []domain.Medication{{Name: "Amlodipin"}},
+		},
+		Attachments: []domain.RecordAttachment{{CID: testUploadCID}},
+	}
+
+	unrestricted := full
+	limitToScope(&unrestricted, &domain.ConsentScope{All: true})
+	if unrestricted.Diagnosis == "" || unrestricted.Attachments == nil || unrestricted.ContentRestricted {
+		t.Fatalf("an unrestricted scope changed the record: %+v", unrestricted)
+	}
+
+	noAttachments := false
+	limited := full
+	limitToScope(&limited, &domain.ConsentScope{Categories: []string{domain.ScopeCategoryVitals}, Attachments: &noAttachments})
+	if limited.Diagnosis != "" || limited.Notes != "" || limited.Medications != nil {
+		t.Errorf("categories outside the scope were returned: %+v", limited)
+	}
+	if len(limited.Vitals) != 1 {
+		t.Errorf("vitals are in the scope but were withheld")
+	}
+	if limited.AttachmentCID != "" || limited.Attachments != nil {
+		t.Errorf("attachments were returned although the scope excludes them")
+	}
+	if !limited.ContentRestricted {
+		t.Errorf("a limited record must be flagged content_restricted")
+	}
+}
+
+func TestGetAuthoredRecordsAppliesEachPatientsScope(t *testing.T) {
+	const (
+		vitalsOnlyPatient = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c12"
+		noAccessPatient   = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c13"
+		datedPatient      = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c14"
+		legacyPatient     = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c15"
+	)
+	written := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	records := &fakeRecordRepo{records: []domain.MedicalRecord{
+		scopedRecord(t, "a0000000-0000-4000-8000-000000000001", vitalsOnlyPatient, written),
+		scopedRecord(t, "a0000000-0000-4000-8000-000000000002", noAccessPatient, written),
+		scopedRecord(t, "a0000000-0000-4000-8000-000000000003", datedPatient, written),
+		scopedRecord(t, "a0000000-0000-4000-8000-000000000004", legacyPatient, written),
+	}}
+	consents := &fakeAccessRepo{accesses: map[string]domain.PatientAccess{
+		vitalsOnlyPatient: {PatientID: vitalsOnlyPatient, Source: domain.AccessSourceConsent, DataScope: `{"categories":["vitals"],"attachments":false}`},
+		datedPatient:      {PatientID: datedPatient, Source: domain.AccessSourceConsent, DataScope: `{"from":"2026-01-01T00:00:00Z"}`},
+		legacyPatient:     {PatientID: legacyPatient, Source: domain.AccessSourceConsent, DataScope: "all"},
+	}}
+	h := &RecordHandler{recordRepo: records, consentRepo: consents, encryptionKey: testEncryptionKey}
+
+	r := httptest.NewRequest(http.MethodGet, "/records/authored", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, testDoctorID))
+	w := httptest.NewRecorder()
+	h.GetAuthoredRecords(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var page domain.RecordPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	byPatient := make(map[string]domain.MedicalRecord)
+	for _, record := range page.Items {
+		byPatient[record.PatientID] = record
+	}
+
+	vitals := byPatient[vitalsOnlyPatient]
+	if vitals.Diagnosis != "" || vitals.Notes != "" || vitals.Attachments != nil || !vitals.ContentRestricted {
+		t.Errorf("vitals-only scope returned more than vitals: %+v", vitals)
+	}
+	if len(vitals.Vitals) != 1 || vitals.Vitals[0].Value != "80" {
+		t.Errorf("vitals-only scope did not return the decrypted vitals: %+v", vitals.Vitals)
+	}
+	for _, patientID := range []string{noAccessPatient, datedPatient} {
+		record := byPatient[patientID]
+		if record.Diagnosis != "" || record.Vitals != nil || record.Attachments != nil || !record.ContentRestricted {
+			t.Errorf("patient %s: record outside any scope returned content: %+v", patientID, record)
+		}
+	}
+	legacy := byPatient[legacyPatient]
+	if legacy.Diagnosis != "Hipertensi" || legacy.ContentRestricted || len(legacy.Attachments) != 1 || !strings.HasSuffix(legacy.Attachments[0].Filename, ".pdf") {
+		t.Errorf("a full grant must return the whole record: %+v", legacy)
+	}
+	if !slices.Equal(consents.breakGlass, []bool{false}) {
+		t.Errorf("authored records looked up access with break-glass %v; emergency reads belong to the audited patient endpoints", consents.breakGlass)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+// DelegationHandler handles guardian/dependent delegations. A patient invites
+// a guardian who must accept; an admin can create an active delegation
+// directly for a dependent who cannot act for themselves, such as a minor.
+type DelegationHandler struct {
+	delegationRepo repository.DelegationRepository
+	userRepo       repository.UserRepository
+}
+
+// NewDelegationHandler creates a new instance of DelegationHandler.
+func NewDelegationHandler(delegationRepo repository.DelegationRepository, userRepo repository.UserRepository) *DelegationHandler {
+	return &DelegationHandler{delegationRepo: delegationRepo, userRepo: userRepo}
+}
+
+// HandleCreate lets a patient invite another patient account as their guardian.
+func (h *DelegationHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	dependentID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pasien dari token", http.StatusInternalServerError)
+		return
+	}
+	if role, _ := r.Context().Value(middleware.UserRoleKey).(string); role != domain.RolePatient {
+		http.Error(w, "Hanya pasien yang dapat menunjuk wali", http.StatusForbidden)
+		return
+	}
+
+	var payload domain.DelegationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if !validateDelegation(w, payload.Scope, payload.Relationship, payload.EndsAt) {
+		return
+	}
+
+	guardian, err := h.userRepo.GetUserByEmail(r.Context(), strings.TrimSpace(payload.GuardianEmail))
+	if err != nil || guardian.Role != domain.RolePatient {
+		http.Error(w, "Akun wali tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if guardian.ID == dependentID {
+		http.Error(w, "Tidak dapat menunjuk diri sendiri sebagai wali", http.StatusBadRequest)
+		return
+	}
+
+	h.create(w, r, domain.Delegation{
+		GuardianID:   guardian.ID,
+		DependentID:  dependentID,
+		Scope:        payload.Scope,
+		Relationship: payload.Relationship,
+		Status:       domain.DelegationPending,
+		EndsAt:       payload.EndsAt,
+		CreatedBy:    dependentID,
+	})
+}
+
+// HandleAdminCreate creates an active delegation after the admin has checked
+// the guardianship documents.
+func (h *DelegationHandler) HandleAdminCreate(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID admin dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.AdminDelegationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if !validateDelegation(w, payload.Scope, payload.Relationship, payload.EndsAt) {
+		return
+	}
+	if payload.GuardianID == payload.DependentID {
+		http.Error(w, "Wali dan tanggungan harus akun yang berbeda", http.StatusBadRequest)
+		return
+	}
+	for _, id := range []string{payload.GuardianID, payload.DependentID} {
+		user, err := h.userRepo.GetUserByID(r.Context(), id)
+		if err != nil || user.Role != domain.RolePatient {
+			http.Error(w, "Akun pasien tidak ditemukan: "+id, http.StatusNotFound)
+			return
+		}
+	}
+
+	now := time.Now()
+	h.create(w, r, domain.Delegation{
+		GuardianID:   payload.GuardianID,
+		DependentID:  payload.DependentID,
+		Scope:        payload.Scope,
+		Relationship: payload.Relationship,
+		Status:       domain.DelegationActive,
+		EndsAt:       payload.EndsAt,
+		CreatedBy:    adminID,
+		AcceptedAt:   &now,
+	})
+}
+
+func (h *DelegationHandler) create(w http.ResponseWriter, r *http.Request, d domain.Delegation) {
+	id, err := h.delegationRepo.CreateDelegation(r.Context(), d)
+	if errors.Is(err, repository.ErrDelegationExists) {
+		http.Error(w, "Delegasi untuk wali dan tanggungan ini sudah ada", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal membuat delegasi %s -> %s: %v", d.GuardianID, d.DependentID, err)
+		http.Error(w, "Gagal membuat delegasi", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":       "Delegasi berhasil dibuat",
+		"delegation_id": id,
+		"status":        d.Status,
+	})
+}
+
+// HandleList lists the delegations where the user is the guardian or the dependent.
+func (h *DelegationHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	delegations, err := h.delegationRepo.GetDelegationsForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil delegasi %s: %v", userID, err)
+		http.Error(w, "Gagal mengambil daftar delegasi", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delegations)
+}
+
+// HandleAccept lets the invited guardian accept a pending delegation.
+func (h *DelegationHandler) HandleAccept(w http.ResponseWriter, r *http.Request) {
+	guardianID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := h.delegationRepo.AcceptDelegation(r.Context(), r.PathValue("delegation_id"), guardianID)
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Delegasi tidak ditemukan atau sudah diproses", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Delegasi berhasil diterima",
+	})
+}
+
+// HandleRevoke lets either the guardian or the dependent end a delegation.
+func (h *DelegationHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := h.delegationRepo.RevokeDelegation(r.Context(), r.PathValue("delegation_id"), userID)
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Delegasi tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Delegasi berhasil dicabut",
+	})
+}
+
+// validateDelegation checks the fields shared by both ways of creating a delegation.
+func validateDelegation(w http.ResponseWriter, scope, relationship string, endsAt *time.Time) bool {
+	if scope != domain.DelegationScopeRecords && scope != domain.DelegationScopeConsent && scope != domain.DelegationScopeFull {
+		http.Error(w, "Scope tidak valid: pilih 'records', 'consent' atau 'full'", http.StatusBadRequest)
+		return false
+	}
+	if strings.TrimSpace(relationship) == "" {
+		http.Error(w, "Hubungan (relationship) wajib diisi", http.StatusBadRequest)
+		return false
+	}
+	if endsAt != nil && !endsAt.After(time.Now()) {
+		http.Error(w, "ends_at harus di masa depan", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
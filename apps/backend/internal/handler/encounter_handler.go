@@ -0,0 +1,610 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+// EncounterHandler handles encounters (visits) and the prescriptions and
+// attachments added to them. Records are written through RecordHandler with
+// an encounter_id; the write-access checks and encryption are shared with it.
+type EncounterHandler struct {
+	encounterRepo repository.EncounterRepository
+	roleRepo      repository.RoleRepository
+	records       *RecordHandler
+}
+
+// NewEncounterHandler creates a new instance of EncounterHandler.
+func NewEncounterHandler(encounterRepo repository.EncounterRepository, roleRepo repository.RoleRepository, records *RecordHandler) *EncounterHandler {
+	return &EncounterHandler{encounterRepo: encounterRepo, roleRepo: roleRepo, records: records}
+}
+
+// HandleOpen opens an encounter for a patient. The caller needs an active
+// consent from the patient that includes write access: once open, the
+// encounter lets its participants (the attending doctor, the caller and
+// clinicians added later) write records without a consent of their own. The
+// attending doctor defaults to the caller, and the facility to the attending
+// doctor's facility. A service account can only open encounters at its own
+// facility, attended by a doctor of that facility.
+func (h *EncounterHandler) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.OpenEncounterPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	payload.PatientID = strings.TrimSpace(payload.PatientID)
+	if payload.PatientID == "" {
+		http.Error(w, "patient_id wajib diisi", http.StatusBadRequest)
+		return
+	}
+	switch payload.Type {
+	case domain.EncounterOutpatient, domain.EncounterInpatient, domain.EncounterTeleconsult:
+	default:
+		http.Error(w, "type harus 'outpatient', 'inpatient' atau 'teleconsult'", http.StatusBadRequest)
+		return
+	}
+	if !h.records.checkPatient(w, r, payload.PatientID) || !h.records.requireWriteAccess(w, r, userID, payload.PatientID) {
+		return
+	}
+
+	attendingID := strings.TrimSpace(payload.AttendingDoctorID)
+	if attendingID == "" {
+		if _, isService := r.Context().Value(middleware.ServiceAccountIDKey).(string); isService {
+			http.Error(w, "attending_doctor_id wajib diisi untuk akun layanan", http.StatusBadRequest)
+			return
+		}
+		attendingID = userID
+	}
+	doctor, ok := h.clinician(w, r, attendingID, "Dokter penanggung jawab")
+	if !ok {
+		return
+	}
+
+	facilityID := strings.TrimSpace(payload.FacilityID)
+	if serviceFacilityID, isService := r.Context().Value(middleware.ServiceFacilityIDKey).(string); isService {
+		if doctor.FacilityID != serviceFacilityID || (facilityID != "" && facilityID != serviceFacilityID) {
+			http.Error(w, "Akun layanan hanya dapat membuka kunjungan di fasilitasnya sendiri, dengan dokter dari fasilitas tersebut", http.StatusForbidden)
+			return
+		}
+	}
+	switch {
+	case facilityID == "" && doctor.FacilityID == "":
+		http.Error(w, "facility_id wajib diisi karena dokter penanggung jawab tidak terdaftar di fasilitas mana pun", http.StatusBadRequest)
+		return
+	case facilityID == "":
+		facilityID = doctor.FacilityID
+	case doctor.FacilityID != "" && doctor.FacilityID != facilityID:
+		http.Error(w, "Dokter penanggung jawab tidak terdaftar di fasilitas tersebut", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	startedAt := now
+	if payload.StartedAt != nil {
+		if payload.StartedAt.After(now.Add(time.Minute)) {
+			http.Error(w, "started_at tidak boleh di masa depan", http.StatusBadRequest)
+			return
+		}
+		startedAt = payload.StartedAt.UTC().Truncate(time.Second)
+	}
+
+	encounter := &domain.Encounter{
+		PatientID:         payload.PatientID,
+		Type:              payload.Type,
+		FacilityID:        facilityID,
+		AttendingDoctorID: doctor.ID,
+		StartedAt:         startedAt,
+		OpenedBy:          userID,
+	}
+	if reason := strings.TrimSpace(payload.Reason); reason != "" {
+		encrypted, err := crypto.Encrypt(reason, h.records.encryptionKey)
+		if err != nil {
+			log.Printf("Gagal mengenkripsi alasan kunjungan: %v", err)
+			http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+			return
+		}
+		encounter.Reason = encrypted
+	}
+
+	encounterID, err := h.encounterRepo.CreateEncounter(r.Context(), encounter)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // fasilitas tidak ada atau bukan UUID
+		http.Error(w, "Fasilitas tidak ditemukan", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal membuka kunjungan pasien %s: %v", payload.PatientID, err)
+		http.Error(w, "Gagal membuka kunjungan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Kunjungan berhasil dibuka",
+		"encounterID": encounterID,
+	})
+}
+
+// clinician loads a user who is to take part in an encounter, who must be
+// clinical staff with approved credentials. label names them in errors.
+func (h *EncounterHandler) clinician(w http.ResponseWriter, r *http.Request, userID, label string) (*domain.User, bool) {
+	user, err := h.records.userRepo.GetUserByID(r.Context(), userID)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "22P02":
+		http.Error(w, label+" tidak ditemukan", http.StatusBadRequest)
+		return nil, false
+	case err != nil:
+		log.Printf("Gagal mengambil data pengguna %s: %v", userID, err)
+		http.Error(w, "Gagal memverifikasi data dokter", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	role, err := h.roleRepo.GetRole(r.Context(), user.Role)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Gagal mengambil role %s: %v", user.Role, err)
+		http.Error(w, "Gagal memverifikasi data dokter", http.StatusInternalServerError)
+		return nil, false
+	}
+	if role == nil || !role.ClinicalStaff || user.VerificationStatus != domain.VerificationApproved {
+		http.Error(w, label+" harus tenaga kesehatan yang sudah diverifikasi", http.StatusBadRequest)
+		return nil, false
+	}
+	return user, true
+}
+
+// HandleClose closes an open encounter. Only its participants may close it.
+func (h *EncounterHandler) HandleClose(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+	encounter, ok := h.records.requireOpenEncounter(w, r, r.PathValue("encounter_id"), userID)
+	if !ok {
+		return
+	}
+
+	rowsAffected, err := h.encounterRepo.CloseEncounter(r.Context(), encounter.ID, userID)
+	if err != nil {
+		log.Printf("Gagal menutup kunjungan %s: %v", encounter.ID, err)
+		http.Error(w, "Gagal menutup kunjungan", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Kunjungan sudah ditutup", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Kunjungan berhasil ditutup"})
+}
+
+// HandleAddParticipant lets the attending doctor of an open encounter add a
+// verified clinician of the encounter's facility, e.g. the nurse taking the
+// vitals, who may then add data to the encounter like the attending doctor.
+func (h *EncounterHandler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+	encounter, ok := h.records.requireOpenEncounter(w, r, r.PathValue("encounter_id"), userID)
+	if !ok {
+		return
+	}
+	if encounter.AttendingDoctorID != userID {
+		http.Error(w, "Akses ditolak: Hanya dokter penanggung jawab yang dapat menambah peserta kunjungan", http.StatusForbidden)
+		return
+	}
+
+	var payload domain.EncounterParticipantPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	payload.ParticipantID = strings.TrimSpace(payload.ParticipantID)
+	if payload.ParticipantID == "" {
+		http.Error(w, "participant_id wajib diisi", http.StatusBadRequest)
+		return
+	}
+	participant, ok := h.clinician(w, r, payload.ParticipantID, "Peserta")
+	if !ok {
+		return
+	}
+	if participant.FacilityID != encounter.FacilityID {
+		http.Error(w, "Peserta harus terdaftar di fasilitas kunjungan ini", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.encounterRepo.AddParticipant(r.Context(), encounter.ID, participant.ID, userID); err != nil {
+		log.Printf("Gagal menambah peserta %s ke kunjungan %s: %v", participant.ID, encounter.ID, err)
+		http.Error(w, "Gagal menambah peserta kunjungan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Peserta berhasil ditambahkan ke kunjungan"})
+}
+
+// HandleAddPrescription adds a prescription to an open encounter. Like a
+// record written into the encounter, it needs no separate write consent, and
+// it is hashed and anchored on the blockchain like a record.
+func (h *EncounterHandler) HandleAddPrescription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+	encounter, ok := h.records.requireOpenEncounter(w, r, r.PathValue("encounter_id"), userID)
+	if !ok {
+		return
+	}
+
+	var payload domain.PrescriptionPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Items) == 0 {
+		http.Error(w, "Resep harus berisi minimal satu obat", http.StatusBadRequest)
+		return
+	}
+	content := domain.ClinicalContent{Medications: payload.Items}
+	if !validateClinicalContent(w, &content) {
+		return
+	}
+
+	prescriberName, err := h.records.authorName(r, userID)
+	if err != nil {
+		log.Printf("Gagal mengambil nama dokter: %v", err)
+		http.Error(w, "Gagal memverifikasi data dokter", http.StatusInternalServerError)
+		return
+	}
+	if err := encryptClinicalContent(&content, h.records.encryptionKey, h.records.blindIndexKey); err != nil {
+		log.Printf("Gagal mengenkripsi resep: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+	prescription := &domain.Prescription{
+		EncounterID:    encounter.ID,
+		PatientID:      encounter.PatientID,
+		PrescriberID:   userID,
+		PrescriberName: prescriberName,
+		Items:          content.Medications,
+	}
+	if notes := strings.TrimSpace(payload.Notes); notes != "" {
+		if prescription.Notes, err = crypto.Encrypt(notes, h.records.encryptionKey); err != nil {
+			log.Printf("Gagal mengenkripsi catatan resep: %v", err)
+			http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	prescriptionID, err := h.encounterRepo.CreatePrescription(r.Context(), prescription)
+	if err != nil {
+		log.Printf("Gagal menyimpan resep untuk kunjungan %s: %v", encounter.ID, err)
+		http.Error(w, "Gagal menyimpan resep", http.StatusInternalServerError)
+		return
+	}
+
+	dataHash := prescriptionDataHash(prescription)
+	tx, ok := h.records.anchorHash(w, "resep "+prescriptionID, dataHash, func(txHash string) error {
+		return h.encounterRepo.SetPrescriptionAnchor(r.Context(), prescriptionID, dataHash, txHash)
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":        "Resep berhasil ditambahkan ke kunjungan dan dicatat di blockchain",
+		"prescriptionID": prescriptionID,
+		"txHash":         tx.Hash().Hex(),
+	})
+}
+
+// HandleAddAttachments attaches files uploaded to IPFS directly to an open
+// encounter, e.g. referral letters that do not belong to a single record.
+// The files added in one request are hashed and anchored together.
+func (h *EncounterHandler) HandleAddAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+	encounter, ok := h.records.requireOpenEncounter(w, r, r.PathValue("encounter_id"), userID)
+	if !ok {
+		return
+	}
+
+	var payload domain.EncounterAttachmentsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Attachments) == 0 {
+		http.Error(w, "Minimal satu lampiran wajib diisi", http.StatusBadRequest)
+		return
+	}
+	if !h.records.resolveAttachments(w, r, payload.Attachments, userID, nil) {
+		return
+	}
+	if err := encryptAttachments(payload.Attachments, h.records.encryptionKey); err != nil {
+		log.Printf("Gagal mengenkripsi metadata lampiran: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+
+	err := h.encounterRepo.AddAttachments(r.Context(), encounter.ID, payload.Attachments)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Lampiran dengan CID yang sama sudah ada di kunjungan ini", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal menyimpan lampiran kunjungan %s: %v", encounter.ID, err)
+		http.Error(w, "Gagal menyimpan lampiran", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, len(payload.Attachments))
+	for i := range payload.Attachments {
+		ids[i] = payload.Attachments[i].ID
+	}
+	dataHash := encounterAttachmentsDataHash(encounter, payload.Attachments)
+	tx, ok := h.records.anchorHash(w, "lampiran kunjungan "+encounter.ID, dataHash, func(txHash string) error {
+		return h.encounterRepo.SetAttachmentsAnchor(r.Context(), ids, dataHash, txHash)
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":       "Lampiran berhasil ditambahkan ke kunjungan dan dicatat di blockchain",
+		"attachmentIDs": ids,
+		"txHash":        tx.Hash().Hex(),
+	})
+}
+
+// prescriptionDataHash returns the hash anchored for a prescription. Like a
+// record's, it covers the content as stored, with text fields encrypted.
+func prescriptionDataHash(p *domain.Prescription) string {
+	data := fmt.Sprintf("prescription|%s|%s|%s|%s|%s|%s|%s", p.ID, p.EncounterID, p.PatientID, p.PrescriberID, p.PrescriberName, p.Notes, hashTime(&p.CreatedAt))
+	data += clinicalHashInput(domain.ClinicalContent{Medications: p.Items})
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+// encounterAttachmentsDataHash returns the hash anchored for files attached
+// to an encounter in one request, after they were stored and given IDs.
+func encounterAttachmentsDataHash(encounter *domain.Encounter, attachments []domain.RecordAttachment) string {
+	data := "encounter-attachments|" + encounter.ID + "|" + encounter.PatientID
+	for _, a := range attachments {
+		data += "|" + a.ID
+	}
+	data += attachmentsHashInput(attachments)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+// GetMyEncounters handles the logged-in patient reading their encounter
+// timeline, newest first, one page at a time.
+func (h *EncounterHandler) GetMyEncounters(w http.ResponseWriter, r *http.Request) {
+	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan patient Id", http.StatusInternalServerError)
+		return
+	}
+	h.writeTimeline(w, r, patientID, nil)
+}
+
+// GetPatientEncounters handles staff reading a patient's encounter timeline,
+// limited to the scope of the patient's consent.
+func (h *EncounterHandler) GetPatientEncounters(w http.ResponseWriter, r *http.Request) {
+	scope, _ := r.Context().Value(middleware.ConsentScopeKey).(*domain.ConsentScope)
+	h.writeTimeline(w, r, r.PathValue("patient_id"), scope)
+}
+
+// writeTimeline writes one page of a patient's encounters with their
+// records, prescriptions and attachments. Accepts cursor and limit (1-50,
+// default 20). A limited scope withholds what it does not cover; a scope
+// naming specific records also hides encounters without any of them.
+func (h *EncounterHandler) writeTimeline(w http.ResponseWriter, r *http.Request, patientID string, scope *domain.ConsentScope) {
+	cursor, limit, ok := parsePage(w, r, 50)
+	if !ok {
+		return
+	}
+	if scope != nil && scope.Unrestricted() {
+		scope = nil
+	}
+
+	encounters, err := h.encounterRepo.ListPatientEncounters(r.Context(), patientID, scope, cursor, limit+1)
+	if err != nil {
+		log.Printf("Gagal mengambil kunjungan pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil kunjungan", http.StatusInternalServerError)
+		return
+	}
+	page := domain.EncounterPage{Items: encounters}
+	if len(encounters) > limit {
+		page.Items = encounters[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.StartedAt, last.ID)
+	}
+
+	ids := make([]string, len(page.Items))
+	byID := make(map[string]*domain.Encounter, len(page.Items))
+	for i := range page.Items {
+		ids[i] = page.Items[i].ID
+		byID[page.Items[i].ID] = &page.Items[i]
+		page.Items[i].Records = make([]domain.MedicalRecord, 0)
+	}
+	if err := h.encounterRepo.LoadEncounterDetails(r.Context(), page.Items); err != nil {
+		log.Printf("Gagal mengambil isi kunjungan pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil kunjungan", http.StatusInternalServerError)
+		return
+	}
+	records, err := h.records.recordRepo.ListEncounterRecords(r.Context(), ids, scope)
+	if err != nil {
+		log.Printf("Gagal mengambil rekam medis kunjungan pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil kunjungan", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range records {
+		record := &records[i]
+		record.Diagnosis = h.records.decryptOrMark(record.Diagnosis)
+		record.Notes = h.records.decryptOrMark(record.Notes)
+		if record.AmendmentReason != "" {
+			record.AmendmentReason = h.records.decryptOrMark(record.AmendmentReason)
+		}
+		h.records.decryptClinicalContent(&record.ClinicalContent)
+		h.records.decryptAttachments(record.Attachments)
+		limitToScope(record, scope)
+		if r.PathValue("patient_id") != "" {
+			record.HistoryURL = "/records/patient/" + record.PatientID + "/history/" + record.ID
+		} else {
+			record.HistoryURL = "/records/history/" + record.ID
+		}
+		encounter := byID[record.EncounterID]
+		encounter.Records = append(encounter.Records, *record)
+	}
+
+	visible := page.Items[:0]
+	for i := range page.Items {
+		encounter := page.Items[i]
+		if encounter.Reason != "" {
+			encounter.Reason = h.records.decryptOrMark(encounter.Reason)
+		}
+		for j := range encounter.Prescriptions {
+			h.decryptPrescription(&encounter.Prescriptions[j])
+		}
+		h.records.decryptAttachments(encounter.Attachments)
+
+		if scope != nil {
+			// Data kunjungan yang tidak terikat pada satu rekam medis hanya
+			// terlihat jika izin tidak dibatasi pada rekam medis tertentu.
+			wholeEncounter := len(scope.RecordIDs) == 0
+			if !wholeEncounter && len(encounter.Records) == 0 {
+				continue
+			}
+			if !scope.AllowsCategory(domain.ScopeCategoryNotes) {
+				encounter.Reason = ""
+			}
+			if !wholeEncounter || !scope.AllowsCategory(domain.ScopeCategoryMedications) {
+				encounter.Prescriptions = make([]domain.Prescription, 0)
+			}
+			if !wholeEncounter || !scope.AllowsAttachments() {
+				encounter.Attachments = make([]domain.RecordAttachment, 0)
+			}
+			encounter.ContentRestricted = true
+		}
+		visible = append(visible, encounter)
+	}
+	page.Items = visible
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetPatientPrescriptions handles staff with prescriptions:read (e.g.
+// pharmacists) listing a patient's prescriptions, newest first, one page at a
+// time. Accepts cursor and limit (1-100, default 20). The patient's consent
+// must cover medications and not be limited to specific records; its date
+// range applies to when a prescription was written.
+func (h *EncounterHandler) GetPatientPrescriptions(w http.ResponseWriter, r *http.Request) {
+	patientID := r.PathValue("patient_id")
+	scope, _ := r.Context().Value(middleware.ConsentScopeKey).(*domain.ConsentScope)
+	if scope != nil && (!scope.AllowsCategory(domain.ScopeCategoryMedications) || len(scope.RecordIDs) > 0) {
+		http.Error(w, "Akses ditolak: Izin pasien tidak mencakup resep", http.StatusForbidden)
+		return
+	}
+	cursor, limit, ok := parsePage(w, r, 100)
+	if !ok {
+		return
+	}
+	if scope != nil && scope.Unrestricted() {
+		scope = nil
+	}
+
+	prescriptions, err := h.encounterRepo.ListPatientPrescriptions(r.Context(), patientID, scope, cursor, limit+1)
+	if err != nil {
+		log.Printf("Gagal mengambil resep pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil resep", http.StatusInternalServerError)
+		return
+	}
+	page := domain.PrescriptionPage{Items: prescriptions}
+	if len(prescriptions) > limit {
+		page.Items = prescriptions[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for i := range page.Items {
+		h.decryptPrescription(&page.Items[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parsePage reads the cursor and limit (1-maxLimit, default 20) of a listing
+// ordered by time and ID. On failure it writes the error response.
+func parsePage(w http.ResponseWriter, r *http.Request, maxLimit int) (*domain.RecordCursor, int, bool) {
+	query := r.URL.Query()
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxLimit {
+			http.Error(w, fmt.Sprintf("limit harus antara 1 dan %d", maxLimit), http.StatusBadRequest)
+			return nil, 0, false
+		}
+	}
+	var cursor *domain.RecordCursor
+	if value := query.Get("cursor"); value != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		cursor = &domain.RecordCursor{}
+		if err != nil || json.Unmarshal(raw, cursor) != nil || cursor.ID == "" {
+			http.Error(w, "cursor tidak valid", http.StatusBadRequest)
+			return nil, 0, false
+		}
+	}
+	return cursor, limit, true
+}
+
+// encodeCursor returns the cursor of a page whose last item is at (t, id).
+func encodeCursor(t time.Time, id string) string {
+	next, _ := json.Marshal(domain.RecordCursor{CreatedAt: t, ID: id})
+	return base64.RawURLEncoding.EncodeToString(next)
+}
+
+// decryptPrescription decrypts a prescription's items and notes in place.
+func (h *EncounterHandler) decryptPrescription(p *domain.Prescription) {
+	h.records.decryptClinicalContent(&domain.ClinicalContent{Medications: p.Items})
+	if p.Notes != "" {
+		p.Notes = h.records.decryptOrMark(p.Notes)
+	}
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+)
+
+const (
+	testNurseID      = "a11ce000-0000-4000-8000-000000000001"
+	otherNurseID     = "a11ce000-0000-4000-8000-000000000002"
+	unverifiedNurse  = "a11ce000-0000-4000-8000-000000000003"
+	testColleagueID  = "a11ce000-0000-4000-8000-000000000004"
+	outsideDoctorID  = "a11ce000-0000-4000-8000-000000000005"
+	participantsPath = "/encounters/" + testEncounterID + "/participants"
+)
+
+func TestHandleOpenNeedsWriteConsentAndServiceAccountsStayInTheirFacility(t *testing.T) {
+	users := &fakeUserRepo{users: map[string]*domain.User{
+		testPatientID:   {ID: testPatientID, Role: domain.RolePatient},
+		testDoctorID:    {ID: testDoctorID, Role: domain.RoleDoctor, FacilityID: testFacilityID, VerificationStatus: domain.VerificationApproved},
+		outsideDoctorID: {ID: outsideDoctorID, Role: domain.RoleDoctor, FacilityID: otherFacilityID, VerificationStatus: domain.VerificationApproved},
+	}}
+	const serviceAccountID = "5e5e5e5e-0000-4000-8000-000000000001"
+	cases := []struct {
+		name      string
+		scope     string
+		service   bool
+		attending string
+		status    int
+	}{
+		// Izin baca saja tidak boleh menjadi jalan pintas untuk menulis lewat kunjungan.
+		{"doctor with read-only consent", `{"all":true}`, false, "", http.StatusForbidden},
+		{"doctor with write consent", `{"all":true,"write":true}`, false, "", http.StatusCreated},
+		{"service naming a doctor of its facility", `{"all":true,"write":true,"facility_systems":true}`, true, testDoctorID, http.StatusCreated},
+		{"service naming a doctor of another facility", `{"all":true,"write":true,"facility_systems":true}`, true, outsideDoctorID, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		encounters := &fakeEncounterRepo{}
+		records := &RecordHandler{userRepo: users, encounterRepo: encounters, consentRepo: &fakeAccessRepo{accesses: consentAccess(testPatientID, tc.scope)}}
+		h := NewEncounterHandler(encounters, &fakeRoleRepo{}, records)
+
+		body := `{"patient_id":"` + testPatientID + `","type":"outpatient","attending_doctor_id":"` + tc.attending + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/encounters", strings.NewReader(body))
+		ctx := context.WithValue(r.Context(), middleware.UserIDKey, testDoctorID)
+		if tc.service {
+			ctx = context.WithValue(r.Context(), middleware.UserIDKey, serviceAccountID)
+			ctx = context.WithValue(ctx, middleware.ServiceAccountIDKey, serviceAccountID)
+			ctx = context.WithValue(ctx, middleware.ServiceFacilityIDKey, testFacilityID)
+		}
+		w := httptest.NewRecorder()
+		h.HandleOpen(w, r.WithContext(ctx))
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.status, w.Body)
+		}
+		if opened := encounters.encounter.ID != ""; opened != (tc.status == http.StatusCreated) {
+			t.Errorf("%s: encounter opened = %v", tc.name, opened)
+		}
+	}
+}
+
+func TestHandleAddParticipantLetsAttendingDoctorAddClinicians(t *testing.T) {
+	users := &fakeUserRepo{users: map[string]*domain.User{
+		testNurseID:     {ID: testNurseID, Role: domain.RoleNurse, FacilityID: testFacilityID, VerificationStatus: domain.VerificationApproved},
+		otherNurseID:    {ID: otherNurseID, Role: domain.RoleNurse, FacilityID: otherFacilityID, VerificationStatus: domain.VerificationApproved},
+		unverifiedNurse: {ID: unverifiedNurse, Role: domain.RoleNurse, FacilityID: testFacilityID, VerificationStatus: domain.VerificationPending},
+		testPatientID:   {ID: testPatientID, Role: domain.RolePatient},
+	}}
+	cases := []struct {
+		name          string
+		callerID      string
+		participantID string
+		status        int
+	}{
+		{"nurse of the facility", testDoctorID, testNurseID, http.StatusCreated},
+		{"nurse of another facility", testDoctorID, otherNurseID, http.StatusBadRequest},
+		{"unverified nurse", testDoctorID, unverifiedNurse, http.StatusBadRequest},
+		{"patient", testDoctorID, testPatientID, http.StatusBadRequest},
+		{"participant who is not attending", testColleagueID, testNurseID, http.StatusForbidden},
+		// Staf lain di fasilitas yang sama bukan peserta kunjungan.
+		{"staff outside the encounter", outsideDoctorID, testNurseID, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		encounters := &fakeEncounterRepo{
+			encounter: domain.Encounter{ID: testEncounterID, PatientID: testPatientID, FacilityID: testFacilityID, AttendingDoctorID: testDoctorID, Status: domain.EncounterOpen},
+			writers:   []string{testDoctorID, testColleagueID},
+		}
+		h := NewEncounterHandler(encounters, &fakeRoleRepo{}, &RecordHandler{userRepo: users, encounterRepo: encounters})
+
+		r := httptest.NewRequest(http.MethodPost, participantsPath, strings.NewReader(`{"participant_id":"`+tc.participantID+`"}`))
+		r.SetPathValue("encounter_id", testEncounterID)
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, tc.callerID))
+		w := httptest.NewRecorder()
+		h.HandleAddParticipant(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.status, w.Body)
+		}
+		if added := slices.Contains(encounters.writers, tc.participantID); added != (tc.status == http.StatusCreated) {
+			t.Errorf("%s: participant added = %v", tc.name, added)
+		}
+	}
+}
+
+func testPrescription() *domain.Prescription {
+	return &domain.Prescription{
+		ID:             "b0b0b0b0-0000-4000-8000-000000000001",
+		EncounterID:    testEncounterID,
+		PatientID:      testPatientID,
+		PrescriberID:   testDoctorID,
+		PrescriberName: "dr. Uji",
+		Notes:          "catatan-terenkripsi",
+		CreatedAt:      time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+		Items:          []domain.Medication{{Name: "nama-terenkripsi", Dose: "dosis-terenkripsi", Route: "oral", Frequency: "3x1", Duration: "5 hari"}},
+	}
+}
+
+func TestPrescriptionDataHashCoversEveryField(t *testing.T) {
+	original := prescriptionDataHash(testPrescription())
+	if prescriptionDataHash(testPrescription()) != original {
+		t.Fatal("prescription hash is not deterministic")
+	}
+
+	changes := map[string]func(p *domain.Prescription){
+		"id":              func(p *domain.Prescription) { p.ID = "b0b0b0b0-0000-4000-8000-000000000002" },
+		"encounter":       func(p *domain.Prescription) { p.EncounterID = "e0c0e0c0-0000-4000-8000-000000000002" },
+		"patient":         func(p *domain.Prescription) { p.PatientID = testDoctorID },
+		"prescriber":      func(p *domain.Prescription) { p.PrescriberID = testPatientID },
+		"prescriber name": func(p *domain.Prescription) { p.PrescriberName = "dr. Lain" },
+		"notes":           func(p *domain.Prescription) { p.Notes = "catatan-lain" },
+		"created at":      func(p *domain.Prescription) { p.CreatedAt = p.CreatedAt.Add(time.Hour) },
+		"item dose":       func(p *domain.Prescription) { p.Items[0].Dose = "dosis-lain" },
+		"item removed":    func(p *domain.Prescription) { p.Items = nil },
+	}
+	for name, change := range changes {
+		p := testPrescription()
+		change(p)
+		if prescriptionDataHash(p) == original {
+			t.Errorf("changing the %s does not change the prescription hash", name)
+		}
+	}
+}
+
+func TestEncounterAttachmentsDataHashCoversFilesAndEncounter(t *testing.T) {
+	encounter := &domain.Encounter{ID: testEncounterID, PatientID: testPatientID}
+	files := func() []domain.RecordAttachment {
+		return []domain.RecordAttachment{{
+			ID: "d0d0d0d0-0000-4000-8000-000000000001", CID: testUploadCID, Filename: "nama-terenkripsi",
+			MIMEType: "application/pdf", Size: 2048, SHA256: strings.Repeat("ab", 32),
+			UploadedBy: testUploaderID, UploadedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		}}
+	}
+	original := encounterAttachmentsDataHash(encounter, files())
+
+	otherEncounter := &domain.Encounter{ID: "e0c0e0c0-0000-4000-8000-000000000002", PatientID: testPatientID}
+	if encounterAttachmentsDataHash(otherEncounter, files()) == original {
+		t.Error("the same files attached to another encounter must hash differently")
+	}
+	changes := map[string]func(a *domain.RecordAttachment){
+		"id":     func(a *domain.RecordAttachment) { a.ID = "d0d0d0d0-0000-4000-8000-000000000002" },
+		"cid":    func(a *domain.RecordAttachment) { a.CID = otherUploadCID },
+		"sha256": func(a *domain.RecordAttachment) { a.SHA256 = strings.Repeat("cd", 32) },
+		"size":   func(a *domain.RecordAttachment) { a.Size++ },
+	}
+	for name, change := range changes {
+		attachments := files()
+		change(&attachments[0])
+		if encounterAttachmentsDataHash(encounter, attachments) == original {
+			t.Errorf("changing the %s does not change the attachments hash", name)
+		}
+	}
+}
+
+// fakePrescriptionRepo pages through prescriptions, newest first, and
+// remembers the scope and cursor it was asked for.
+type fakePrescriptionRepo struct {
+	fakeEncounterRepo
+	prescriptions []domain.Prescription
+	scope         *domain.ConsentScope
+	cursor        *domain.RecordCursor
+}
+
+func (f *fakePrescriptionRepo) ListPatientPrescriptions(ctx context.Context, patientID string, scope *domain.ConsentScope, cursor *domain.RecordCursor, limit int) ([]domain.Prescription, error) {
+	f.scope, f.cursor = scope, cursor
+	page := f.prescriptions
+	if cursor != nil {
+		page = page[slices.IndexFunc(page, func(p domain.Prescription) bool { return p.ID == cursor.ID })+1:]
+	}
+	return slices.Clone(page[:min(limit, len(page))]), nil
+}
+
+func TestGetPatientPrescriptionsPagesWithinTheScope(t *testing.T) {
+	prescriptions := &fakePrescriptionRepo{}
+	for i := range 3 {
+		p := testPrescription()
+		p.ID = fmt.Sprintf("b0b0b0b0-0000-4000-8000-00000000000%d", 3-i)
+		p.CreatedAt = p.CreatedAt.Add(-time.Duration(i) * time.Hour)
+		p.Notes, p.Items = "", nil
+		prescriptions.prescriptions = append(prescriptions.prescriptions, *p)
+	}
+	h := NewEncounterHandler(prescriptions, &fakeRoleRepo{}, &RecordHandler{encryptionKey: testEncryptionKey})
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scope := &domain.ConsentScope{Categories: []string{domain.ScopeCategoryMedications}, From: &from}
+
+	list := func(query string, scope *domain.ConsentScope) (*httptest.ResponseRecorder, domain.PrescriptionPage) {
+		r := httptest.NewRequest(http.MethodGet, "/prescriptions/patient/"+testPatientID+query, nil)
+		r.SetPathValue("patient_id", testPatientID)
+		r = r.WithContext(context.WithValue(r.Context(), middleware.ConsentScopeKey, scope))
+		w := httptest.NewRecorder()
+		h.GetPatientPrescriptions(w, r)
+		var page domain.PrescriptionPage
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, page
+	}
+
+	_, first := list("?limit=2", scope)
+	if len(first.Items) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page: %d items, cursor %q", len(first.Items), first.NextCursor)
+	}
+	// Rentang tanggal izin harus diterapkan di query, sebelum LIMIT.
+	if prescriptions.scope != scope {
+		t.Error("the consent's date range was not passed to the query")
+	}
+	_, second := list("?limit=2&cursor="+first.NextCursor, scope)
+	if len(second.Items) != 1 || second.NextCursor != "" || prescriptions.cursor == nil || second.Items[0].ID != prescriptions.prescriptions[2].ID {
+		t.Errorf("second page: %+v", second)
+	}
+
+	if w, _ := list("", &domain.ConsentScope{Categories: []string{domain.ScopeCategoryVitals}}); w.Code != http.StatusForbidden {
+		t.Errorf("a scope without medications: status %d, want 403", w.Code)
+	}
+}
@@ -2,8 +2,14 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -11,32 +17,66 @@ import (
 	"github.com/ipfs/boxo/files"
 	ipfshttp "github.com/ipfs/kubo/client/rpc"
 	iface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
 )
 
 type IpfsHandler struct {
 	ipfsClient iface.CoreAPI
+	uploadRepo repository.UploadRepository
 }
 
-func NewIpfsHandler(ipfsClient *ipfshttp.HttpApi) *IpfsHandler {
-	return &IpfsHandler{ipfsClient: ipfsClient}
+func NewIpfsHandler(ipfsClient *ipfshttp.HttpApi, uploadRepo repository.UploadRepository) *IpfsHandler {
+	return &IpfsHandler{ipfsClient: ipfsClient, uploadRepo: uploadRepo}
 }
 
+// UploadFile stores a file in IPFS and records its size, type and SHA-256 as
+// computed here, so attachments never rely on what the client claims.
 func (h *IpfsHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	uploaderID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
 	// Set timeout for context
 	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 	defer cancel()
 
-	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB limit
+	// Sisakan ruang untuk header multipart di atas batas ukuran berkas.
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(maxAttachmentSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Ukuran berkas maksimal %d MiB", maxAttachmentSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Gagal mem-parsing form", http.StatusBadRequest)
 		return
 	}
 
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Gagal membaca file dari request", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
+	if header.Size > maxAttachmentSize {
+		http.Error(w, fmt.Sprintf("Ukuran berkas maksimal %d MiB", maxAttachmentSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload, err := describeUpload(file)
+	if err != nil {
+		log.Printf("Gagal membaca berkas unggahan: %v", err)
+		http.Error(w, "Gagal membaca file dari request", http.StatusBadRequest)
+		return
+	}
+	if upload.Size == 0 {
+		http.Error(w, "Berkas kosong tidak dapat diunggah", http.StatusBadRequest)
+		return
+	}
 
 	fileNode := files.NewReaderFile(file)
 	path, err := h.ipfsClient.Unixfs().Add(ctx, fileNode)
@@ -47,9 +87,45 @@ func (h *IpfsHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fullPath := path.String()
-	cid := strings.TrimPrefix(fullPath, "/ipfs/")
+	upload.CID = strings.TrimPrefix(fullPath, "/ipfs/")
+	upload.UploadedBy = uploaderID
+	if err := h.uploadRepo.SaveUpload(r.Context(), upload); err != nil {
+		log.Printf("Gagal menyimpan metadata berkas %s: %v", upload.CID, err)
+		http.Error(w, "Gagal menyimpan metadata berkas", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"cid": cid})
+	json.NewEncoder(w).Encode(upload)
+}
+
+// describeUpload reads file once to compute its size and SHA-256 and sniffs
+// its MIME type from the content, then rewinds it for the IPFS upload.
+func describeUpload(file io.ReadSeeker) (*domain.UploadedFile, error) {
+	hasher := sha256.New()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+	hasher.Write(head)
+	rest, err := io.Copy(hasher, file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	return &domain.UploadedFile{
+		MIMEType: mediaType,
+		Size:     int64(n) + rest,
+		SHA256:   hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
 }
@@ -0,0 +1,477 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minPassphraseLength is enforced for key backup passphrases. The passphrase
+	// is the only secret protecting an escrowed key, so it must be longer than a password.
+	minPassphraseLength = 12
+	// keyRecoveryTTL is how long a key recovery link stays valid.
+	keyRecoveryTTL = 30 * time.Minute
+)
+
+// KeyHandler handles user key material: rotation of the public key and opt-in
+// escrow of the private key. An escrowed key is sealed with a passphrase only
+// the user knows (Argon2id + AES-GCM) and then encrypted again with the server
+// key, so neither a database dump nor the server alone can recover it.
+type KeyHandler struct {
+	userRepo      repository.UserRepository
+	keyRepo       repository.KeyRepository
+	tokenRepo     repository.UserTokenRepository
+	loginRepo     repository.LoginRepository
+	mailer        mail.Mailer
+	encryptionKey []byte
+}
+
+// NewKeyHandler creates a new instance of KeyHandler.
+func NewKeyHandler(userRepo repository.UserRepository, keyRepo repository.KeyRepository, tokenRepo repository.UserTokenRepository, loginRepo repository.LoginRepository, mailer mail.Mailer, encryptionKey []byte) *KeyHandler {
+	return &KeyHandler{
+		userRepo:      userRepo,
+		keyRepo:       keyRepo,
+		tokenRepo:     tokenRepo,
+		loginRepo:     loginRepo,
+		mailer:        mailer,
+		encryptionKey: encryptionKey,
+	}
+}
+
+// HandleGetBackupStatus reports whether the logged-in user has an escrowed key.
+func (h *KeyHandler) HandleGetBackupStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	sealedKey, backedUpAt, err := h.keyRepo.GetKeyBackup(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil status backup kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal mengambil status backup kunci", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"backed_up":    sealedKey != "",
+		"backed_up_at": backedUpAt,
+	})
+}
+
+// HandleBackup escrows the user's private key under a passphrase. The key must
+// match the public key registered for the account.
+func (h *KeyHandler) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.KeyBackupPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.PrivateKey == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Passphrase) < minPassphraseLength {
+		http.Error(w, fmt.Sprintf("Passphrase minimal %d karakter", minPassphraseLength), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	publicKey, err := auth.PublicKeyFromPrivateHex(payload.PrivateKey)
+	if err != nil || publicKey != user.PublicKey {
+		http.Error(w, "Kunci privat tidak cocok dengan kunci publik akun Anda", http.StatusBadRequest)
+		return
+	}
+
+	sealedKey, err := sealPrivateKey(payload.PrivateKey, payload.Passphrase, h.encryptionKey)
+	if err != nil {
+		http.Error(w, "Gagal mengenkripsi kunci", http.StatusInternalServerError)
+		return
+	}
+	if err := h.keyRepo.SaveKeyBackup(r.Context(), userID, sealedKey); err != nil {
+		log.Printf("Gagal menyimpan backup kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal menyimpan backup kunci", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Backup kunci berhasil disimpan. Simpan passphrase Anda dengan aman; passphrase tidak dapat dipulihkan.",
+	})
+}
+
+// HandleDeleteBackup removes the escrowed key after the account password is re-entered.
+func (h *KeyHandler) HandleDeleteBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.PasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.checkPassword(w, r, userID, payload.Password); !ok {
+		return
+	}
+
+	if err := h.keyRepo.DeleteKeyBackup(r.Context(), userID); err != nil {
+		log.Printf("Gagal menghapus backup kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal menghapus backup kunci", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Backup kunci berhasil dihapus",
+	})
+}
+
+// HandleRequestRecovery starts a key restore. The user re-enters their password
+// and then has to confirm the link sent to their email, so a stolen session
+// alone is not enough to pull the key.
+func (h *KeyHandler) HandleRequestRecovery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.PasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.checkPassword(w, r, userID, payload.Password)
+	if !ok {
+		return
+	}
+
+	sealedKey, _, err := h.keyRepo.GetKeyBackup(r.Context(), userID)
+	if err != nil || sealedKey == "" {
+		http.Error(w, "Akun ini tidak memiliki backup kunci", http.StatusNotFound)
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		http.Error(w, "Gagal membuat token pemulihan", http.StatusInternalServerError)
+		return
+	}
+	if err := h.tokenRepo.CreateToken(r.Context(), userID, repository.TokenPurposeKeyRecovery, auth.HashToken(token), time.Now().Add(keyRecoveryTTL)); err != nil {
+		log.Printf("Gagal menyimpan token pemulihan kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal membuat token pemulihan", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Pemulihan kunci RekamedChain",
+		Body: fmt.Sprintf("Halo %s,\n\nSeseorang meminta pemulihan kunci privat akun Anda. Gunakan kode berikut di aplikasi untuk melanjutkan:\n%s\n\nKode berlaku selama 30 menit. Jika ini bukan Anda, segera ganti password Anda.",
+			user.Name, token),
+	})
+	if err != nil {
+		log.Printf("Gagal mengirim email pemulihan kunci ke user %s: %v", userID, err)
+		http.Error(w, "Gagal mengirim email pemulihan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Kode pemulihan telah dikirim ke email Anda",
+	})
+}
+
+// HandleRestore returns the escrowed private key once the recovery token from
+// the email and the backup passphrase are both presented.
+func (h *KeyHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.KeyRestorePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	if h.accountLocked(w, r, userID) {
+		return
+	}
+
+	tokenOwner, err := h.tokenRepo.ConsumeToken(r.Context(), repository.TokenPurposeKeyRecovery, auth.HashToken(payload.Token))
+	if err != nil || tokenOwner != userID {
+		http.Error(w, "Kode pemulihan tidak valid atau sudah kedaluwarsa", http.StatusBadRequest)
+		return
+	}
+
+	sealedKey, _, err := h.keyRepo.GetKeyBackup(r.Context(), userID)
+	if err != nil || sealedKey == "" {
+		http.Error(w, "Akun ini tidak memiliki backup kunci", http.StatusNotFound)
+		return
+	}
+
+	privateKey, err := openPrivateKey(sealedKey, payload.Passphrase, h.encryptionKey)
+	if err != nil {
+		// Passphrase salah ikut dihitung ke penguncian akun agar tidak bisa ditebak berulang kali.
+		if _, err := h.loginRepo.RegisterFailedLogin(r.Context(), userID, maxAccountFailures, accountLockDuration); err != nil {
+			log.Printf("Gagal mencatat kegagalan pemulihan kunci user %s: %v", userID, err)
+		}
+		http.Error(w, "Passphrase salah. Minta kode pemulihan baru untuk mencoba lagi.", http.StatusUnauthorized)
+		return
+	}
+
+	log.Printf("User %s memulihkan kunci privat dari backup", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Kunci berhasil dipulihkan",
+		"private_key": privateKey,
+	})
+}
+
+// HandleGetKeyHistory lists the public keys of the logged-in user with their validity periods.
+func (h *KeyHandler) HandleGetKeyHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	keys, err := h.keyRepo.GetKeyHistory(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil riwayat kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal mengambil riwayat kunci", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// HandleRequestRotationRecovery emails a one-time token that authorises a key
+// rotation for users who no longer hold their old private key.
+func (h *KeyHandler) HandleRequestRotationRecovery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.PasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.checkPassword(w, r, userID, payload.Password)
+	if !ok {
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		http.Error(w, "Gagal membuat token pemulihan", http.StatusInternalServerError)
+		return
+	}
+	if err := h.tokenRepo.CreateToken(r.Context(), userID, repository.TokenPurposeKeyRotation, auth.HashToken(token), time.Now().Add(keyRecoveryTTL)); err != nil {
+		log.Printf("Gagal menyimpan token rotasi kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal membuat token pemulihan", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Penggantian kunci RekamedChain",
+		Body: fmt.Sprintf("Halo %s,\n\nSeseorang meminta penggantian kunci akun Anda tanpa kunci lama. Gunakan kode berikut di aplikasi untuk mendaftarkan kunci baru:\n%s\n\nKode berlaku selama 30 menit. Jika ini bukan Anda, segera ganti password Anda.",
+			user.Name, token),
+	})
+	if err != nil {
+		log.Printf("Gagal mengirim email rotasi kunci ke user %s: %v", userID, err)
+		http.Error(w, "Gagal mengirim email pemulihan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Kode penggantian kunci telah dikirim ke email Anda",
+	})
+}
+
+// HandleRotateKey replaces the user's public key. The new key must sign the
+// rotation message (proof of possession), and the change is authorised either
+// by a signature of the current key or by a recovery token. Accounts that have
+// no key yet enroll their first key here with the proof of possession alone.
+func (h *KeyHandler) HandleRotateKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.KeyRotationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if payload.OldKeySignature != "" && payload.RecoveryToken != "" {
+		http.Error(w, "Sertakan salah satu: old_key_signature atau recovery_token", http.StatusBadRequest)
+		return
+	}
+
+	newPublicKey, err := auth.NormalizePublicKeyHex(payload.NewPublicKey)
+	if err != nil {
+		http.Error(w, "Kunci publik baru tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	// Akun tanpa kunci (mis. dibuat lewat SSO) mendaftarkan kunci pertamanya tanpa bukti kunci lama.
+	if user.PublicKey != "" && payload.OldKeySignature == "" && payload.RecoveryToken == "" {
+		http.Error(w, "Sertakan salah satu: old_key_signature atau recovery_token", http.StatusBadRequest)
+		return
+	}
+	if newPublicKey == user.PublicKey {
+		http.Error(w, "Kunci baru sama dengan kunci yang sedang aktif", http.StatusBadRequest)
+		return
+	}
+
+	message := auth.KeyRotationMessage(userID, newPublicKey)
+	if valid, err := auth.VerifySignature(newPublicKey, message, payload.NewKeySignature); err != nil || !valid {
+		http.Error(w, "Tanda tangan kunci baru tidak valid", http.StatusUnauthorized)
+		return
+	}
+
+	method := "signature"
+	switch {
+	case payload.OldKeySignature != "":
+		if user.PublicKey == "" {
+			http.Error(w, "Akun belum memiliki kunci; kirim tanpa old_key_signature untuk mendaftarkan kunci pertama", http.StatusBadRequest)
+			return
+		}
+		if valid, err := auth.VerifySignature(user.PublicKey, message, payload.OldKeySignature); err != nil || !valid {
+			http.Error(w, "Tanda tangan kunci lama tidak valid", http.StatusUnauthorized)
+			return
+		}
+	case payload.RecoveryToken != "":
+		method = "recovery"
+		tokenOwner, err := h.tokenRepo.ConsumeToken(r.Context(), repository.TokenPurposeKeyRotation, auth.HashToken(payload.RecoveryToken))
+		if err != nil || tokenOwner != userID {
+			http.Error(w, "Kode pemulihan tidak valid atau sudah kedaluwarsa", http.StatusUnauthorized)
+			return
+		}
+	default:
+		method = "enrollment"
+	}
+
+	if err := h.keyRepo.RotatePublicKey(r.Context(), userID, user.PublicKey, newPublicKey, method); err != nil {
+		if errors.Is(err, repository.ErrKeyChanged) {
+			http.Error(w, "Kunci akun berubah saat proses rotasi, silakan ulangi", http.StatusConflict)
+			return
+		}
+		log.Printf("Gagal merotasi kunci user %s: %v", userID, err)
+		http.Error(w, "Gagal mengganti kunci", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s mengganti kunci publik (metode: %s)", userID, method)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":    "Kunci berhasil diganti. Backup kunci lama telah dihapus; buat backup baru bila diperlukan.",
+		"public_key": newPublicKey,
+	})
+}
+
+// checkPassword re-verifies the account password and counts failures towards
+// the account lockout. It writes the error response itself.
+func (h *KeyHandler) checkPassword(w http.ResponseWriter, r *http.Request, userID, password string) (*domain.User, bool) {
+	if h.accountLocked(w, r, userID) {
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return nil, false
+	}
+	withPassword, err := h.userRepo.GetUserByEmail(r.Context(), user.Email)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return nil, false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(withPassword.HashedPassword), []byte(password)); err != nil {
+		if _, err := h.loginRepo.RegisterFailedLogin(r.Context(), userID, maxAccountFailures, accountLockDuration); err != nil {
+			log.Printf("Gagal mencatat kegagalan password user %s: %v", userID, err)
+		}
+		http.Error(w, "Password salah", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+// accountLocked reports (and answers) when the account is in a lockout period.
+func (h *KeyHandler) accountLocked(w http.ResponseWriter, r *http.Request, userID string) bool {
+	state, err := h.loginRepo.GetLoginState(r.Context(), userID)
+	if err != nil || state.LockedUntil == nil || !state.LockedUntil.After(time.Now()) {
+		return false
+	}
+	writeRetryAfter(w, time.Until(*state.LockedUntil))
+	http.Error(w, "Akun terkunci sementara karena terlalu banyak percobaan gagal", http.StatusLocked)
+	return true
+}
+
+// sealPrivateKey wraps a private key with the user's passphrase and then with the server key.
+func sealPrivateKey(privateKeyHex, passphrase string, encryptionKey []byte) (string, error) {
+	inner, err := crypto.SealWithPassphrase(privateKeyHex, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return crypto.Encrypt(inner, encryptionKey)
+}
+
+// openPrivateKey reverses sealPrivateKey.
+func openPrivateKey(sealedKey, passphrase string, encryptionKey []byte) (string, error) {
+	inner, err := crypto.Decrypt(sealedKey, encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return crypto.OpenWithPassphrase(inner, passphrase)
+}
+
+// escrowOnRegister stores the freshly generated key when the user opted in at registration.
+func escrowOnRegister(ctx context.Context, keyRepo repository.KeyRepository, userID, privateKeyHex, passphrase string, encryptionKey []byte) error {
+	sealedKey, err := sealPrivateKey(privateKeyHex, passphrase, encryptionKey)
+	if err != nil {
+		return err
+	}
+	return keyRepo.SaveKeyBackup(ctx, userID, sealedKey)
+}
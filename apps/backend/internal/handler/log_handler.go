@@ -6,20 +6,26 @@ import (
 	"net/http"
 
 	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
 	"github.com/trifur/rekamedchain/backend/internal/repository"
 )
 
 // LogHandler handles audit log related HTTP requests.
 type LogHandler struct {
-	logRepo repository.LogRepository
+	logRepo   repository.LogRepository
+	loginRepo repository.LoginRepository
 }
 
+// loginEventLimit caps how many login events are returned to the patient.
+const loginEventLimit = 50
+
 // NewLogHandler creates a new instance of LogHandler.
-func NewLogHandler(logRepo repository.LogRepository) *LogHandler {
-	return &LogHandler{logRepo: logRepo}
+func NewLogHandler(logRepo repository.LogRepository, loginRepo repository.LoginRepository) *LogHandler {
+	return &LogHandler{logRepo: logRepo, loginRepo: loginRepo}
 }
 
-// HandleGetAuditLog handles the request to fetch audit logs for a specific patient.
+// HandleGetAuditLog handles the request to fetch audit logs for a specific
+// patient. Entries about records outside the consent scope are left out.
 func (h *LogHandler) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
 	patientID := r.PathValue("patient_id")
 	if patientID == "" {
@@ -34,6 +40,10 @@ func (h *LogHandler) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if scope, ok := r.Context().Value(middleware.ConsentScopeKey).(*domain.ConsentScope); ok && !scope.Unrestricted() {
+		logs = limitLogsToScope(logs, scope)
+	}
+
 	if logs == nil {
 		logs = make([]domain.AccessLog, 0)
 	}
@@ -41,3 +51,59 @@ func (h *LogHandler) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(logs)
 }
+
+// HandleGetMyAuditLog handles fetching the access log of the logged-in patient.
+func (h *LogHandler) HandleGetMyAuditLog(w http.ResponseWriter, r *http.Request) {
+	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pasien dari token", http.StatusInternalServerError)
+		return
+	}
+
+	logs, err := h.logRepo.GetLogsByPatientID(r.Context(), patientID)
+	if err != nil {
+		log.Printf("Gagal mengambil data log audit untuk pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil data dari server", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
+
+// HandleGetMyLoginEvents handles fetching recent login attempts on the logged-in user's account.
+func (h *LogHandler) HandleGetMyLoginEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.loginRepo.GetLoginEventsByUserID(r.Context(), userID, loginEventLimit)
+	if err != nil {
+		log.Printf("Gagal mengambil riwayat login user %s: %v", userID, err)
+		http.Error(w, "Gagal mengambil data dari server", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// limitLogsToScope drops entries about records the scope does not cover and
+// hides the diagnosis of the rest when diagnoses are not covered.
+func limitLogsToScope(logs []domain.AccessLog, scope *domain.ConsentScope) []domain.AccessLog {
+	limited := make([]domain.AccessLog, 0, len(logs))
+	for _, entry := range logs {
+		if entry.RecordWrittenAt != nil {
+			if !scope.AllowsRecord(*entry.RecordWrittenAt, entry.RecordVersionIDs...) {
+				continue
+			}
+			if !scope.AllowsCategory(domain.ScopeCategoryDiagnoses) {
+				entry.RecordDiagnosis = ""
+			}
+		}
+		limited = append(limited, entry)
+	}
+	return limited
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+const (
+	// maxAccountFailures is the number of consecutive failures before an account is locked.
+	maxAccountFailures = 5
+	// accountLockDuration is how long a locked account stays locked without admin help.
+	accountLockDuration = 15 * time.Minute
+	// maxIPFailures is the number of failures allowed from one IP inside ipFailureWindow.
+	maxIPFailures   = 20
+	ipFailureWindow = 15 * time.Minute
+	// baseFailureDelay doubles after every consecutive failure (1s, 2s, 4s, ...).
+	baseFailureDelay = time.Second
+	maxFailureDelay  = 30 * time.Second
+)
+
+// ipBlocked reports (and answers the request) when the client IP has too many recent failures.
+func (h *AuthHandler) ipBlocked(w http.ResponseWriter, r *http.Request) bool {
+	failures, err := h.loginRepo.CountRecentFailuresByIP(r.Context(), h.clientIP(r), time.Now().Add(-ipFailureWindow))
+	if err != nil {
+		log.Printf("Gagal menghitung percobaan login dari IP: %v", err)
+		return false
+	}
+	if failures < maxIPFailures {
+		return false
+	}
+
+	writeRetryAfter(w, ipFailureWindow)
+	http.Error(w, "Terlalu banyak percobaan login dari alamat ini. Coba lagi nanti.", http.StatusTooManyRequests)
+	return true
+}
+
+// accountBlocked reports (and answers the request) when the account is locked
+// or still inside the progressive delay that follows a failed attempt.
+func (h *AuthHandler) accountBlocked(w http.ResponseWriter, r *http.Request, userID string) bool {
+	state, err := h.loginRepo.GetLoginState(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil status login user %s: %v", userID, err)
+		return false
+	}
+
+	now := time.Now()
+	if state.LockedUntil != nil && state.LockedUntil.After(now) {
+		writeRetryAfter(w, state.LockedUntil.Sub(now))
+		http.Error(w, fmt.Sprintf("Akun dikunci sementara karena terlalu banyak percobaan gagal. Coba lagi setelah %s.", state.LockedUntil.Format(time.RFC3339)), http.StatusLocked)
+		return true
+	}
+
+	if state.FailedCount > 0 && state.LastFailedAt != nil {
+		nextAllowed := state.LastFailedAt.Add(failureDelay(state.FailedCount))
+		if nextAllowed.After(now) {
+			writeRetryAfter(w, nextAllowed.Sub(now))
+			http.Error(w, "Terlalu cepat mencoba kembali. Tunggu sebentar sebelum login lagi.", http.StatusTooManyRequests)
+			return true
+		}
+	}
+	return false
+}
+
+// recordLoginFailure logs the failed attempt and, for known accounts, moves
+// the account closer to a lockout.
+func (h *AuthHandler) recordLoginFailure(r *http.Request, email string, user *domain.User, reason string) {
+	event := &domain.LoginEvent{
+		Email:     email,
+		IPAddress: h.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   false,
+		Reason:    reason,
+	}
+	if user != nil {
+		event.UserID = user.ID
+		event.Email = user.Email
+		state, err := h.loginRepo.RegisterFailedLogin(r.Context(), user.ID, maxAccountFailures, accountLockDuration)
+		if err != nil {
+			log.Printf("Gagal mencatat kegagalan login user %s: %v", user.ID, err)
+		} else if state.LockedUntil != nil && state.FailedCount == maxAccountFailures {
+			log.Printf("[SECURITY] Akun %s dikunci hingga %s setelah %d percobaan gagal", user.ID, state.LockedUntil.Format(time.RFC3339), state.FailedCount)
+		}
+	}
+
+	if err := h.loginRepo.RecordLoginEvent(r.Context(), event); err != nil {
+		log.Printf("Gagal mencatat login event: %v", err)
+	}
+}
+
+// recordLoginSuccess logs a completed login and clears the failure counters.
+func (h *AuthHandler) recordLoginSuccess(r *http.Request, user *domain.User, reason string) {
+	if err := h.loginRepo.ResetFailedLogins(r.Context(), user.ID); err != nil {
+		log.Printf("Gagal mereset kegagalan login user %s: %v", user.ID, err)
+	}
+
+	event := &domain.LoginEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IPAddress: h.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+		Reason:    reason,
+	}
+	if err := h.loginRepo.RecordLoginEvent(r.Context(), event); err != nil {
+		log.Printf("Gagal mencatat login event: %v", err)
+	}
+}
+
+// failureDelay returns the wait imposed after the given number of consecutive failures.
+func failureDelay(failures int) time.Duration {
+	delay := time.Duration(float64(baseFailureDelay) * math.Pow(2, float64(failures-1)))
+	if delay > maxFailureDelay {
+		return maxFailureDelay
+	}
+	return delay
+}
+
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	// totpIssuer is the name shown in authenticator apps.
+	totpIssuer = "RekamedChain"
+	// recoveryCodeCount is the number of recovery codes issued on activation.
+	recoveryCodeCount = 10
+)
+
+// MFAHandler handles TOTP enrollment for doctor accounts.
+type MFAHandler struct {
+	userRepo      repository.UserRepository
+	mfaRepo       repository.MFARepository
+	sessionRepo   repository.SessionRepository
+	encryptionKey []byte
+}
+
+// NewMFAHandler creates a new instance of MFAHandler.
+func NewMFAHandler(userRepo repository.UserRepository, mfaRepo repository.MFARepository, sessionRepo repository.SessionRepository, encryptionKey []byte) *MFAHandler {
+	return &MFAHandler{
+		userRepo:      userRepo,
+		mfaRepo:       mfaRepo,
+		sessionRepo:   sessionRepo,
+		encryptionKey: encryptionKey,
+	}
+}
+
+// HandleEnroll generates a new TOTP secret and returns its provisioning URI.
+// The secret only takes effect after HandleActivate confirms a valid code.
+func (h *MFAHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Akun tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if user.Role == domain.RolePatient {
+		http.Error(w, "MFA hanya tersedia untuk akun tenaga kesehatan dan admin", http.StatusForbidden)
+		return
+	}
+
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil status MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal memproses permintaan", http.StatusInternalServerError)
+		return
+	}
+	if settings.Enabled {
+		http.Error(w, "MFA sudah aktif. Nonaktifkan terlebih dahulu untuk mendaftar ulang.", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Gagal membuat secret MFA", http.StatusInternalServerError)
+		return
+	}
+	encryptedSecret, err := crypto.Encrypt(secret, h.encryptionKey)
+	if err != nil {
+		log.Printf("Gagal mengenkripsi secret MFA: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+	if err := h.mfaRepo.SaveTOTPSecret(r.Context(), userID, encryptedSecret); err != nil {
+		log.Printf("Gagal menyimpan secret MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal menyimpan secret MFA", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(secret, user.Email, totpIssuer),
+	})
+}
+
+// HandleActivate confirms enrollment with a code from the authenticator app and
+// returns the recovery codes. They are shown only once.
+func (h *MFAHandler) HandleActivate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	sessionID, okSession := r.Context().Value(middleware.SessionIDKey).(string)
+	if !ok || !okSession {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.MFACodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), userID)
+	if err != nil || settings.SecretEncrypted == "" {
+		http.Error(w, "Belum ada pendaftaran MFA yang menunggu aktivasi", http.StatusBadRequest)
+		return
+	}
+	if settings.Enabled {
+		http.Error(w, "MFA sudah aktif", http.StatusConflict)
+		return
+	}
+
+	ok, err = verifySecondFactor(r.Context(), h.mfaRepo, h.encryptionKey, userID, settings, payload.Code, "")
+	if err != nil {
+		log.Printf("Gagal memverifikasi kode MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal memverifikasi kode", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Kode autentikasi salah", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, "Gagal membuat kode pemulihan", http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+
+	if err := h.mfaRepo.EnableMFA(r.Context(), userID, hashes); err != nil {
+		log.Printf("Gagal mengaktifkan MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal mengaktifkan MFA", http.StatusInternalServerError)
+		return
+	}
+
+	// Sesi saat ini baru saja membuktikan faktor kedua; token berikutnya dari /auth/refresh membawa mfa=true.
+	if err := h.sessionRepo.MarkMFAVerified(r.Context(), sessionID, userID); err != nil {
+		log.Printf("Gagal menandai sesi %s terverifikasi MFA: %v", sessionID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":        "MFA berhasil diaktifkan. Simpan kode pemulihan di tempat yang aman.",
+		"recovery_codes": codes,
+	})
+}
+
+// HandleDisable turns MFA off after checking a current code. It is refused when
+// the user's facility requires MFA.
+func (h *MFAHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.MFACodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.mfaRepo.GetMFASettings(r.Context(), userID)
+	if err != nil || !settings.Enabled {
+		http.Error(w, "MFA tidak aktif", http.StatusBadRequest)
+		return
+	}
+	if settings.Required {
+		http.Error(w, "Fasilitas Anda mewajibkan MFA, sehingga tidak dapat dinonaktifkan", http.StatusForbidden)
+		return
+	}
+
+	ok, err = verifySecondFactor(r.Context(), h.mfaRepo, h.encryptionKey, userID, settings, payload.Code, "")
+	if err != nil {
+		log.Printf("Gagal memverifikasi kode MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal memverifikasi kode", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Kode autentikasi salah", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.mfaRepo.DisableMFA(r.Context(), userID); err != nil {
+		log.Printf("Gagal menonaktifkan MFA user %s: %v", userID, err)
+		http.Error(w, "Gagal menonaktifkan MFA", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "MFA berhasil dinonaktifkan",
+	})
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when no TOTP code
+// is given. Accepted TOTP steps and recovery codes are burned so they cannot be replayed.
+func verifySecondFactor(ctx context.Context, mfaRepo repository.MFARepository, encryptionKey []byte, userID string, settings *domain.MFASettings, code, recoveryCode string) (bool, error) {
+	if code == "" && recoveryCode != "" {
+		return mfaRepo.ConsumeRecoveryCode(ctx, userID, auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)))
+	}
+
+	secret, err := crypto.Decrypt(settings.SecretEncrypted, encryptionKey)
+	if err != nil {
+		return false, err
+	}
+
+	step, valid := auth.ValidateTOTP(secret, code, time.Now())
+	if !valid {
+		return false, nil
+	}
+	return mfaRepo.MarkTOTPStepUsed(ctx, userID, step)
+}
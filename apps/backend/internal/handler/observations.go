@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// CreateVitals records vital signs as a new record. It lets staff with
+// vitals:write, such as nurses, document measurements without being able to
+// write diagnoses or prescriptions.
+func (h *RecordHandler) CreateVitals(w http.ResponseWriter, r *http.Request) {
+	h.createRecord(w, r, func(body io.Reader) (*domain.CreateRecordPayload, string) {
+		var payload domain.VitalsPayload
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			return nil, "Request body tidak valid"
+		}
+		if len(payload.Vitals) == 0 {
+			return nil, "Minimal satu tanda vital wajib diisi"
+		}
+		return &domain.CreateRecordPayload{
+			PatientID:       payload.PatientID,
+			EncounterID:     payload.EncounterID,
+			Notes:           payload.Notes,
+			ClinicalContent: domain.ClinicalContent{Vitals: payload.Vitals},
+		}, ""
+	})
+}
+
+// CreateLabResult records laboratory result files as a new record. It lets
+// staff with lab_results:write, such as lab staff, attach results without
+// being able to write diagnoses or prescriptions.
+func (h *RecordHandler) CreateLabResult(w http.ResponseWriter, r *http.Request) {
+	h.createRecord(w, r, func(body io.Reader) (*domain.CreateRecordPayload, string) {
+		var payload domain.LabResultPayload
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			return nil, "Request body tidak valid"
+		}
+		if len(payload.Attachments) == 0 {
+			return nil, "Minimal satu berkas hasil laboratorium wajib dilampirkan"
+		}
+		return &domain.CreateRecordPayload{
+			PatientID:   payload.PatientID,
+			EncounterID: payload.EncounterID,
+			Notes:       payload.Notes,
+			Attachments: payload.Attachments,
+		}, ""
+	})
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcStateTTL is how long the user has to finish logging in at the IdP.
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCLoginProvider is a configured hospital IdP together with the facility
+// and role given to staff accounts provisioned through it. TrustMFA lets an
+// "mfa" amr claim from the IdP stand in for our own TOTP step.
+type OIDCLoginProvider struct {
+	Client     *auth.OIDCProvider
+	FacilityID string
+	Role       string
+	TrustMFA   bool
+}
+
+// OIDCHandler handles staff login through hospital OpenID Connect identity
+// providers. Successful logins go through the same session and token issuing
+// as password logins.
+type OIDCHandler struct {
+	authHandler *AuthHandler
+	oidcRepo    repository.OIDCRepository
+	providers   map[string]OIDCLoginProvider
+}
+
+// NewOIDCHandler creates a new instance of OIDCHandler.
+func NewOIDCHandler(authHandler *AuthHandler, oidcRepo repository.OIDCRepository, providers map[string]OIDCLoginProvider) *OIDCHandler {
+	return &OIDCHandler{authHandler: authHandler, oidcRepo: oidcRepo, providers: providers}
+}
+
+// HandleListProviders lists the IDs of the configured identity providers.
+func (h *OIDCHandler) HandleListProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{
+		"providers": slices.Sorted(maps.Keys(h.providers)),
+	})
+}
+
+// HandleStart begins a login: it stores a one-time state with the PKCE
+// verifier and nonce, and returns the IdP URL the browser must be sent to.
+func (h *OIDCHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	providerID := r.PathValue("provider")
+	provider, ok := h.providers[providerID]
+	if !ok {
+		http.Error(w, "Penyedia identitas tidak dikenal", http.StatusNotFound)
+		return
+	}
+
+	state, errState := auth.GenerateNonce()
+	nonce, errNonce := auth.GenerateNonce()
+	verifier, errVerifier := auth.GeneratePKCEVerifier()
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		http.Error(w, "Gagal memulai login", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.Client.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("Gagal menghubungi penyedia identitas %s: %v", providerID, err)
+		http.Error(w, "Penyedia identitas tidak dapat dihubungi", http.StatusBadGateway)
+		return
+	}
+
+	if err := h.oidcRepo.SaveState(r.Context(), auth.HashToken(state), providerID, verifier, nonce, time.Now().Add(oidcStateTTL)); err != nil {
+		log.Printf("Gagal menyimpan state OIDC: %v", err)
+		http.Error(w, "Gagal memulai login", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": authURL,
+	})
+}
+
+// HandleCallback finishes a login with the code and state returned by the
+// IdP. The IdP subject is mapped to a linked account, then to an existing
+// staff account of the provider's facility with the same verified email, and
+// otherwise a new staff account is provisioned awaiting credential verification.
+func (h *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	providerID := r.PathValue("provider")
+	provider, ok := h.providers[providerID]
+	if !ok {
+		http.Error(w, "Penyedia identitas tidak dikenal", http.StatusNotFound)
+		return
+	}
+
+	var payload domain.OIDCCallbackPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Code == "" || payload.State == "" {
+		http.Error(w, "Request body tidak valid (membutuhkan code dan state)", http.StatusBadRequest)
+		return
+	}
+
+	if h.authHandler.ipBlocked(w, r) {
+		return
+	}
+
+	verifier, nonce, err := h.oidcRepo.ConsumeState(r.Context(), auth.HashToken(payload.State), providerID)
+	if err != nil {
+		http.Error(w, "State login tidak valid atau sudah kedaluwarsa", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := provider.Client.Exchange(r.Context(), payload.Code, verifier)
+	if err != nil {
+		log.Printf("Login OIDC %s gagal: %v", providerID, err)
+		http.Error(w, "Login melalui penyedia identitas gagal", http.StatusUnauthorized)
+		return
+	}
+	if identity.Nonce != nonce {
+		http.Error(w, "Login melalui penyedia identitas gagal", http.StatusUnauthorized)
+		return
+	}
+
+	userID, status, msg := h.resolveUser(r, providerID, provider, identity)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	user, err := h.authHandler.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Gagal memproses login", http.StatusInternalServerError)
+		return
+	}
+	if h.authHandler.accountBlocked(w, r, user.ID) {
+		return
+	}
+
+	// MFA di IdP rumah sakit hanya diakui bila penyedia ini dikonfigurasi untuk dipercaya;
+	// selain itu TOTP kita (dan kewajiban MFA fasilitas) tetap berlaku.
+	if provider.TrustMFA && slices.Contains(identity.AMR, "mfa") {
+		h.authHandler.createAndSendToken(w, r, user, true)
+		return
+	}
+	h.authHandler.completeLogin(w, r, user)
+}
+
+// resolveUser maps an IdP identity to a user ID. On failure it returns an
+// HTTP status and message instead.
+func (h *OIDCHandler) resolveUser(r *http.Request, providerID string, provider OIDCLoginProvider, identity *auth.OIDCIdentity) (string, int, string) {
+	ctx := r.Context()
+
+	userID, err := h.oidcRepo.GetUserIDByIdentity(ctx, providerID, identity.Subject)
+	if err == nil {
+		if err := h.oidcRepo.TouchIdentity(ctx, providerID, identity.Subject); err != nil {
+			log.Printf("Gagal memperbarui identitas OIDC %s/%s: %v", providerID, identity.Subject, err)
+		}
+		return userID, 0, ""
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Gagal mencari identitas OIDC: %v", err)
+		return "", http.StatusInternalServerError, "Gagal memproses login"
+	}
+
+	// Akun hanya ditautkan lewat email yang sudah diverifikasi oleh IdP.
+	if identity.Email == "" || !identity.EmailVerified {
+		return "", http.StatusForbidden, "Penyedia identitas tidak mengirim email terverifikasi"
+	}
+
+	existing, err := h.authHandler.userRepo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		role, err := h.authHandler.roleRepo.GetRole(ctx, existing.Role)
+		if err != nil || !role.ClinicalStaff {
+			return "", http.StatusConflict, "Email ini sudah dipakai akun yang bukan tenaga kesehatan"
+		}
+		// IdP satu rumah sakit tidak boleh mengambil alih akun fasilitas lain
+		// hanya karena emailnya sama.
+		account, err := h.authHandler.userRepo.GetUserByID(ctx, existing.ID)
+		if err != nil {
+			log.Printf("Gagal mengambil user %s: %v", existing.ID, err)
+			return "", http.StatusInternalServerError, "Gagal memproses login"
+		}
+		if provider.FacilityID == "" || account.FacilityID != provider.FacilityID {
+			return "", http.StatusConflict, "Email ini sudah dipakai akun tenaga kesehatan yang tidak terdaftar di fasilitas penyedia identitas ini"
+		}
+		userID = existing.ID
+	case errors.Is(err, pgx.ErrNoRows):
+		userID, err = h.provisionStaff(r, provider, identity)
+		if err != nil {
+			log.Printf("Gagal membuat akun tenaga kesehatan dari OIDC %s: %v", providerID, err)
+			return "", http.StatusInternalServerError, "Gagal membuat akun"
+		}
+		log.Printf("Akun %s dibuat otomatis dari penyedia identitas %s, menunggu verifikasi admin", userID, providerID)
+	default:
+		log.Printf("Gagal mencari user berdasarkan email: %v", err)
+		return "", http.StatusInternalServerError, "Gagal memproses login"
+	}
+
+	if err := h.oidcRepo.LinkIdentity(ctx, userID, providerID, identity.Subject, identity.Email); err != nil {
+		log.Printf("Gagal menautkan identitas OIDC %s/%s: %v", providerID, identity.Subject, err)
+		return "", http.StatusInternalServerError, "Gagal memproses login"
+	}
+	return userID, 0, ""
+}
+
+// provisionStaff creates a staff account for a first-time IdP login. It has no
+// usable password and, like self-registered staff, waits for admin approval.
+func (h *OIDCHandler) provisionStaff(r *http.Request, provider OIDCLoginProvider, identity *auth.OIDCIdentity) (string, error) {
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name = identity.Email
+	}
+
+	// Seperti registrasi mandiri, fasilitas baru berlaku setelah disetujui admin.
+	userID, err := h.authHandler.userRepo.CreateUser(r.Context(), &domain.User{
+		Name:                name,
+		Email:               identity.Email,
+		HashedPassword:      string(hashedPassword),
+		Role:                provider.Role,
+		RequestedFacilityID: provider.FacilityID,
+		VerificationStatus:  domain.VerificationPending,
+	})
+	if err != nil {
+		return "", err
+	}
+	return userID, h.authHandler.userRepo.MarkEmailVerified(r.Context(), userID)
+}
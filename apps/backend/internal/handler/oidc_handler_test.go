@@ -0,0 +1,458 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	testProviderID  = "rs-test"
+	testFacilityID  = "3c9e1f20-6a4b-4d1e-8b7a-2f5c9d0e1a33"
+	otherFacilityID = "9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c44"
+)
+
+// stubIdP is a minimal OpenID Connect provider in the spirit of cmd/oidcstub:
+// /authorize approves immediately and /token enforces PKCE.
+type stubIdP struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	// Klaim pengguna yang dikembalikan di ID token.
+	subject string
+	email   string
+	amr     []string
+	// nonce, bila diisi, menggantikan nonce dari permintaan /authorize.
+	nonce string
+
+	mu    sync.Mutex
+	codes map[string]authorizationRequest
+}
+
+type authorizationRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, subject: "idp-user-1", email: "dokter@rs.test", amr: []string{"pwd"}, codes: make(map[string]authorizationRequest)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := hex.EncodeToString([]byte(q.Get("state")))
+		idp.mu.Lock()
+		idp.codes[code] = authorizationRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+		idp.mu.Unlock()
+
+		redirect, _ := url.Parse(q.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		req, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		nonce := req.nonce
+		if idp.nonce != "" {
+			nonce = idp.nonce
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.srv.URL,
+			"sub":            idp.subject,
+			"aud":            "rekamedchain",
+			"exp":            time.Now().Add(5 * time.Minute).Unix(),
+			"nonce":          nonce,
+			"email":          idp.email,
+			"email_verified": true,
+			"name":           "dr. Uji",
+			"amr":            idp.amr,
+		})
+		token.Header["kid"] = "test-1"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+type oidcState struct {
+	provider, verifier, nonce string
+}
+
+type fakeOIDCRepo struct {
+	repository.OIDCRepository
+	states     map[string]oidcState
+	identities map[string]string
+}
+
+func (f *fakeOIDCRepo) SaveState(ctx context.Context, stateHash, provider, codeVerifier, nonce string, expiresAt time.Time) error {
+	f.states[stateHash] = oidcState{provider, codeVerifier, nonce}
+	return nil
+}
+
+func (f *fakeOIDCRepo) ConsumeState(ctx context.Context, stateHash, provider string) (string, string, error) {
+	s, ok := f.states[stateHash]
+	delete(f.states, stateHash)
+	if !ok || s.provider != provider {
+		return "", "", pgx.ErrNoRows
+	}
+	return s.verifier, s.nonce, nil
+}
+
+func (f *fakeOIDCRepo) GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error) {
+	userID, ok := f.identities[provider+"/"+subject]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (f *fakeOIDCRepo) LinkIdentity(ctx context.Context, userID, provider, subject, email string) error {
+	f.identities[provider+"/"+subject] = userID
+	return nil
+}
+
+func (f *fakeOIDCRepo) TouchIdentity(ctx context.Context, provider, subject string) error {
+	return nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[string]*domain.User
+}
+
+func (f *fakeUserRepo) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	u := *user
+	return &u, nil
+}
+
+func (f *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			// Seperti query aslinya, facility_id tidak ikut diambil.
+			return &domain.User{ID: user.ID, Email: user.Email, Role: user.Role, VerificationStatus: user.VerificationStatus}, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeUserRepo) CreateUser(ctx context.Context, user *domain.User) (string, error) {
+	u := *user
+	u.ID = "new-user"
+	f.users[u.ID] = &u
+	return u.ID, nil
+}
+
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, userID string) error {
+	f.users[userID].EmailVerified = true
+	return nil
+}
+
+type fakeRoleRepo struct {
+	repository.RoleRepository
+}
+
+func (f *fakeRoleRepo) GetRole(ctx context.Context, name string) (*domain.Role, error) {
+	return &domain.Role{Name: name, ClinicalStaff: name != domain.RolePatient, Permissions: []string{domain.PermRecordsRead}}, nil
+}
+
+type fakeLoginRepo struct {
+	repository.LoginRepository
+	ipFailures int
+}
+
+func (f *fakeLoginRepo) CountRecentFailuresByIP(ctx context.Context, ipAddress string, since time.Time) (int, error) {
+	return f.ipFailures, nil
+}
+
+func (f *fakeLoginRepo) GetLoginState(ctx context.Context, userID string) (*domain.LoginState, error) {
+	return &domain.LoginState{}, nil
+}
+
+func (f *fakeLoginRepo) ResetFailedLogins(ctx context.Context, userID string) error {
+	return nil
+}
+
+func (f *fakeLoginRepo) RecordLoginEvent(ctx context.Context, event *domain.LoginEvent) error {
+	return nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	created *domain.Session
+}
+
+func (f *fakeSessionRepo) CreateSession(ctx context.Context, session *domain.Session, refreshTokenHash string) (string, error) {
+	f.created = session
+	return "session-1", nil
+}
+
+type fakeMFARepo struct {
+	repository.MFARepository
+	enabled bool
+}
+
+func (f *fakeMFARepo) GetMFASettings(ctx context.Context, userID string) (*domain.MFASettings, error) {
+	return &domain.MFASettings{Enabled: f.enabled}, nil
+}
+
+type oidcTest struct {
+	idp      *stubIdP
+	handler  *OIDCHandler
+	oidc     *fakeOIDCRepo
+	users    *fakeUserRepo
+	sessions *fakeSessionRepo
+	mfa      *fakeMFARepo
+}
+
+func newOIDCTest(t *testing.T, trustMFA bool) *oidcTest {
+	t.Helper()
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := auth.NewTokenIssuer("k1", signingKey, nil, "rekamedchain", "rekamedchain-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := &oidcTest{
+		idp:      newStubIdP(t),
+		oidc:     &fakeOIDCRepo{states: make(map[string]oidcState), identities: make(map[string]string)},
+		users:    &fakeUserRepo{users: make(map[string]*domain.User)},
+		sessions: &fakeSessionRepo{},
+		mfa:      &fakeMFARepo{},
+	}
+	authHandler := NewAuthHandler(tt.users, nil, tt.sessions, tt.mfa, &fakeLoginRepo{}, &fakeRoleRepo{}, issuer, nil, nil)
+	tt.handler = NewOIDCHandler(authHandler, tt.oidc, map[string]OIDCLoginProvider{
+		testProviderID: {
+			Client:     auth.NewOIDCProvider(tt.idp.srv.URL, "rekamedchain", "", "http://app.test/callback", tt.idp.srv.Client()),
+			FacilityID: testFacilityID,
+			Role:       domain.RoleDoctor,
+			TrustMFA:   trustMFA,
+		},
+	})
+	return tt
+}
+
+// login runs HandleStart, follows the browser to the IdP and returns the code
+// and state the IdP redirected back with.
+func (tt *oidcTest) login(t *testing.T) (string, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/"+testProviderID+"/start", nil)
+	r.SetPathValue("provider", testProviderID)
+	w := httptest.NewRecorder()
+	tt.handler.HandleStart(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("start: status = %d: %s", w.Code, w.Body)
+	}
+	var start struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	json.NewDecoder(w.Body).Decode(&start)
+
+	browser := tt.idp.srv.Client()
+	browser.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := browser.Get(start.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirect.Query().Get("code"), redirect.Query().Get("state")
+}
+
+func (tt *oidcTest) callback(code, state string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(domain.OIDCCallbackPayload{Code: code, State: state})
+	r := httptest.NewRequest(http.MethodPost, "/auth/oidc/"+testProviderID+"/callback", strings.NewReader(string(body)))
+	r.SetPathValue("provider", testProviderID)
+	w := httptest.NewRecorder()
+	tt.handler.HandleCallback(w, r)
+	return w
+}
+
+func TestOIDCCallbackProvisionsNewStaff(t *testing.T) {
+	tt := newOIDCTest(t, false)
+	w := tt.callback(tt.login(t))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	user := tt.users.users["new-user"]
+	if user == nil || user.Email != tt.idp.email || user.Role != domain.RoleDoctor || !user.EmailVerified {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+	// Fasilitas baru berlaku setelah admin menyetujui kredensial.
+	if user.FacilityID != "" || user.RequestedFacilityID != testFacilityID || user.VerificationStatus != domain.VerificationPending {
+		t.Fatalf("provisioned user facility/status = %q/%q/%q", user.FacilityID, user.RequestedFacilityID, user.VerificationStatus)
+	}
+	if tt.oidc.identities[testProviderID+"/"+tt.idp.subject] != "new-user" {
+		t.Fatal("identity was not linked to the provisioned account")
+	}
+
+	// Login berikutnya memakai tautan subject, bukan email.
+	tt.idp.email = "email-baru@rs.test"
+	if w := tt.callback(tt.login(t)); w.Code != http.StatusOK || len(tt.users.users) != 1 {
+		t.Fatalf("second login: status = %d, users = %d", w.Code, len(tt.users.users))
+	}
+}
+
+func TestOIDCCallbackRejectsBadStateNonceAndVerifier(t *testing.T) {
+	t.Run("unknown state", func(t *testing.T) {
+		tt := newOIDCTest(t, false)
+		code, _ := tt.login(t)
+		if w := tt.callback(code, "state-lain"); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("state used twice", func(t *testing.T) {
+		tt := newOIDCTest(t, false)
+		code, state := tt.login(t)
+		if w := tt.callback(code, state); w.Code != http.StatusOK {
+			t.Fatalf("first callback: status = %d: %s", w.Code, w.Body)
+		}
+		if w := tt.callback(code, state); w.Code != http.StatusBadRequest {
+			t.Fatalf("replayed callback: status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		tt := newOIDCTest(t, false)
+		tt.idp.nonce = "nonce-dari-login-lain"
+		if w := tt.callback(tt.login(t)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+		if len(tt.users.users) != 0 || len(tt.oidc.identities) != 0 {
+			t.Fatal("nothing may be provisioned or linked on a nonce mismatch")
+		}
+	})
+
+	t.Run("PKCE verifier mismatch", func(t *testing.T) {
+		tt := newOIDCTest(t, false)
+		code, state := tt.login(t)
+		stored := tt.oidc.states[auth.HashToken(state)]
+		stored.verifier = "verifier-lain"
+		tt.oidc.states[auth.HashToken(state)] = stored
+		if w := tt.callback(code, state); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestOIDCCallbackLinksOnlyStaffOfTheProviderFacility(t *testing.T) {
+	cases := []struct {
+		name       string
+		existing   domain.User
+		wantStatus int
+	}{
+		{"same facility", domain.User{Role: domain.RoleDoctor, FacilityID: testFacilityID, VerificationStatus: domain.VerificationApproved}, http.StatusOK},
+		{"other facility", domain.User{Role: domain.RoleDoctor, FacilityID: otherFacilityID, VerificationStatus: domain.VerificationApproved}, http.StatusConflict},
+		{"pending without facility", domain.User{Role: domain.RoleDoctor, RequestedFacilityID: testFacilityID, VerificationStatus: domain.VerificationPending}, http.StatusConflict},
+		{"patient", domain.User{Role: domain.RolePatient}, http.StatusConflict},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tt := newOIDCTest(t, false)
+			existing := c.existing
+			existing.ID, existing.Email = "existing-user", tt.idp.email
+			tt.users.users[existing.ID] = &existing
+
+			w := tt.callback(tt.login(t))
+			if w.Code != c.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, c.wantStatus, w.Body)
+			}
+			linked := tt.oidc.identities[testProviderID+"/"+tt.idp.subject]
+			if (c.wantStatus == http.StatusOK) != (linked == existing.ID) {
+				t.Fatalf("linked to %q", linked)
+			}
+			if len(tt.users.users) != 1 {
+				t.Fatal("no account may be provisioned when the email is taken")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackTrustsIdPMFAOnlyWhenConfigured(t *testing.T) {
+	for _, trust := range []bool{false, true} {
+		tt := newOIDCTest(t, trust)
+		tt.idp.amr = []string{"pwd", "mfa"}
+		tt.mfa.enabled = true
+
+		w := tt.callback(tt.login(t))
+		if w.Code != http.StatusOK {
+			t.Fatalf("trust=%v: status = %d: %s", trust, w.Code, w.Body)
+		}
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+
+		if trust {
+			if tt.sessions.created == nil || !tt.sessions.created.MFAVerified || resp["token"] == nil {
+				t.Fatalf("trusted IdP MFA should issue an MFA-verified session: %v", resp)
+			}
+		} else if tt.sessions.created != nil || resp["mfa_required"] != true {
+			t.Fatalf("untrusted IdP MFA must still ask for TOTP: %v", resp)
+		}
+	}
+}
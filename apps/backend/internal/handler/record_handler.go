@@ -2,58 +2,132 @@ package handler
 
 import (
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/trifur/rekamedchain/backend/internal/blockchain"
 	"github.com/trifur/rekamedchain/backend/internal/crypto"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
 	"github.com/trifur/rekamedchain/backend/internal/middleware"
 	"github.com/trifur/rekamedchain/backend/internal/repository"
+	"github.com/trifur/rekamedchain/backend/internal/search"
 )
 
 // RecordHandler handles medical record related HTTP requests.
 type RecordHandler struct {
 	recordRepo       repository.RecordRepository
 	userRepo         repository.UserRepository // Dibutuhkan untuk mengambil nama dokter
+	terminologyRepo  repository.TerminologyRepository
+	consentRepo      repository.ConsentRepository
+	encounterRepo    repository.EncounterRepository
+	logRepo          repository.LogRepository
+	uploadRepo       repository.UploadRepository
 	encryptionKey    []byte
+	blindIndexKey    []byte
 	blockchainClient *blockchain.BlockchainClient
 }
 
 // NewRecordHandler creates a new instance of RecordHandler.
-func NewRecordHandler(recordRepo repository.RecordRepository, userRepo repository.UserRepository, encryptionKey []byte, bcClient *blockchain.BlockchainClient) *RecordHandler {
+func NewRecordHandler(recordRepo repository.RecordRepository, userRepo repository.UserRepository, terminologyRepo repository.TerminologyRepository, consentRepo repository.ConsentRepository, encounterRepo repository.EncounterRepository, logRepo repository.LogRepository, uploadRepo repository.UploadRepository, encryptionKey, blindIndexKey []byte, bcClient *blockchain.BlockchainClient) *RecordHandler {
 	return &RecordHandler{
 		recordRepo:       recordRepo,
 		userRepo:         userRepo,
+		terminologyRepo:  terminologyRepo,
+		consentRepo:      consentRepo,
+		encounterRepo:    encounterRepo,
+		logRepo:          logRepo,
+		uploadRepo:       uploadRepo,
 		encryptionKey:    encryptionKey,
+		blindIndexKey:    blindIndexKey,
 		blockchainClient: bcClient,
 	}
 }
 
-// CreateRecord handles the creation of a new medical record.
+// CreateRecord handles the creation of a new medical record. The writer must
+// have an active treatment relationship with the patient: a consent with
+// write access, or an open encounter of the patient that the record is
+// written into. Every attempt is recorded in the patient's audit log.
 func (h *RecordHandler) CreateRecord(w http.ResponseWriter, r *http.Request) {
+	h.createRecord(w, r, func(body io.Reader) (*domain.CreateRecordPayload, string) {
+		var payload domain.CreateRecordPayload
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			return nil, "Request body tidak valid"
+		}
+		return &payload, ""
+	})
+}
+
+// createRecord stores and anchors a new record. decode reads the request body
+// into a record payload, or returns why the body is not acceptable; it lets
+// the narrower vitals and lab result endpoints share this path.
+func (h *RecordHandler) createRecord(w http.ResponseWriter, r *http.Request, decode func(io.Reader) (*domain.CreateRecordPayload, string)) {
 	doctorID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok {
 		http.Error(w, "Gagal mendapatkan ID dokter dari token", http.StatusInternalServerError)
 		return
 	}
+	audited := &auditedWriter{ResponseWriter: w}
+	w = audited
+	attempt := &domain.RecordWriteAttempt{ActorID: doctorID, Action: domain.RecordWriteCreate}
+	defer h.auditWrite(r, audited, attempt)
 
-	var payload domain.CreateRecordPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+	payload, msg := decode(r.Body)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	payload.PatientID = strings.TrimSpace(payload.PatientID)
+	if payload.PatientID == "" {
+		http.Error(w, "patient_id wajib diisi", http.StatusBadRequest)
+		return
+	}
+	if !h.checkPatient(w, r, payload.PatientID) {
+		return
+	}
+	attempt.PatientID = payload.PatientID
+	if payload.EncounterID = strings.TrimSpace(payload.EncounterID); payload.EncounterID == "" {
+		if !h.requireWriteAccess(w, r, doctorID, payload.PatientID) {
+			return
+		}
+	} else {
+		// Kunjungan yang masih terbuka sudah merupakan hubungan perawatan aktif,
+		// sehingga izin tulis dari pasien tidak diperlukan.
+		encounter, ok := h.requireOpenEncounter(w, r, payload.EncounterID, doctorID)
+		if !ok {
+			return
+		}
+		if encounter.PatientID != payload.PatientID {
+			http.Error(w, "Kunjungan bukan milik pasien ini", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !validateClinicalContent(w, &payload.ClinicalContent) || !h.checkDiagnosisCodes(w, r, &payload.ClinicalContent) {
+		return
+	}
+	if !h.resolveAttachments(w, r, payload.Attachments, doctorID, nil) {
 		return
 	}
 
-	doctor, err := h.userRepo.GetUserByID(r.Context(), doctorID)
+	authorName, err := h.authorName(r, doctorID)
 	if err != nil {
 		log.Printf("Gagal mengambil nama dokter: %v", err)
 		http.Error(w, "Gagal memverifikasi data dokter", http.StatusInternalServerError)
 		return
 	}
 
+	// Indeks pencarian dihitung dari teks asli sebelum dienkripsi.
+	searchIndex := search.Indexes(search.RecordTerms(payload.Diagnosis, payload.Notes, payload.ClinicalContent), h.blindIndexKey)
+
 	encryptedDiagnosis, err := crypto.Encrypt(payload.Diagnosis, h.encryptionKey)
 	if err != nil {
 		log.Printf("Gagal mengenkripsi diagnosis: %v", err)
@@ -66,13 +140,30 @@ func (h *RecordHandler) CreateRecord(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
 		return
 	}
+	if err := encryptClinicalContent(&payload.ClinicalContent, h.encryptionKey, h.blindIndexKey); err != nil {
+		log.Printf("Gagal mengenkripsi isi klinis: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+	if err := encryptAttachments(payload.Attachments, h.encryptionKey); err != nil {
+		log.Printf("Gagal mengenkripsi metadata lampiran: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
 
 	newRecord := &domain.MedicalRecord{
-		PatientID:     strings.TrimSpace(payload.PatientID),
-		DoctorName:    "dr. " + doctor.Name,
-		Diagnosis:     encryptedDiagnosis, // Simpan data terenkripsi
-		Notes:         encryptedNotes,     // Simpan data terenkripsi
-		AttachmentCID: payload.AttachmentCID,
+		PatientID:       payload.PatientID,
+		DoctorName:      authorName,
+		Diagnosis:       encryptedDiagnosis, // Simpan data terenkripsi
+		Notes:           encryptedNotes,     // Simpan data terenkripsi
+		AttachmentCID:   payload.AttachmentCID,
+		Attachments:     payload.Attachments,
+		AuthorID:        doctorID,
+		DoctorID:        h.doctorID(r, doctorID),
+		Version:         1,
+		EncounterID:     payload.EncounterID,
+		ClinicalContent: payload.ClinicalContent,
+		SearchIndex:     searchIndex,
 	}
 
 	recordID, err := h.recordRepo.CreateRecord(r.Context(), newRecord)
@@ -81,21 +172,14 @@ func (h *RecordHandler) CreateRecord(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Gagal menyimpan rekam medis", http.StatusInternalServerError)
 		return
 	}
+	newRecord.ID = recordID
+	attempt.RecordID = recordID
 
 	// --- LOGIKA BLOCKCHAIN BARU ---
-	// 1. Buat hash dari data rekam medis
-	recordData := fmt.Sprintf("%s%s%s%s%s%s", recordID, newRecord.PatientID, newRecord.DoctorName, newRecord.Diagnosis, newRecord.Notes, newRecord.AttachmentCID)
-	dataHash := fmt.Sprintf("%x", sha256.Sum256([]byte(recordData)))
-
-	// 2. Panggil fungsi di smart contract
-	tx, err := h.blockchainClient.AddRecord(dataHash)
-	if err != nil {
-		log.Printf("Gagal mencatat transaksi ke blockchain: %v", err)
-		http.Error(w, "Gagal mencatat ke blockchain", http.StatusInternalServerError)
+	tx, ok := h.anchorRecord(w, r, newRecord, "")
+	if !ok {
 		return
 	}
-
-	log.Printf("Transaksi berhasil dikirim ke blockchain! Hash Transaksi: %s", tx.Hash().Hex())
 	// --- AKHIR LOGIKA BLOCKCHAIN BARU ---
 
 	w.Header().Set("Content-Type", "application/json")
@@ -107,7 +191,335 @@ func (h *RecordHandler) CreateRecord(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetMyRecords handles fetching records for the logged-in patient.
+// AmendRecord handles correcting a medical record. The correction is stored
+// as a new version linked to the previous one, which stays unchanged, and the
+// new version is hashed and anchored like a new record. Only the author of the
+// latest version may amend it, and only while they still have an active
+// treatment relationship with the patient: a consent with write access, or
+// the record's encounter still being open. Every attempt is audited.
+func (h *RecordHandler) AmendRecord(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID dokter dari token", http.StatusInternalServerError)
+		return
+	}
+	previousID := r.PathValue("record_id")
+	audited := &auditedWriter{ResponseWriter: w}
+	w = audited
+	attempt := &domain.RecordWriteAttempt{ActorID: doctorID, Action: domain.RecordWriteAmend}
+	defer h.auditWrite(r, audited, attempt)
+
+	previous, err := h.recordRepo.GetRecordByID(r.Context(), previousID)
+	if err != nil {
+		http.Error(w, "Rekam medis tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	attempt.PatientID = previous.PatientID
+	if previous.AuthorID != doctorID {
+		http.Error(w, "Akses ditolak: Hanya penulis rekam medis yang dapat mengamandemennya", http.StatusForbidden)
+		return
+	}
+	if previous.SupersededAt != nil {
+		http.Error(w, "Versi ini sudah diamandemen, amandemen harus dibuat dari versi terbaru", http.StatusConflict)
+		return
+	}
+	if !h.encounterAllowsWrite(r, previous.EncounterID, doctorID) && !h.requireWriteAccess(w, r, doctorID, previous.PatientID) {
+		return
+	}
+
+	var payload domain.AmendRecordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(payload.Reason) == "" {
+		http.Error(w, "Alasan amandemen (reason) wajib diisi", http.StatusBadRequest)
+		return
+	}
+	if !validateClinicalContent(w, &payload.ClinicalContent) || !h.checkDiagnosisCodes(w, r, &payload.ClinicalContent) {
+		return
+	}
+	if !h.resolveAttachments(w, r, payload.Attachments, doctorID, previous.Attachments) {
+		return
+	}
+
+	authorName, err := h.authorName(r, doctorID)
+	if err != nil {
+		log.Printf("Gagal mengambil nama dokter: %v", err)
+		http.Error(w, "Gagal memverifikasi data dokter", http.StatusInternalServerError)
+		return
+	}
+
+	searchIndex := search.Indexes(search.RecordTerms(payload.Diagnosis, payload.Notes, payload.ClinicalContent), h.blindIndexKey)
+
+	encrypted := make([]string, 3)
+	for i, plain := range []string{payload.Diagnosis, payload.Notes, payload.Reason} {
+		if encrypted[i], err = crypto.Encrypt(plain, h.encryptionKey); err != nil {
+			log.Printf("Gagal mengenkripsi amandemen: %v", err)
+			http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := encryptClinicalContent(&payload.ClinicalContent, h.encryptionKey, h.blindIndexKey); err != nil {
+		log.Printf("Gagal mengenkripsi isi klinis: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+	if err := encryptAttachments(payload.Attachments, h.encryptionKey); err != nil {
+		log.Printf("Gagal mengenkripsi metadata lampiran: %v", err)
+		http.Error(w, "Gagal memproses data", http.StatusInternalServerError)
+		return
+	}
+
+	amended := &domain.MedicalRecord{
+		PatientID:       previous.PatientID,
+		DoctorName:      authorName,
+		Diagnosis:       encrypted[0],
+		Notes:           encrypted[1],
+		AttachmentCID:   payload.AttachmentCID,
+		Attachments:     payload.Attachments,
+		AmendmentReason: encrypted[2],
+		AuthorID:        doctorID,
+		DoctorID:        h.doctorID(r, doctorID),
+		EncounterID:     previous.EncounterID, // Amandemen tetap berada di kunjungan yang sama.
+		ClinicalContent: payload.ClinicalContent,
+		SearchIndex:     searchIndex,
+	}
+	recordID, err := h.recordRepo.AmendRecord(r.Context(), previous.ID, amended)
+	if errors.Is(err, repository.ErrRecordSuperseded) {
+		http.Error(w, "Versi ini sudah diamandemen, amandemen harus dibuat dari versi terbaru", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal menyimpan amandemen rekam medis %s: %v", previous.ID, err)
+		http.Error(w, "Gagal menyimpan amandemen", http.StatusInternalServerError)
+		return
+	}
+	amended.ID = recordID
+	attempt.RecordID = recordID
+
+	tx, ok := h.anchorRecord(w, r, amended, previous.DataHash)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":  "Amandemen rekam medis berhasil disimpan dan dicatat di blockchain",
+		"recordID": recordID,
+		"version":  amended.Version,
+		"txHash":   tx.Hash().Hex(),
+	})
+}
+
+// GetRecordHistory lists every version of a record, newest first. Patients
+// reach it through /records/history/{record_id}; staff through the patient
+// route guarded by ConsentMiddleware, limited to the consent's scope.
+func (h *RecordHandler) GetRecordHistory(w http.ResponseWriter, r *http.Request) {
+	patientID := r.PathValue("patient_id")
+	if patientID == "" {
+		patientID, _ = r.Context().Value(middleware.UserIDKey).(string)
+	}
+
+	history, err := h.recordRepo.GetRecordHistory(r.Context(), r.PathValue("record_id"))
+	if err != nil {
+		log.Printf("Gagal mengambil riwayat rekam medis: %v", err)
+		http.Error(w, "Gagal mengambil riwayat rekam medis", http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 || history[0].PatientID != patientID {
+		http.Error(w, "Rekam medis tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	scope, _ := r.Context().Value(middleware.ConsentScopeKey).(*domain.ConsentScope)
+	if scope != nil {
+		versionIDs := make([]string, len(history))
+		for i := range history {
+			versionIDs[i] = history[i].ID
+		}
+		// Versi pertama berada di akhir daftar (terbaru lebih dulu).
+		if !scope.AllowsRecord(history[len(history)-1].CreatedAt, versionIDs...) {
+			http.Error(w, "Rekam medis tidak ditemukan", http.StatusNotFound)
+			return
+		}
+	}
+
+	for i := range history {
+		history[i].Diagnosis = h.decryptOrMark(history[i].Diagnosis)
+		history[i].Notes = h.decryptOrMark(history[i].Notes)
+		if history[i].AmendmentReason != "" {
+			history[i].AmendmentReason = h.decryptOrMark(history[i].AmendmentReason)
+		}
+		h.decryptClinicalContent(&history[i].ClinicalContent)
+		h.decryptAttachments(history[i].Attachments)
+		limitToScope(&history[i], scope)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// anchorRecord hashes a record version, records the hash on the blockchain and
+// stores both hashes on the version. On failure it writes the error response.
+func (h *RecordHandler) anchorRecord(w http.ResponseWriter, r *http.Request, record *domain.MedicalRecord, previousHash string) (*types.Transaction, bool) {
+	dataHash := recordDataHash(record, previousHash)
+	return h.anchorHash(w, "rekam medis "+record.ID, dataHash, func(txHash string) error {
+		return h.recordRepo.SetRecordAnchor(r.Context(), record.ID, dataHash, txHash)
+	})
+}
+
+// anchorHash records the hash of data that is already stored, described by
+// subject, on the blockchain and saves it with store. On failure, including
+// failing to save a hash that is already on the blockchain, it writes the
+// error response.
+func (h *RecordHandler) anchorHash(w http.ResponseWriter, subject, dataHash string, store func(txHash string) error) (*types.Transaction, bool) {
+	tx, err := h.blockchainClient.AddRecord(dataHash)
+	if err != nil {
+		log.Printf("Gagal mencatat transaksi %s ke blockchain: %v", subject, err)
+		// Datanya sudah tersimpan; jangan sampai klien mengirim ulang dan membuat duplikat.
+		http.Error(w, fmt.Sprintf("%s%s tersimpan, tetapi gagal dicatat ke blockchain", strings.ToUpper(subject[:1]), subject[1:]), http.StatusInternalServerError)
+		return nil, false
+	}
+	log.Printf("Transaksi berhasil dikirim ke blockchain! Hash Transaksi: %s", tx.Hash().Hex())
+
+	if err := store(tx.Hash().Hex()); err != nil {
+		log.Printf("Gagal menyimpan hash %s (transaksi %s): %v", subject, tx.Hash().Hex(), err)
+		// Tanpa data_hash dan tx_hash tersimpan, data ini tidak dapat diverifikasi terhadap blockchain.
+		http.Error(w, fmt.Sprintf("%s%s tersimpan dan dicatat di blockchain (transaksi %s), tetapi hash-nya gagal disimpan", strings.ToUpper(subject[:1]), subject[1:], tx.Hash().Hex()), http.StatusInternalServerError)
+		return nil, false
+	}
+	return tx, true
+}
+
+// recordDataHash returns the hash anchored for a record version. Version 1
+// keeps the original layout so hashes anchored before amendments existed
+// still match; later versions also commit to their predecessor and reason,
+// and structured clinical content, attachments and the encounter are appended
+// when present.
+func recordDataHash(record *domain.MedicalRecord, previousHash string) string {
+	recordData := fmt.Sprintf("%s%s%s%s%s%s", record.ID, record.PatientID, record.DoctorName, record.Diagnosis, record.Notes, record.AttachmentCID)
+	if record.Version > 1 {
+		recordData += fmt.Sprintf("|v%d|%s|%s|%s", record.Version, record.PreviousVersionID, previousHash, record.AmendmentReason)
+	}
+	if !record.ClinicalContent.IsEmpty() {
+		recordData += "|clinical" + clinicalHashInput(record.ClinicalContent)
+	}
+	if len(record.Attachments) > 0 {
+		recordData += "|attachments" + attachmentsHashInput(record.Attachments)
+	}
+	if record.EncounterID != "" {
+		recordData += "|encounter|" + record.EncounterID
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(recordData)))
+}
+
+// decryptOrMark decrypts a stored field, or returns a marker if that fails.
+func (h *RecordHandler) decryptOrMark(ciphertext string) string {
+	plaintext, err := crypto.Decrypt(ciphertext, h.encryptionKey)
+	if err != nil {
+		return "[Gagal Dekripsi Data]"
+	}
+	return plaintext
+}
+
+// authorName returns the name recorded as the author of a new record: the
+// doctor's name, or the service account's name for API key requests.
+func (h *RecordHandler) authorName(r *http.Request, userID string) (string, error) {
+	if serviceAccountID, ok := r.Context().Value(middleware.ServiceAccountIDKey).(string); ok {
+		claims, _ := r.Context().Value(middleware.ClaimsKey).(*domain.Claims)
+		log.Printf("[API-KEY] Rekam medis dibuat oleh akun layanan %s", serviceAccountID)
+		return claims.Name + " (sistem)", nil
+	}
+
+	doctor, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return "", err
+	}
+	// Gelar "dr." hanya untuk dokter; perawat dan petugas lab ditulis dengan namanya saja.
+	if doctor.Role != domain.RoleDoctor {
+		return doctor.Name, nil
+	}
+	return "dr. " + doctor.Name, nil
+}
+
+// doctorID returns the user ID to link a new record version to, or "" when
+// the request is authenticated with a service account's API key.
+func (h *RecordHandler) doctorID(r *http.Request, userID string) string {
+	if _, ok := r.Context().Value(middleware.ServiceAccountIDKey).(string); ok {
+		return ""
+	}
+	return userID
+}
+
+// GetAuthoredRecords handles a doctor listing the records they wrote, across
+// patients, one page at a time. Clinical content is only returned for
+// patients the doctor still has a consent from, limited to its scope like
+// GetPatientRecords; other records show their metadata. Break-glass access
+// does not apply here, since emergency reads must go through the audited
+// patient endpoints.
+func (h *RecordHandler) GetAuthoredRecords(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID dokter dari token", http.StatusInternalServerError)
+		return
+	}
+
+	filter, ok := h.parseRecordFilter(w, r)
+	if !ok {
+		return
+	}
+	records, total, err := h.recordRepo.ListDoctorRecords(r.Context(), doctorID, filter)
+	if err != nil {
+		log.Printf("Gagal mengambil rekam medis tulisan dokter %s: %v", doctorID, err)
+		http.Error(w, "Gagal mengambil rekam medis", http.StatusInternalServerError)
+		return
+	}
+	page := recordPage(records, total, filter.Limit)
+
+	patientIDs := make([]string, len(page.Items))
+	for i, record := range page.Items {
+		patientIDs[i] = record.PatientID
+	}
+	accesses, err := h.consentRepo.GetEffectiveAccess(r.Context(), doctorID, patientIDs, false)
+	if err != nil {
+		log.Printf("Gagal memeriksa izin akses dokter %s: %v", doctorID, err)
+		http.Error(w, "Gagal mengambil rekam medis", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range page.Items {
+		record := &page.Items[i]
+		scope, covered, err := h.authoredRecordScope(r, record, accesses)
+		if err != nil {
+			log.Printf("Gagal memeriksa cakupan izin rekam medis %s: %v", record.ID, err)
+			http.Error(w, "Gagal mengambil rekam medis", http.StatusInternalServerError)
+			return
+		}
+		if !covered {
+			// Izin pasien sudah berakhir atau tidak mencakup rekam medis ini: tampilkan metadata saja.
+			record.Diagnosis, record.Notes, record.AmendmentReason, record.AttachmentCID = "", "", "", ""
+			record.ClinicalContent = domain.ClinicalContent{}
+			record.Attachments = nil
+			record.ContentRestricted = true
+			continue
+		}
+		record.Diagnosis = h.decryptOrMark(record.Diagnosis)
+		record.Notes = h.decryptOrMark(record.Notes)
+		if record.AmendmentReason != "" {
+			record.AmendmentReason = h.decryptOrMark(record.AmendmentReason)
+		}
+		h.decryptClinicalContent(&record.ClinicalContent)
+		h.decryptAttachments(record.Attachments)
+		limitToScope(record, scope)
+		record.HistoryURL = "/records/patient/" + record.PatientID + "/history/" + record.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetMyRecords handles fetching records for the logged-in patient, one page at a time.
 func (h *RecordHandler) GetMyRecords(w http.ResponseWriter, r *http.Request) {
 	patientID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok {
@@ -115,56 +527,223 @@ func (h *RecordHandler) GetMyRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	records, err := h.recordRepo.GetRecordsByPatientID(r.Context(), patientID)
-	if err != nil { /* ... error handling ... */
+	filter, ok := h.parseRecordFilter(w, r)
+	if !ok {
+		return
+	}
+	records, total, err := h.recordRepo.ListPatientRecords(r.Context(), patientID, filter)
+	if err != nil {
+		log.Printf("Gagal mengambil rekam medis pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil rekam medis", http.StatusInternalServerError)
+		return
 	}
+	page := recordPage(records, total, filter.Limit)
 
-	// --- DECRYPT DATA ---
-	for i := range records {
-		decryptedDiagnosis, err := crypto.Decrypt(records[i].Diagnosis, h.encryptionKey)
+	// --- DECRYPT DATA (hanya halaman yang dikembalikan) ---
+	for i := range page.Items {
+		decryptedDiagnosis, err := crypto.Decrypt(page.Items[i].Diagnosis, h.encryptionKey)
 		if err == nil {
-			records[i].Diagnosis = decryptedDiagnosis
+			page.Items[i].Diagnosis = decryptedDiagnosis
 		}
-		decryptedNotes, err := crypto.Decrypt(records[i].Notes, h.encryptionKey)
+		decryptedNotes, err := crypto.Decrypt(page.Items[i].Notes, h.encryptionKey)
 		if err == nil {
-			records[i].Notes = decryptedNotes
+			page.Items[i].Notes = decryptedNotes
 		}
+		if page.Items[i].AmendmentReason != "" {
+			page.Items[i].AmendmentReason = h.decryptOrMark(page.Items[i].AmendmentReason)
+		}
+		h.decryptClinicalContent(&page.Items[i].ClinicalContent)
+		h.decryptAttachments(page.Items[i].Attachments)
+		page.Items[i].HistoryURL = "/records/history/" + page.Items[i].ID
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(records)
+	json.NewEncoder(w).Encode(page)
 }
 
-// GetPatientRecords handles a doctor fetching records for a specific patient.
+// GetPatientRecords handles a doctor fetching records for a specific patient,
+// one page at a time, limited to the scope of the patient's consent.
 func (h *RecordHandler) GetPatientRecords(w http.ResponseWriter, r *http.Request) {
 	patientID := r.PathValue("patient_id")
-	if patientID == "" { /* ... error handling ... */
+	if patientID == "" {
+		http.Error(w, "ID pasien tidak boleh kosong", http.StatusBadRequest)
+		return
 	}
 
-	records, err := h.recordRepo.GetRecordsByPatientID(r.Context(), patientID)
-	if err != nil { /* ... error handling ... */
+	filter, ok := h.parseRecordFilter(w, r)
+	if !ok {
+		return
+	}
+	records, total, err := h.recordRepo.ListPatientRecords(r.Context(), patientID, filter)
+	if err != nil {
+		log.Printf("Gagal mengambil rekam medis pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal mengambil rekam medis", http.StatusInternalServerError)
+		return
 	}
+	page := recordPage(records, total, filter.Limit)
 
-	// --- DECRYPT DATA ---
-	for i := range records {
-		decryptedDiagnosis, err := crypto.Decrypt(records[i].Diagnosis, h.encryptionKey)
+	// --- DECRYPT DATA (hanya halaman yang dikembalikan) ---
+	for i := range page.Items {
+		decryptedDiagnosis, err := crypto.Decrypt(page.Items[i].Diagnosis, h.encryptionKey)
 		if err == nil {
-			records[i].Diagnosis = decryptedDiagnosis
+			page.Items[i].Diagnosis = decryptedDiagnosis
 		} else {
-			records[i].Diagnosis = "[Gagal Dekripsi Data]" // Tampilkan pesan jika gagal
+			page.Items[i].Diagnosis = "[Gagal Dekripsi Data]" // Tampilkan pesan jika gagal
 		}
-		decryptedNotes, err := crypto.Decrypt(records[i].Notes, h.encryptionKey)
+		decryptedNotes, err := crypto.Decrypt(page.Items[i].Notes, h.encryptionKey)
 		if err == nil {
-			records[i].Notes = decryptedNotes
+			page.Items[i].Notes = decryptedNotes
 		} else {
-			records[i].Notes = "[Gagal Dekripsi Data]"
+			page.Items[i].Notes = "[Gagal Dekripsi Data]"
 		}
+		if page.Items[i].AmendmentReason != "" {
+			page.Items[i].AmendmentReason = h.decryptOrMark(page.Items[i].AmendmentReason)
+		}
+		h.decryptClinicalContent(&page.Items[i].ClinicalContent)
+		h.decryptAttachments(page.Items[i].Attachments)
+		limitToScope(&page.Items[i], filter.Scope)
+		page.Items[i].HistoryURL = "/records/patient/" + patientID + "/history/" + page.Items[i].ID
 	}
 
-	if records == nil {
-		records = make([]domain.MedicalRecord, 0)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// SearchMyRecords handles keyword search over the logged-in patient's records.
+// It takes the same parameters as GetMyRecords and requires q.
+func (h *RecordHandler) SearchMyRecords(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSpace(r.URL.Query().Get("q")) == "" {
+		http.Error(w, "Parameter pencarian q wajib diisi", http.StatusBadRequest)
+		return
 	}
+	h.GetMyRecords(w, r)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(records)
+// SearchPatientRecords handles keyword search over a patient's records by
+// staff with access. It takes the same parameters as GetPatientRecords and requires q.
+func (h *RecordHandler) SearchPatientRecords(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSpace(r.URL.Query().Get("q")) == "" {
+		http.Error(w, "Parameter pencarian q wajib diisi", http.StatusBadRequest)
+		return
+	}
+	h.GetPatientRecords(w, r)
+}
+
+// parseRecordFilter reads the listing query parameters: cursor, limit (1-100,
+// default 20), from and to (YYYY-MM-DD or RFC3339; a date in "to" includes the
+// whole day), doctor_id, encounter_id, diagnosis_code, has_attachment, q
+// (keywords that must all appear) and sort (newest|oldest).
+func (h *RecordHandler) parseRecordFilter(w http.ResponseWriter, r *http.Request) (domain.RecordFilter, bool) {
+	query := r.URL.Query()
+	filter := domain.RecordFilter{Limit: 20, Sort: domain.RecordSortNewest}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			http.Error(w, "limit harus antara 1 dan 100", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if value != domain.RecordSortNewest && value != domain.RecordSortOldest {
+			http.Error(w, "sort harus 'newest' atau 'oldest'", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Sort = value
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		var cursor domain.RecordCursor
+		if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.ID == "" {
+			http.Error(w, "cursor tidak valid", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Cursor = &cursor
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			date, dateErr := time.Parse("2006-01-02", value)
+			if dateErr != nil {
+				http.Error(w, bound.name+" harus berformat YYYY-MM-DD atau RFC3339", http.StatusBadRequest)
+				return filter, false
+			}
+			// Tanggal pada "to" berarti sampai akhir hari tersebut.
+			if bound.name == "to" {
+				date = date.AddDate(0, 0, 1)
+			}
+			t = date
+		}
+		*bound.target = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		http.Error(w, "from harus sebelum to", http.StatusBadRequest)
+		return filter, false
+	}
+
+	filter.DoctorID = strings.TrimSpace(query.Get("doctor_id"))
+	filter.EncounterID = strings.TrimSpace(query.Get("encounter_id"))
+
+	if code := strings.ToUpper(strings.TrimSpace(query.Get("diagnosis_code"))); code != "" {
+		filter.DiagnosisCodeIndex = crypto.BlindIndex(code, h.blindIndexKey)
+	}
+
+	if q := query.Get("q"); strings.TrimSpace(q) != "" {
+		terms := search.Terms(q)
+		if len(terms) == 0 {
+			http.Error(w, "Kata pencarian terlalu pendek atau terlalu umum", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.TermIndexes = search.Indexes(terms, h.blindIndexKey)
+	}
+
+	if value := query.Get("has_attachment"); value != "" {
+		hasAttachment, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "has_attachment harus true atau false", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.HasAttachment = &hasAttachment
+	}
+
+	// Filter tidak boleh membocorkan isi yang berada di luar cakupan izin pasien.
+	if scope, ok := r.Context().Value(middleware.ConsentScopeKey).(*domain.ConsentScope); ok && !scope.Unrestricted() {
+		switch {
+		case filter.HasAttachment != nil && !scope.AllowsAttachments():
+			http.Error(w, "Akses ditolak: Izin pasien tidak mencakup lampiran", http.StatusForbidden)
+			return filter, false
+		case filter.DiagnosisCodeIndex != "" && !scope.AllowsCategory(domain.ScopeCategoryDiagnoses):
+			http.Error(w, "Akses ditolak: Izin pasien tidak mencakup diagnosis", http.StatusForbidden)
+			return filter, false
+		case len(filter.TermIndexes) > 0 && len(scope.Categories) > 0:
+			http.Error(w, "Akses ditolak: Pencarian kata kunci hanya tersedia jika izin pasien mencakup seluruh isi rekam medis", http.StatusForbidden)
+			return filter, false
+		}
+		filter.Scope = scope
+	}
+	return filter, true
+}
+
+// recordPage drops the extra row fetched to detect a following page and
+// builds the cursor pointing at the last record returned.
+func recordPage(records []domain.MedicalRecord, total, limit int) domain.RecordPage {
+	page := domain.RecordPage{Items: records, Total: total}
+	if len(records) > limit {
+		page.Items = records[:limit]
+		last := page.Items[limit-1]
+		cursor, _ := json.Marshal(domain.RecordCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(cursor)
+	}
+	return page
 }
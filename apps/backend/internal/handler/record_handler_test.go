@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+)
+
+func testRecordVersion() *domain.MedicalRecord {
+	return &domain.MedicalRecord{
+		ID:            "a1b2c3d4-0000-4000-8000-000000000001",
+		PatientID:     testPatientID,
+		DoctorName:    "dr. Uji",
+		Diagnosis:     "Demam berdarah",
+		Notes:         "Rawat jalan",
+		AttachmentCID: "bafyoldcid",
+		Version:       1,
+	}
+}
+
+func TestRecordDataHashKeepsLegacyLayoutForFirstVersion(t *testing.T) {
+	record := testRecordVersion()
+	// Hash yang sudah tercatat di blockchain sebelum ada amandemen harus tetap cocok.
+	legacy := fmt.Sprintf("%x", sha256.Sum256([]byte(record.ID+record.PatientID+record.DoctorName+record.Diagnosis+record.Notes+record.AttachmentCID)))
+	if got := recordDataHash(record, ""); got != legacy {
+		t.Fatalf("version 1 hash = %s, want legacy %s", got, legacy)
+	}
+	if recordDataHash(record, "ignored") != legacy {
+		t.Fatal("version 1 has no predecessor and must not depend on previousHash")
+	}
+}
+
+func TestRecordDataHashChainsAmendments(t *testing.T) {
+	first := testRecordVersion()
+	firstHash := recordDataHash(first, "")
+
+	amended := testRecordVersion()
+	amended.ID = "a1b2c3d4-0000-4000-8000-000000000002"
+	amended.Version = 2
+	amended.PreviousVersionID = first.ID
+	amended.AmendmentReason = "Salah ketik diagnosis"
+	amended.Diagnosis = "Demam tifoid"
+	amendedHash := recordDataHash(amended, firstHash)
+
+	if amendedHash == firstHash {
+		t.Fatal("an amendment must not hash like its predecessor")
+	}
+
+	// Mengubah versi sebelumnya mengubah hash-nya, sehingga rantai ke amandemen putus.
+	tampered := testRecordVersion()
+	tampered.Diagnosis = "Diagnosis lain"
+	if recordDataHash(amended, recordDataHash(tampered, "")) == amendedHash {
+		t.Fatal("amendment hash must commit to the predecessor's hash")
+	}
+
+	changes := map[string]func(r *domain.MedicalRecord){
+		"version":          func(r *domain.MedicalRecord) { r.Version = 3 },
+		"previous version": func(r *domain.MedicalRecord) { r.PreviousVersionID = "a1b2c3d4-0000-4000-8000-000000000009" },
+		"reason":           func(r *domain.MedicalRecord) { r.AmendmentReason = "Alasan lain" },
+		"notes":            func(r *domain.MedicalRecord) { r.Notes = "Rawat inap" },
+		"encounter":        func(r *domain.MedicalRecord) { r.EncounterID = "e1" },
+		"clinical content": func(r *domain.MedicalRecord) {
+			r.Diagnoses = []domain.RecordDiagnosis{{Code: "A01.0", Description: "Demam tifoid", Primary: true}}
+		},
+		"attachment": func(r *domain.MedicalRecord) {
+			r.Attachments = []domain.RecordAttachment{{CID: "bafynew", Filename: "lab.pdf", MIMEType: "application/pdf", Size: 10, SHA256: "ab", UploadedAt: time.Unix(0, 0)}}
+		},
+	}
+	for name, change := range changes {
+		changed := *amended
+		change(&changed)
+		if recordDataHash(&changed, firstHash) == amendedHash {
+			t.Errorf("changing the %s did not change the hash", name)
+		}
+	}
+}
+
+func TestAmendRecordChecksAuthorAndLatestVersionFirst(t *testing.T) {
+	superseded := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	records := &fakeRecordRepo{records: []domain.MedicalRecord{
+		{ID: "a1b2c3d4-0000-4000-8000-000000000011", PatientID: testPatientID, AuthorID: testColleagueID, Version: 1},
+		{ID: "a1b2c3d4-0000-4000-8000-000000000012", PatientID: testPatientID, AuthorID: testDoctorID, Version: 1, SupersededAt: &superseded},
+	}}
+	cases := []struct {
+		name     string
+		recordID string
+		status   int
+		outcome  string
+	}{
+		{"someone else's record", records.records[0].ID, http.StatusForbidden, domain.WriteOutcomeDenied},
+		{"superseded version", records.records[1].ID, http.StatusConflict, domain.WriteOutcomeRejected},
+	}
+	for _, tc := range cases {
+		logs := &fakeLogRepo{}
+		// Tanpa repositori izin: pemeriksaan izin, isi body dan lampiran tidak boleh dijalankan lebih dulu.
+		h := &RecordHandler{recordRepo: records, logRepo: logs}
+		r := httptest.NewRequest(http.MethodPost, "/records/"+tc.recordID+"/amend", strings.NewReader("bukan json"))
+		r.SetPathValue("record_id", tc.recordID)
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, testDoctorID))
+		w := httptest.NewRecorder()
+		h.AmendRecord(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.status, w.Body)
+		}
+		if len(logs.writes) != 1 || logs.writes[0].Outcome != tc.outcome || logs.writes[0].PatientID != testPatientID {
+			t.Errorf("%s: audited %+v, want one %s attempt for the patient", tc.name, logs.writes, tc.outcome)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/auth"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	// defaultAPIKeyRateLimit applies when the admin does not set a per-minute limit.
+	defaultAPIKeyRateLimit = 60
+	// defaultAPIKeyLifetime applies when the admin does not set an expiry.
+	defaultAPIKeyLifetime = 365 * 24 * time.Hour
+	// apiKeyDisplayLength is how much of the key is kept in clear text to identify it.
+	apiKeyDisplayLength = 12
+)
+
+// ServiceAccountHandler handles service accounts for hospital system
+// integrations and the API keys they authenticate with.
+type ServiceAccountHandler struct {
+	serviceRepo repository.ServiceAccountRepository
+}
+
+// NewServiceAccountHandler creates a new instance of ServiceAccountHandler.
+func NewServiceAccountHandler(serviceRepo repository.ServiceAccountRepository) *ServiceAccountHandler {
+	return &ServiceAccountHandler{serviceRepo: serviceRepo}
+}
+
+// HandleCreate creates a service account owned by a facility.
+func (h *ServiceAccountHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID admin dari token", http.StatusInternalServerError)
+		return
+	}
+
+	var payload domain.ServiceAccountPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if payload.FacilityID == "" || strings.TrimSpace(payload.Name) == "" {
+		http.Error(w, "facility_id dan name wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.serviceRepo.CreateServiceAccount(r.Context(), domain.ServiceAccount{
+		FacilityID:  payload.FacilityID,
+		Name:        strings.TrimSpace(payload.Name),
+		Description: payload.Description,
+		CreatedBy:   adminID,
+	})
+	if errors.Is(err, repository.ErrFacilityNotFound) {
+		http.Error(w, "Fasilitas tidak ditemukan", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Gagal membuat akun layanan: %v", err)
+		http.Error(w, "Gagal membuat akun layanan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":            "Akun layanan berhasil dibuat",
+		"service_account_id": id,
+	})
+}
+
+// HandleList lists every service account.
+func (h *ServiceAccountHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.serviceRepo.ListServiceAccounts(r.Context())
+	if err != nil {
+		log.Printf("Gagal mengambil daftar akun layanan: %v", err)
+		http.Error(w, "Gagal mengambil daftar akun layanan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+// HandleCreateKey issues a new API key. The key is returned once and only its
+// hash is stored.
+func (h *ServiceAccountHandler) HandleCreateKey(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID admin dari token", http.StatusInternalServerError)
+		return
+	}
+	serviceAccountID := r.PathValue("service_account_id")
+
+	var payload domain.APIKeyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Request body tidak valid", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Scopes) == 0 {
+		http.Error(w, "Minimal satu scope dibutuhkan", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range payload.Scopes {
+		if !slices.Contains(domain.ServiceScopes, scope) {
+			http.Error(w, "Scope tidak diizinkan untuk akun layanan: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	if payload.RateLimitPerMinute < 0 {
+		http.Error(w, "rate_limit_per_minute tidak boleh negatif", http.StatusBadRequest)
+		return
+	}
+	if payload.RateLimitPerMinute == 0 {
+		payload.RateLimitPerMinute = defaultAPIKeyRateLimit
+	}
+	expiresAt := time.Now().Add(defaultAPIKeyLifetime)
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at harus di masa depan", http.StatusBadRequest)
+			return
+		}
+		expiresAt = *payload.ExpiresAt
+	}
+
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		http.Error(w, "Gagal membuat API key", http.StatusInternalServerError)
+		return
+	}
+
+	key := domain.APIKey{
+		ServiceAccountID:   serviceAccountID,
+		Prefix:             apiKey[:apiKeyDisplayLength],
+		Scopes:             payload.Scopes,
+		RateLimitPerMinute: payload.RateLimitPerMinute,
+		ExpiresAt:          expiresAt,
+	}
+	keyID, err := h.serviceRepo.CreateAPIKey(r.Context(), key, auth.HashToken(apiKey), adminID)
+	if err != nil {
+		log.Printf("Gagal menyimpan API key untuk akun layanan %s: %v", serviceAccountID, err)
+		http.Error(w, "Gagal membuat API key (akun layanan tidak ditemukan?)", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin %s menerbitkan API key %s untuk akun layanan %s dengan scope %v", adminID, key.Prefix, serviceAccountID, key.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":    "API key berhasil dibuat. Simpan key ini, key tidak akan ditampilkan lagi.",
+		"key_id":     keyID,
+		"api_key":    apiKey,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+	})
+}
+
+// HandleListKeys lists the API keys of a service account without their secrets.
+func (h *ServiceAccountHandler) HandleListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.serviceRepo.ListAPIKeys(r.Context(), r.PathValue("service_account_id"))
+	if err != nil {
+		log.Printf("Gagal mengambil daftar API key: %v", err)
+		http.Error(w, "Gagal mengambil daftar API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// HandleRevokeKey revokes an API key immediately.
+func (h *ServiceAccountHandler) HandleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	revoked, err := h.serviceRepo.RevokeAPIKey(r.Context(), r.PathValue("service_account_id"), r.PathValue("key_id"))
+	if err != nil {
+		log.Printf("Gagal mencabut API key: %v", err)
+		http.Error(w, "Gagal mencabut API key", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "API key tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "API key berhasil dicabut",
+	})
+}
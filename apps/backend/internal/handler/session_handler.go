@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+// SessionHandler handles listing and revoking the logged-in user's sessions.
+type SessionHandler struct {
+	sessionRepo repository.SessionRepository
+}
+
+// NewSessionHandler creates a new instance of SessionHandler.
+func NewSessionHandler(sessionRepo repository.SessionRepository) *SessionHandler {
+	return &SessionHandler{sessionRepo: sessionRepo}
+}
+
+// HandleGetMySessions lists the active sessions (devices) of the logged-in user.
+func (h *SessionHandler) HandleGetMySessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+	currentSessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	sessions, err := h.sessionRepo.GetSessionsByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Gagal mengambil sesi user %s: %v", userID, err)
+		http.Error(w, "Gagal mengambil data sesi", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// HandleRevokeSession revokes one of the logged-in user's sessions.
+func (h *SessionHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Gagal mendapatkan ID pengguna dari token", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := r.PathValue("session_id")
+	if sessionID == "" {
+		http.Error(w, "Session ID dibutuhkan", http.StatusBadRequest)
+		return
+	}
+
+	rowsAffected, err := h.sessionRepo.RevokeSession(r.Context(), sessionID, userID)
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Sesi tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Sesi berhasil dicabut",
+	})
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+// TerminologyHandler handles lookups in the clinical code catalogs.
+type TerminologyHandler struct {
+	terminologyRepo repository.TerminologyRepository
+}
+
+// NewTerminologyHandler creates a new instance of TerminologyHandler.
+func NewTerminologyHandler(terminologyRepo repository.TerminologyRepository) *TerminologyHandler {
+	return &TerminologyHandler{terminologyRepo: terminologyRepo}
+}
+
+// HandleSearchICD10 serves autocomplete: ?q= matches a code prefix ("E11")
+// or words of the English or Indonesian name ("diabetes", "demam ber").
+// ?lang=en|id picks the display name; Indonesian is the default.
+func (h *TerminologyHandler) HandleSearchICD10(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(make([]domain.ICD10Code, 0))
+		return
+	}
+
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			http.Error(w, "limit harus antara 1 dan 100", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	codes, err := h.terminologyRepo.SearchICD10(r.Context(), icd10CodePrefix(query), icd10TextQuery(query), limit)
+	if err != nil {
+		log.Printf("Gagal mencari kode ICD-10 %q: %v", query, err)
+		http.Error(w, "Gagal mencari kode ICD-10", http.StatusInternalServerError)
+		return
+	}
+
+	lang := displayLanguage(r)
+	for i := range codes {
+		codes[i].Display = icd10Display(codes[i], lang)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+// HandleGetICD10 returns a single catalog entry.
+func (h *TerminologyHandler) HandleGetICD10(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.TrimSpace(r.PathValue("code")))
+
+	found, err := h.terminologyRepo.GetICD10Codes(r.Context(), []string{code})
+	if err != nil {
+		log.Printf("Gagal mengambil kode ICD-10 %s: %v", code, err)
+		http.Error(w, "Gagal mengambil kode ICD-10", http.StatusInternalServerError)
+		return
+	}
+	entry, ok := found[code]
+	if !ok {
+		http.Error(w, "Kode ICD-10 tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	entry.Display = icd10Display(entry, displayLanguage(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// icd10CodePrefixPattern matches the start of an ICD-10 code: "E", "E1", "E11", "E11.", "E11.9".
+var icd10CodePrefixPattern = regexp.MustCompile(`^[A-Z]([0-9]{0,2}|[0-9]{2}\.[0-9A-Z]{0,4})$`)
+
+// icd10CodePrefix returns the query as a code prefix, or "" if it cannot be
+// the start of a code.
+func icd10CodePrefix(query string) string {
+	prefix := strings.ToUpper(query)
+	if !icd10CodePrefixPattern.MatchString(prefix) {
+		return ""
+	}
+	return prefix
+}
+
+// icd10TextQuery turns free text into a to_tsquery expression in which every
+// word must match as a prefix, e.g. "demam ber" -> "demam:* & ber:*".
+func icd10TextQuery(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// displayLanguage returns "en" or "id" from ?lang= or the Accept-Language header.
+func displayLanguage(r *http.Request) string {
+	lang := strings.ToLower(r.URL.Query().Get("lang"))
+	if lang == "" {
+		lang = strings.ToLower(r.Header.Get("Accept-Language"))
+	}
+	if strings.HasPrefix(lang, "en") {
+		return "en"
+	}
+	return "id"
+}
+
+func icd10Display(code domain.ICD10Code, lang string) string {
+	if lang == "en" {
+		return code.NameEN
+	}
+	return code.NameID
+}
@@ -15,12 +15,13 @@ import (
 
 // UserHandler handles user-related HTTP requests like searching.
 type UserHandler struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	consentRepo repository.ConsentRepository
 }
 
 // NewUserHandler creates a new instance of UserHandler.
-func NewUserHandler(userRepo repository.UserRepository) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo repository.UserRepository, consentRepo repository.ConsentRepository) *UserHandler {
+	return &UserHandler{userRepo: userRepo, consentRepo: consentRepo}
 }
 
 // HandleSearchUsers handles searching for patients by name or email.
@@ -41,8 +42,14 @@ func (h *UserHandler) HandleSearchUsers(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Panggil repository dengan doctorID
-	users, err := h.userRepo.SearchUsers(r.Context(), query, doctorID)
+	// Akun layanan hanya dapat menemukan pasien yang mengizinkan sistem fasilitasnya.
+	var users []domain.PublicUser
+	var err error
+	if _, isService := r.Context().Value(middleware.ServiceAccountIDKey).(string); isService {
+		users, err = h.userRepo.SearchPatientsForServiceAccount(r.Context(), query, doctorID)
+	} else {
+		users, err = h.userRepo.SearchUsers(r.Context(), query, doctorID)
+	}
 	if err != nil {
 		log.Printf("Gagal mencari user: %v", err)
 		http.Error(w, "Gagal mencari user", http.StatusInternalServerError)
@@ -91,9 +98,14 @@ func (h *UserHandler) HandleGetMyProfile(w http.ResponseWriter, r *http.Request)
 		Role:           user.Role,
 		FormattedID:    formattedID,
 		NIP:            user.NIP,
+		STRNumber:      user.STRNumber,
+		SIPNumber:      user.SIPNumber,
 		Phone:          user.Phone,
 		Specialization: user.Specialization,
 	}
+	if user.Role != domain.RolePatient && user.Role != domain.RoleAdmin {
+		userProfile.VerificationStatus = user.VerificationStatus
+	}
 
 	// 5. Kirim respons JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -115,6 +127,19 @@ func (h *UserHandler) HandleGetPatientProfile(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if serviceAccountID, isService := r.Context().Value(middleware.ServiceAccountIDKey).(string); isService {
+		accesses, err := h.consentRepo.GetEffectiveAccess(r.Context(), serviceAccountID, []string{patientID}, false)
+		if err != nil {
+			log.Printf("Gagal memeriksa izin akun layanan %s untuk pasien %s: %v", serviceAccountID, patientID, err)
+			http.Error(w, "Gagal memeriksa izin pasien", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := accesses[patientID]; !ok {
+			http.Error(w, "Akses ditolak: Pasien belum mengizinkan sistem fasilitas Anda", http.StatusForbidden)
+			return
+		}
+	}
+
 	// 2. Panggil repository untuk mendapatkan detail user
 	user, err := h.userRepo.GetUserByID(r.Context(), patientID)
 	if err != nil {
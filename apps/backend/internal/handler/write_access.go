@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/middleware"
+)
+
+// auditedWriter remembers the status and error message of a response so a
+// record write attempt can be logged with its outcome.
+type auditedWriter struct {
+	http.ResponseWriter
+	status int
+	detail string
+}
+
+func (w *auditedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && w.detail == "" {
+		w.detail = strings.TrimSpace(string(b))
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// auditWrite stores a record write attempt in the patient's audit log once
+// the response is complete. Attempts against an unknown patient, whose
+// PatientID was never set, only go to the server log.
+func (h *RecordHandler) auditWrite(r *http.Request, w *auditedWriter, attempt *domain.RecordWriteAttempt) {
+	if claims, ok := r.Context().Value(middleware.ClaimsKey).(*domain.Claims); ok {
+		attempt.ActorName = claims.Name
+		if claims.Role == domain.RoleService {
+			attempt.ActorName += " (sistem)"
+		}
+	}
+	switch {
+	case attempt.RecordID != "" && w.status >= http.StatusInternalServerError:
+		// RecordID hanya terisi setelah rekam medis tersimpan, jadi yang gagal adalah pencatatan ke blockchain.
+		attempt.Outcome = domain.WriteOutcomeUnanchored
+	case w.status < http.StatusBadRequest:
+		attempt.Outcome = domain.WriteOutcomeSuccess
+	case w.status == http.StatusForbidden:
+		attempt.Outcome = domain.WriteOutcomeDenied
+	case w.status < http.StatusInternalServerError:
+		attempt.Outcome = domain.WriteOutcomeRejected
+	default:
+		attempt.Outcome = domain.WriteOutcomeFailed
+	}
+	if attempt.Outcome != domain.WriteOutcomeSuccess {
+		attempt.Detail = w.detail
+	}
+	if attempt.PatientID == "" {
+		log.Printf("[AUDIT] Percobaan menulis rekam medis oleh %s (%s) untuk pasien tidak dikenal: %s", attempt.ActorName, attempt.ActorID, attempt.Detail)
+		return
+	}
+
+	// Tetap dicatat walaupun klien sudah memutus koneksi.
+	if err := h.logRepo.LogRecordWrite(context.WithoutCancel(r.Context()), attempt); err != nil {
+		log.Printf("Gagal mencatat percobaan menulis rekam medis pasien %s oleh %s: %v", attempt.PatientID, attempt.ActorID, err)
+	}
+}
+
+// checkPatient verifies that patientID belongs to a patient account.
+func (h *RecordHandler) checkPatient(w http.ResponseWriter, r *http.Request, patientID string) bool {
+	patient, err := h.userRepo.GetUserByID(r.Context(), patientID)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "22P02": // bukan UUID yang valid
+		http.Error(w, "Pasien tidak ditemukan", http.StatusNotFound)
+		return false
+	case err != nil:
+		log.Printf("Gagal mengambil data pasien %s: %v", patientID, err)
+		http.Error(w, "Gagal memverifikasi data pasien", http.StatusInternalServerError)
+		return false
+	case patient.Role != domain.RolePatient:
+		http.Error(w, "Pasien tidak ditemukan", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// requireWriteAccess checks that the consent the writer currently holds from
+// the patient, chosen like for reads (the most recently granted one), is
+// valid and includes write access. Break-glass never counts. Writing into an
+// open encounter the writer takes part in needs no consent of its own; see
+// requireOpenEncounter.
+func (h *RecordHandler) requireWriteAccess(w http.ResponseWriter, r *http.Request, writerID, patientID string) bool {
+	accesses, err := h.consentRepo.GetEffectiveAccess(r.Context(), writerID, []string{patientID}, false)
+	if err != nil {
+		log.Printf("Gagal memeriksa izin %s untuk pasien %s: %v", writerID, patientID, err)
+		http.Error(w, "Gagal memeriksa izin pasien", http.StatusInternalServerError)
+		return false
+	}
+	access, ok := accesses[patientID]
+	if !ok {
+		http.Error(w, "Akses ditolak: Tidak ada izin aktif dari pasien ini", http.StatusForbidden)
+		return false
+	}
+	scope, err := domain.ParseConsentScope(access.DataScope)
+	if err != nil {
+		http.Error(w, "Akses ditolak: Cakupan izin dari pasien ini tidak valid", http.StatusForbidden)
+		return false
+	}
+	if !scope.Write {
+		http.Error(w, "Akses ditolak: Izin dari pasien ini hanya mencakup akses baca, bukan menulis rekam medis", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// encounterAllowsWrite reports whether encounterID is an open encounter that
+// writerID may add data to. Lookup errors count as no.
+func (h *RecordHandler) encounterAllowsWrite(r *http.Request, encounterID, writerID string) bool {
+	if encounterID == "" {
+		return false
+	}
+	encounter, err := h.encounterRepo.GetEncounterByID(r.Context(), encounterID)
+	if err != nil || encounter.Status != domain.EncounterOpen {
+		return false
+	}
+	allowed, err := h.encounterRepo.CanWriteToEncounter(r.Context(), encounter.ID, writerID)
+	if err != nil {
+		log.Printf("Gagal memeriksa akses %s ke kunjungan %s: %v", writerID, encounter.ID, err)
+		return false
+	}
+	return allowed
+}
+
+// requireOpenEncounter loads an encounter that writerID may add data to: it
+// must exist, still be open, and have the writer as a participant (its
+// attending doctor, whoever opened it, or a clinician added to it).
+func (h *RecordHandler) requireOpenEncounter(w http.ResponseWriter, r *http.Request, encounterID, writerID string) (*domain.Encounter, bool) {
+	encounter, err := h.encounterRepo.GetEncounterByID(r.Context(), encounterID)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "22P02":
+		http.Error(w, "Kunjungan tidak ditemukan", http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		log.Printf("Gagal mengambil kunjungan %s: %v", encounterID, err)
+		http.Error(w, "Gagal memverifikasi data kunjungan", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	allowed, err := h.encounterRepo.CanWriteToEncounter(r.Context(), encounter.ID, writerID)
+	if err != nil {
+		log.Printf("Gagal memeriksa akses %s ke kunjungan %s: %v", writerID, encounter.ID, err)
+		http.Error(w, "Gagal memverifikasi data kunjungan", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !allowed {
+		http.Error(w, "Akses ditolak: Hanya peserta kunjungan ini yang dapat menambah datanya", http.StatusForbidden)
+		return nil, false
+	}
+	if encounter.Status != domain.EncounterOpen {
+		http.Error(w, "Kunjungan sudah ditutup", http.StatusConflict)
+		return nil, false
+	}
+	return encounter, true
+}
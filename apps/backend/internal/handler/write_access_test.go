@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const testEncounterID = "e0c0e0c0-0000-4000-8000-000000000001"
+
+// fakeAccessRepo serves GetEffectiveAccess from a fixed map, as the
+// repository would after choosing one grant per patient.
+type fakeAccessRepo struct {
+	repository.ConsentRepository
+	accesses   map[string]domain.PatientAccess
+	breakGlass []bool
+}
+
+func (f *fakeAccessRepo) GetEffectiveAccess(ctx context.Context, accessorID string, patientIDs []string, breakGlass bool) (map[string]domain.PatientAccess, error) {
+	f.breakGlass = append(f.breakGlass, breakGlass)
+	found := make(map[string]domain.PatientAccess)
+	for _, id := range patientIDs {
+		if access, ok := f.accesses[id]; ok {
+			found[id] = access
+		}
+	}
+	return found, nil
+}
+
+func consentAccess(patientID, scope string) map[string]domain.PatientAccess {
+	return map[string]domain.PatientAccess{patientID: {PatientID: patientID, Source: domain.AccessSourceConsent, DataScope: scope}}
+}
+
+type fakeEncounterRepo struct {
+	repository.EncounterRepository
+	encounter domain.Encounter
+	writers   []string
+}
+
+func (f *fakeEncounterRepo) GetEncounterByID(ctx context.Context, encounterID string) (*domain.Encounter, error) {
+	encounter := f.encounter
+	return &encounter, nil
+}
+
+func (f *fakeEncounterRepo) CanWriteToEncounter(ctx context.Context, encounterID, writerID string) (bool, error) {
+	for _, id := range f.writers {
+		if id == writerID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeEncounterRepo) CreateEncounter(ctx context.Context, encounter *domain.Encounter) (string, error) {
+	f.encounter = *encounter
+	f.encounter.ID = testEncounterID
+	return testEncounterID, nil
+}
+
+// AddParticipant adds to writers, since participants may add data.
+func (f *fakeEncounterRepo) AddParticipant(ctx context.Context, encounterID, participantID, addedBy string) error {
+	f.writers = append(f.writers, participantID)
+	return nil
+}
+
+type fakeLogRepo struct {
+	repository.LogRepository
+	writes []domain.RecordWriteAttempt
+}
+
+func (f *fakeLogRepo) LogRecordWrite(ctx context.Context, attempt *domain.RecordWriteAttempt) error {
+	f.writes = append(f.writes, *attempt)
+	return nil
+}
+
+func TestRequireWriteAccessHonoursScopeAndLegacyGrants(t *testing.T) {
+	cases := []struct {
+		name     string
+		accesses map[string]domain.PatientAccess
+		write    bool
+	}{
+		{"no consent", nil, false},
+		// Izin lama berlabel bebas disetujui pasien sebagai akses baca, jadi tidak pernah berarti izin menulis.
+		{"legacy label", consentAccess(testPatientID, "all"), false},
+		{"read-only scope", consentAccess(testPatientID, `{"all":true}`), false},
+		{"write scope", consentAccess(testPatientID, `{"categories":["vitals"],"write":true}`), true},
+		{"invalid scope", consentAccess(testPatientID, `{"write":"ya"}`), false},
+	}
+	for _, tc := range cases {
+		consents := &fakeAccessRepo{accesses: tc.accesses}
+		h := &RecordHandler{consentRepo: consents}
+		r := httptest.NewRequest(http.MethodPost, "/records", nil)
+		if got := h.requireWriteAccess(httptest.NewRecorder(), r, testDoctorID, testPatientID); got != tc.write {
+			t.Errorf("%s: write access = %v, want %v", tc.name, got, tc.write)
+		}
+		if slices.Contains(consents.breakGlass, true) {
+			t.Errorf("%s: break-glass must never count as consent to write", tc.name)
+		}
+	}
+}
+
+func TestEncounterAllowsWriteOnlyWhileOpenForItsWriters(t *testing.T) {
+	encounters := &fakeEncounterRepo{
+		encounter: domain.Encounter{ID: testEncounterID, PatientID: testPatientID, Status: domain.EncounterOpen},
+		writers:   []string{testDoctorID},
+	}
+	h := &RecordHandler{encounterRepo: encounters}
+	r := httptest.NewRequest(http.MethodPost, "/records", nil)
+
+	if !h.encounterAllowsWrite(r, testEncounterID, testDoctorID) {
+		t.Error("open encounter must stand in for a write consent")
+	}
+	if h.encounterAllowsWrite(r, testEncounterID, testUploaderID) {
+		t.Error("a writer the encounter does not allow got access")
+	}
+	if h.encounterAllowsWrite(r, "", testDoctorID) {
+		t.Error("a record without an encounter got access")
+	}
+	encounters.encounter.Status = "closed"
+	if h.encounterAllowsWrite(r, testEncounterID, testDoctorID) {
+		t.Error("a closed encounter must not stand in for a write consent")
+	}
+}
+
+func TestAuditWriteSeparatesUnanchoredRecords(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		recordID string
+		want     string
+	}{
+		{"created", http.StatusCreated, "r1", domain.WriteOutcomeSuccess},
+		{"denied", http.StatusForbidden, "", domain.WriteOutcomeDenied},
+		{"invalid", http.StatusBadRequest, "", domain.WriteOutcomeRejected},
+		{"not stored", http.StatusInternalServerError, "", domain.WriteOutcomeFailed},
+		{"stored, not anchored", http.StatusInternalServerError, "r1", domain.WriteOutcomeUnanchored},
+	}
+	for _, tc := range cases {
+		logs := &fakeLogRepo{}
+		h := &RecordHandler{logRepo: logs}
+		w := &auditedWriter{ResponseWriter: httptest.NewRecorder()}
+		w.WriteHeader(tc.status)
+		attempt := &domain.RecordWriteAttempt{PatientID: testPatientID, ActorID: testDoctorID, RecordID: tc.recordID}
+		h.auditWrite(httptest.NewRequest(http.MethodPost, "/records", nil), w, attempt)
+		if len(logs.writes) != 1 || logs.writes[0].Outcome != tc.want {
+			t.Errorf("%s: logged %+v, want outcome %s", tc.name, logs.writes, tc.want)
+		}
+	}
+}
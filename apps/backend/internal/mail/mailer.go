@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Handlers depend on this interface so that local
+// development and tests can swap SMTP for LogMailer.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends email through an SMTP server.
+type SMTPMailer struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	envelope string
+}
+
+// NewSMTPMailer creates a new instance of SMTPMailer. Authentication is only
+// used when a username is given.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	// "Nama <alamat>" dipakai di header, sedangkan SMTP envelope butuh alamatnya saja.
+	envelope := from
+	if parsed, err := netmail.ParseAddress(from); err == nil {
+		envelope = parsed.Address
+	}
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		auth:     auth,
+		from:     from,
+		envelope: envelope,
+	}
+}
+
+// Send delivers the message through the SMTP server.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.envelope, []string{msg.To}, render(m.from, msg))
+}
+
+// LogMailer writes emails to the application log and, when a directory is
+// configured, to one .eml file per message. It never delivers anything.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+// NewLogMailer creates a new instance of LogMailer.
+func NewLogMailer(dir, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+// Send logs the message and optionally stores it on disk.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("[MAIL] To: %s | Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), render(m.from, msg), 0o644)
+}
+
+// render builds an RFC 5322 message.
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -2,23 +2,47 @@ package middleware
 
 import (
 	"context"
+	"log"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/auth"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
 )
 
 type contextKey string
 
 const (
-	UserIDKey   = contextKey("userID")
-	UserRoleKey = contextKey("userRole")
+	UserIDKey    = contextKey("userID")
+	UserRoleKey  = contextKey("userRole")
+	SessionIDKey = contextKey("sessionID")
+	ClaimsKey    = contextKey("claims")
+	// ActorIDKey holds the guardian's ID when a request acts on behalf of a dependent;
+	// UserIDKey then holds the dependent's ID.
+	ActorIDKey = contextKey("actorID")
+	// ServiceAccountIDKey and APIKeyIDKey identify requests made with an API
+	// key; ServiceFacilityIDKey holds the service account's facility.
+	ServiceAccountIDKey  = contextKey("serviceAccountID")
+	APIKeyIDKey          = contextKey("apiKeyID")
+	ServiceFacilityIDKey = contextKey("serviceFacilityID")
+	// ConsentScopeKey holds the *domain.ConsentScope that ConsentMiddleware
+	// granted for the request; handlers must limit their results to it.
+	ConsentScopeKey = contextKey("consentScope")
 )
 
-// AuthMiddleware validates the JWT token from the Authorization header.
-func AuthMiddleware(next http.Handler, jwtKey []byte) http.Handler {
+// OnBehalfOfHeader names the dependent patient a guardian is acting for.
+const OnBehalfOfHeader = "X-On-Behalf-Of"
+
+// AuthMiddleware validates the JWT token from the Authorization header
+// and rejects tokens whose session has been revoked or has expired. Service
+// accounts send an API key instead (see authenticateAPIKey); pass a nil
+// serviceRepo for routes that only humans may call.
+func AuthMiddleware(next http.Handler, tokenIssuer *auth.TokenIssuer, sessionRepo repository.SessionRepository, serviceRepo repository.ServiceAccountRepository) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -27,37 +51,131 @@ func AuthMiddleware(next http.Handler, jwtKey []byte) http.Handler {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &domain.Claims{}
+		if strings.HasPrefix(tokenString, auth.APIKeyPrefix) {
+			if serviceRepo == nil {
+				http.Error(w, "API key tidak dapat digunakan untuk endpoint ini", http.StatusForbidden)
+				return
+			}
+			authenticateAPIKey(w, r, next, serviceRepo, tokenString)
+			return
+		}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		claims := &domain.Claims{}
 
-		if err != nil || !token.Valid {
+		// Kunci verifikasi dipilih berdasarkan "kid"; algoritma, issuer dan audience diperiksa ketat.
+		err := tokenIssuer.ParseAccessToken(tokenString, claims)
+		if err != nil || claims.SessionID == "" {
 			http.Error(w, "Token tidak valid", http.StatusUnauthorized)
 			return
 		}
 
+		active, err := sessionRepo.TouchSession(r.Context(), claims.SessionID, claims.UserID)
+		if err != nil || !active {
+			http.Error(w, "Sesi telah berakhir, silakan login kembali", http.StatusUnauthorized)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 		ctx = context.WithValue(ctx, UserRoleKey, claims.Role)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// DoctorMiddleware ensures that the user has the 'doctor' role.
-func DoctorMiddleware(next http.Handler) http.Handler {
+// authenticateAPIKey authenticates a service account by API key, enforces the
+// key's per-minute rate limit and builds claims whose permissions are the
+// key's scopes. Every call is logged with the service identity.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, serviceRepo repository.ServiceAccountRepository, apiKey string) {
+	key, err := serviceRepo.GetActiveAPIKeyByHash(r.Context(), auth.HashToken(apiKey))
+	if err != nil {
+		http.Error(w, "API key tidak valid atau sudah kedaluwarsa", http.StatusUnauthorized)
+		return
+	}
+
+	count, windowStart, now, err := serviceRepo.RegisterAPIKeyUse(r.Context(), key.ID)
+	if err != nil {
+		log.Printf("Gagal mencatat pemakaian API key %s: %v", key.Prefix, err)
+		http.Error(w, "Gagal memproses API key", http.StatusInternalServerError)
+		return
+	}
+	if count > key.RateLimitPerMinute {
+		// Dihitung dari jam database, yang juga menentukan awal jendela.
+		retryAfter := int(math.Ceil(windowStart.Add(time.Minute).Sub(now).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		http.Error(w, "Batas permintaan API key terlampaui, coba lagi nanti", http.StatusTooManyRequests)
+		return
+	}
+
+	log.Printf("[API-KEY] Layanan %q (%s, kunci %s) %s %s", key.ServiceAccountName, key.ServiceAccountID, key.Prefix, r.Method, r.URL.Path)
+
+	claims := &domain.Claims{
+		UserID:        key.ServiceAccountID,
+		Name:          key.ServiceAccountName,
+		Role:          domain.RoleService,
+		EmailVerified: true,
+		Permissions:   key.Scopes,
+	}
+	ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, UserRoleKey, claims.Role)
+	ctx = context.WithValue(ctx, ClaimsKey, claims)
+	ctx = context.WithValue(ctx, ServiceAccountIDKey, key.ServiceAccountID)
+	ctx = context.WithValue(ctx, APIKeyIDKey, key.ID)
+	ctx = context.WithValue(ctx, ServiceFacilityIDKey, key.FacilityID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequirePermission ensures that the token carries every listed permission.
+// Clinical staff must also have admin-approved credentials and, when their
+// facility requires it, a session that completed MFA.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsKey).(*domain.Claims)
+			if !ok {
+				http.Error(w, "Token tidak valid", http.StatusUnauthorized)
+				return
+			}
+
+			if claims.VerificationStatus != "" && claims.VerificationStatus != domain.VerificationApproved {
+				http.Error(w, "Akses ditolak: Kredensial (STR/SIP) Anda belum diverifikasi admin", http.StatusForbidden)
+				return
+			}
+			if claims.MFARequired && !claims.MFA {
+				http.Error(w, "Akses ditolak: Fasilitas Anda mewajibkan autentikasi dua faktor (MFA)", http.StatusForbidden)
+				return
+			}
+
+			for _, permission := range permissions {
+				if !slices.Contains(claims.Permissions, permission) {
+					http.Error(w, "Akses ditolak: Anda tidak memiliki izin "+permission, http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// VerifiedEmailMiddleware blocks sensitive actions until the user has verified their email.
+func VerifiedEmailMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role, ok := r.Context().Value(UserRoleKey).(string)
-		if !ok || role != "doctor" {
-			http.Error(w, "Akses ditolak: Hanya untuk dokter", http.StatusForbidden)
+		claims, ok := r.Context().Value(ClaimsKey).(*domain.Claims)
+		if !ok || !claims.EmailVerified {
+			http.Error(w, "Akses ditolak: Verifikasi email Anda terlebih dahulu", http.StatusForbidden)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// ConsentMiddleware checks if a doctor has been granted access to a patient's records.
-func ConsentMiddleware(db *pgxpool.Pool, next http.Handler) http.Handler {
+// ConsentMiddleware checks if a doctor has been granted access to a patient's
+// records, or has an unexpired break-glass session for that patient, and
+// stores the effective scope under ConsentScopeKey. The grant is chosen by
+// ConsentRepository.GetEffectiveAccess: break-glass grants all and takes
+// precedence, otherwise the most recently granted consent applies. Every read
+// made under break-glass is logged through breakGlassRepo.
+func ConsentMiddleware(consentRepo repository.ConsentRepository, breakGlassRepo repository.BreakGlassRepository, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		doctorID, ok := r.Context().Value(UserIDKey).(string)
 		if !ok {
@@ -71,20 +189,61 @@ func ConsentMiddleware(db *pgxpool.Pool, next http.Handler) http.Handler {
 			return
 		}
 
-		var status string
-		sql := `SELECT status FROM consent_requests 
-                WHERE doctor_id = $1 
-                  AND patient_id = $2 
-                  AND status = 'granted' 
-                  AND (expires_at IS NULL OR expires_at > NOW())
-                LIMIT 1`
-		err := db.QueryRow(r.Context(), sql, doctorID, patientID).Scan(&status)
-
-		if err != nil {
+		// Akses darurat didahulukan agar izin yang sempit tidak menghalangi penanganan darurat.
+		accesses, err := consentRepo.GetEffectiveAccess(r.Context(), doctorID, []string{patientID}, true)
+		access, ok := accesses[patientID]
+		if err != nil || !ok {
 			http.Error(w, "Akses ditolak: Anda tidak memiliki izin dari pasien ini", http.StatusForbidden)
 			return
 		}
+		scope, err := domain.ParseConsentScope(access.DataScope)
+		if err != nil {
+			log.Printf("Cakupan izin pasien %s untuk dokter %s tidak valid: %v", patientID, doctorID, err)
+			http.Error(w, "Akses ditolak: Cakupan izin dari pasien ini tidak valid", http.StatusForbidden)
+			return
+		}
+		if access.Source == domain.AccessSourceBreakGlass {
+			// Akses darurat tanpa jejak audit tidak diizinkan: jika pencatatan gagal, akses ditolak.
+			if err := breakGlassRepo.LogAccess(r.Context(), access.BreakGlassSessionID, doctorID, patientID, r.Method, r.URL.RequestURI()); err != nil {
+				log.Printf("Gagal mencatat akses darurat dokter %s ke pasien %s: %v", doctorID, patientID, err)
+				http.Error(w, "Gagal mencatat akses darurat", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("[BREAK-GLASS] Dokter %s mengakses %s milik pasien %s", doctorID, r.URL.Path, patientID)
+		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), ConsentScopeKey, &scope)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ActingOnBehalfMiddleware lets a guardian call a patient endpoint for a
+// dependent by sending the dependent's ID in the X-On-Behalf-Of header. When
+// an active delegation covering scope exists, UserIDKey is replaced with the
+// dependent's ID and the guardian's ID is kept in ActorIDKey. Requests without
+// the header pass through unchanged.
+func ActingOnBehalfMiddleware(delegationRepo repository.DelegationRepository, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dependentID := r.Header.Get(OnBehalfOfHeader)
+		if dependentID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		guardianID, ok := r.Context().Value(UserIDKey).(string)
+		if !ok {
+			http.Error(w, "Token tidak valid", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := delegationRepo.HasActiveDelegation(r.Context(), guardianID, dependentID, scope)
+		if err != nil || !allowed {
+			http.Error(w, "Akses ditolak: Anda tidak memiliki delegasi aktif untuk pasien ini", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, dependentID)
+		ctx = context.WithValue(ctx, ActorIDKey, guardianID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+	"github.com/trifur/rekamedchain/backend/internal/repository"
+)
+
+const (
+	testDoctorID  = "5e2d9a47-1c3b-4b8e-a0d6-7f4c2e9b1a22"
+	testPatientID = "0b8a3c52-5d0e-4c55-8f0e-3b1f8f6a9c11"
+	testSessionID = "b9a55000-0000-4000-8000-000000000001"
+)
+
+type fakeConsentRepo struct {
+	repository.ConsentRepository
+	access *domain.PatientAccess
+}
+
+func (f *fakeConsentRepo) GetEffectiveAccess(ctx context.Context, accessorID string, patientIDs []string, breakGlass bool) (map[string]domain.PatientAccess, error) {
+	accesses := make(map[string]domain.PatientAccess)
+	if f.access != nil && (breakGlass || f.access.Source != domain.AccessSourceBreakGlass) {
+		accesses[f.access.PatientID] = *f.access
+	}
+	return accesses, nil
+}
+
+type fakeBreakGlassRepo struct {
+	repository.BreakGlassRepository
+	logged []string
+	err    error
+}
+
+func (f *fakeBreakGlassRepo) LogAccess(ctx context.Context, sessionID, doctorID, patientID, method, path string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.logged = append(f.logged, sessionID+" "+method+" "+path)
+	return nil
+}
+
+func TestConsentMiddlewareAuditsEveryBreakGlassRead(t *testing.T) {
+	breakGlass := &domain.PatientAccess{PatientID: testPatientID, Source: domain.AccessSourceBreakGlass, DataScope: `{"all":true}`, BreakGlassSessionID: testSessionID}
+	consent := &domain.PatientAccess{PatientID: testPatientID, Source: domain.AccessSourceConsent, DataScope: `{"categories":["vitals"]}`}
+	cases := []struct {
+		name    string
+		access  *domain.PatientAccess
+		logErr  error
+		status  int
+		audited bool
+	}{
+		{"no access", nil, nil, http.StatusForbidden, false},
+		{"consent", consent, nil, http.StatusOK, false},
+		{"break-glass", breakGlass, nil, http.StatusOK, true},
+		// Akses darurat tanpa jejak audit harus ditolak.
+		{"break-glass without audit", breakGlass, errors.New("db down"), http.StatusInternalServerError, false},
+	}
+	for _, tc := range cases {
+		logs := &fakeBreakGlassRepo{err: tc.logErr}
+		var scope *domain.ConsentScope
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, _ = r.Context().Value(ConsentScopeKey).(*domain.ConsentScope)
+		})
+		handler := ConsentMiddleware(&fakeConsentRepo{access: tc.access}, logs, next)
+
+		r := httptest.NewRequest(http.MethodGet, "/records/patient/"+testPatientID, nil)
+		r.SetPathValue("patient_id", testPatientID)
+		r = r.WithContext(context.WithValue(r.Context(), UserIDKey, testDoctorID))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+		if audited := len(logs.logged) == 1; audited != tc.audited || len(logs.logged) > 1 {
+			t.Errorf("%s: audit rows %v", tc.name, logs.logged)
+		}
+		if (scope != nil) != (tc.status == http.StatusOK) {
+			t.Errorf("%s: next handler reached = %v", tc.name, scope != nil)
+		}
+	}
+}
+
+type fakeServiceRepo struct {
+	repository.ServiceAccountRepository
+	count       int
+	windowStart time.Time
+	now         time.Time
+}
+
+func (f *fakeServiceRepo) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	return &domain.APIKey{ID: "k1", Prefix: "rmc_test", RateLimitPerMinute: 1}, nil
+}
+
+func (f *fakeServiceRepo) RegisterAPIKeyUse(ctx context.Context, keyID string) (int, time.Time, time.Time, error) {
+	return f.count, f.windowStart, f.now, nil
+}
+
+func TestAPIKeyRetryAfterFollowsTheDatabaseClock(t *testing.T) {
+	// Jam database sengaja dibuat berbeda dari jam lokal.
+	windowStart := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	cases := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"start of window", windowStart, "60"},
+		{"mid-second", windowStart.Add(15*time.Second + 200*time.Millisecond), "45"},
+		{"end of window", windowStart.Add(time.Minute - time.Millisecond), "1"},
+	}
+	for _, tc := range cases {
+		repo := &fakeServiceRepo{count: 2, windowStart: windowStart, now: tc.now}
+		w := httptest.NewRecorder()
+		authenticateAPIKey(w, httptest.NewRequest(http.MethodGet, "/records", nil), http.NotFoundHandler(), repo, "rmc_test_secret")
+
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: status %d, want 429", tc.name, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != tc.want {
+			t.Errorf("%s: Retry-After %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
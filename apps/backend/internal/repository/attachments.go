@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// insertAttachments stores the attachment list of a record version inside the
+// transaction that creates the version, and fills in their IDs.
+func insertAttachments(ctx context.Context, tx pgx.Tx, recordID string, attachments []domain.RecordAttachment) error {
+	for i := range attachments {
+		a := &attachments[i]
+		query := `INSERT INTO record_attachments (record_id, position, cid, filename, mime_type, size_bytes, sha256, uploaded_by, uploaded_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, a.CID, a.Filename, a.MIMEType, a.Size, a.SHA256, a.UploadedBy, a.UploadedAt).Scan(&a.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAttachments fills the attachment lists of records in one query.
+func loadAttachments(ctx context.Context, db *pgxpool.Pool, records []domain.MedicalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ids := make([]string, len(records))
+	byID := make(map[string]*domain.MedicalRecord, len(records))
+	for i := range records {
+		ids[i] = records[i].ID
+		byID[records[i].ID] = &records[i]
+	}
+
+	query := `SELECT record_id, id, cid, filename, mime_type, size_bytes, sha256, uploaded_by::text, uploaded_at
+			FROM record_attachments WHERE record_id = ANY($1) ORDER BY position`
+	return queryEntries(ctx, db, query, ids, func(rows pgx.Rows) error {
+		var recordID string
+		var a domain.RecordAttachment
+		if err := rows.Scan(&recordID, &a.ID, &a.CID, &a.Filename, &a.MIMEType, &a.Size, &a.SHA256, &a.UploadedBy, &a.UploadedAt); err != nil {
+			return err
+		}
+		byID[recordID].Attachments = append(byID[recordID].Attachments, a)
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// BreakGlassRepository defines the interface for emergency access sessions.
+type BreakGlassRepository interface {
+	CreateSession(ctx context.Context, doctorID, patientID, reason string, expiresAt time.Time) (string, error)
+	GetSessionsByReviewStatus(ctx context.Context, status string) ([]domain.BreakGlassSession, error)
+	ReviewSession(ctx context.Context, sessionID, status, note, adminID string) (int64, error)
+	GetSessionAccesses(ctx context.Context, sessionID string) ([]domain.BreakGlassAccess, error)
+	LogAccess(ctx context.Context, sessionID, doctorID, patientID, method, path string) error
+}
+
+type postgresBreakGlassRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresBreakGlassRepository creates a new instance of BreakGlassRepository.
+func NewPostgresBreakGlassRepository(db *pgxpool.Pool) BreakGlassRepository {
+	return &postgresBreakGlassRepository{db: db}
+}
+
+// CreateSession records a new break-glass session awaiting admin review.
+func (r *postgresBreakGlassRepository) CreateSession(ctx context.Context, doctorID, patientID, reason string, expiresAt time.Time) (string, error) {
+	sql := `INSERT INTO break_glass_sessions (doctor_id, patient_id, reason, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	var id string
+	err := r.db.QueryRow(ctx, sql, doctorID, patientID, reason, expiresAt).Scan(&id)
+	return id, err
+}
+
+// LogAccess records one request a doctor made to a patient's data under a break-glass session.
+func (r *postgresBreakGlassRepository) LogAccess(ctx context.Context, sessionID, doctorID, patientID, method, path string) error {
+	sql := `INSERT INTO break_glass_accesses (session_id, doctor_id, patient_id, method, path) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(ctx, sql, sessionID, doctorID, patientID, method, path)
+	return err
+}
+
+// GetSessionsByReviewStatus retrieves break-glass sessions with the given review status, oldest first.
+func (r *postgresBreakGlassRepository) GetSessionsByReviewStatus(ctx context.Context, status string) ([]domain.BreakGlassSession, error) {
+	sql := `SELECT bg.id, bg.doctor_id, d.name, bg.patient_id, p.name, bg.reason, bg.expires_at,
+				bg.review_status, COALESCE(bg.review_note, ''), bg.reviewed_by, bg.reviewed_at, bg.created_at,
+				(SELECT COUNT(*) FROM break_glass_accesses a WHERE a.session_id = bg.id)
+			FROM break_glass_sessions bg
+			JOIN users d ON bg.doctor_id = d.id
+			JOIN users p ON bg.patient_id = p.id
+			WHERE bg.review_status = $1
+			ORDER BY bg.created_at ASC`
+	rows, err := r.db.Query(ctx, sql, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]domain.BreakGlassSession, 0)
+	for rows.Next() {
+		var s domain.BreakGlassSession
+		if err := rows.Scan(&s.ID, &s.DoctorID, &s.DoctorName, &s.PatientID, &s.PatientName, &s.Reason, &s.ExpiresAt,
+			&s.ReviewStatus, &s.ReviewNote, &s.ReviewedBy, &s.ReviewedAt, &s.CreatedAt, &s.AccessCount); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// ReviewSession records the admin's verdict on a session that has not been reviewed yet.
+// A session flagged as misuse stops granting access immediately.
+func (r *postgresBreakGlassRepository) ReviewSession(ctx context.Context, sessionID, status, note, adminID string) (int64, error) {
+	sql := `UPDATE break_glass_sessions
+			SET review_status = $2, review_note = NULLIF($3, ''), reviewed_by = $4, reviewed_at = NOW(),
+				expires_at = CASE WHEN $2 = 'misuse' THEN LEAST(expires_at, NOW()) ELSE expires_at END
+			WHERE id = $1 AND review_status = 'pending'`
+	res, err := r.db.Exec(ctx, sql, sessionID, status, note, adminID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// GetSessionAccesses retrieves every request served under a break-glass session, oldest first.
+func (r *postgresBreakGlassRepository) GetSessionAccesses(ctx context.Context, sessionID string) ([]domain.BreakGlassAccess, error) {
+	sql := `SELECT id, session_id, doctor_id, patient_id, method, path, accessed_at
+			FROM break_glass_accesses
+			WHERE session_id = $1
+			ORDER BY accessed_at ASC`
+	rows, err := r.db.Query(ctx, sql, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make([]domain.BreakGlassAccess, 0)
+	for rows.Next() {
+		var a domain.BreakGlassAccess
+		if err := rows.Scan(&a.ID, &a.SessionID, &a.DoctorID, &a.PatientID, &a.Method, &a.Path, &a.AccessedAt); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, a)
+	}
+	return accesses, rows.Err()
+}
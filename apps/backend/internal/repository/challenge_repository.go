@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// ChallengeRepository defines the interface for passwordless login challenges.
+type ChallengeRepository interface {
+	CreateChallenge(ctx context.Context, userID, nonce string, expiresAt time.Time) (string, error)
+	ConsumeChallenge(ctx context.Context, challengeID string) (*domain.AuthChallenge, error)
+}
+
+type postgresChallengeRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresChallengeRepository creates a new instance of ChallengeRepository.
+func NewPostgresChallengeRepository(db *pgxpool.Pool) ChallengeRepository {
+	return &postgresChallengeRepository{db: db}
+}
+
+// CreateChallenge stores a new nonce for the given user.
+func (r *postgresChallengeRepository) CreateChallenge(ctx context.Context, userID, nonce string, expiresAt time.Time) (string, error) {
+	sql := `INSERT INTO auth_challenges (user_id, nonce, expires_at) VALUES ($1, $2, $3) RETURNING id`
+	var challengeID string
+	err := r.db.QueryRow(ctx, sql, userID, nonce, expiresAt).Scan(&challengeID)
+	return challengeID, err
+}
+
+// ConsumeChallenge marks a challenge as used and returns it.
+// A challenge can only be consumed once and only before it expires.
+func (r *postgresChallengeRepository) ConsumeChallenge(ctx context.Context, challengeID string) (*domain.AuthChallenge, error) {
+	sql := `UPDATE auth_challenges
+			SET used_at = NOW()
+			WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING id, user_id, nonce, expires_at`
+	var challenge domain.AuthChallenge
+	err := r.db.QueryRow(ctx, sql, challengeID).Scan(&challenge.ID, &challenge.UserID, &challenge.Nonce, &challenge.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// insertClinicalContent stores the structured entries of a record version
+// inside the transaction that creates the version, and fills in their IDs.
+func insertClinicalContent(ctx context.Context, tx pgx.Tx, recordID string, content *domain.ClinicalContent) error {
+	for i := range content.Vitals {
+		v := &content.Vitals[i]
+		query := `INSERT INTO record_vitals (record_id, position, vital_type, value, unit, measured_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, v.Type, v.Value, v.Unit, v.MeasuredAt).Scan(&v.ID); err != nil {
+			return err
+		}
+	}
+	for i := range content.Diagnoses {
+		d := &content.Diagnoses[i]
+		query := `INSERT INTO record_diagnoses (record_id, position, code, description, is_primary, code_index, uncatalogued) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, d.Code, d.Description, d.Primary, d.CodeIndex, d.Uncatalogued).Scan(&d.ID); err != nil {
+			return err
+		}
+	}
+	for i := range content.Medications {
+		m := &content.Medications[i]
+		query := `INSERT INTO record_medications (record_id, position, name, dose, route, frequency, duration) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, m.Name, m.Dose, m.Route, m.Frequency, m.Duration).Scan(&m.ID); err != nil {
+			return err
+		}
+	}
+	for i := range content.Allergies {
+		a := &content.Allergies[i]
+		query := `INSERT INTO record_allergies (record_id, position, substance, reaction, severity) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, a.Substance, a.Reaction, a.Severity).Scan(&a.ID); err != nil {
+			return err
+		}
+	}
+	for i := range content.Procedures {
+		p := &content.Procedures[i]
+		query := `INSERT INTO record_procedures (record_id, position, name, code, notes, performed_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+		if err := tx.QueryRow(ctx, query, recordID, i, p.Name, p.Code, p.Notes, p.PerformedAt).Scan(&p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadClinicalContent fills the structured entries of records, one query per entry table.
+func loadClinicalContent(ctx context.Context, db *pgxpool.Pool, records []domain.MedicalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ids := make([]string, len(records))
+	byID := make(map[string]*domain.ClinicalContent, len(records))
+	for i := range records {
+		ids[i] = records[i].ID
+		byID[records[i].ID] = &records[i].ClinicalContent
+	}
+
+	err := queryEntries(ctx, db, `SELECT record_id, id, vital_type, value, unit, measured_at FROM record_vitals WHERE record_id = ANY($1) ORDER BY position`, ids,
+		func(rows pgx.Rows) error {
+			var recordID string
+			var v domain.VitalSign
+			if err := rows.Scan(&recordID, &v.ID, &v.Type, &v.Value, &v.Unit, &v.MeasuredAt); err != nil {
+				return err
+			}
+			byID[recordID].Vitals = append(byID[recordID].Vitals, v)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	err = queryEntries(ctx, db, `SELECT record_id, id, code, description, is_primary, uncatalogued FROM record_diagnoses WHERE record_id = ANY($1) ORDER BY position`, ids,
+		func(rows pgx.Rows) error {
+			var recordID string
+			var d domain.RecordDiagnosis
+			if err := rows.Scan(&recordID, &d.ID, &d.Code, &d.Description, &d.Primary, &d.Uncatalogued); err != nil {
+				return err
+			}
+			byID[recordID].Diagnoses = append(byID[recordID].Diagnoses, d)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	err = queryEntries(ctx, db, `SELECT record_id, id, name, dose, route, frequency, duration FROM record_medications WHERE record_id = ANY($1) ORDER BY position`, ids,
+		func(rows pgx.Rows) error {
+			var recordID string
+			var m domain.Medication
+			if err := rows.Scan(&recordID, &m.ID, &m.Name, &m.Dose, &m.Route, &m.Frequency, &m.Duration); err != nil {
+				return err
+			}
+			byID[recordID].Medications = append(byID[recordID].Medications, m)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	err = queryEntries(ctx, db, `SELECT record_id, id, substance, reaction, severity FROM record_allergies WHERE record_id = ANY($1) ORDER BY position`, ids,
+		func(rows pgx.Rows) error {
+			var recordID string
+			var a domain.Allergy
+			if err := rows.Scan(&recordID, &a.ID, &a.Substance, &a.Reaction, &a.Severity); err != nil {
+				return err
+			}
+			byID[recordID].Allergies = append(byID[recordID].Allergies, a)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return queryEntries(ctx, db, `SELECT record_id, id, name, code, notes, performed_at FROM record_procedures WHERE record_id = ANY($1) ORDER BY position`, ids,
+		func(rows pgx.Rows) error {
+			var recordID string
+			var p domain.Procedure
+			if err := rows.Scan(&recordID, &p.ID, &p.Name, &p.Code, &p.Notes, &p.PerformedAt); err != nil {
+				return err
+			}
+			byID[recordID].Procedures = append(byID[recordID].Procedures, p)
+			return nil
+		})
+}
+
+// queryEntries runs query for the given record IDs and calls scan for every row.
+func queryEntries(ctx context.Context, db *pgxpool.Pool, query string, ids []string, scan func(rows pgx.Rows) error) error {
+	rows, err := db.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -2,20 +2,29 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
 )
 
+// ErrNonceReused is returned when a consent signature's nonce has already been used.
+var ErrNonceReused = errors.New("consent signature nonce already used")
+
 // ConsentRepository defines the interface for consent data operations.
+// Every status change is stored together with the patient's signature over it.
 type ConsentRepository interface {
-	CreateRequest(ctx context.Context, doctorID, patientID string) (string, error)
+	CreateRequest(ctx context.Context, doctorID, patientID, dataScope string) (string, error)
+	GetRequestByID(ctx context.Context, requestID string) (*domain.ConsentRequest, error)
 	GetRequestsByPatientID(ctx context.Context, patientID string) ([]domain.ConsentRequest, error)
-	GrantConsent(ctx context.Context, requestID, patientID, duration, dataScope string) (int64, error)
-	DenyConsent(ctx context.Context, requestID, patientID string) (int64, error)
-	RevokeConsent(ctx context.Context, requestID, patientID string) (int64, error)
+	GrantConsent(ctx context.Context, requestID, patientID, duration, dataScope string, expiresAt *time.Time, sig domain.ConsentSignature) (int64, error)
+	DenyConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error)
+	RevokeConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error)
+	GetSignatures(ctx context.Context, requestID string) ([]domain.ConsentSignature, error)
+	GetEffectiveAccess(ctx context.Context, accessorID string, patientIDs []string, breakGlass bool) (map[string]domain.PatientAccess, error)
 }
 
 // postgresConsentRepository is the PostgreSQL implementation of ConsentRepository.
@@ -29,17 +38,54 @@ func NewPostgresConsentRepository(db *pgxpool.Pool) ConsentRepository {
 }
 
 // CreateRequest inserts a new consent request into the database.
-func (r *postgresConsentRepository) CreateRequest(ctx context.Context, doctorID, patientID string) (string, error) {
-	sql := `INSERT INTO consent_requests (doctor_id, patient_id) VALUES ($1, $2) RETURNING id`
+func (r *postgresConsentRepository) CreateRequest(ctx context.Context, doctorID, patientID, dataScope string) (string, error) {
+	sql := `INSERT INTO consent_requests (doctor_id, patient_id, data_scope) VALUES ($1, $2, NULLIF($3, '')) RETURNING id`
 	var requestID string
-	err := r.db.QueryRow(ctx, sql, doctorID, patientID).Scan(&requestID)
+	err := r.db.QueryRow(ctx, sql, doctorID, patientID, dataScope).Scan(&requestID)
 	return requestID, err
 }
 
+// GetRequestByID retrieves a single consent request, including the requesting doctor's ID.
+func (r *postgresConsentRepository) GetRequestByID(ctx context.Context, requestID string) (*domain.ConsentRequest, error) {
+	sql := `SELECT
+				cr.id,
+				cr.doctor_id,
+				d.name as doctor_name,
+				cr.patient_id,
+				p.name as patient_name,
+				cr.status,
+				cr.created_at,
+				cr.updated_at,
+				COALESCE(cr.duration, '') as duration,
+				COALESCE(cr.data_scope, '') as data_scope,
+				cr.expires_at
+			FROM consent_requests cr
+			JOIN users d ON cr.doctor_id = d.id
+			JOIN users p ON cr.patient_id = p.id
+			WHERE cr.id = $1`
+	var req domain.ConsentRequest
+	err := r.db.QueryRow(ctx, sql, requestID).Scan(&req.ID,
+		&req.DoctorID,
+		&req.DoctorName,
+		&req.PatientID,
+		&req.PatientName,
+		&req.Status,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+		&req.Duration,
+		&req.DataScope,
+		&req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
 // GetRequestsByPatientID retrieves all consent requests for a specific patient.
 func (r *postgresConsentRepository) GetRequestsByPatientID(ctx context.Context, patientID string) ([]domain.ConsentRequest, error) {
 	sql := `SELECT 
 				cr.id, 
+				cr.doctor_id,
 				d.name as doctor_name, 
 				cr.patient_id, 
 				p.name as patient_name,
@@ -55,9 +101,6 @@ func (r *postgresConsentRepository) GetRequestsByPatientID(ctx context.Context,
 			WHERE cr.patient_id = $1 
 			ORDER BY cr.created_at DESC`
 
-	// 🟡 Tambahkan log debug
-	log.Printf("[DEBUG] Menjalankan GetRequestsByPatientID untuk patientID=%s", patientID)
-
 	rows, err := r.db.Query(ctx, sql, patientID)
 	if err != nil {
 		log.Printf("[ERROR] Query consent_requests gagal: %v", err)
@@ -69,6 +112,7 @@ func (r *postgresConsentRepository) GetRequestsByPatientID(ctx context.Context,
 	for rows.Next() {
 		var req domain.ConsentRequest
 		if err := rows.Scan(&req.ID,
+			&req.DoctorID,
 			&req.DoctorName,
 			&req.PatientID,
 			&req.PatientName,
@@ -88,21 +132,13 @@ func (r *postgresConsentRepository) GetRequestsByPatientID(ctx context.Context,
 		log.Printf("[ERROR] rows iteration error: %v", err)
 		return nil, err
 	}
-
-	log.Printf("[DEBUG] GetRequestsByPatientID berhasil: total %d records", len(requests))
 	return requests, nil
 }
 
-// GrantConsent updates the status of a consent request to 'granted'.
-// GrantConsent updates the status of a consent request to 'granted'.
-func (r *postgresConsentRepository) GrantConsent(ctx context.Context, requestID, patientID, duration, dataScope string) (int64, error) {
-	var expiresAt *time.Time
-	if duration == "24h" {
-		t := time.Now().Add(24 * time.Hour)
-		expiresAt = &t
-	}
+// GrantConsent updates the status of a consent request to 'granted' with the
+// expiry the patient signed, and stores the signature in the same transaction.
+func (r *postgresConsentRepository) GrantConsent(ctx context.Context, requestID, patientID, duration, dataScope string, expiresAt *time.Time, sig domain.ConsentSignature) (int64, error) {
 	// Jika 'permanent', expiresAt akan tetap nil (null di DB)
-
 	sql := `UPDATE consent_requests 
             SET status = 'granted', 
                 duration = $3,
@@ -110,32 +146,131 @@ func (r *postgresConsentRepository) GrantConsent(ctx context.Context, requestID,
                 expires_at = $5,
                 updated_at = NOW() 
             WHERE id = $1 AND patient_id = $2 AND status = 'pending'`
-
-	res, err := r.db.Exec(ctx, sql, requestID, patientID, duration, dataScope, expiresAt)
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected(), nil
+	return r.updateWithSignature(ctx, sig, sql, requestID, patientID, duration, dataScope, expiresAt)
 }
 
 // DenyConsent updates the status of a consent request to 'denied'.
 // Can only be done by the patient and only if the status is 'pending'.
-func (r *postgresConsentRepository) DenyConsent(ctx context.Context, requestID, patientID string) (int64, error) {
+func (r *postgresConsentRepository) DenyConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error) {
 	sql := `UPDATE consent_requests SET status = 'denied', updated_at = NOW() WHERE id = $1 AND patient_id = $2 AND status = 'pending'`
-	res, err := r.db.Exec(ctx, sql, requestID, patientID)
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected(), nil
+	return r.updateWithSignature(ctx, sig, sql, requestID, patientID)
 }
 
 // RevokeConsent updates the status of a consent request to 'revoked'.
 // Can only be done by the patient and only if the status was 'granted'.
-func (r *postgresConsentRepository) RevokeConsent(ctx context.Context, requestID, patientID string) (int64, error) {
+func (r *postgresConsentRepository) RevokeConsent(ctx context.Context, requestID, patientID string, sig domain.ConsentSignature) (int64, error) {
 	sql := `UPDATE consent_requests SET status = 'revoked', updated_at = NOW() WHERE id = $1 AND patient_id = $2 AND status = 'granted'`
-	res, err := r.db.Exec(ctx, sql, requestID, patientID)
+	return r.updateWithSignature(ctx, sig, sql, requestID, patientID)
+}
+
+// updateWithSignature runs a status update and, only if it changed a row,
+// records the signature that authorised it. Nothing is written otherwise.
+func (r *postgresConsentRepository) updateWithSignature(ctx context.Context, sig domain.ConsentSignature, sql string, args ...any) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, sql, args...)
 	if err != nil {
 		return 0, err
 	}
+	if res.RowsAffected() == 0 {
+		return 0, nil
+	}
+
+	insert := `INSERT INTO consent_signatures (consent_request_id, action, signer_id, message, signature, public_key, nonce)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.Exec(ctx, insert, sig.ConsentRequestID, sig.Action, sig.SignerID, sig.Message, sig.Signature, sig.PublicKey, sig.Nonce)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, ErrNonceReused
+		}
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
 	return res.RowsAffected(), nil
 }
+
+// GetSignatures retrieves every signature stored for a consent request, oldest first.
+func (r *postgresConsentRepository) GetSignatures(ctx context.Context, requestID string) ([]domain.ConsentSignature, error) {
+	sql := `SELECT id, consent_request_id, action, signer_id, message, signature, public_key, nonce, created_at
+			FROM consent_signatures
+			WHERE consent_request_id = $1
+			ORDER BY created_at ASC`
+	rows, err := r.db.Query(ctx, sql, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signatures := make([]domain.ConsentSignature, 0)
+	for rows.Next() {
+		var sig domain.ConsentSignature
+		if err := rows.Scan(&sig.ID, &sig.ConsentRequestID, &sig.Action, &sig.SignerID, &sig.Message, &sig.Signature, &sig.PublicKey, &sig.Nonce, &sig.CreatedAt); err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures, rows.Err()
+}
+
+// facilitySystemsGrant matches consents that are granted, unexpired and
+// signed with facility_systems, to a staff member of the facility of the
+// service account given as $2. Free-label scopes never extend to systems.
+const facilitySystemsGrant = `cr.status = 'granted'
+			  AND (cr.expires_at IS NULL OR cr.expires_at > NOW())
+			  AND CASE WHEN cr.data_scope LIKE '{%' THEN COALESCE((cr.data_scope::jsonb ->> 'facility_systems')::boolean, FALSE) ELSE FALSE END
+			  AND cr.doctor_id IN (
+					SELECT u.id FROM users u
+					JOIN service_accounts sa ON sa.facility_id = u.facility_id
+					WHERE sa.id = $2)`
+
+// GetEffectiveAccess returns, for each of patientIDs that accessorID can
+// currently access, the single grant that applies (see domain.PatientAccess).
+// This is the only rule for choosing between several grants; reads, writes and
+// record listings all go through it. Break-glass sessions are only considered
+// when breakGlass is set, since they allow audited emergency reads and never
+// writes. A service account holds no consents of its own: it only gets the
+// consents that patients explicitly extended to the systems of its facility
+// (facility_systems in the signed scope). Patients without access are left out.
+func (r *postgresConsentRepository) GetEffectiveAccess(ctx context.Context, accessorID string, patientIDs []string, breakGlass bool) (map[string]domain.PatientAccess, error) {
+	sql := `SELECT DISTINCT ON (patient_id) patient_id::text, source, data_scope, session_id FROM (
+				SELECT bg.patient_id, 'break_glass' AS source, '{"all":true}' AS data_scope, bg.id::text AS session_id, 1 AS priority, bg.created_at AS updated_at
+				FROM break_glass_sessions bg
+				WHERE $3 AND bg.patient_id = ANY($1) AND bg.doctor_id = $2 AND bg.expires_at > NOW()
+				UNION ALL
+				SELECT cr.patient_id, 'consent', COALESCE(cr.data_scope, ''), '', 2, cr.updated_at
+				FROM consent_requests cr
+				WHERE cr.patient_id = ANY($1)
+				  AND cr.status = 'granted'
+				  AND (cr.expires_at IS NULL OR cr.expires_at > NOW())
+				  AND cr.doctor_id = $2
+				UNION ALL
+				SELECT cr.patient_id, 'consent', COALESCE(cr.data_scope, ''), '', 2, cr.updated_at
+				FROM consent_requests cr
+				WHERE cr.patient_id = ANY($1)
+				  AND ` + facilitySystemsGrant + `
+			) access
+			ORDER BY patient_id, priority, updated_at DESC`
+	rows, err := r.db.Query(ctx, sql, patientIDs, accessorID, breakGlass)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make(map[string]domain.PatientAccess)
+	for rows.Next() {
+		var access domain.PatientAccess
+		if err := rows.Scan(&access.PatientID, &access.Source, &access.DataScope, &access.BreakGlassSessionID); err != nil {
+			return nil, err
+		}
+		accesses[access.PatientID] = access
+	}
+	return accesses, rows.Err()
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// ErrDelegationExists is returned when the guardian and dependent already have a pending or active delegation.
+var ErrDelegationExists = errors.New("delegation already exists")
+
+// DelegationRepository defines the interface for guardian/dependent delegations.
+type DelegationRepository interface {
+	CreateDelegation(ctx context.Context, d domain.Delegation) (string, error)
+	GetDelegationsForUser(ctx context.Context, userID string) ([]domain.Delegation, error)
+	AcceptDelegation(ctx context.Context, delegationID, guardianID string) (int64, error)
+	RevokeDelegation(ctx context.Context, delegationID, userID string) (int64, error)
+	HasActiveDelegation(ctx context.Context, guardianID, dependentID, scope string) (bool, error)
+}
+
+type postgresDelegationRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresDelegationRepository creates a new instance of DelegationRepository.
+func NewPostgresDelegationRepository(db *pgxpool.Pool) DelegationRepository {
+	return &postgresDelegationRepository{db: db}
+}
+
+// CreateDelegation inserts a delegation. Status and AcceptedAt are taken from
+// d, so an admin can create a delegation that is active immediately.
+func (r *postgresDelegationRepository) CreateDelegation(ctx context.Context, d domain.Delegation) (string, error) {
+	sql := `INSERT INTO delegations (guardian_id, dependent_id, scope, relationship, status, ends_at, created_by, accepted_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`
+	var id string
+	err := r.db.QueryRow(ctx, sql, d.GuardianID, d.DependentID, d.Scope, d.Relationship, d.Status, d.EndsAt, d.CreatedBy, d.AcceptedAt).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return "", ErrDelegationExists
+	}
+	return id, err
+}
+
+// GetDelegationsForUser retrieves every delegation where the user is the guardian or the dependent.
+func (r *postgresDelegationRepository) GetDelegationsForUser(ctx context.Context, userID string) ([]domain.Delegation, error) {
+	sql := `SELECT d.id, d.guardian_id, g.name, d.dependent_id, p.name, d.scope, d.relationship,
+				d.status, d.ends_at, d.created_by, d.accepted_at, d.revoked_at, d.created_at
+			FROM delegations d
+			JOIN users g ON d.guardian_id = g.id
+			JOIN users p ON d.dependent_id = p.id
+			WHERE d.guardian_id = $1 OR d.dependent_id = $1
+			ORDER BY d.created_at DESC`
+	rows, err := r.db.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delegations := make([]domain.Delegation, 0)
+	for rows.Next() {
+		var d domain.Delegation
+		if err := rows.Scan(&d.ID, &d.GuardianID, &d.GuardianName, &d.DependentID, &d.DependentName, &d.Scope, &d.Relationship,
+			&d.Status, &d.EndsAt, &d.CreatedBy, &d.AcceptedAt, &d.RevokedAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, d)
+	}
+	return delegations, rows.Err()
+}
+
+// AcceptDelegation activates a pending delegation. Only the invited guardian can accept it.
+func (r *postgresDelegationRepository) AcceptDelegation(ctx context.Context, delegationID, guardianID string) (int64, error) {
+	sql := `UPDATE delegations SET status = 'active', accepted_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND guardian_id = $2 AND status = 'pending'
+			  AND (ends_at IS NULL OR ends_at > NOW())`
+	res, err := r.db.Exec(ctx, sql, delegationID, guardianID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// RevokeDelegation ends a pending or active delegation. Either party may revoke it.
+func (r *postgresDelegationRepository) RevokeDelegation(ctx context.Context, delegationID, userID string) (int64, error) {
+	sql := `UPDATE delegations SET status = 'revoked', revoked_at = NOW(), revoked_by = $2, updated_at = NOW()
+			WHERE id = $1 AND (guardian_id = $2 OR dependent_id = $2) AND status IN ('pending', 'active')`
+	res, err := r.db.Exec(ctx, sql, delegationID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// HasActiveDelegation reports whether the guardian currently holds an
+// unexpired delegation for the dependent that covers scope.
+func (r *postgresDelegationRepository) HasActiveDelegation(ctx context.Context, guardianID, dependentID, scope string) (bool, error) {
+	sql := `SELECT EXISTS (
+				SELECT 1 FROM delegations
+				WHERE guardian_id = $1 AND dependent_id = $2 AND status = 'active'
+				  AND (scope = $3 OR scope = 'full')
+				  AND (ends_at IS NULL OR ends_at > NOW())
+			)`
+	var exists bool
+	err := r.db.QueryRow(ctx, sql, guardianID, dependentID, scope).Scan(&exists)
+	return exists, err
+}
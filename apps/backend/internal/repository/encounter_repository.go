@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// EncounterRepository defines the interface for encounters and the
+// prescriptions and attachments recorded in them.
+type EncounterRepository interface {
+	CreateEncounter(ctx context.Context, encounter *domain.Encounter) (string, error)
+	GetEncounterByID(ctx context.Context, encounterID string) (*domain.Encounter, error)
+	CloseEncounter(ctx context.Context, encounterID, closedBy string) (int64, error)
+	CanWriteToEncounter(ctx context.Context, encounterID, writerID string) (bool, error)
+	AddParticipant(ctx context.Context, encounterID, participantID, addedBy string) error
+	ListPatientEncounters(ctx context.Context, patientID string, scope *domain.ConsentScope, cursor *domain.RecordCursor, limit int) ([]domain.Encounter, error)
+	LoadEncounterDetails(ctx context.Context, encounters []domain.Encounter) error
+	AddAttachments(ctx context.Context, encounterID string, attachments []domain.RecordAttachment) error
+	SetAttachmentsAnchor(ctx context.Context, attachmentIDs []string, dataHash, txHash string) error
+	CreatePrescription(ctx context.Context, prescription *domain.Prescription) (string, error)
+	SetPrescriptionAnchor(ctx context.Context, prescriptionID, dataHash, txHash string) error
+	ListPatientPrescriptions(ctx context.Context, patientID string, scope *domain.ConsentScope, cursor *domain.RecordCursor, limit int) ([]domain.Prescription, error)
+}
+
+type postgresEncounterRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresEncounterRepository creates a new instance of EncounterRepository.
+func NewPostgresEncounterRepository(db *pgxpool.Pool) EncounterRepository {
+	return &postgresEncounterRepository{db: db}
+}
+
+// encounterColumns lists the columns scanned by scanEncounter, in order.
+const encounterColumns = `e.id, e.patient_id, e.encounter_type, e.status, e.facility_id, f.name, e.attending_doctor_id,
+			COALESCE(e.reason, ''), e.started_at, e.ended_at, e.opened_by,
+			d.name, COALESCE(d.specialization, ''), COALESCE(d.facility_id::text, ''), COALESCE(df.name, '')`
+
+// encounterJoins joins the facility and the attending doctor's profile.
+const encounterJoins = `FROM encounters e
+			JOIN facilities f ON f.id = e.facility_id
+			JOIN users d ON d.id = e.attending_doctor_id
+			LEFT JOIN facilities df ON df.id = d.facility_id`
+
+// CreateEncounter opens a new encounter.
+func (r *postgresEncounterRepository) CreateEncounter(ctx context.Context, encounter *domain.Encounter) (string, error) {
+	sql := `INSERT INTO encounters (patient_id, facility_id, attending_doctor_id, encounter_type, reason, started_at, opened_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id string
+	err := r.db.QueryRow(ctx, sql, encounter.PatientID, encounter.FacilityID, encounter.AttendingDoctorID, encounter.Type,
+		encounter.Reason, encounter.StartedAt, encounter.OpenedBy).Scan(&id)
+	return id, err
+}
+
+// GetEncounterByID retrieves a single encounter without its contents.
+func (r *postgresEncounterRepository) GetEncounterByID(ctx context.Context, encounterID string) (*domain.Encounter, error) {
+	sql := `SELECT ` + encounterColumns + ` ` + encounterJoins + ` WHERE e.id = $1`
+	return scanEncounter(r.db.QueryRow(ctx, sql, encounterID))
+}
+
+// CloseEncounter closes an open encounter now. It returns 0 when the
+// encounter does not exist or is already closed.
+func (r *postgresEncounterRepository) CloseEncounter(ctx context.Context, encounterID, closedBy string) (int64, error) {
+	sql := `UPDATE encounters SET status = 'closed', ended_at = GREATEST(NOW(), started_at), closed_by = $2
+			WHERE id = $1 AND status = 'open'`
+	res, err := r.db.Exec(ctx, sql, encounterID, closedBy)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// CanWriteToEncounter reports whether writerID takes part in an encounter and
+// may add data to it: its attending doctor, whoever opened it, or a clinician
+// the attending doctor added. Other staff of the facility may not.
+func (r *postgresEncounterRepository) CanWriteToEncounter(ctx context.Context, encounterID, writerID string) (bool, error) {
+	sql := `SELECT EXISTS (
+				SELECT 1 FROM encounters e
+				WHERE e.id = $1
+				  AND (e.attending_doctor_id = $2
+				    OR e.opened_by = $2
+				    OR EXISTS (SELECT 1 FROM encounter_participants p WHERE p.encounter_id = e.id AND p.participant_id = $2))
+			)`
+	var allowed bool
+	err := r.db.QueryRow(ctx, sql, encounterID, writerID).Scan(&allowed)
+	return allowed, err
+}
+
+// AddParticipant lets a clinician add data to an encounter. Adding someone
+// who already takes part is not an error.
+func (r *postgresEncounterRepository) AddParticipant(ctx context.Context, encounterID, participantID, addedBy string) error {
+	sql := `INSERT INTO encounter_participants (encounter_id, participant_id, added_by) VALUES ($1, $2, $3)
+			ON CONFLICT (encounter_id, participant_id) DO NOTHING`
+	_, err := r.db.Exec(ctx, sql, encounterID, participantID, addedBy)
+	return err
+}
+
+// ListPatientEncounters retrieves up to limit encounters of a patient, newest
+// first, starting after cursor. When scope is not nil, only encounters that
+// started within its date range are returned.
+func (r *postgresEncounterRepository) ListPatientEncounters(ctx context.Context, patientID string, scope *domain.ConsentScope, cursor *domain.RecordCursor, limit int) ([]domain.Encounter, error) {
+	conditions := []string{"e.patient_id = $1"}
+	args := []any{patientID}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if scope != nil && scope.From != nil {
+		where("e.started_at >= $%d", *scope.From)
+	}
+	if scope != nil && scope.To != nil {
+		where("e.started_at <= $%d", *scope.To)
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(e.started_at, e.id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+	args = append(args, limit)
+
+	sql := `SELECT ` + encounterColumns + ` ` + encounterJoins + `
+			WHERE ` + strings.Join(conditions, " AND ") + `
+			ORDER BY e.started_at DESC, e.id DESC
+			LIMIT $` + strconv.Itoa(len(args))
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	encounters := make([]domain.Encounter, 0)
+	for rows.Next() {
+		encounter, err := scanEncounter(rows)
+		if err != nil {
+			return nil, err
+		}
+		encounters = append(encounters, *encounter)
+	}
+	return encounters, rows.Err()
+}
+
+// LoadEncounterDetails fills the prescriptions and the encounter-level
+// attachments of encounters. Records are loaded by the record repository.
+func (r *postgresEncounterRepository) LoadEncounterDetails(ctx context.Context, encounters []domain.Encounter) error {
+	if len(encounters) == 0 {
+		return nil
+	}
+	ids := make([]string, len(encounters))
+	byID := make(map[string]*domain.Encounter, len(encounters))
+	for i := range encounters {
+		ids[i] = encounters[i].ID
+		byID[encounters[i].ID] = &encounters[i]
+		encounters[i].Prescriptions = make([]domain.Prescription, 0)
+		encounters[i].Attachments = make([]domain.RecordAttachment, 0)
+	}
+
+	prescriptions, err := r.queryPrescriptions(ctx, `WHERE p.encounter_id = ANY($1::uuid[]) ORDER BY p.created_at`, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range prescriptions {
+		byID[p.EncounterID].Prescriptions = append(byID[p.EncounterID].Prescriptions, p)
+	}
+
+	query := `SELECT encounter_id, id, cid, filename, mime_type, size_bytes, sha256, uploaded_by::text, uploaded_at,
+				COALESCE(data_hash, ''), COALESCE(tx_hash, '')
+			FROM record_attachments WHERE encounter_id = ANY($1) ORDER BY position, uploaded_at`
+	return queryEntries(ctx, r.db, query, ids, func(rows pgx.Rows) error {
+		var encounterID string
+		var a domain.RecordAttachment
+		if err := rows.Scan(&encounterID, &a.ID, &a.CID, &a.Filename, &a.MIMEType, &a.Size, &a.SHA256, &a.UploadedBy, &a.UploadedAt, &a.DataHash, &a.TxHash); err != nil {
+			return err
+		}
+		byID[encounterID].Attachments = append(byID[encounterID].Attachments, a)
+		return nil
+	})
+}
+
+// AddAttachments attaches files directly to an encounter, after the ones it
+// already has, and fills in their IDs.
+func (r *postgresEncounterRepository) AddAttachments(ctx context.Context, encounterID string, attachments []domain.RecordAttachment) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var next int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(position) + 1, 0) FROM record_attachments WHERE encounter_id = $1`, encounterID).Scan(&next); err != nil {
+		return err
+	}
+	for i := range attachments {
+		a := &attachments[i]
+		query := `INSERT INTO record_attachments (encounter_id, position, cid, filename, mime_type, size_bytes, sha256, uploaded_by, uploaded_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+		if err := tx.QueryRow(ctx, query, encounterID, next+i, a.CID, a.Filename, a.MIMEType, a.Size, a.SHA256, a.UploadedBy, a.UploadedAt).Scan(&a.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// SetAttachmentsAnchor stores the hash of files attached to an encounter
+// together and the blockchain transaction that anchored it.
+func (r *postgresEncounterRepository) SetAttachmentsAnchor(ctx context.Context, attachmentIDs []string, dataHash, txHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE record_attachments SET data_hash = $2, tx_hash = $3 WHERE id = ANY($1) AND encounter_id IS NOT NULL`,
+		attachmentIDs, dataHash, txHash)
+	return err
+}
+
+// CreatePrescription stores a prescription and its items in one transaction.
+func (r *postgresEncounterRepository) CreatePrescription(ctx context.Context, prescription *domain.Prescription) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	insert := `INSERT INTO prescriptions (encounter_id, patient_id, prescriber_id, prescriber_name, notes)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err = tx.QueryRow(ctx, insert, prescription.EncounterID, prescription.PatientID, prescription.PrescriberID,
+		prescription.PrescriberName, prescription.Notes).Scan(&prescription.ID, &prescription.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	for i := range prescription.Items {
+		m := &prescription.Items[i]
+		query := `INSERT INTO prescription_items (prescription_id, position, name, dose, route, frequency, duration) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		if err := tx.QueryRow(ctx, query, prescription.ID, i, m.Name, m.Dose, m.Route, m.Frequency, m.Duration).Scan(&m.ID); err != nil {
+			return "", err
+		}
+	}
+	return prescription.ID, tx.Commit(ctx)
+}
+
+// SetPrescriptionAnchor stores the hash of a prescription and the blockchain transaction that anchored it.
+func (r *postgresEncounterRepository) SetPrescriptionAnchor(ctx context.Context, prescriptionID, dataHash, txHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE prescriptions SET data_hash = $2, tx_hash = $3 WHERE id = $1`, prescriptionID, dataHash, txHash)
+	return err
+}
+
+// ListPatientPrescriptions retrieves up to limit prescriptions of a patient,
+// newest first, starting after cursor. When scope is not nil, only
+// prescriptions written within its date range are returned.
+func (r *postgresEncounterRepository) ListPatientPrescriptions(ctx context.Context, patientID string, scope *domain.ConsentScope, cursor *domain.RecordCursor, limit int) ([]domain.Prescription, error) {
+	conditions := []string{"p.patient_id = $1"}
+	args := []any{patientID}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if scope != nil && scope.From != nil {
+		where("p.created_at >= $%d", *scope.From)
+	}
+	if scope != nil && scope.To != nil {
+		where("p.created_at <= $%d", *scope.To)
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(p.created_at, p.id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+	args = append(args, limit)
+
+	clause := `WHERE ` + strings.Join(conditions, " AND ") + `
+			ORDER BY p.created_at DESC, p.id DESC
+			LIMIT $` + strconv.Itoa(len(args))
+	return r.queryPrescriptions(ctx, clause, args...)
+}
+
+// queryPrescriptions runs a prescription query with the given WHERE/ORDER
+// clause and loads the items of every prescription found.
+func (r *postgresEncounterRepository) queryPrescriptions(ctx context.Context, clause string, args ...any) ([]domain.Prescription, error) {
+	rows, err := r.db.Query(ctx, `SELECT p.id, p.encounter_id, p.patient_id, p.prescriber_id, p.prescriber_name, p.notes, p.created_at,
+				COALESCE(p.data_hash, ''), COALESCE(p.tx_hash, '')
+			FROM prescriptions p `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	prescriptions := make([]domain.Prescription, 0)
+	for rows.Next() {
+		var p domain.Prescription
+		if err := rows.Scan(&p.ID, &p.EncounterID, &p.PatientID, &p.PrescriberID, &p.PrescriberName, &p.Notes, &p.CreatedAt, &p.DataHash, &p.TxHash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Items = make([]domain.Medication, 0)
+		prescriptions = append(prescriptions, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(prescriptions) == 0 {
+		return prescriptions, nil
+	}
+
+	ids := make([]string, len(prescriptions))
+	byID := make(map[string]*domain.Prescription, len(prescriptions))
+	for i := range prescriptions {
+		ids[i] = prescriptions[i].ID
+		byID[prescriptions[i].ID] = &prescriptions[i]
+	}
+	query := `SELECT prescription_id, id, name, dose, route, frequency, duration FROM prescription_items WHERE prescription_id = ANY($1) ORDER BY position`
+	err = queryEntries(ctx, r.db, query, ids, func(rows pgx.Rows) error {
+		var prescriptionID string
+		var m domain.Medication
+		if err := rows.Scan(&prescriptionID, &m.ID, &m.Name, &m.Dose, &m.Route, &m.Frequency, &m.Duration); err != nil {
+			return err
+		}
+		byID[prescriptionID].Items = append(byID[prescriptionID].Items, m)
+		return nil
+	})
+	return prescriptions, err
+}
+
+// scanEncounter scans a row selected with encounterColumns.
+func scanEncounter(row pgx.Row) (*domain.Encounter, error) {
+	var e domain.Encounter
+	var doctor domain.DoctorProfile
+	if err := row.Scan(&e.ID, &e.PatientID, &e.Type, &e.Status, &e.FacilityID, &e.FacilityName, &e.AttendingDoctorID,
+		&e.Reason, &e.StartedAt, &e.EndedAt, &e.OpenedBy,
+		&doctor.Name, &doctor.Specialization, &doctor.FacilityID, &doctor.FacilityName); err != nil {
+		return nil, err
+	}
+	doctor.ID = e.AttendingDoctorID
+	e.AttendingDoctor = &doctor
+	return &e, nil
+}
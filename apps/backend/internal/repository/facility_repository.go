@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// FacilityRepository defines the interface for facility data operations.
+type FacilityRepository interface {
+	ListFacilities(ctx context.Context) ([]domain.Facility, error)
+	SetRequireDoctorMFA(ctx context.Context, facilityID string, required bool) (*domain.Facility, error)
+}
+
+type postgresFacilityRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresFacilityRepository creates a new instance of FacilityRepository.
+func NewPostgresFacilityRepository(db *pgxpool.Pool) FacilityRepository {
+	return &postgresFacilityRepository{db: db}
+}
+
+// ListFacilities returns all facilities ordered by name.
+func (r *postgresFacilityRepository) ListFacilities(ctx context.Context) ([]domain.Facility, error) {
+	sql := `SELECT id, name, require_doctor_mfa, created_at, updated_at FROM facilities ORDER BY name ASC`
+	rows, err := r.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facilities := make([]domain.Facility, 0)
+	for rows.Next() {
+		var f domain.Facility
+		if err := rows.Scan(&f.ID, &f.Name, &f.RequireDoctorMFA, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		facilities = append(facilities, f)
+	}
+	return facilities, rows.Err()
+}
+
+// SetRequireDoctorMFA changes whether clinical staff of the facility must use MFA.
+func (r *postgresFacilityRepository) SetRequireDoctorMFA(ctx context.Context, facilityID string, required bool) (*domain.Facility, error) {
+	sql := `UPDATE facilities SET require_doctor_mfa = $2, updated_at = NOW() WHERE id = $1
+			RETURNING id, name, require_doctor_mfa, created_at, updated_at`
+	var f domain.Facility
+	err := r.db.QueryRow(ctx, sql, facilityID, required).Scan(&f.ID, &f.Name, &f.RequireDoctorMFA, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// ErrKeyChanged is returned by RotatePublicKey when the user's key was replaced concurrently.
+var ErrKeyChanged = errors.New("public key changed during rotation")
+
+// KeyRepository defines the interface for user key material: the escrowed
+// (encrypted) private key and the history of public keys.
+type KeyRepository interface {
+	SaveKeyBackup(ctx context.Context, userID, sealedKey string) error
+	GetKeyBackup(ctx context.Context, userID string) (string, *time.Time, error)
+	DeleteKeyBackup(ctx context.Context, userID string) error
+	RotatePublicKey(ctx context.Context, userID, oldPublicKey, newPublicKey, method string) error
+	GetKeyHistory(ctx context.Context, userID string) ([]domain.UserKey, error)
+	GetPublicKeyAt(ctx context.Context, userID string, at time.Time) (string, error)
+}
+
+type postgresKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresKeyRepository creates a new instance of KeyRepository.
+func NewPostgresKeyRepository(db *pgxpool.Pool) KeyRepository {
+	return &postgresKeyRepository{db: db}
+}
+
+// SaveKeyBackup stores (or replaces) the user's encrypted private key.
+func (r *postgresKeyRepository) SaveKeyBackup(ctx context.Context, userID, sealedKey string) error {
+	sql := `UPDATE users SET private_key_encrypted = $2, key_backup_at = NOW(), updated_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(ctx, sql, userID, sealedKey)
+	return err
+}
+
+// GetKeyBackup retrieves the encrypted private key. It returns an empty string
+// when the user has not opted in to key escrow.
+func (r *postgresKeyRepository) GetKeyBackup(ctx context.Context, userID string) (string, *time.Time, error) {
+	sql := `SELECT COALESCE(private_key_encrypted, ''), key_backup_at FROM users WHERE id = $1`
+	var sealedKey string
+	var backedUpAt *time.Time
+	err := r.db.QueryRow(ctx, sql, userID).Scan(&sealedKey, &backedUpAt)
+	return sealedKey, backedUpAt, err
+}
+
+// DeleteKeyBackup removes the escrowed key.
+func (r *postgresKeyRepository) DeleteKeyBackup(ctx context.Context, userID string) error {
+	sql := `UPDATE users SET private_key_encrypted = NULL, key_backup_at = NULL, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(ctx, sql, userID)
+	return err
+}
+
+// RotatePublicKey closes the validity period of the current key and makes
+// newPublicKey the active key. The old escrow backup belongs to the old key,
+// so it is removed. An empty oldPublicKey enrolls the first key of an account
+// that has none.
+func (r *postgresKeyRepository) RotatePublicKey(ctx context.Context, userID, oldPublicKey, newPublicKey, method string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Pastikan kunci yang dibuktikan masih kunci aktif (tidak ada rotasi lain di antaranya).
+	// oldPublicKey kosong berarti pendaftaran kunci pertama: kolomnya harus masih NULL.
+	update := `UPDATE users
+			SET public_key = $3, private_key_encrypted = NULL, key_backup_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND public_key IS NOT DISTINCT FROM NULLIF($2, '')`
+	res, err := tx.Exec(ctx, update, userID, oldPublicKey, newPublicKey)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return ErrKeyChanged
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE user_keys SET valid_until = NOW() WHERE user_id = $1 AND valid_until IS NULL`, userID); err != nil {
+		return err
+	}
+	insert := `INSERT INTO user_keys (user_id, public_key, rotation_method) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insert, userID, newPublicKey, method); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetKeyHistory retrieves every public key the user has had, newest first.
+func (r *postgresKeyRepository) GetKeyHistory(ctx context.Context, userID string) ([]domain.UserKey, error) {
+	sql := `SELECT id, public_key, valid_from, valid_until, COALESCE(rotation_method, '')
+			FROM user_keys
+			WHERE user_id = $1
+			ORDER BY valid_from DESC`
+	rows, err := r.db.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]domain.UserKey, 0)
+	for rows.Next() {
+		var key domain.UserKey
+		if err := rows.Scan(&key.ID, &key.PublicKey, &key.ValidFrom, &key.ValidUntil, &key.RotationMethod); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetPublicKeyAt retrieves the public key that was active at the given time, so
+// signatures made before a rotation still verify against the right key.
+func (r *postgresKeyRepository) GetPublicKeyAt(ctx context.Context, userID string, at time.Time) (string, error) {
+	sql := `SELECT public_key FROM user_keys
+			WHERE user_id = $1 AND valid_from <= $2 AND (valid_until IS NULL OR valid_until > $2)
+			ORDER BY valid_from DESC
+			LIMIT 1`
+	var publicKey string
+	err := r.db.QueryRow(ctx, sql, userID, at).Scan(&publicKey)
+	return publicKey, err
+}
@@ -10,6 +10,7 @@ import (
 // LogRepository defines the interface for audit log operations.
 type LogRepository interface {
 	GetLogsByPatientID(ctx context.Context, patientID string) ([]domain.AccessLog, error)
+	LogRecordWrite(ctx context.Context, attempt *domain.RecordWriteAttempt) error
 }
 
 type postgresLogRepository struct {
@@ -23,17 +24,45 @@ func NewPostgresLogRepository(db *pgxpool.Pool) LogRepository {
 
 // GetLogsByPatientID retrieves a combined audit log for a specific patient.
 func (r *postgresLogRepository) GetLogsByPatientID(ctx context.Context, patientID string) ([]domain.AccessLog, error) {
-	// Query ini menggabungkan data dari dua aktivitas berbeda menjadi satu log
+	// Query ini menggabungkan data dari beberapa aktivitas berbeda menjadi satu log.
+	// Entri yang terkait rekam medis membawa waktu versi pertama dan ID semua
+	// versinya agar dapat dibatasi sesuai cakupan izin pasien.
 	sql := `
-		-- Log untuk pembuatan rekam medis
+		-- Log untuk pembuatan rekam medis yang ditulis sebelum percobaan penulisan dicatat
 		SELECT 
 			mr.doctor_name, 
 			'membuat rekam medis' as action, 
 			mr.diagnosis, 
 			mr.created_at as timestamp, 
-			'terverifikasi' as status
+			'terverifikasi' as status,
+			g.created_at as record_written_at,
+			ARRAY(SELECT v.id::text FROM medical_records v WHERE v.record_group_id = mr.record_group_id) as record_version_ids
 		FROM medical_records mr
+		JOIN medical_records g ON g.id = mr.record_group_id
 		WHERE mr.patient_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM record_write_attempts wa WHERE wa.record_id = mr.id)
+
+		UNION ALL
+
+		-- Log untuk setiap percobaan menulis rekam medis, termasuk yang ditolak
+		SELECT 
+			wa.actor_name as doctor_name, 
+			CASE wa.action WHEN 'amend' THEN 'mengamandemen rekam medis' ELSE 'membuat rekam medis' END as action, 
+			CASE WHEN wa.outcome = 'success' THEN COALESCE(mr.diagnosis, '') ELSE COALESCE(wa.detail, '') END as diagnosis, 
+			wa.created_at as timestamp, 
+			CASE wa.outcome
+				WHEN 'success' THEN 'terverifikasi'
+				WHEN 'denied' THEN 'ditolak'
+				WHEN 'rejected' THEN 'tidak valid'
+				WHEN 'unanchored' THEN 'tersimpan, belum tercatat di blockchain'
+				ELSE 'gagal'
+			END as status,
+			g.created_at,
+			CASE WHEN mr.id IS NOT NULL THEN ARRAY(SELECT v.id::text FROM medical_records v WHERE v.record_group_id = mr.record_group_id) END
+		FROM record_write_attempts wa
+		LEFT JOIN medical_records mr ON mr.id = wa.record_id
+		LEFT JOIN medical_records g ON g.id = mr.record_group_id
+		WHERE wa.patient_id = $1
 
 		UNION ALL
 
@@ -43,11 +72,43 @@ func (r *postgresLogRepository) GetLogsByPatientID(ctx context.Context, patientI
 			'meminta izin akses' as action, 
 			'' as diagnosis, 
 			cr.created_at as timestamp, 
-			cr.status
+			cr.status,
+			NULL::timestamptz,
+			NULL::text[]
 		FROM consent_requests cr
 		JOIN users u ON cr.doctor_id = u.id
 		WHERE cr.patient_id = $1
 
+		UNION ALL
+
+		-- Log untuk akses darurat (break-glass), alasan ditampilkan kepada pasien
+		SELECT 
+			u.name as doctor_name, 
+			'AKSES DARURAT (break-glass)' as action, 
+			bg.reason as diagnosis, 
+			bg.created_at as timestamp, 
+			bg.review_status as status,
+			NULL::timestamptz,
+			NULL::text[]
+		FROM break_glass_sessions bg
+		JOIN users u ON bg.doctor_id = u.id
+		WHERE bg.patient_id = $1
+
+		UNION ALL
+
+		-- Log untuk setiap pembacaan data selama sesi akses darurat
+		SELECT 
+			u.name as doctor_name, 
+			'membaca data (akses darurat)' as action, 
+			a.method || ' ' || a.path as diagnosis, 
+			a.accessed_at as timestamp, 
+			'tercatat' as status,
+			NULL::timestamptz,
+			NULL::text[]
+		FROM break_glass_accesses a
+		JOIN users u ON a.doctor_id = u.id
+		WHERE a.patient_id = $1
+
 		ORDER BY timestamp DESC;
 	`
 	rows, err := r.db.Query(ctx, sql, patientID)
@@ -59,10 +120,19 @@ func (r *postgresLogRepository) GetLogsByPatientID(ctx context.Context, patientI
 	logs := make([]domain.AccessLog, 0)
 	for rows.Next() {
 		var logItem domain.AccessLog
-		if err := rows.Scan(&logItem.DoctorName, &logItem.Action, &logItem.RecordDiagnosis, &logItem.Timestamp, &logItem.Status); err != nil {
+		if err := rows.Scan(&logItem.DoctorName, &logItem.Action, &logItem.RecordDiagnosis, &logItem.Timestamp, &logItem.Status,
+			&logItem.RecordWrittenAt, &logItem.RecordVersionIDs); err != nil {
 			return nil, err
 		}
 		logs = append(logs, logItem)
 	}
 	return logs, nil
 }
+
+// LogRecordWrite records an attempt to write a record for a patient.
+func (r *postgresLogRepository) LogRecordWrite(ctx context.Context, attempt *domain.RecordWriteAttempt) error {
+	sql := `INSERT INTO record_write_attempts (patient_id, actor_id, actor_name, action, record_id, outcome, detail)
+			VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, NULLIF($7, ''))`
+	_, err := r.db.Exec(ctx, sql, attempt.PatientID, attempt.ActorID, attempt.ActorName, attempt.Action, attempt.RecordID, attempt.Outcome, attempt.Detail)
+	return err
+}
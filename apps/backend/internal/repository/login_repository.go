@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// LoginRepository defines the interface for login events and account lockout state.
+type LoginRepository interface {
+	RecordLoginEvent(ctx context.Context, event *domain.LoginEvent) error
+	CountRecentFailuresByIP(ctx context.Context, ipAddress string, since time.Time) (int, error)
+	GetLoginEventsByUserID(ctx context.Context, userID string, limit int) ([]domain.LoginEvent, error)
+	GetLoginState(ctx context.Context, userID string) (*domain.LoginState, error)
+	RegisterFailedLogin(ctx context.Context, userID string, maxFailures int, lockDuration time.Duration) (*domain.LoginState, error)
+	ResetFailedLogins(ctx context.Context, userID string) error
+	UnlockAccount(ctx context.Context, userID string) (int64, error)
+}
+
+type postgresLoginRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresLoginRepository creates a new instance of LoginRepository.
+func NewPostgresLoginRepository(db *pgxpool.Pool) LoginRepository {
+	return &postgresLoginRepository{db: db}
+}
+
+// RecordLoginEvent inserts a login attempt. UserID may be empty for unknown accounts.
+func (r *postgresLoginRepository) RecordLoginEvent(ctx context.Context, event *domain.LoginEvent) error {
+	sql := `INSERT INTO login_events (user_id, email, ip_address, user_agent, success, reason)
+			VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, NULLIF($6, ''))`
+	_, err := r.db.Exec(ctx, sql, event.UserID, event.Email, event.IPAddress, event.UserAgent, event.Success, event.Reason)
+	return err
+}
+
+// CountRecentFailuresByIP counts failed attempts from an IP address since the given time.
+func (r *postgresLoginRepository) CountRecentFailuresByIP(ctx context.Context, ipAddress string, since time.Time) (int, error) {
+	sql := `SELECT COUNT(*) FROM login_events WHERE ip_address = $1 AND success = FALSE AND created_at > $2`
+	var count int
+	err := r.db.QueryRow(ctx, sql, ipAddress, since).Scan(&count)
+	return count, err
+}
+
+// GetLoginEventsByUserID retrieves the most recent login attempts on an account.
+func (r *postgresLoginRepository) GetLoginEventsByUserID(ctx context.Context, userID string, limit int) ([]domain.LoginEvent, error) {
+	sql := `SELECT id, ip_address, COALESCE(user_agent, ''), success, COALESCE(reason, ''), created_at
+			FROM login_events
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2`
+	rows, err := r.db.Query(ctx, sql, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]domain.LoginEvent, 0)
+	for rows.Next() {
+		var event domain.LoginEvent
+		if err := rows.Scan(&event.ID, &event.IPAddress, &event.UserAgent, &event.Success, &event.Reason, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetLoginState retrieves the failed-attempt counters of an account.
+func (r *postgresLoginRepository) GetLoginState(ctx context.Context, userID string) (*domain.LoginState, error) {
+	sql := `SELECT failed_login_count, last_failed_login_at, locked_until FROM users WHERE id = $1`
+	var state domain.LoginState
+	err := r.db.QueryRow(ctx, sql, userID).Scan(&state.FailedCount, &state.LastFailedAt, &state.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RegisterFailedLogin increments the failure counter and locks the account
+// once maxFailures consecutive failures have been reached.
+func (r *postgresLoginRepository) RegisterFailedLogin(ctx context.Context, userID string, maxFailures int, lockDuration time.Duration) (*domain.LoginState, error) {
+	sql := `UPDATE users
+			SET failed_login_count = failed_login_count + 1,
+				last_failed_login_at = NOW(),
+				locked_until = CASE
+					WHEN failed_login_count + 1 >= $2 THEN NOW() + make_interval(secs => $3)
+					ELSE locked_until
+				END
+			WHERE id = $1
+			RETURNING failed_login_count, last_failed_login_at, locked_until`
+	var state domain.LoginState
+	err := r.db.QueryRow(ctx, sql, userID, maxFailures, lockDuration.Seconds()).Scan(&state.FailedCount, &state.LastFailedAt, &state.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ResetFailedLogins clears the counters after a successful login.
+func (r *postgresLoginRepository) ResetFailedLogins(ctx context.Context, userID string) error {
+	sql := `UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = $1`
+	_, err := r.db.Exec(ctx, sql, userID)
+	return err
+}
+
+// UnlockAccount lifts a lockout before it expires (admin action).
+func (r *postgresLoginRepository) UnlockAccount(ctx context.Context, userID string) (int64, error) {
+	sql := `UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL, updated_at = NOW() WHERE id = $1`
+	res, err := r.db.Exec(ctx, sql, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
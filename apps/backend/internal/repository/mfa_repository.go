@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// MFARepository defines the interface for second-factor (TOTP) data operations.
+type MFARepository interface {
+	GetMFASettings(ctx context.Context, userID string) (*domain.MFASettings, error)
+	SaveTOTPSecret(ctx context.Context, userID, encryptedSecret string) error
+	EnableMFA(ctx context.Context, userID string, recoveryCodeHashes []string) error
+	DisableMFA(ctx context.Context, userID string) error
+	MarkTOTPStepUsed(ctx context.Context, userID string, step int64) (bool, error)
+	ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	ConsumeMFAToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+}
+
+type postgresMFARepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresMFARepository creates a new instance of MFARepository.
+func NewPostgresMFARepository(db *pgxpool.Pool) MFARepository {
+	return &postgresMFARepository{db: db}
+}
+
+// GetMFASettings retrieves the user's TOTP state together with the MFA policy of their facility.
+func (r *postgresMFARepository) GetMFASettings(ctx context.Context, userID string) (*domain.MFASettings, error) {
+	sql := `SELECT u.mfa_enabled,
+				COALESCE(u.totp_secret_encrypted, ''),
+				u.totp_last_used_step,
+				COALESCE(f.require_doctor_mfa, FALSE) AND r.clinical_staff
+			FROM users u
+			JOIN roles r ON r.name = u.role
+			LEFT JOIN facilities f ON u.facility_id = f.id
+			WHERE u.id = $1`
+	var settings domain.MFASettings
+	err := r.db.QueryRow(ctx, sql, userID).Scan(&settings.Enabled, &settings.SecretEncrypted, &settings.LastUsedStep, &settings.Required)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SaveTOTPSecret stores a new (not yet activated) TOTP secret.
+func (r *postgresMFARepository) SaveTOTPSecret(ctx context.Context, userID, encryptedSecret string) error {
+	sql := `UPDATE users SET totp_secret_encrypted = $2, totp_last_used_step = 0, updated_at = NOW()
+			WHERE id = $1 AND mfa_enabled = FALSE`
+	_, err := r.db.Exec(ctx, sql, userID, encryptedSecret)
+	return err
+}
+
+// EnableMFA activates TOTP and replaces the user's recovery codes in one transaction.
+func (r *postgresMFARepository) EnableMFA(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET mfa_enabled = TRUE, mfa_enabled_at = NOW(), updated_at = NOW() WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DisableMFA turns TOTP off and removes the secret and recovery codes.
+func (r *postgresMFARepository) DisableMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE users
+			SET mfa_enabled = FALSE, mfa_enabled_at = NULL, totp_secret_encrypted = NULL, totp_last_used_step = 0, updated_at = NOW()
+			WHERE id = $1`
+	if _, err := tx.Exec(ctx, sql, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code. It returns false
+// when that step (or a later one) was already used, which blocks code replay.
+func (r *postgresMFARepository) MarkTOTPStepUsed(ctx context.Context, userID string, step int64) (bool, error) {
+	sql := `UPDATE users SET totp_last_used_step = $2 WHERE id = $1 AND totp_last_used_step < $2`
+	res, err := r.db.Exec(ctx, sql, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// ConsumeRecoveryCode marks a matching unused recovery code as used.
+func (r *postgresMFARepository) ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	sql := `UPDATE mfa_recovery_codes SET used_at = NOW()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.db.Exec(ctx, sql, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// ConsumeMFAToken records that the MFA token with the given ID has been used.
+// It reports false when the token was already used before.
+func (r *postgresMFARepository) ConsumeMFAToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	// Token yang sudah kedaluwarsa tidak perlu diingat lagi karena ditolak saat parsing.
+	if _, err := r.db.Exec(ctx, `DELETE FROM used_mfa_tokens WHERE expires_at < NOW()`); err != nil {
+		return false, err
+	}
+	sql := `INSERT INTO used_mfa_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT (token_id) DO NOTHING`
+	res, err := r.db.Exec(ctx, sql, tokenID, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OIDCRepository defines the interface for OpenID Connect login state and
+// the external identities linked to users.
+type OIDCRepository interface {
+	SaveState(ctx context.Context, stateHash, provider, codeVerifier, nonce string, expiresAt time.Time) error
+	ConsumeState(ctx context.Context, stateHash, provider string) (string, string, error)
+	GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error)
+	LinkIdentity(ctx context.Context, userID, provider, subject, email string) error
+	TouchIdentity(ctx context.Context, provider, subject string) error
+}
+
+type postgresOIDCRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresOIDCRepository creates a new instance of OIDCRepository.
+func NewPostgresOIDCRepository(db *pgxpool.Pool) OIDCRepository {
+	return &postgresOIDCRepository{db: db}
+}
+
+// SaveState stores the PKCE verifier and nonce of a login that was just started.
+func (r *postgresOIDCRepository) SaveState(ctx context.Context, stateHash, provider, codeVerifier, nonce string, expiresAt time.Time) error {
+	// Bersihkan state kedaluwarsa sekalian agar tabel tidak tumbuh tanpa batas.
+	if _, err := r.db.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	sql := `INSERT INTO oidc_states (state_hash, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(ctx, sql, stateHash, provider, codeVerifier, nonce, expiresAt)
+	return err
+}
+
+// ConsumeState deletes an unexpired state and returns its code verifier and
+// nonce, so each state can be redeemed only once.
+func (r *postgresOIDCRepository) ConsumeState(ctx context.Context, stateHash, provider string) (string, string, error) {
+	sql := `DELETE FROM oidc_states
+			WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+			RETURNING code_verifier, nonce`
+	var codeVerifier, nonce string
+	err := r.db.QueryRow(ctx, sql, stateHash, provider).Scan(&codeVerifier, &nonce)
+	return codeVerifier, nonce, err
+}
+
+// GetUserIDByIdentity finds the user linked to an IdP subject.
+func (r *postgresOIDCRepository) GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error) {
+	sql := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+	var userID string
+	err := r.db.QueryRow(ctx, sql, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// LinkIdentity links an IdP subject to a user.
+func (r *postgresOIDCRepository) LinkIdentity(ctx context.Context, userID, provider, subject, email string) error {
+	sql := `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, NULLIF($4, ''), NOW())`
+	_, err := r.db.Exec(ctx, sql, userID, provider, subject, email)
+	return err
+}
+
+// TouchIdentity records a login through an already linked identity.
+func (r *postgresOIDCRepository) TouchIdentity(ctx context.Context, provider, subject string) error {
+	sql := `UPDATE user_identities SET last_login_at = NOW() WHERE provider = $1 AND subject = $2`
+	_, err := r.db.Exec(ctx, sql, provider, subject)
+	return err
+}
@@ -3,16 +3,33 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/trifur/rekamedchain/backend/internal/domain"
 )
 
+// ErrRecordSuperseded is returned when amending a version that is no longer the latest.
+var ErrRecordSuperseded = errors.New("record version already superseded")
+
 // RecordRepository defines the interface for medical record data operations.
+// Records are append-only: a correction is stored as a new version.
 type RecordRepository interface {
 	CreateRecord(ctx context.Context, record *domain.MedicalRecord) (string, error)
-	GetRecordsByPatientID(ctx context.Context, patientID string) ([]domain.MedicalRecord, error)
+	AmendRecord(ctx context.Context, previousID string, record *domain.MedicalRecord) (string, error)
+	SetRecordAnchor(ctx context.Context, recordID, dataHash, txHash string) error
+	GetRecordByID(ctx context.Context, recordID string) (*domain.MedicalRecord, error)
+	ListPatientRecords(ctx context.Context, patientID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error)
+	ListDoctorRecords(ctx context.Context, doctorID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error)
+	ListEncounterRecords(ctx context.Context, encounterIDs []string, scope *domain.ConsentScope) ([]domain.MedicalRecord, error)
+	GetRecordHistory(ctx context.Context, recordID string) ([]domain.MedicalRecord, error)
+	ListRecordsForIndexing(ctx context.Context, afterID string, limit int, all bool) ([]domain.MedicalRecord, error)
+	UpdateSearchIndex(ctx context.Context, record *domain.MedicalRecord) error
+	ClearSearchIndexed(ctx context.Context, recordID string) error
 	CreateLedgerBlock(ctx context.Context, block *domain.LedgerBlock) error
 	GetLastLedgerHash(ctx context.Context) (string, error)
 }
@@ -26,20 +43,289 @@ func NewPostgresRecordRepository(db *pgxpool.Pool) RecordRepository {
 	return &postgresRecordRepository{db: db}
 }
 
-// CreateRecord inserts a new medical record into the database.
+// recordColumns lists the columns scanned by scanRecord, in order.
+const recordColumns = `id, patient_id, doctor_name, diagnosis, notes, attachment_cid, created_at,
+			record_group_id, version, previous_version_id, superseded_at, COALESCE(amendment_reason, ''),
+			COALESCE(author_id::text, ''), COALESCE(data_hash, ''), COALESCE(tx_hash, ''), COALESCE(doctor_id::text, ''),
+			COALESCE(encounter_id::text, '')`
+
+// CreateRecord inserts a new medical record into the database as version 1 of
+// a new record group, together with its structured clinical content.
 func (r *postgresRecordRepository) CreateRecord(ctx context.Context, record *domain.MedicalRecord) (string, error) {
-	query := `INSERT INTO medical_records (patient_id, doctor_name, diagnosis, notes, attachment_cid) 
-			VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `WITH new_id AS (SELECT uuid_generate_v4() AS id)
+			INSERT INTO medical_records (id, record_group_id, patient_id, doctor_name, diagnosis, notes, attachment_cid, author_id, doctor_id, encounter_id) 
+			SELECT id, id, $1, $2, $3, $4, $5, NULLIF($6, '')::uuid, NULLIF($7, '')::uuid, NULLIF($8, '')::uuid FROM new_id
+			RETURNING id`
+	var recordID string
+	err = tx.QueryRow(ctx, query, record.PatientID, record.DoctorName, record.Diagnosis, record.Notes, record.AttachmentCID, record.AuthorID, record.DoctorID, record.EncounterID).Scan(&recordID)
+	if err != nil {
+		return "", err
+	}
+	if err := insertClinicalContent(ctx, tx, recordID, &record.ClinicalContent); err != nil {
+		return "", err
+	}
+	if err := insertAttachments(ctx, tx, recordID, record.Attachments); err != nil {
+		return "", err
+	}
+	if err := insertSearchTerms(ctx, tx, recordID, record.SearchIndex); err != nil {
+		return "", err
+	}
+
+	return recordID, tx.Commit(ctx)
+}
+
+// AmendRecord stores record as the next version after previousID and marks
+// previousID as superseded. The previous version's content is left untouched.
+func (r *postgresRecordRepository) AmendRecord(ctx context.Context, previousID string, record *domain.MedicalRecord) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	// Kunci baris versi terakhir agar dua amandemen bersamaan tidak membuat cabang.
+	var groupID string
+	var version int
+	lock := `SELECT record_group_id, version FROM medical_records WHERE id = $1 AND superseded_at IS NULL FOR UPDATE`
+	if err := tx.QueryRow(ctx, lock, previousID).Scan(&groupID, &version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrRecordSuperseded
+		}
+		return "", err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE medical_records SET superseded_at = NOW() WHERE id = $1`, previousID); err != nil {
+		return "", err
+	}
+
+	insert := `INSERT INTO medical_records (record_group_id, version, previous_version_id, patient_id, doctor_name, diagnosis, notes, attachment_cid, amendment_reason, author_id, doctor_id, encounter_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, '')::uuid, NULLIF($11, '')::uuid, NULLIF($12, '')::uuid)
+			RETURNING id`
 	var recordID string
-	err := r.db.QueryRow(ctx, query, record.PatientID, record.DoctorName, record.Diagnosis, record.Notes, record.AttachmentCID).Scan(&recordID)
-	return recordID, err
+	err = tx.QueryRow(ctx, insert, groupID, version+1, previousID, record.PatientID, record.DoctorName, record.Diagnosis, record.Notes,
+		record.AttachmentCID, record.AmendmentReason, record.AuthorID, record.DoctorID, record.EncounterID).Scan(&recordID)
+	if err != nil {
+		return "", err
+	}
+	if err := insertClinicalContent(ctx, tx, recordID, &record.ClinicalContent); err != nil {
+		return "", err
+	}
+	if err := insertAttachments(ctx, tx, recordID, record.Attachments); err != nil {
+		return "", err
+	}
+	if err := insertSearchTerms(ctx, tx, recordID, record.SearchIndex); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	record.RecordGroupID = groupID
+	record.Version = version + 1
+	record.PreviousVersionID = previousID
+	return recordID, nil
+}
+
+// SetRecordAnchor stores the hash of a version and the blockchain transaction that anchored it.
+func (r *postgresRecordRepository) SetRecordAnchor(ctx context.Context, recordID, dataHash, txHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE medical_records SET data_hash = $2, tx_hash = $3 WHERE id = $1`, recordID, dataHash, txHash)
+	return err
+}
+
+// GetRecordByID retrieves a single version of a medical record.
+func (r *postgresRecordRepository) GetRecordByID(ctx context.Context, recordID string) (*domain.MedicalRecord, error) {
+	records, err := r.queryRecords(ctx, `SELECT `+recordColumns+` FROM medical_records WHERE id = $1`, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return &records[0], nil
+}
+
+// ListPatientRecords retrieves one page of the latest versions of a patient's
+// records, plus the number of records matching the filter. Up to filter.Limit+1
+// rows are returned so the caller can tell whether another page follows.
+func (r *postgresRecordRepository) ListPatientRecords(ctx context.Context, patientID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error) {
+	return r.listRecords(ctx, "patient_id", patientID, filter)
+}
+
+// ListDoctorRecords retrieves one page of the latest versions of the records a
+// doctor authored, across patients, like ListPatientRecords.
+func (r *postgresRecordRepository) ListDoctorRecords(ctx context.Context, doctorID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error) {
+	return r.listRecords(ctx, "doctor_id", doctorID, filter)
+}
+
+// listRecords pages through current record versions whose ownerColumn equals ownerID.
+func (r *postgresRecordRepository) listRecords(ctx context.Context, ownerColumn, ownerID string, filter domain.RecordFilter) ([]domain.MedicalRecord, int, error) {
+	conditions := []string{ownerColumn + " = $1", "superseded_at IS NULL"}
+	args := []any{ownerID}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.From != nil {
+		where("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where("created_at < $%d", *filter.To)
+	}
+	if filter.DoctorID != "" {
+		// Penulis rekam medis adalah penulis versi pertamanya.
+		where("(SELECT g.doctor_id FROM medical_records g WHERE g.id = medical_records.record_group_id)::text = $%d", filter.DoctorID)
+	}
+	if filter.EncounterID != "" {
+		where("encounter_id::text = $%d", filter.EncounterID)
+	}
+	if filter.DiagnosisCodeIndex != "" {
+		where("EXISTS (SELECT 1 FROM record_diagnoses d WHERE d.record_id = medical_records.id AND d.code_index = $%d)", filter.DiagnosisCodeIndex)
+	}
+	scopeConditions(filter.Scope, where)
+	if filter.HasAttachment != nil {
+		where(`(COALESCE(attachment_cid, '') <> ''
+			OR EXISTS (SELECT 1 FROM record_attachments a WHERE a.record_id = medical_records.id)) = $%d`, *filter.HasAttachment)
+	}
+	if len(filter.TermIndexes) > 0 {
+		// Setiap kata pencarian harus ada pada rekam medis (AND).
+		where(`id IN (SELECT record_id FROM record_search_terms WHERE term_index = ANY($%[1]d)
+				GROUP BY record_id HAVING COUNT(*) = cardinality($%[1]d::text[]))`, filter.TermIndexes)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM medical_records WHERE ` + strings.Join(conditions, " AND ")
+	if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, comparison := "DESC", "<"
+	if filter.Sort == domain.RecordSortOldest {
+		order, comparison = "ASC", ">"
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d, $%d::uuid)", comparison, len(args)-1, len(args)))
+	}
+	args = append(args, filter.Limit+1)
+
+	query := `SELECT ` + recordColumns + `
+			FROM medical_records WHERE ` + strings.Join(conditions, " AND ") + `
+			ORDER BY created_at ` + order + `, id ` + order + `
+			LIMIT $` + strconv.Itoa(len(args))
+	records, err := r.queryRecords(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// GetRecordHistory retrieves every version of the record that recordID belongs to, newest first.
+func (r *postgresRecordRepository) GetRecordHistory(ctx context.Context, recordID string) ([]domain.MedicalRecord, error) {
+	query := `SELECT ` + recordColumns + `
+			FROM medical_records
+			WHERE record_group_id = (SELECT record_group_id FROM medical_records WHERE id = $1)
+			ORDER BY version DESC`
+	return r.queryRecords(ctx, query, recordID)
+}
+
+// ListEncounterRecords retrieves the latest versions of the records written in
+// the given encounters, oldest first, limited to scope when it is not nil.
+func (r *postgresRecordRepository) ListEncounterRecords(ctx context.Context, encounterIDs []string, scope *domain.ConsentScope) ([]domain.MedicalRecord, error) {
+	conditions := []string{"encounter_id = ANY($1::uuid[])", "superseded_at IS NULL"}
+	args := []any{encounterIDs}
+	scopeConditions(scope, func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	})
+
+	query := `SELECT ` + recordColumns + `
+			FROM medical_records WHERE ` + strings.Join(conditions, " AND ") + `
+			ORDER BY created_at, id`
+	return r.queryRecords(ctx, query, args...)
+}
+
+// scopeConditions adds the SQL conditions that limit current record versions
+// to a consent scope. Its date range refers to when the first version was written.
+func scopeConditions(scope *domain.ConsentScope, where func(condition string, arg any)) {
+	if scope == nil {
+		return
+	}
+	firstWritten := "(SELECT g.created_at FROM medical_records g WHERE g.id = medical_records.record_group_id)"
+	if scope.From != nil {
+		where(firstWritten+" >= $%d", *scope.From)
+	}
+	if scope.To != nil {
+		where(firstWritten+" <= $%d", *scope.To)
+	}
+	if len(scope.RecordIDs) > 0 {
+		where("record_group_id IN (SELECT g.record_group_id FROM medical_records g WHERE g.id = ANY($%d::uuid[]))", scope.RecordIDs)
+	}
 }
 
-// GetRecordsByPatientID retrieves all medical records for a given patient.
-func (r *postgresRecordRepository) GetRecordsByPatientID(ctx context.Context, patientID string) ([]domain.MedicalRecord, error) {
-	query := `SELECT id, patient_id, doctor_name, diagnosis, notes, attachment_cid, created_at 
-			FROM medical_records WHERE patient_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(ctx, query, patientID)
+// ListRecordsForIndexing retrieves up to limit records with an ID after
+// afterID, in ID order. Unless all is set, only records that have not been
+// indexed yet are returned.
+func (r *postgresRecordRepository) ListRecordsForIndexing(ctx context.Context, afterID string, limit int, all bool) ([]domain.MedicalRecord, error) {
+	query := `SELECT ` + recordColumns + `
+			FROM medical_records
+			WHERE id > $1::uuid AND ($2 OR search_indexed_at IS NULL)
+			ORDER BY id
+			LIMIT $3`
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	return r.queryRecords(ctx, query, afterID, all, limit)
+}
+
+// UpdateSearchIndex replaces the search terms of a record and the code
+// indexes of its diagnoses, and marks the record as indexed.
+func (r *postgresRecordRepository) UpdateSearchIndex(ctx context.Context, record *domain.MedicalRecord) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM record_search_terms WHERE record_id = $1`, record.ID); err != nil {
+		return err
+	}
+	if err := insertSearchTerms(ctx, tx, record.ID, record.SearchIndex); err != nil {
+		return err
+	}
+	for _, d := range record.Diagnoses {
+		if _, err := tx.Exec(ctx, `UPDATE record_diagnoses SET code_index = NULLIF($2, '') WHERE id = $1`, d.ID, d.CodeIndex); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ClearSearchIndexed marks a record as not indexed, so that the next
+// reindex run without -all picks it up again.
+func (r *postgresRecordRepository) ClearSearchIndexed(ctx context.Context, recordID string) error {
+	_, err := r.db.Exec(ctx, `UPDATE medical_records SET search_indexed_at = NULL WHERE id = $1 AND search_indexed_at IS NOT NULL`, recordID)
+	return err
+}
+
+// insertSearchTerms stores the blind indexes of a record's search terms and marks it as indexed.
+func insertSearchTerms(ctx context.Context, tx pgx.Tx, recordID string, termIndexes []string) error {
+	query := `INSERT INTO record_search_terms (record_id, term_index) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(ctx, query, recordID, termIndexes); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `UPDATE medical_records SET search_indexed_at = NOW() WHERE id = $1`, recordID)
+	return err
+}
+
+func (r *postgresRecordRepository) queryRecords(ctx context.Context, query string, args ...any) ([]domain.MedicalRecord, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,19 +333,84 @@ func (r *postgresRecordRepository) GetRecordsByPatientID(ctx context.Context, pa
 
 	records := make([]domain.MedicalRecord, 0)
 	for rows.Next() {
-		var record domain.MedicalRecord
-		var attachmentCID sql.NullString
-		if err := rows.Scan(&record.ID, &record.PatientID, &record.DoctorName, &record.Diagnosis, &record.Notes, &attachmentCID, &record.CreatedAt); err != nil {
+		record, err := scanRecord(rows)
+		if err != nil {
 			return nil, err
 		}
-		if attachmentCID.Valid {
-			record.AttachmentCID = attachmentCID.String
-		}
-		records = append(records, record)
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Isi klinis terstruktur, lampiran dan profil dokter dimuat terpisah.
+	if err := loadClinicalContent(ctx, r.db, records); err != nil {
+		return nil, err
+	}
+	if err := loadAttachments(ctx, r.db, records); err != nil {
+		return nil, err
+	}
+	if err := r.loadDoctorProfiles(ctx, records); err != nil {
+		return nil, err
 	}
 	return records, nil
 }
 
+// loadDoctorProfiles attaches the current profile of each record's doctor.
+func (r *postgresRecordRepository) loadDoctorProfiles(ctx context.Context, records []domain.MedicalRecord) error {
+	doctorIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.DoctorID != "" {
+			doctorIDs = append(doctorIDs, record.DoctorID)
+		}
+	}
+	if len(doctorIDs) == 0 {
+		return nil
+	}
+
+	query := `SELECT u.id, u.name, COALESCE(u.specialization, ''), COALESCE(u.facility_id::text, ''), COALESCE(f.name, '')
+			FROM users u
+			LEFT JOIN facilities f ON f.id = u.facility_id
+			WHERE u.id = ANY($1)`
+	rows, err := r.db.Query(ctx, query, doctorIDs)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]*domain.DoctorProfile)
+	for rows.Next() {
+		var profile domain.DoctorProfile
+		if err := rows.Scan(&profile.ID, &profile.Name, &profile.Specialization, &profile.FacilityID, &profile.FacilityName); err != nil {
+			return err
+		}
+		profiles[profile.ID] = &profile
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range records {
+		records[i].Doctor = profiles[records[i].DoctorID]
+	}
+	return nil
+}
+
+// scanRecord scans a row selected with recordColumns.
+func scanRecord(row pgx.Row) (*domain.MedicalRecord, error) {
+	var record domain.MedicalRecord
+	var attachmentCID, previousVersionID sql.NullString
+	if err := row.Scan(&record.ID, &record.PatientID, &record.DoctorName, &record.Diagnosis, &record.Notes, &attachmentCID, &record.CreatedAt,
+		&record.RecordGroupID, &record.Version, &previousVersionID, &record.SupersededAt, &record.AmendmentReason,
+		&record.AuthorID, &record.DataHash, &record.TxHash, &record.DoctorID, &record.EncounterID); err != nil {
+		return nil, err
+	}
+	record.AttachmentCID = attachmentCID.String
+	record.PreviousVersionID = previousVersionID.String
+	return &record, nil
+}
+
 // CreateLedgerBlock inserts a new block into the blockchain_ledger table.
 func (r *postgresRecordRepository) CreateLedgerBlock(ctx context.Context, block *domain.LedgerBlock) error {
 	query := `INSERT INTO blockchain_ledger (record_id, data_hash, previous_hash) VALUES ($1, $2, $3)`
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// RoleRepository defines the interface for reading roles and their permissions.
+type RoleRepository interface {
+	GetRole(ctx context.Context, name string) (*domain.Role, error)
+	ListRoles(ctx context.Context) ([]domain.Role, error)
+}
+
+type postgresRoleRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresRoleRepository creates a new instance of RoleRepository.
+func NewPostgresRoleRepository(db *pgxpool.Pool) RoleRepository {
+	return &postgresRoleRepository{db: db}
+}
+
+// GetRole retrieves a role together with the permissions granted to it.
+func (r *postgresRoleRepository) GetRole(ctx context.Context, name string) (*domain.Role, error) {
+	sql := `SELECT r.name, r.description, r.clinical_staff,
+				COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+			FROM roles r
+			LEFT JOIN role_permissions rp ON rp.role = r.name
+			WHERE r.name = $1
+			GROUP BY r.name`
+	var role domain.Role
+	err := r.db.QueryRow(ctx, sql, name).Scan(&role.Name, &role.Description, &role.ClinicalStaff, &role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoles retrieves every role with its permissions.
+func (r *postgresRoleRepository) ListRoles(ctx context.Context) ([]domain.Role, error) {
+	sql := `SELECT r.name, r.description, r.clinical_staff,
+				COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+			FROM roles r
+			LEFT JOIN role_permissions rp ON rp.role = r.name
+			GROUP BY r.name
+			ORDER BY r.name`
+	rows, err := r.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]domain.Role, 0)
+	for rows.Next() {
+		var role domain.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.ClinicalStaff, &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
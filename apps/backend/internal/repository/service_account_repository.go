@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// ErrFacilityNotFound is returned when a service account names a facility that does not exist.
+var ErrFacilityNotFound = errors.New("facility not found")
+
+// ServiceAccountRepository defines the interface for service accounts and their API keys.
+type ServiceAccountRepository interface {
+	CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) (string, error)
+	ListServiceAccounts(ctx context.Context) ([]domain.ServiceAccount, error)
+	CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash, createdBy string) (string, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID string) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountID, keyID string) (int64, error)
+	GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	RegisterAPIKeyUse(ctx context.Context, keyID string) (count int, windowStart, now time.Time, err error)
+}
+
+type postgresServiceAccountRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresServiceAccountRepository creates a new instance of ServiceAccountRepository.
+func NewPostgresServiceAccountRepository(db *pgxpool.Pool) ServiceAccountRepository {
+	return &postgresServiceAccountRepository{db: db}
+}
+
+// CreateServiceAccount inserts a new service account owned by a facility.
+func (r *postgresServiceAccountRepository) CreateServiceAccount(ctx context.Context, account domain.ServiceAccount) (string, error) {
+	sql := `INSERT INTO service_accounts (facility_id, name, description, created_by)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+			RETURNING id`
+	var id string
+	err := r.db.QueryRow(ctx, sql, account.FacilityID, account.Name, account.Description, account.CreatedBy).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == "fk_service_account_facility" {
+		return "", ErrFacilityNotFound
+	}
+	return id, err
+}
+
+// ListServiceAccounts retrieves every service account, newest first.
+func (r *postgresServiceAccountRepository) ListServiceAccounts(ctx context.Context) ([]domain.ServiceAccount, error) {
+	sql := `SELECT id, facility_id, name, COALESCE(description, ''), created_by, created_at
+			FROM service_accounts
+			ORDER BY created_at DESC`
+	rows, err := r.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]domain.ServiceAccount, 0)
+	for rows.Next() {
+		var a domain.ServiceAccount
+		if err := rows.Scan(&a.ID, &a.FacilityID, &a.Name, &a.Description, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// CreateAPIKey stores the hash of a new API key for a service account.
+func (r *postgresServiceAccountRepository) CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash, createdBy string) (string, error) {
+	sql := `INSERT INTO api_keys (service_account_id, key_prefix, key_hash, scopes, rate_limit_per_minute, expires_at, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`
+	var id string
+	err := r.db.QueryRow(ctx, sql, key.ServiceAccountID, key.Prefix, keyHash, key.Scopes, key.RateLimitPerMinute, key.ExpiresAt, createdBy).Scan(&id)
+	return id, err
+}
+
+// ListAPIKeys retrieves the keys of a service account, including revoked and expired ones.
+func (r *postgresServiceAccountRepository) ListAPIKeys(ctx context.Context, serviceAccountID string) ([]domain.APIKey, error) {
+	sql := `SELECT id, service_account_id, key_prefix, scopes, rate_limit_per_minute, expires_at, last_used_at, revoked_at, created_at
+			FROM api_keys
+			WHERE service_account_id = $1
+			ORDER BY created_at DESC`
+	rows, err := r.db.Query(ctx, sql, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]domain.APIKey, 0)
+	for rows.Next() {
+		var k domain.APIKey
+		if err := rows.Scan(&k.ID, &k.ServiceAccountID, &k.Prefix, &k.Scopes, &k.RateLimitPerMinute, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes a key immediately.
+func (r *postgresServiceAccountRepository) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID string) (int64, error) {
+	sql := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL`
+	res, err := r.db.Exec(ctx, sql, keyID, serviceAccountID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// GetActiveAPIKeyByHash retrieves a key that is neither revoked nor expired.
+func (r *postgresServiceAccountRepository) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	sql := `SELECT k.id, k.service_account_id, sa.name, sa.facility_id, k.key_prefix, k.scopes, k.rate_limit_per_minute, k.expires_at, k.last_used_at, k.created_at
+			FROM api_keys k
+			JOIN service_accounts sa ON k.service_account_id = sa.id
+			WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND k.expires_at > NOW()`
+	var k domain.APIKey
+	err := r.db.QueryRow(ctx, sql, keyHash).Scan(&k.ID, &k.ServiceAccountID, &k.ServiceAccountName, &k.FacilityID, &k.Prefix, &k.Scopes, &k.RateLimitPerMinute, &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// RegisterAPIKeyUse counts a request against the key's current one-minute
+// window and returns the count so far, along with when the window started and
+// the database's current time, so callers can tell how long the window has
+// left without relying on their own clock. Windows older than an hour are
+// pruned.
+func (r *postgresServiceAccountRepository) RegisterAPIKeyUse(ctx context.Context, keyID string) (count int, windowStart, now time.Time, err error) {
+	sql := `WITH pruned AS (
+				DELETE FROM api_key_usage WHERE api_key_id = $1 AND window_start < NOW() - INTERVAL '1 hour'
+			), touched AS (
+				UPDATE api_keys SET last_used_at = NOW() WHERE id = $1
+			)
+			INSERT INTO api_key_usage (api_key_id, window_start, request_count)
+			VALUES ($1, date_trunc('minute', NOW()), 1)
+			ON CONFLICT (api_key_id, window_start) DO UPDATE SET request_count = api_key_usage.request_count + 1
+			RETURNING request_count, window_start, NOW()`
+	err = r.db.QueryRow(ctx, sql, keyID).Scan(&count, &windowStart, &now)
+	return count, windowStart, now, err
+}
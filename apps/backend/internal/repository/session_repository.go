@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// SessionRepository defines the interface for login session operations.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *domain.Session, refreshTokenHash string) (string, error)
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*domain.Session, error)
+	TouchSession(ctx context.Context, sessionID, userID string) (bool, error)
+	MarkMFAVerified(ctx context.Context, sessionID, userID string) error
+	GetSessionsByUserID(ctx context.Context, userID string) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, sessionID, userID string) (int64, error)
+	RevokeAllSessions(ctx context.Context, userID string) (int64, error)
+}
+
+type postgresSessionRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresSessionRepository creates a new instance of SessionRepository.
+func NewPostgresSessionRepository(db *pgxpool.Pool) SessionRepository {
+	return &postgresSessionRepository{db: db}
+}
+
+// CreateSession inserts a new session holding the hash of its refresh token.
+func (r *postgresSessionRepository) CreateSession(ctx context.Context, session *domain.Session, refreshTokenHash string) (string, error) {
+	sql := `INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at, mfa_verified)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	var sessionID string
+	err := r.db.QueryRow(ctx, sql, session.UserID, refreshTokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt, session.MFAVerified).Scan(&sessionID)
+	return sessionID, err
+}
+
+// RotateRefreshToken replaces the refresh token of an active session.
+// The old token stops working immediately, so a replayed token is rejected.
+func (r *postgresSessionRepository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*domain.Session, error) {
+	sql := `UPDATE sessions
+			SET refresh_token_hash = $2, expires_at = $3, last_seen_at = NOW()
+			WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), mfa_verified, created_at, last_seen_at, expires_at`
+	var session domain.Session
+	err := r.db.QueryRow(ctx, sql, oldHash, newHash, expiresAt).Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.MFAVerified,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession updates last_seen_at and reports whether the session is still active.
+func (r *postgresSessionRepository) TouchSession(ctx context.Context, sessionID, userID string) (bool, error) {
+	sql := `UPDATE sessions SET last_seen_at = NOW()
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()`
+	res, err := r.db.Exec(ctx, sql, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// MarkMFAVerified records that the session has completed a second factor.
+func (r *postgresSessionRepository) MarkMFAVerified(ctx context.Context, sessionID, userID string) error {
+	sql := `UPDATE sessions SET mfa_verified = TRUE WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(ctx, sql, sessionID, userID)
+	return err
+}
+
+// GetSessionsByUserID retrieves all active sessions for a user, most recently used first.
+func (r *postgresSessionRepository) GetSessionsByUserID(ctx context.Context, userID string) ([]domain.Session, error) {
+	sql := `SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), mfa_verified, created_at, last_seen_at, expires_at
+			FROM sessions
+			WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			ORDER BY last_seen_at DESC`
+	rows, err := r.db.Query(ctx, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]domain.Session, 0)
+	for rows.Next() {
+		var session domain.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.MFAVerified,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes a single session owned by the user.
+func (r *postgresSessionRepository) RevokeSession(ctx context.Context, sessionID, userID string) (int64, error) {
+	sql := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.db.Exec(ctx, sql, sessionID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// RevokeAllSessions revokes every active session of the user ("log out all devices").
+func (r *postgresSessionRepository) RevokeAllSessions(ctx context.Context, userID string) (int64, error) {
+	sql := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	res, err := r.db.Exec(ctx, sql, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
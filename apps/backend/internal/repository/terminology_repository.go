@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// TerminologyRepository defines the interface for the clinical code catalogs.
+type TerminologyRepository interface {
+	SyncICD10(ctx context.Context, codes []domain.ICD10Code) (int64, error)
+	SearchICD10(ctx context.Context, codePrefix, textQuery string, limit int) ([]domain.ICD10Code, error)
+	GetICD10Codes(ctx context.Context, codes []string) (map[string]domain.ICD10Code, error)
+}
+
+type postgresTerminologyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresTerminologyRepository creates a new instance of TerminologyRepository.
+func NewPostgresTerminologyRepository(db *pgxpool.Pool) TerminologyRepository {
+	return &postgresTerminologyRepository{db: db}
+}
+
+// SyncICD10 upserts the catalog and returns how many codes were added or
+// changed. Codes missing from the list are kept, since records may use them.
+func (r *postgresTerminologyRepository) SyncICD10(ctx context.Context, codes []domain.ICD10Code) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO icd10_codes (code, name_en, name_id) VALUES ($1, $2, $3)
+			ON CONFLICT (code) DO UPDATE SET name_en = EXCLUDED.name_en, name_id = EXCLUDED.name_id, updated_at = NOW()
+			WHERE icd10_codes.name_en <> EXCLUDED.name_en OR icd10_codes.name_id <> EXCLUDED.name_id`
+	batch := &pgx.Batch{}
+	for _, code := range codes {
+		batch.Queue(query, code.Code, code.NameEN, code.NameID)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	var changed int64
+	for range codes {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return 0, err
+		}
+		changed += tag.RowsAffected()
+	}
+	if err := results.Close(); err != nil {
+		return 0, err
+	}
+	return changed, tx.Commit(ctx)
+}
+
+// SearchICD10 finds codes starting with codePrefix or whose names match
+// textQuery (a to_tsquery expression). Code matches are listed first.
+func (r *postgresTerminologyRepository) SearchICD10(ctx context.Context, codePrefix, textQuery string, limit int) ([]domain.ICD10Code, error) {
+	query := `SELECT code, name_en, name_id FROM icd10_codes
+			WHERE ($1 <> '' AND code LIKE $1 || '%')
+			   OR ($2 <> '' AND search_vector @@ to_tsquery('simple', $2))
+			ORDER BY ($1 <> '' AND code LIKE $1 || '%') DESC,
+			         CASE WHEN $2 <> '' THEN ts_rank(search_vector, to_tsquery('simple', $2)) ELSE 0 END DESC,
+			         code
+			LIMIT $3`
+	rows, err := r.db.Query(ctx, query, codePrefix, textQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := make([]domain.ICD10Code, 0)
+	for rows.Next() {
+		var code domain.ICD10Code
+		if err := rows.Scan(&code.Code, &code.NameEN, &code.NameID); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// GetICD10Codes returns the catalog entries of the given codes, keyed by code.
+// Codes that are not in the catalog are absent from the map.
+func (r *postgresTerminologyRepository) GetICD10Codes(ctx context.Context, codes []string) (map[string]domain.ICD10Code, error) {
+	found := make(map[string]domain.ICD10Code, len(codes))
+	if len(codes) == 0 {
+		return found, nil
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT code, name_en, name_id FROM icd10_codes WHERE code = ANY($1)`, codes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code domain.ICD10Code
+		if err := rows.Scan(&code.Code, &code.NameEN, &code.NameID); err != nil {
+			return nil, err
+		}
+		found[code.Code] = code
+	}
+	return found, rows.Err()
+}
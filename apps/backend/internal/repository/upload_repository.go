@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// UploadRepository defines the interface for the metadata of uploaded files.
+type UploadRepository interface {
+	SaveUpload(ctx context.Context, file *domain.UploadedFile) error
+	GetUploads(ctx context.Context, uploaderID string, cids []string) (map[string]domain.UploadedFile, error)
+}
+
+type postgresUploadRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresUploadRepository creates a new instance of UploadRepository.
+func NewPostgresUploadRepository(db *pgxpool.Pool) UploadRepository {
+	return &postgresUploadRepository{db: db}
+}
+
+// SaveUpload records a file uploaded by file.UploadedBy and fills in its
+// upload time. Uploading the same file again keeps the first upload time.
+func (r *postgresUploadRepository) SaveUpload(ctx context.Context, file *domain.UploadedFile) error {
+	sql := `INSERT INTO uploaded_files (cid, uploaded_by, mime_type, size_bytes, sha256)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (cid, uploaded_by) DO UPDATE SET mime_type = EXCLUDED.mime_type
+			RETURNING uploaded_at`
+	return r.db.QueryRow(ctx, sql, file.CID, file.UploadedBy, file.MIMEType, file.Size, file.SHA256).Scan(&file.UploadedAt)
+}
+
+// GetUploads returns the files with the given CIDs that uploaderID uploaded, keyed by CID.
+func (r *postgresUploadRepository) GetUploads(ctx context.Context, uploaderID string, cids []string) (map[string]domain.UploadedFile, error) {
+	sql := `SELECT cid, uploaded_by::text, mime_type, size_bytes, sha256, uploaded_at
+			FROM uploaded_files WHERE uploaded_by = $1 AND cid = ANY($2)`
+	rows, err := r.db.Query(ctx, sql, uploaderID, cids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make(map[string]domain.UploadedFile, len(cids))
+	for rows.Next() {
+		var f domain.UploadedFile
+		if err := rows.Scan(&f.CID, &f.UploadedBy, &f.MIMEType, &f.Size, &f.SHA256, &f.UploadedAt); err != nil {
+			return nil, err
+		}
+		uploads[f.CID] = f
+	}
+	return uploads, rows.Err()
+}
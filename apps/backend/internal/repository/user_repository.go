@@ -14,6 +14,11 @@ type UserRepository interface {
 	GetDoctorByEmail(ctx context.Context, email string) (*domain.User, error)
 	GetUserByID(ctx context.Context, id string) (*domain.User, error)
 	SearchUsers(ctx context.Context, query string, doctorID string) ([]domain.PublicUser, error)
+	SearchPatientsForServiceAccount(ctx context.Context, query, serviceAccountID string) ([]domain.PublicUser, error)
+	MarkEmailVerified(ctx context.Context, userID string) error
+	UpdatePassword(ctx context.Context, userID, hashedPassword string) error
+	GetStaffByVerificationStatus(ctx context.Context, status string) ([]domain.User, error)
+	SetStaffVerification(ctx context.Context, staffID, status, note, adminID, facilityID string) (int64, error)
 }
 
 // postgrestUserRepository is the PostgreSQL implementation of UserRepository.
@@ -29,19 +34,27 @@ func NewPostgresUserRepository(db *pgxpool.Pool) UserRepository {
 // CreateUser inserts a new user into the database.
 func (r *postgresUserRepository) CreateUser(ctx context.Context, user *domain.User) (string, error) {
 	// PERBARUI SQL QUERY DI SINI
-	sql := `INSERT INTO users (name, email, hashed_password, role, public_key, nip, phone, specialization) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	// Kunci publik awal juga dicatat di riwayat user_keys.
+	sql := `WITH new_user AS (
+				INSERT INTO users (name, email, hashed_password, role, public_key, nip, phone, specialization, facility_id, str_number, sip_number, verification_status, requested_facility_id) 
+				VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, NULLIF($9, '')::uuid, NULLIF($10, ''), NULLIF($11, ''), $12, NULLIF($13, '')::uuid) RETURNING id, public_key, created_at
+			), initial_key AS (
+				INSERT INTO user_keys (user_id, public_key, valid_from)
+				SELECT id, public_key, created_at FROM new_user WHERE public_key IS NOT NULL
+			)
+			SELECT id FROM new_user`
 	var userID string
 	// PERBARUI PARAMETER QUERY DI SINI
-	err := r.db.QueryRow(ctx, sql, user.Name, user.Email, user.HashedPassword, user.Role, user.PublicKey, user.NIP, user.Phone, user.Specialization).Scan(&userID)
+	err := r.db.QueryRow(ctx, sql, user.Name, user.Email, user.HashedPassword, user.Role, user.PublicKey, user.NIP, user.Phone, user.Specialization, user.FacilityID,
+		user.STRNumber, user.SIPNumber, user.VerificationStatus, user.RequestedFacilityID).Scan(&userID)
 	return userID, err
 }
 
 // GetUserByEmail retrieves a user by their email address.
 func (r *postgresUserRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	sql := `SELECT id, name, email, role, hashed_password FROM users WHERE email = $1`
-	err := r.db.QueryRow(ctx, sql, email).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.HashedPassword)
+	sql := `SELECT id, name, email, role, hashed_password, email_verified_at IS NOT NULL, verification_status FROM users WHERE email = $1`
+	err := r.db.QueryRow(ctx, sql, email).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.HashedPassword, &user.EmailVerified, &user.VerificationStatus)
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +63,8 @@ func (r *postgresUserRepository) GetUserByEmail(ctx context.Context, email strin
 
 func (r *postgresUserRepository) GetDoctorByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	sql := `SELECT id, name, email, role, specialization, hashed_password FROM users WHERE email = $1`
-	err := r.db.QueryRow(ctx, sql, email).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Specialization, &user.HashedPassword)
+	sql := `SELECT id, name, email, role, COALESCE(specialization, ''), hashed_password, email_verified_at IS NOT NULL, verification_status FROM users WHERE email = $1`
+	err := r.db.QueryRow(ctx, sql, email).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Specialization, &user.HashedPassword, &user.EmailVerified, &user.VerificationStatus)
 	if err != nil {
 		return nil, err
 	}
@@ -96,15 +109,103 @@ func (r *postgresUserRepository) SearchUsers(ctx context.Context, query string,
 	return users, nil
 }
 
+// SearchPatientsForServiceAccount searches only the patients who extended a
+// consent to the systems of the service account's facility.
+func (r *postgresUserRepository) SearchPatientsForServiceAccount(ctx context.Context, query, serviceAccountID string) ([]domain.PublicUser, error) {
+	sql := `
+		SELECT u.id, u.name, u.email, 'granted'
+		FROM users u
+		WHERE u.role = 'patient' AND (u.name ILIKE $1 OR u.email ILIKE $1)
+		  AND EXISTS (
+			SELECT 1 FROM consent_requests cr
+			WHERE cr.patient_id = u.id
+			  AND ` + facilitySystemsGrant + `)
+		LIMIT 10;
+	`
+	rows, err := r.db.Query(ctx, sql, "%"+query+"%", serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]domain.PublicUser, 0)
+	for rows.Next() {
+		var user domain.PublicUser
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.ConsentStatus); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 // GetUserByID retrieves a user by their ID.
 func (r *postgresUserRepository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
 	var user domain.User
 	// Perbarui query untuk mengambil kolom baru
-	sql := `SELECT id, name, email, role, nip, phone, specialization FROM users WHERE id = $1`
+	sql := `SELECT id, name, email, role, COALESCE(nip, ''), COALESCE(phone, ''), COALESCE(specialization, ''), COALESCE(public_key, ''), COALESCE(facility_id::text, ''), email_verified_at IS NOT NULL,
+				COALESCE(str_number, ''), COALESCE(sip_number, ''), verification_status, COALESCE(verification_note, ''), verified_at, COALESCE(requested_facility_id::text, '')
+			FROM users WHERE id = $1`
 	// Perbarui Scan untuk membaca kolom baru
-	err := r.db.QueryRow(ctx, sql, id).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.NIP, &user.Phone, &user.Specialization)
+	err := r.db.QueryRow(ctx, sql, id).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.NIP, &user.Phone, &user.Specialization, &user.PublicKey, &user.FacilityID, &user.EmailVerified,
+		&user.STRNumber, &user.SIPNumber, &user.VerificationStatus, &user.VerificationNote, &user.VerifiedAt, &user.RequestedFacilityID)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+// MarkEmailVerified records that the user proved ownership of their email address.
+func (r *postgresUserRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	sql := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(ctx, sql, userID)
+	return err
+}
+
+// UpdatePassword replaces the user's password hash.
+func (r *postgresUserRepository) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	sql := `UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(ctx, sql, userID, hashedPassword)
+	return err
+}
+
+// GetStaffByVerificationStatus lists clinical staff in the given review state, oldest registration first.
+func (r *postgresUserRepository) GetStaffByVerificationStatus(ctx context.Context, status string) ([]domain.User, error) {
+	sql := `SELECT id, name, email, role, COALESCE(nip, ''), COALESCE(str_number, ''), COALESCE(sip_number, ''), COALESCE(phone, ''), COALESCE(specialization, ''),
+				COALESCE(facility_id::text, ''), COALESCE(requested_facility_id::text, ''), email_verified_at IS NOT NULL, verification_status, COALESCE(verification_note, ''), verified_at, created_at, updated_at
+			FROM users
+			WHERE role IN (SELECT name FROM roles WHERE clinical_staff) AND verification_status = $1
+			ORDER BY created_at ASC`
+	rows, err := r.db.Query(ctx, sql, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := make([]domain.User, 0)
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.NIP, &user.STRNumber, &user.SIPNumber, &user.Phone, &user.Specialization,
+			&user.FacilityID, &user.RequestedFacilityID, &user.EmailVerified, &user.VerificationStatus, &user.VerificationNote, &user.VerifiedAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, err
+		}
+		staff = append(staff, user)
+	}
+	return staff, rows.Err()
+}
+
+// SetStaffVerification records an admin's decision on a staff member's
+// credentials. Approval also makes the staff member a member of facilityID,
+// or of the facility they requested when facilityID is empty.
+func (r *postgresUserRepository) SetStaffVerification(ctx context.Context, staffID, status, note, adminID, facilityID string) (int64, error) {
+	sql := `UPDATE users
+			SET verification_status = $2, verification_note = NULLIF($3, ''), verified_by = $4, verified_at = NOW(), updated_at = NOW(),
+				facility_id = CASE WHEN $2 = 'approved' THEN COALESCE(NULLIF($5, '')::uuid, requested_facility_id, facility_id) ELSE facility_id END,
+				requested_facility_id = CASE WHEN $2 = 'approved' THEN NULL ELSE requested_facility_id END
+			WHERE id = $1 AND role IN (SELECT name FROM roles WHERE clinical_staff)`
+	res, err := r.db.Exec(ctx, sql, staffID, status, note, adminID, facilityID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
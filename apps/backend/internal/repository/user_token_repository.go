@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Purposes of one-time user tokens.
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeKeyRecovery       = "key_recovery"
+	TokenPurposeKeyRotation       = "key_rotation"
+)
+
+// UserTokenRepository defines the interface for one-time, expiring user tokens
+// (email verification, password reset, key recovery). Only token hashes are stored.
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error
+	ConsumeToken(ctx context.Context, purpose, tokenHash string) (string, error)
+}
+
+type postgresUserTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresUserTokenRepository creates a new instance of UserTokenRepository.
+func NewPostgresUserTokenRepository(db *pgxpool.Pool) UserTokenRepository {
+	return &postgresUserTokenRepository{db: db}
+}
+
+// CreateToken stores a new token and invalidates earlier unused tokens with the same purpose.
+func (r *postgresUserTokenRepository) CreateToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	invalidate := `UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, invalidate, userID, purpose); err != nil {
+		return err
+	}
+
+	insert := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, insert, userID, purpose, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeToken marks a valid token as used and returns the ID of its owner.
+func (r *postgresUserTokenRepository) ConsumeToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	sql := `UPDATE user_tokens SET used_at = NOW()
+			WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING user_id`
+	var userID string
+	err := r.db.QueryRow(ctx, sql, tokenHash, purpose).Scan(&userID)
+	return userID, err
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -12,16 +13,21 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/cors"
 
+	"github.com/trifur/rekamedchain/backend/internal/auth"
 	"github.com/trifur/rekamedchain/backend/internal/blockchain"
+	"github.com/trifur/rekamedchain/backend/internal/config"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
 	"github.com/trifur/rekamedchain/backend/internal/handler"
+	"github.com/trifur/rekamedchain/backend/internal/mail"
 	"github.com/trifur/rekamedchain/backend/internal/middleware"
 	"github.com/trifur/rekamedchain/backend/internal/repository"
 )
 
-func NewRouter(db *pgxpool.Pool, ipfsURL, ipfsGatewayURL string, jwtKey, encryptionKey []byte, bcClient *blockchain.BlockchainClient) http.Handler {
+func NewRouter(db *pgxpool.Pool, cfg *config.Config, tokenIssuer *auth.TokenIssuer, mailer mail.Mailer, bcClient *blockchain.BlockchainClient) http.Handler {
 	// --- Inisialisasi ---
+	encryptionKey := cfg.EncryptionKey
 	httpClient := &http.Client{Timeout: 60 * time.Second}
-	ipfsClient, err := ipfshttp.NewURLApiWithClient(ipfsURL, httpClient)
+	ipfsClient, err := ipfshttp.NewURLApiWithClient(cfg.IPFS_API, httpClient)
 	if err != nil {
 		log.Fatalf("IPFS connection error: %v\n", err)
 	}
@@ -31,14 +37,55 @@ func NewRouter(db *pgxpool.Pool, ipfsURL, ipfsGatewayURL string, jwtKey, encrypt
 	recordRepo := repository.NewPostgresRecordRepository(db)
 	consentRepo := repository.NewPostgresConsentRepository(db)
 	logRepo := repository.NewPostgresLogRepository(db)
-
-	authHandler := handler.NewAuthHandler(userRepo, jwtKey)
-	recordHandler := handler.NewRecordHandler(recordRepo, userRepo, encryptionKey, bcClient)
-	ipfsHandler := handler.NewIpfsHandler(ipfsClient)
-	consentHandler := handler.NewConsentHandler(consentRepo)
+	challengeRepo := repository.NewPostgresChallengeRepository(db)
+	sessionRepo := repository.NewPostgresSessionRepository(db)
+	mfaRepo := repository.NewPostgresMFARepository(db)
+	loginRepo := repository.NewPostgresLoginRepository(db)
+	tokenRepo := repository.NewPostgresUserTokenRepository(db)
+	roleRepo := repository.NewPostgresRoleRepository(db)
+	keyRepo := repository.NewPostgresKeyRepository(db)
+	delegationRepo := repository.NewPostgresDelegationRepository(db)
+	breakGlassRepo := repository.NewPostgresBreakGlassRepository(db)
+	serviceRepo := repository.NewPostgresServiceAccountRepository(db)
+	oidcRepo := repository.NewPostgresOIDCRepository(db)
+	terminologyRepo := repository.NewPostgresTerminologyRepository(db)
+	encounterRepo := repository.NewPostgresEncounterRepository(db)
+	facilityRepo := repository.NewPostgresFacilityRepository(db)
+	uploadRepo := repository.NewPostgresUploadRepository(db)
+
+	accountHandler := handler.NewAccountHandler(userRepo, tokenRepo, sessionRepo, roleRepo, keyRepo, mailer, cfg.AppBaseURL, encryptionKey)
+	authHandler := handler.NewAuthHandler(userRepo, challengeRepo, sessionRepo, mfaRepo, loginRepo, roleRepo, tokenIssuer, encryptionKey, cfg.TrustedProxies)
+	recordHandler := handler.NewRecordHandler(recordRepo, userRepo, terminologyRepo, consentRepo, encounterRepo, logRepo, uploadRepo, encryptionKey, cfg.BlindIndexKey, bcClient)
+	encounterHandler := handler.NewEncounterHandler(encounterRepo, roleRepo, recordHandler)
+	ipfsHandler := handler.NewIpfsHandler(ipfsClient, uploadRepo)
+	consentHandler := handler.NewConsentHandler(consentRepo, keyRepo)
 	ledgerHandler := handler.NewLedgerHandler(bcClient)
-	userHandler := handler.NewUserHandler(userRepo)
-	logHandler := handler.NewLogHandler(logRepo)
+	userHandler := handler.NewUserHandler(userRepo, consentRepo)
+	logHandler := handler.NewLogHandler(logRepo, loginRepo)
+	sessionHandler := handler.NewSessionHandler(sessionRepo)
+	mfaHandler := handler.NewMFAHandler(userRepo, mfaRepo, sessionRepo, encryptionKey)
+	keyHandler := handler.NewKeyHandler(userRepo, keyRepo, tokenRepo, loginRepo, mailer, encryptionKey)
+	adminHandler := handler.NewAdminHandler(userRepo, roleRepo, sessionRepo, loginRepo, facilityRepo, mailer)
+	delegationHandler := handler.NewDelegationHandler(delegationRepo, userRepo)
+	breakGlassHandler := handler.NewBreakGlassHandler(breakGlassRepo, userRepo, mailer)
+	serviceAccountHandler := handler.NewServiceAccountHandler(serviceRepo)
+	terminologyHandler := handler.NewTerminologyHandler(terminologyRepo)
+
+	// Penyedia identitas rumah sakit (OIDC) untuk login tenaga kesehatan.
+	oidcProviders := make(map[string]handler.OIDCLoginProvider, len(cfg.OIDCProviders))
+	for id, p := range cfg.OIDCProviders {
+		role, err := roleRepo.GetRole(context.Background(), p.Role)
+		if err != nil || !role.ClinicalStaff {
+			log.Fatalf("OIDC provider %s: role %q bukan role tenaga kesehatan", id, p.Role)
+		}
+		oidcProviders[id] = handler.OIDCLoginProvider{
+			Client:     auth.NewOIDCProvider(p.IssuerURL, p.ClientID, p.ClientSecret, p.RedirectURL, &http.Client{Timeout: 10 * time.Second}),
+			FacilityID: p.FacilityID,
+			Role:       p.Role,
+			TrustMFA:   p.TrustMFA,
+		}
+	}
+	oidcHandler := handler.NewOIDCHandler(authHandler, oidcRepo, oidcProviders)
 
 	// --- Routing Menggunakan SATU Mux Utama ---
 	apiMux := http.NewServeMux()
@@ -49,41 +96,152 @@ func NewRouter(db *pgxpool.Pool, ipfsURL, ipfsGatewayURL string, jwtKey, encrypt
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"message": "RekamedChain API is alive!"})
 	})
-	apiMux.HandleFunc("POST /register", authHandler.Register)
+	apiMux.HandleFunc("GET /.well-known/jwks.json", authHandler.HandleJWKS)
+	apiMux.HandleFunc("POST /register", accountHandler.Register)
 	apiMux.HandleFunc("POST /doctor/login", authHandler.DoctorLogin)
+	apiMux.HandleFunc("POST /staff/login", authHandler.DoctorLogin)
+	apiMux.HandleFunc("POST /doctor/login/mfa", authHandler.DoctorLoginMFA)
 	apiMux.HandleFunc("POST /patient/login", authHandler.PatientLogin)
+	apiMux.HandleFunc("POST /admin/login", authHandler.AdminLogin)
+	apiMux.HandleFunc("GET /auth/oidc/providers", oidcHandler.HandleListProviders)
+	apiMux.HandleFunc("GET /auth/oidc/{provider}/start", oidcHandler.HandleStart)
+	apiMux.HandleFunc("POST /auth/oidc/{provider}/callback", oidcHandler.HandleCallback)
+	apiMux.HandleFunc("POST /auth/challenge", authHandler.RequestChallenge)
+	apiMux.HandleFunc("POST /auth/challenge/verify", authHandler.VerifyChallenge)
+	apiMux.HandleFunc("POST /auth/refresh", authHandler.Refresh)
+	apiMux.HandleFunc("POST /auth/email/verify/confirm", accountHandler.HandleConfirmEmailVerification)
+	apiMux.HandleFunc("POST /auth/password/forgot", accountHandler.HandleForgotPassword)
+	apiMux.HandleFunc("POST /auth/password/reset", accountHandler.HandleResetPassword)
 
 	// == Patient Routes (Authenticated) ==
-	apiMux.Handle("GET /users/me", middleware.AuthMiddleware(http.HandlerFunc(userHandler.HandleGetMyProfile), jwtKey))
-	apiMux.Handle("GET /records", middleware.AuthMiddleware(http.HandlerFunc(recordHandler.GetMyRecords), jwtKey))
-	apiMux.Handle("GET /consent/requests/me", middleware.AuthMiddleware(http.HandlerFunc(consentHandler.HandleGetMyRequests), jwtKey))
-	apiMux.Handle("POST /consent/sign/{request_id}", middleware.AuthMiddleware(http.HandlerFunc(consentHandler.HandleGrant), jwtKey))
-	apiMux.Handle("POST /consent/deny/{request_id}", middleware.AuthMiddleware(http.HandlerFunc(consentHandler.HandleDeny), jwtKey))
-	apiMux.Handle("POST /consent/revoke/{request_id}", middleware.AuthMiddleware(http.HandlerFunc(consentHandler.HandleRevoke), jwtKey))
-	// apiMux.Handle("GET /log-access", ...).
-
-	// == Doctor Routes (Authenticated + Doctor Role) ==
-	// Buat "rantai" middleware untuk dokter agar tidak diulang-ulang
-	doctorOnly := func(next http.Handler) http.Handler {
-		return middleware.AuthMiddleware(middleware.DoctorMiddleware(next), jwtKey)
+	authenticated := func(next http.Handler) http.Handler {
+		return middleware.AuthMiddleware(next, tokenIssuer, sessionRepo, nil)
+	}
+	// Aksi sensitif (persetujuan izin, penulisan data) hanya untuk email yang sudah diverifikasi.
+	verified := func(next http.Handler) http.Handler {
+		return authenticated(middleware.VerifiedEmailMiddleware(next))
 	}
 
-	apiMux.Handle("POST /records", doctorOnly(http.HandlerFunc(recordHandler.CreateRecord)))
-	apiMux.Handle("POST /upload", doctorOnly(http.HandlerFunc(ipfsHandler.UploadFile)))
-	apiMux.Handle("POST /consent/request", doctorOnly(http.HandlerFunc(consentHandler.HandleRequest)))
-	apiMux.Handle("GET /ledger", doctorOnly(http.HandlerFunc(ledgerHandler.HandleGetLedger)))
-	apiMux.Handle("GET /users/search", doctorOnly(http.HandlerFunc(userHandler.HandleSearchUsers)))
-	apiMux.Handle("GET /users/detail/{patient_id}", doctorOnly(http.HandlerFunc(userHandler.HandleGetPatientProfile)))
+	// Wali dapat memanggil rute pasien atas nama tanggungannya lewat header X-On-Behalf-Of.
+	onBehalf := func(scope string, next http.HandlerFunc) http.Handler {
+		return middleware.ActingOnBehalfMiddleware(delegationRepo, scope, next)
+	}
 
-	// Rute dokter dengan middleware tambahan (consent)
-	getPatientRecordsHandler := middleware.ConsentMiddleware(db, http.HandlerFunc(recordHandler.GetPatientRecords))
-	apiMux.Handle("GET /records/patient/{patient_id}", doctorOnly(getPatientRecordsHandler))
+	apiMux.Handle("GET /users/me", authenticated(http.HandlerFunc(userHandler.HandleGetMyProfile)))
+	apiMux.Handle("GET /records", authenticated(onBehalf(domain.DelegationScopeRecords, recordHandler.GetMyRecords)))
+	apiMux.Handle("GET /records/history/{record_id}", authenticated(onBehalf(domain.DelegationScopeRecords, recordHandler.GetRecordHistory)))
+	apiMux.Handle("GET /records/search", authenticated(onBehalf(domain.DelegationScopeRecords, recordHandler.SearchMyRecords)))
+	apiMux.Handle("GET /encounters", authenticated(onBehalf(domain.DelegationScopeRecords, encounterHandler.GetMyEncounters)))
+	apiMux.Handle("GET /consent/requests/me", authenticated(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleGetMyRequests)))
+	apiMux.Handle("GET /consent/requests/{request_id}/message", authenticated(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleGetMessage)))
+	apiMux.Handle("GET /consent/requests/{request_id}/signatures", authenticated(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleGetSignatures)))
+	apiMux.Handle("POST /consent/sign/{request_id}", verified(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleGrant)))
+	apiMux.Handle("POST /consent/deny/{request_id}", verified(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleDeny)))
+	apiMux.Handle("POST /consent/revoke/{request_id}", verified(onBehalf(domain.DelegationScopeConsent, consentHandler.HandleRevoke)))
+	apiMux.Handle("GET /log-access", authenticated(onBehalf(domain.DelegationScopeRecords, logHandler.HandleGetMyAuditLog)))
+	apiMux.Handle("GET /log-access/logins", authenticated(http.HandlerFunc(logHandler.HandleGetMyLoginEvents)))
+
+	// == Delegation Routes (wali <-> tanggungan) ==
+	apiMux.Handle("GET /delegations", authenticated(http.HandlerFunc(delegationHandler.HandleList)))
+	apiMux.Handle("POST /delegations", verified(http.HandlerFunc(delegationHandler.HandleCreate)))
+	apiMux.Handle("POST /delegations/{delegation_id}/accept", verified(http.HandlerFunc(delegationHandler.HandleAccept)))
+	apiMux.Handle("POST /delegations/{delegation_id}/revoke", authenticated(http.HandlerFunc(delegationHandler.HandleRevoke)))
+
+	// == Terminology Routes (Authenticated): autocomplete kode diagnosis ==
+	apiMux.Handle("GET /terminology/icd10", authenticated(http.HandlerFunc(terminologyHandler.HandleSearchICD10)))
+	apiMux.Handle("GET /terminology/icd10/{code}", authenticated(http.HandlerFunc(terminologyHandler.HandleGetICD10)))
+
+	// == Session Routes (Authenticated, semua role) ==
+	apiMux.Handle("POST /auth/email/verify/request", authenticated(http.HandlerFunc(accountHandler.HandleRequestEmailVerification)))
+	apiMux.Handle("POST /auth/logout", authenticated(http.HandlerFunc(authHandler.Logout)))
+	apiMux.Handle("POST /auth/logout-all", authenticated(http.HandlerFunc(authHandler.LogoutAll)))
+	apiMux.Handle("GET /sessions", authenticated(http.HandlerFunc(sessionHandler.HandleGetMySessions)))
+	apiMux.Handle("DELETE /sessions/{session_id}", authenticated(http.HandlerFunc(sessionHandler.HandleRevokeSession)))
+
+	// == MFA Routes (Authenticated) ==
+	// Sengaja tanpa RequirePermission: tenaga kesehatan yang wajib MFA harus tetap bisa mendaftar.
+	apiMux.Handle("POST /mfa/totp/enroll", authenticated(http.HandlerFunc(mfaHandler.HandleEnroll)))
+	apiMux.Handle("POST /mfa/totp/activate", authenticated(http.HandlerFunc(mfaHandler.HandleActivate)))
+	apiMux.Handle("POST /mfa/totp/disable", authenticated(http.HandlerFunc(mfaHandler.HandleDisable)))
+
+	// == Key Routes (Authenticated): escrow opt-in dan rotasi kunci ==
+	apiMux.Handle("GET /keys/backup", authenticated(http.HandlerFunc(keyHandler.HandleGetBackupStatus)))
+	apiMux.Handle("POST /keys/backup", verified(http.HandlerFunc(keyHandler.HandleBackup)))
+	apiMux.Handle("DELETE /keys/backup", authenticated(http.HandlerFunc(keyHandler.HandleDeleteBackup)))
+	apiMux.Handle("POST /keys/recovery/request", verified(http.HandlerFunc(keyHandler.HandleRequestRecovery)))
+	apiMux.Handle("POST /keys/restore", verified(http.HandlerFunc(keyHandler.HandleRestore)))
+	apiMux.Handle("GET /keys/history", authenticated(http.HandlerFunc(keyHandler.HandleGetKeyHistory)))
+	apiMux.Handle("POST /keys/rotate/request", verified(http.HandlerFunc(keyHandler.HandleRequestRotationRecovery)))
+	apiMux.Handle("POST /keys/rotate", verified(http.HandlerFunc(keyHandler.HandleRotateKey)))
+
+	// == Staff Routes (Authenticated + Permission) ==
+	// Tenaga kesehatan (dokter, perawat, lab, apoteker) dibatasi per izin, bukan per role.
+	// Hanya rute berbasis izin yang menerima API key akun layanan; scope key menjadi izinnya.
+	withPermission := func(next http.Handler, permissions ...string) http.Handler {
+		inner := middleware.VerifiedEmailMiddleware(middleware.RequirePermission(permissions...)(next))
+		return middleware.AuthMiddleware(inner, tokenIssuer, sessionRepo, serviceRepo)
+	}
 
-	getAuditLogHandler := middleware.ConsentMiddleware(db, http.HandlerFunc(logHandler.HandleGetAuditLog))
-	apiMux.Handle("GET /audit-log/{patient_id}", doctorOnly(getAuditLogHandler))
+	apiMux.Handle("POST /records", withPermission(http.HandlerFunc(recordHandler.CreateRecord), domain.PermRecordsWrite))
+	apiMux.Handle("POST /records/vitals", withPermission(http.HandlerFunc(recordHandler.CreateVitals), domain.PermVitalsWrite))
+	apiMux.Handle("POST /records/lab-results", withPermission(http.HandlerFunc(recordHandler.CreateLabResult), domain.PermLabResultsWrite))
+	apiMux.Handle("POST /records/{record_id}/amend", withPermission(http.HandlerFunc(recordHandler.AmendRecord), domain.PermRecordsWrite))
+	apiMux.Handle("GET /records/authored", withPermission(http.HandlerFunc(recordHandler.GetAuthoredRecords), domain.PermRecordsWrite))
+	apiMux.Handle("POST /encounters", withPermission(http.HandlerFunc(encounterHandler.HandleOpen), domain.PermRecordsWrite))
+	apiMux.Handle("POST /encounters/{encounter_id}/close", withPermission(http.HandlerFunc(encounterHandler.HandleClose), domain.PermRecordsWrite))
+	apiMux.Handle("POST /encounters/{encounter_id}/participants", withPermission(http.HandlerFunc(encounterHandler.HandleAddParticipant), domain.PermRecordsWrite))
+	apiMux.Handle("POST /encounters/{encounter_id}/prescriptions", withPermission(http.HandlerFunc(encounterHandler.HandleAddPrescription), domain.PermPrescriptionsWrite))
+	apiMux.Handle("POST /encounters/{encounter_id}/attachments", withPermission(http.HandlerFunc(encounterHandler.HandleAddAttachments), domain.PermFilesUpload))
+	apiMux.Handle("POST /upload", withPermission(http.HandlerFunc(ipfsHandler.UploadFile), domain.PermFilesUpload))
+	apiMux.Handle("POST /consent/request", withPermission(http.HandlerFunc(consentHandler.HandleRequest), domain.PermConsentRequest))
+	apiMux.Handle("GET /ledger", withPermission(http.HandlerFunc(ledgerHandler.HandleGetLedger), domain.PermLedgerRead))
+	apiMux.Handle("GET /users/search", withPermission(http.HandlerFunc(userHandler.HandleSearchUsers), domain.PermPatientsSearch))
+	apiMux.Handle("GET /users/detail/{patient_id}", withPermission(http.HandlerFunc(userHandler.HandleGetPatientProfile), domain.PermPatientsRead))
+
+	// Akses darurat tanpa izin pasien; selalu ditinjau admin setelahnya.
+	apiMux.Handle("POST /break-glass/{patient_id}", withPermission(http.HandlerFunc(breakGlassHandler.HandleOpen), domain.PermBreakGlassUse))
+
+	// Rute tenaga kesehatan dengan middleware tambahan (consent atau break-glass)
+	getPatientRecordsHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(recordHandler.GetPatientRecords))
+	apiMux.Handle("GET /records/patient/{patient_id}", withPermission(getPatientRecordsHandler, domain.PermRecordsRead))
+
+	searchPatientRecordsHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(recordHandler.SearchPatientRecords))
+	apiMux.Handle("GET /records/patient/{patient_id}/search", withPermission(searchPatientRecordsHandler, domain.PermRecordsRead))
+
+	getRecordHistoryHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(recordHandler.GetRecordHistory))
+	apiMux.Handle("GET /records/patient/{patient_id}/history/{record_id}", withPermission(getRecordHistoryHandler, domain.PermRecordsRead))
+
+	getPatientEncountersHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(encounterHandler.GetPatientEncounters))
+	apiMux.Handle("GET /encounters/patient/{patient_id}", withPermission(getPatientEncountersHandler, domain.PermRecordsRead))
+
+	getPatientPrescriptionsHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(encounterHandler.GetPatientPrescriptions))
+	apiMux.Handle("GET /prescriptions/patient/{patient_id}", withPermission(getPatientPrescriptionsHandler, domain.PermPrescriptionsRead))
+
+	getAuditLogHandler := middleware.ConsentMiddleware(consentRepo, breakGlassRepo, http.HandlerFunc(logHandler.HandleGetAuditLog))
+	apiMux.Handle("GET /audit-log/{patient_id}", withPermission(getAuditLogHandler, domain.PermAuditRead))
+
+	// == Admin Routes (Authenticated + Permission) ==
+	apiMux.Handle("GET /admin/roles", withPermission(http.HandlerFunc(adminHandler.HandleListRoles), domain.PermStaffVerify))
+	apiMux.Handle("GET /admin/staff", withPermission(http.HandlerFunc(adminHandler.HandleListStaff), domain.PermStaffVerify))
+	apiMux.Handle("GET /admin/staff/{staff_id}", withPermission(http.HandlerFunc(adminHandler.HandleGetStaff), domain.PermStaffVerify))
+	apiMux.Handle("POST /admin/staff/{staff_id}/approve", withPermission(http.HandlerFunc(adminHandler.HandleApproveStaff), domain.PermStaffVerify))
+	apiMux.Handle("POST /admin/staff/{staff_id}/reject", withPermission(http.HandlerFunc(adminHandler.HandleRejectStaff), domain.PermStaffVerify))
+	apiMux.Handle("GET /admin/facilities", withPermission(http.HandlerFunc(adminHandler.HandleListFacilities), domain.PermFacilitiesManage))
+	apiMux.Handle("PUT /admin/facilities/{facility_id}/mfa-policy", withPermission(http.HandlerFunc(adminHandler.HandleSetMFAPolicy), domain.PermFacilitiesManage))
+	apiMux.Handle("POST /admin/delegations", withPermission(http.HandlerFunc(delegationHandler.HandleAdminCreate), domain.PermDelegationsManage))
+	apiMux.Handle("GET /admin/break-glass", withPermission(http.HandlerFunc(breakGlassHandler.HandleListForReview), domain.PermBreakGlassReview))
+	apiMux.Handle("GET /admin/break-glass/{session_id}/accesses", withPermission(http.HandlerFunc(breakGlassHandler.HandleListAccesses), domain.PermBreakGlassReview))
+	apiMux.Handle("POST /admin/break-glass/{session_id}/confirm", withPermission(http.HandlerFunc(breakGlassHandler.HandleConfirm), domain.PermBreakGlassReview))
+	apiMux.Handle("POST /admin/break-glass/{session_id}/misuse", withPermission(http.HandlerFunc(breakGlassHandler.HandleFlagMisuse), domain.PermBreakGlassReview))
+	apiMux.Handle("GET /admin/service-accounts", withPermission(http.HandlerFunc(serviceAccountHandler.HandleList), domain.PermServiceAccounts))
+	apiMux.Handle("POST /admin/service-accounts", withPermission(http.HandlerFunc(serviceAccountHandler.HandleCreate), domain.PermServiceAccounts))
+	apiMux.Handle("GET /admin/service-accounts/{service_account_id}/keys", withPermission(http.HandlerFunc(serviceAccountHandler.HandleListKeys), domain.PermServiceAccounts))
+	apiMux.Handle("POST /admin/service-accounts/{service_account_id}/keys", withPermission(http.HandlerFunc(serviceAccountHandler.HandleCreateKey), domain.PermServiceAccounts))
+	apiMux.Handle("DELETE /admin/service-accounts/{service_account_id}/keys/{key_id}", withPermission(http.HandlerFunc(serviceAccountHandler.HandleRevokeKey), domain.PermServiceAccounts))
+	apiMux.Handle("POST /admin/users/{user_id}/unlock", withPermission(http.HandlerFunc(adminHandler.HandleUnlockAccount), domain.PermAccountsUnlock))
 
 	// --- Final Handler Setup ---
-	parsedGatewayURL, _ := url.Parse(ipfsGatewayURL)
+	parsedGatewayURL, _ := url.Parse(cfg.IPFS_Gateway)
 	ipfsProxy := httputil.NewSingleHostReverseProxy(parsedGatewayURL)
 
 	masterMux := http.NewServeMux()
@@ -0,0 +1,76 @@
+// Package search turns record text into blind-indexed search terms, so that
+// encrypted records can be matched by keyword without decrypting them.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/trifur/rekamedchain/backend/internal/crypto"
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// minTermLength drops one-letter words, which match almost every record.
+const minTermLength = 2
+
+// stopwords are common Indonesian and English words not worth indexing.
+var stopwords = map[string]bool{
+	"dan": true, "atau": true, "yang": true, "di": true, "ke": true, "dari": true, "dengan": true,
+	"untuk": true, "pada": true, "ini": true, "itu": true, "tidak": true, "ada": true, "sudah": true,
+	"the": true, "and": true, "or": true, "of": true, "with": true, "without": true, "in": true,
+	"to": true, "for": true, "on": true, "is": true, "no": true, "not": true,
+}
+
+// Terms normalises text into distinct search terms: lower-cased words of
+// letters and digits. Dots inside a word are kept so codes such as "e11.9"
+// and numbers such as "38.5" stay whole.
+func Terms(texts ...string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, text := range texts {
+		words := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+			return !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '.'
+		})
+		for _, word := range words {
+			word = strings.Trim(word, ".")
+			if len([]rune(word)) < minTermLength || stopwords[word] || seen[word] {
+				continue
+			}
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// RecordTerms returns the search terms of a record from its plaintext fields.
+// ICD-10 codes are also indexed by their category, so "E11" finds "E11.9".
+func RecordTerms(diagnosis, notes string, content domain.ClinicalContent) []string {
+	texts := []string{diagnosis, notes}
+	for _, d := range content.Diagnoses {
+		texts = append(texts, d.Code, d.Description)
+		if category, _, found := strings.Cut(d.Code, "."); found {
+			texts = append(texts, category)
+		}
+	}
+	for _, m := range content.Medications {
+		texts = append(texts, m.Name)
+	}
+	for _, a := range content.Allergies {
+		texts = append(texts, a.Substance)
+	}
+	for _, p := range content.Procedures {
+		texts = append(texts, p.Name, p.Code)
+	}
+	return Terms(texts...)
+}
+
+// Indexes returns the blind index of every term. The "term:" prefix keeps
+// these indexes distinct from other blind indexes made with the same key.
+func Indexes(terms []string, key []byte) []string {
+	indexes := make([]string, len(terms))
+	for i, term := range terms {
+		indexes[i] = crypto.BlindIndex("term:"+term, key)
+	}
+	return indexes
+}
@@ -0,0 +1,43 @@
+// Package terminology holds the clinical code sets bundled with the backend.
+package terminology
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/trifur/rekamedchain/backend/internal/domain"
+)
+
+// icd10CSV is a subset of WHO ICD-10 covering the diagnoses seen most often
+// in primary care, with English and Indonesian names. Columns: code, name_en, name_id.
+//
+//go:embed icd10.csv
+var icd10CSV []byte
+
+// ICD10Codes parses the bundled ICD-10 catalog.
+func ICD10Codes() ([]domain.ICD10Code, error) {
+	records, err := csv.NewReader(bytes.NewReader(icd10CSV)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid icd10.csv: %w", err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != "code,name_en,name_id" {
+		return nil, fmt.Errorf("invalid icd10.csv: unexpected header")
+	}
+
+	codes := make([]domain.ICD10Code, 0, len(records)-1)
+	for i, record := range records[1:] {
+		code := domain.ICD10Code{
+			Code:   strings.ToUpper(strings.TrimSpace(record[0])),
+			NameEN: strings.TrimSpace(record[1]),
+			NameID: strings.TrimSpace(record[2]),
+		}
+		if code.Code == "" || code.NameEN == "" || code.NameID == "" {
+			return nil, fmt.Errorf("invalid icd10.csv: empty field on line %d", i+2)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS auth_challenges CASCADE;
\ No newline at end of file
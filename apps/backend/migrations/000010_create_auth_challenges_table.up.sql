@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS auth_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_user_challenge FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
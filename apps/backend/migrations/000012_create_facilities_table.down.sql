@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS facility_id;
+DROP TABLE IF EXISTS facilities CASCADE;
\ No newline at end of file
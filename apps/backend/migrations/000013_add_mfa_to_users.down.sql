@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS used_mfa_tokens;
+ALTER TABLE sessions DROP COLUMN IF EXISTS mfa_verified;
+DROP TABLE IF EXISTS mfa_recovery_codes CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret_encrypted, DROP COLUMN IF EXISTS totp_last_used_step, DROP COLUMN IF EXISTS mfa_enabled, DROP COLUMN IF EXISTS mfa_enabled_at;
\ No newline at end of file
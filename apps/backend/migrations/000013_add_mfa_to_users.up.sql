@@ -0,0 +1,28 @@
+ALTER TABLE users
+ADD COLUMN totp_secret_encrypted TEXT, -- Dienkripsi dengan ENCRYPTION_KEY
+ADD COLUMN totp_last_used_step BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN mfa_enabled_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_user_recovery_code FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+ALTER TABLE sessions
+ADD COLUMN mfa_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Token MFA (langkah kedua login) hanya boleh dipakai sekali.
+CREATE TABLE IF NOT EXISTS used_mfa_tokens (
+    token_id VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_used_mfa_tokens_expires_at ON used_mfa_tokens(expires_at);
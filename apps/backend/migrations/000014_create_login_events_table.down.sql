@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_count, DROP COLUMN IF EXISTS last_failed_login_at, DROP COLUMN IF EXISTS locked_until;
+DROP TABLE IF EXISTS login_events CASCADE;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS login_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    user_agent TEXT,
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_user_login_event FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id ON login_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_ip_address ON login_events(ip_address, created_at DESC);
+
+ALTER TABLE users
+ADD COLUMN failed_login_count INT NOT NULL DEFAULT 0,
+ADD COLUMN last_failed_login_at TIMESTAMPTZ,
+ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,18 @@
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Akun yang dibuat sebelum fitur verifikasi email dianggap sudah terverifikasi.
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_user_token FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (purpose IN ('email_verification', 'password_reset'))
+);
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_users_verification_status;
+
+UPDATE users SET facility_id = requested_facility_id WHERE facility_id IS NULL AND requested_facility_id IS NOT NULL;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS requested_facility_id,
+DROP COLUMN IF EXISTS verified_at,
+DROP COLUMN IF EXISTS verified_by,
+DROP COLUMN IF EXISTS verification_note,
+DROP COLUMN IF EXISTS verification_status,
+DROP COLUMN IF EXISTS sip_number,
+DROP COLUMN IF EXISTS str_number;
+
+DELETE FROM users WHERE role = 'admin';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('patient', 'doctor'));
@@ -0,0 +1,20 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('patient', 'doctor', 'admin'));
+
+ALTER TABLE users
+ADD COLUMN str_number VARCHAR(50),
+ADD COLUMN sip_number VARCHAR(50),
+ADD COLUMN verification_status VARCHAR(20) NOT NULL DEFAULT 'approved'
+    CHECK (verification_status IN ('pending', 'approved', 'rejected')),
+ADD COLUMN verification_note TEXT,
+ADD COLUMN verified_by UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN verified_at TIMESTAMPTZ,
+-- Fasilitas yang diisi saat registrasi hanya permintaan. Keanggotaan fasilitas
+-- (dan kebijakan MFA-nya) baru berlaku setelah admin menyetujui kredensial.
+ADD COLUMN requested_facility_id UUID REFERENCES facilities(id) ON DELETE SET NULL;
+
+-- Dokter yang sudah terdaftar sebelum alur verifikasi dianggap sudah disetujui.
+-- Akun baru mengikuti nilai yang dikirim aplikasi (dokter baru = 'pending').
+ALTER TABLE users ALTER COLUMN verification_status SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_users_verification_status ON users(verification_status) WHERE role = 'doctor';
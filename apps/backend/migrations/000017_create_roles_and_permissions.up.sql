@@ -0,0 +1,80 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL,
+    -- Tenaga kesehatan wajib diverifikasi admin (STR/SIP) dan tunduk pada kebijakan MFA fasilitas.
+    clinical_staff BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, clinical_staff) VALUES
+    ('patient', 'Pasien pemilik rekam medis', FALSE),
+    ('doctor', 'Dokter', TRUE),
+    ('nurse', 'Perawat', TRUE),
+    ('lab_staff', 'Petugas laboratorium', TRUE),
+    ('pharmacist', 'Apoteker', TRUE),
+    ('admin', 'Administrator sistem', FALSE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('patients:search', 'Mencari pasien'),
+    ('patients:read', 'Melihat profil pasien'),
+    ('consent:request', 'Mengajukan izin akses ke pasien'),
+    ('records:read', 'Melihat rekam medis pasien (dengan izin)'),
+    ('records:write', 'Menulis rekam medis dan diagnosis'),
+    ('vitals:write', 'Mencatat tanda vital'),
+    ('lab_results:write', 'Mengunggah hasil laboratorium'),
+    ('prescriptions:read', 'Melihat resep'),
+    ('prescriptions:write', 'Menulis resep'),
+    ('files:upload', 'Mengunggah berkas ke IPFS'),
+    ('ledger:read', 'Melihat ledger blockchain'),
+    ('audit:read', 'Melihat log audit pasien (dengan izin)'),
+    ('staff:verify', 'Memverifikasi kredensial tenaga kesehatan'),
+    ('accounts:unlock', 'Membuka kunci akun yang terkunci'),
+    ('facilities:manage', 'Mengelola fasilitas dan kebijakan MFA-nya')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('doctor', 'patients:search'),
+    ('doctor', 'patients:read'),
+    ('doctor', 'consent:request'),
+    ('doctor', 'records:read'),
+    ('doctor', 'records:write'),
+    ('doctor', 'vitals:write'),
+    ('doctor', 'prescriptions:read'),
+    ('doctor', 'prescriptions:write'),
+    ('doctor', 'files:upload'),
+    ('doctor', 'ledger:read'),
+    ('doctor', 'audit:read'),
+    ('nurse', 'patients:search'),
+    ('nurse', 'patients:read'),
+    ('nurse', 'consent:request'),
+    ('nurse', 'records:read'),
+    ('nurse', 'vitals:write'),
+    ('lab_staff', 'patients:search'),
+    ('lab_staff', 'patients:read'),
+    ('lab_staff', 'consent:request'),
+    ('lab_staff', 'lab_results:write'),
+    ('lab_staff', 'files:upload'),
+    ('pharmacist', 'patients:search'),
+    ('pharmacist', 'patients:read'),
+    ('pharmacist', 'consent:request'),
+    ('pharmacist', 'prescriptions:read'),
+    ('admin', 'staff:verify'),
+    ('admin', 'accounts:unlock'),
+    ('admin', 'facilities:manage')
+ON CONFLICT DO NOTHING;
+
+-- Daftar role sekarang diatur oleh tabel roles, bukan CHECK constraint.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT fk_user_role FOREIGN KEY (role) REFERENCES roles(name);
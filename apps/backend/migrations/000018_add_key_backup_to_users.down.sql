@@ -0,0 +1,7 @@
+DELETE FROM user_tokens WHERE purpose = 'key_recovery';
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('email_verification', 'password_reset'));
+
+UPDATE users SET private_key_encrypted = NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS key_backup_at;
@@ -0,0 +1,8 @@
+-- private_key_encrypted (000007) sekarang dipakai untuk escrow kunci yang bersifat opt-in.
+-- Isinya dienkripsi dua lapis: Argon2id(passphrase pengguna) lalu ENCRYPTION_KEY server.
+ALTER TABLE users
+ADD COLUMN key_backup_at TIMESTAMPTZ;
+
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('email_verification', 'password_reset', 'key_recovery'));
@@ -0,0 +1,6 @@
+DELETE FROM user_tokens WHERE purpose = 'key_rotation';
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('email_verification', 'password_reset', 'key_recovery'));
+
+DROP TABLE IF EXISTS user_keys CASCADE;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS user_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    public_key TEXT NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    valid_until TIMESTAMPTZ, -- NULL = kunci yang sedang aktif
+    rotation_method VARCHAR(50), -- Cara kunci ini menggantikan kunci sebelumnya: 'signature' atau 'recovery'
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_user_key FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (valid_until IS NULL OR valid_until > valid_from)
+);
+
+-- Hanya satu kunci aktif per pengguna.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_keys_active ON user_keys(user_id) WHERE valid_until IS NULL;
+CREATE INDEX IF NOT EXISTS idx_user_keys_user_id ON user_keys(user_id, valid_from);
+
+-- Kunci yang sudah ada berlaku sejak akun dibuat.
+INSERT INTO user_keys (user_id, public_key, valid_from)
+SELECT id, public_key, created_at FROM users WHERE public_key IS NOT NULL AND public_key <> '';
+
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('email_verification', 'password_reset', 'key_recovery', 'key_rotation'));
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS consent_signatures CASCADE;
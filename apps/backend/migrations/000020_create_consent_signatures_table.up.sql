@@ -0,0 +1,19 @@
+-- Tanda tangan digital pasien atas setiap keputusan izin (grant/deny/revoke).
+-- Pesan kanonik dan kunci publik ikut disimpan agar tanda tangan bisa diverifikasi ulang secara independen.
+CREATE TABLE IF NOT EXISTS consent_signatures (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    consent_request_id UUID NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    signer_id UUID NOT NULL,
+    message TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    nonce VARCHAR(128) NOT NULL UNIQUE, -- Mencegah tanda tangan yang sama dipakai ulang
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_consent_signature_request FOREIGN KEY(consent_request_id) REFERENCES consent_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_consent_signature_signer FOREIGN KEY(signer_id) REFERENCES users(id),
+    CHECK (action IN ('grant', 'deny', 'revoke'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_consent_signatures_request_id ON consent_signatures(consent_request_id);
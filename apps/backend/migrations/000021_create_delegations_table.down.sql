@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission = 'delegations:manage';
+DELETE FROM permissions WHERE name = 'delegations:manage';
+
+DROP TABLE IF EXISTS delegations CASCADE;
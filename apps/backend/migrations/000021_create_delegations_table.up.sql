@@ -0,0 +1,38 @@
+-- Delegasi wali: akun wali (orang tua, pendamping) bertindak atas nama pasien tanggungan.
+CREATE TABLE IF NOT EXISTS delegations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    guardian_id UUID NOT NULL,
+    dependent_id UUID NOT NULL,
+    scope VARCHAR(20) NOT NULL,           -- records, consent, atau full
+    relationship VARCHAR(50) NOT NULL,    -- mis. "orang tua", "pendamping"
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    ends_at TIMESTAMPTZ,                  -- NULL = berlaku sampai dicabut
+    created_by UUID NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_delegation_guardian FOREIGN KEY(guardian_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_delegation_dependent FOREIGN KEY(dependent_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_delegation_created_by FOREIGN KEY(created_by) REFERENCES users(id),
+    CONSTRAINT fk_delegation_revoked_by FOREIGN KEY(revoked_by) REFERENCES users(id),
+    CHECK (guardian_id <> dependent_id),
+    CHECK (scope IN ('records', 'consent', 'full')),
+    CHECK (status IN ('pending', 'active', 'revoked'))
+);
+
+-- Hanya satu delegasi berjalan (pending/active) untuk setiap pasangan wali-tanggungan.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_delegations_open_pair
+    ON delegations(guardian_id, dependent_id) WHERE status IN ('pending', 'active');
+CREATE INDEX IF NOT EXISTS idx_delegations_dependent_id ON delegations(dependent_id);
+
+-- Delegasi untuk anak di bawah umur dibuat admin setelah memeriksa dokumen perwalian.
+INSERT INTO permissions (name, description) VALUES
+    ('delegations:manage', 'Membuat delegasi wali untuk pasien tanggungan')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'delegations:manage')
+ON CONFLICT DO NOTHING;
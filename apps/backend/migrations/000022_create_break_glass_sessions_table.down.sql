@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission IN ('break_glass:use', 'break_glass:review');
+DELETE FROM permissions WHERE name IN ('break_glass:use', 'break_glass:review');
+
+DROP TABLE IF EXISTS break_glass_accesses;
+DROP TABLE IF EXISTS break_glass_sessions CASCADE;
@@ -0,0 +1,47 @@
+-- Akses darurat (break-glass): dokter membaca rekam medis tanpa izin pasien untuk waktu terbatas.
+-- Setiap sesi wajib ditinjau admin setelahnya.
+CREATE TABLE IF NOT EXISTS break_glass_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    doctor_id UUID NOT NULL,
+    patient_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    review_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    review_note TEXT,
+    reviewed_by UUID,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_break_glass_doctor FOREIGN KEY(doctor_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_break_glass_patient FOREIGN KEY(patient_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_break_glass_reviewed_by FOREIGN KEY(reviewed_by) REFERENCES users(id),
+    CHECK (review_status IN ('pending', 'confirmed', 'misuse'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_break_glass_doctor_patient ON break_glass_sessions(doctor_id, patient_id, expires_at);
+CREATE INDEX IF NOT EXISTS idx_break_glass_review_status ON break_glass_sessions(review_status);
+
+-- Setiap pembacaan data pasien lewat sesi akses darurat dicatat, agar admin dan
+-- pasien dapat melihat apa saja yang dibuka selama sesi berlangsung.
+CREATE TABLE IF NOT EXISTS break_glass_accesses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id UUID NOT NULL REFERENCES break_glass_sessions(id) ON DELETE CASCADE,
+    doctor_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    patient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_break_glass_accesses_session ON break_glass_accesses(session_id, accessed_at);
+CREATE INDEX IF NOT EXISTS idx_break_glass_accesses_patient ON break_glass_accesses(patient_id, accessed_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('break_glass:use', 'Membuka akses darurat ke rekam medis pasien'),
+    ('break_glass:review', 'Meninjau penggunaan akses darurat')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('doctor', 'break_glass:use'),
+    ('admin', 'break_glass:review')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,8 @@
+ALTER TABLE consent_requests ALTER COLUMN data_scope TYPE VARCHAR(255);
+
+DELETE FROM role_permissions WHERE permission = 'service_accounts:manage';
+DELETE FROM permissions WHERE name = 'service_accounts:manage';
+
+DROP TABLE IF EXISTS api_key_usage CASCADE;
+DROP TABLE IF EXISTS api_keys CASCADE;
+DROP TABLE IF EXISTS service_accounts CASCADE;
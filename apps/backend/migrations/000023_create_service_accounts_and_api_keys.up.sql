@@ -0,0 +1,53 @@
+-- Akun layanan untuk integrasi sistem rumah sakit (SIMRS, LIS), dimiliki oleh fasilitas.
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    facility_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_service_account_facility FOREIGN KEY(facility_id) REFERENCES facilities(id) ON DELETE CASCADE,
+    CONSTRAINT fk_service_account_created_by FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+-- API key hanya disimpan dalam bentuk hash; prefix disimpan untuk identifikasi di UI dan log.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    service_account_id UUID NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    rate_limit_per_minute INT NOT NULL DEFAULT 60,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_api_key_service_account FOREIGN KEY(service_account_id) REFERENCES service_accounts(id) ON DELETE CASCADE,
+    CONSTRAINT fk_api_key_created_by FOREIGN KEY(created_by) REFERENCES users(id),
+    CHECK (rate_limit_per_minute > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_service_account_id ON api_keys(service_account_id);
+
+-- Penghitung pemakaian per menit untuk rate limit (bersama untuk semua instance backend).
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    window_start TIMESTAMPTZ NOT NULL,
+    request_count INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, window_start)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:manage', 'Mengelola akun layanan dan API key')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'service_accounts:manage')
+ON CONFLICT DO NOTHING;
+
+-- Cakupan izin yang ditandatangani pasien, termasuk izin untuk sistem fasilitas
+-- (facility_systems), bisa lebih panjang dari 255 karakter.
+ALTER TABLE consent_requests ALTER COLUMN data_scope TYPE TEXT;
@@ -0,0 +1,18 @@
+DROP TRIGGER IF EXISTS trg_medical_records_append_only ON medical_records;
+DROP FUNCTION IF EXISTS protect_medical_record_version();
+
+-- Versi lama dibuang; hanya versi terbaru setiap rekam medis yang dipertahankan.
+UPDATE medical_records SET previous_version_id = NULL;
+DELETE FROM medical_records WHERE superseded_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_medical_records_patient_current;
+ALTER TABLE medical_records DROP CONSTRAINT IF EXISTS uq_medical_records_group_version;
+ALTER TABLE medical_records
+    DROP COLUMN IF EXISTS tx_hash,
+    DROP COLUMN IF EXISTS data_hash,
+    DROP COLUMN IF EXISTS author_id,
+    DROP COLUMN IF EXISTS amendment_reason,
+    DROP COLUMN IF EXISTS superseded_at,
+    DROP COLUMN IF EXISTS previous_version_id,
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS record_group_id;
@@ -0,0 +1,42 @@
+-- Amandemen rekam medis bersifat append-only: setiap koreksi menjadi versi baru
+-- dalam satu record_group_id, versi lama ditandai superseded_at dan tidak pernah diubah isinya.
+ALTER TABLE medical_records
+    ADD COLUMN record_group_id UUID,
+    ADD COLUMN version INT NOT NULL DEFAULT 1,
+    ADD COLUMN previous_version_id UUID REFERENCES medical_records(id),
+    ADD COLUMN superseded_at TIMESTAMPTZ,
+    ADD COLUMN amendment_reason TEXT,        -- terenkripsi, sama seperti diagnosis
+    ADD COLUMN author_id UUID,               -- ID dokter atau akun layanan penulis versi ini
+    ADD COLUMN data_hash VARCHAR(64),        -- hash yang dicatat ke blockchain
+    ADD COLUMN tx_hash VARCHAR(66);
+
+UPDATE medical_records SET record_group_id = id WHERE record_group_id IS NULL;
+ALTER TABLE medical_records ALTER COLUMN record_group_id SET NOT NULL;
+
+ALTER TABLE medical_records ADD CONSTRAINT uq_medical_records_group_version UNIQUE (record_group_id, version);
+CREATE INDEX IF NOT EXISTS idx_medical_records_patient_current ON medical_records(patient_id) WHERE superseded_at IS NULL;
+
+-- Versi rekam medis bersifat append-only: setelah ditulis, isinya tidak dapat
+-- diubah atau dihapus, termasuk lewat penghapusan akun pasien (ON DELETE CASCADE).
+-- Yang masih boleh diisi hanyalah penanda berikut:
+--   superseded_at      sekali, saat versi digantikan amandemen
+--   data_hash, tx_hash sekali, saat versi dicatat ke blockchain
+CREATE OR REPLACE FUNCTION protect_medical_record_version() RETURNS trigger AS $$
+DECLARE
+    mutable_columns TEXT[] := ARRAY['superseded_at', 'data_hash', 'tx_hash'];
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be deleted', OLD.id;
+    END IF;
+    IF to_jsonb(NEW) - mutable_columns IS DISTINCT FROM to_jsonb(OLD) - mutable_columns
+        OR (OLD.superseded_at IS NOT NULL AND NEW.superseded_at IS DISTINCT FROM OLD.superseded_at)
+        OR (OLD.data_hash IS NOT NULL AND (NEW.data_hash IS DISTINCT FROM OLD.data_hash OR NEW.tx_hash IS DISTINCT FROM OLD.tx_hash)) THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be modified', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_medical_records_append_only
+    BEFORE UPDATE OR DELETE ON medical_records
+    FOR EACH ROW EXECUTE FUNCTION protect_medical_record_version();
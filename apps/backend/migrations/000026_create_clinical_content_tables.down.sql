@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS trg_record_procedures_append_only ON record_procedures;
+DROP TRIGGER IF EXISTS trg_record_allergies_append_only ON record_allergies;
+DROP TRIGGER IF EXISTS trg_record_medications_append_only ON record_medications;
+DROP TRIGGER IF EXISTS trg_record_diagnoses_append_only ON record_diagnoses;
+DROP TRIGGER IF EXISTS trg_record_vitals_append_only ON record_vitals;
+DROP FUNCTION IF EXISTS protect_record_content();
+
+DROP TABLE IF EXISTS record_procedures;
+DROP TABLE IF EXISTS record_allergies;
+DROP TABLE IF EXISTS record_medications;
+DROP TABLE IF EXISTS record_diagnoses;
+DROP TABLE IF EXISTS record_vitals;
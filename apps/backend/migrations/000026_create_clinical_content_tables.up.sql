@@ -0,0 +1,79 @@
+-- Isi klinis terstruktur dari satu versi rekam medis. Kolom teks bebas dan kode
+-- disimpan terenkripsi (crypto.Encrypt); kolom enumerasi disimpan apa adanya.
+-- position menjaga urutan entri agar hash rekam medis dapat dihitung ulang.
+CREATE TABLE IF NOT EXISTS record_vitals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    vital_type VARCHAR(32) NOT NULL CHECK (vital_type IN ('blood_pressure', 'heart_rate', 'respiratory_rate', 'temperature', 'oxygen_saturation', 'weight', 'height')),
+    value TEXT NOT NULL,            -- terenkripsi
+    unit VARCHAR(16) NOT NULL,
+    measured_at TIMESTAMPTZ,
+    UNIQUE (record_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS record_diagnoses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    code TEXT NOT NULL,             -- kode ICD-10, terenkripsi
+    description TEXT NOT NULL,      -- terenkripsi
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (record_id, position)
+);
+-- Satu rekam medis hanya boleh memiliki satu diagnosis utama.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_record_diagnoses_primary ON record_diagnoses(record_id) WHERE is_primary;
+
+CREATE TABLE IF NOT EXISTS record_medications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    name TEXT NOT NULL,             -- terenkripsi
+    dose TEXT NOT NULL,             -- terenkripsi
+    route VARCHAR(16) NOT NULL CHECK (route IN ('oral', 'sublingual', 'topical', 'inhalation', 'rectal', 'iv', 'im', 'sc', 'other')),
+    frequency TEXT NOT NULL,        -- terenkripsi
+    duration TEXT NOT NULL,         -- terenkripsi
+    UNIQUE (record_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS record_allergies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    substance TEXT NOT NULL,        -- terenkripsi
+    reaction TEXT NOT NULL,         -- terenkripsi
+    severity VARCHAR(16) NOT NULL CHECK (severity IN ('mild', 'moderate', 'severe')),
+    UNIQUE (record_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS record_procedures (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    name TEXT NOT NULL,             -- terenkripsi
+    code TEXT NOT NULL,             -- kode tindakan (opsional), terenkripsi
+    notes TEXT NOT NULL,            -- terenkripsi
+    performed_at TIMESTAMPTZ,
+    UNIQUE (record_id, position)
+);
+
+-- Isi klinis terstruktur ikut di-hash bersama versinya, jadi juga tidak boleh berubah.
+CREATE OR REPLACE FUNCTION protect_record_content() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR to_jsonb(NEW) IS DISTINCT FROM to_jsonb(OLD) THEN
+        RAISE EXCEPTION '% of medical record % is append-only', TG_TABLE_NAME, OLD.record_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_record_vitals_append_only BEFORE UPDATE OR DELETE ON record_vitals
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+CREATE TRIGGER trg_record_diagnoses_append_only BEFORE UPDATE OR DELETE ON record_diagnoses
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+CREATE TRIGGER trg_record_medications_append_only BEFORE UPDATE OR DELETE ON record_medications
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+CREATE TRIGGER trg_record_allergies_append_only BEFORE UPDATE OR DELETE ON record_allergies
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+CREATE TRIGGER trg_record_procedures_append_only BEFORE UPDATE OR DELETE ON record_procedures
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
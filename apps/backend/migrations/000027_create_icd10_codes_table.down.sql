@@ -0,0 +1,3 @@
+ALTER TABLE record_diagnoses DROP COLUMN IF EXISTS uncatalogued;
+
+DROP TABLE IF EXISTS icd10_codes;
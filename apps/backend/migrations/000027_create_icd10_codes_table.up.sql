@@ -0,0 +1,17 @@
+-- Katalog ICD-10 diisi dari berkas bawaan (internal/terminology/icd10.csv)
+-- setiap kali server dijalankan.
+CREATE TABLE IF NOT EXISTS icd10_codes (
+    code VARCHAR(10) PRIMARY KEY,
+    name_en TEXT NOT NULL,
+    name_id TEXT NOT NULL,
+    -- Konfigurasi 'simple' karena nama berbahasa Inggris dan Indonesia dicari bersamaan.
+    search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', code || ' ' || name_en || ' ' || name_id)) STORED,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_icd10_codes_search ON icd10_codes USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_icd10_codes_code_prefix ON icd10_codes (code text_pattern_ops);
+
+-- Kode ICD-10 yang formatnya valid tetapi tidak ada di katalog bawaan tetap
+-- diterima dan ditandai, karena katalog hanya memuat sebagian ICD-10.
+ALTER TABLE record_diagnoses ADD COLUMN uncatalogued BOOLEAN NOT NULL DEFAULT FALSE;
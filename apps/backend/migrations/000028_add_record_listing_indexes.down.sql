@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_medical_records_patient_listing;
+CREATE INDEX IF NOT EXISTS idx_medical_records_patient_current ON medical_records(patient_id) WHERE superseded_at IS NULL;
+
+DROP INDEX IF EXISTS idx_record_diagnoses_code_index;
+ALTER TABLE record_diagnoses DROP COLUMN IF EXISTS code_index;
@@ -0,0 +1,8 @@
+-- Indeks buta (HMAC) kode ICD-10 agar daftar rekam medis dapat difilter per
+-- diagnosis tanpa mendekripsi kolom code.
+ALTER TABLE record_diagnoses ADD COLUMN code_index VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_record_diagnoses_code_index ON record_diagnoses(code_index, record_id);
+
+-- Paginasi berbasis cursor mengurutkan per (created_at, id).
+DROP INDEX IF EXISTS idx_medical_records_patient_current;
+CREATE INDEX IF NOT EXISTS idx_medical_records_patient_listing ON medical_records(patient_id, created_at, id) WHERE superseded_at IS NULL;
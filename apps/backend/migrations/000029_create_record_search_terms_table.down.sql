@@ -0,0 +1,27 @@
+CREATE OR REPLACE FUNCTION protect_record_content() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR to_jsonb(NEW) IS DISTINCT FROM to_jsonb(OLD) THEN
+        RAISE EXCEPTION '% of medical record % is append-only', TG_TABLE_NAME, OLD.record_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION protect_medical_record_version() RETURNS trigger AS $$
+DECLARE
+    mutable_columns TEXT[] := ARRAY['superseded_at', 'data_hash', 'tx_hash'];
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be deleted', OLD.id;
+    END IF;
+    IF to_jsonb(NEW) - mutable_columns IS DISTINCT FROM to_jsonb(OLD) - mutable_columns
+        OR (OLD.superseded_at IS NOT NULL AND NEW.superseded_at IS DISTINCT FROM OLD.superseded_at)
+        OR (OLD.data_hash IS NOT NULL AND (NEW.data_hash IS DISTINCT FROM OLD.data_hash OR NEW.tx_hash IS DISTINCT FROM OLD.tx_hash)) THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be modified', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE medical_records DROP COLUMN IF EXISTS search_indexed_at;
+DROP TABLE IF EXISTS record_search_terms;
@@ -0,0 +1,39 @@
+-- Indeks buta (HMAC) dari kata-kata pada diagnosis, catatan dan isi klinis
+-- terstruktur. Kata aslinya tidak pernah disimpan tanpa enkripsi.
+CREATE TABLE IF NOT EXISTS record_search_terms (
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    term_index VARCHAR(64) NOT NULL,
+    PRIMARY KEY (record_id, term_index)
+);
+CREATE INDEX IF NOT EXISTS idx_record_search_terms_term ON record_search_terms(term_index);
+
+-- NULL berarti rekam medis belum diindeks (dibuat sebelum fitur ini); diisi oleh cmd/reindex.
+ALTER TABLE medical_records ADD COLUMN search_indexed_at TIMESTAMPTZ;
+
+-- Pengindeks pencarian boleh mengisi search_indexed_at kapan saja pada versi
+-- rekam medis yang append-only.
+CREATE OR REPLACE FUNCTION protect_medical_record_version() RETURNS trigger AS $$
+DECLARE
+    mutable_columns TEXT[] := ARRAY['superseded_at', 'data_hash', 'tx_hash', 'search_indexed_at'];
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be deleted', OLD.id;
+    END IF;
+    IF to_jsonb(NEW) - mutable_columns IS DISTINCT FROM to_jsonb(OLD) - mutable_columns
+        OR (OLD.superseded_at IS NOT NULL AND NEW.superseded_at IS DISTINCT FROM OLD.superseded_at)
+        OR (OLD.data_hash IS NOT NULL AND (NEW.data_hash IS DISTINCT FROM OLD.data_hash OR NEW.tx_hash IS DISTINCT FROM OLD.tx_hash)) THEN
+        RAISE EXCEPTION 'medical record version % is append-only and cannot be modified', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Hanya code_index (blind index diagnosis) yang boleh diisi ulang oleh pengindeks.
+CREATE OR REPLACE FUNCTION protect_record_content() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR to_jsonb(NEW) - 'code_index' IS DISTINCT FROM to_jsonb(OLD) - 'code_index' THEN
+        RAISE EXCEPTION '% of medical record % is append-only', TG_TABLE_NAME, OLD.record_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
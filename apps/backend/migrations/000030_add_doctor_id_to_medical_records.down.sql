@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_medical_records_doctor_listing;
+ALTER TABLE medical_records DROP COLUMN IF EXISTS doctor_id;
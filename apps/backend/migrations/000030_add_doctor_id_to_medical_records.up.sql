@@ -0,0 +1,31 @@
+-- doctor_name tetap disimpan sebagai nama saat rekam medis ditulis (ikut di-hash
+-- ke blockchain); doctor_id menautkan ke akun dokter untuk profil terkini.
+-- Rekam medis dari akun layanan tidak memiliki doctor_id.
+ALTER TABLE medical_records ADD COLUMN doctor_id UUID REFERENCES users(id);
+
+-- Pengisian doctor_id pada versi yang sudah ada bukan perubahan isi rekam medis.
+ALTER TABLE medical_records DISABLE TRIGGER trg_medical_records_append_only;
+
+-- 1. Versi yang penulisnya (author_id) adalah akun pengguna.
+UPDATE medical_records m
+SET doctor_id = m.author_id
+FROM users u
+WHERE u.id = m.author_id AND m.doctor_id IS NULL;
+
+-- 2. Rekam medis lama tanpa author_id: cocokkan "dr. <nama>" hanya jika tepat
+--    satu tenaga kesehatan memiliki nama tersebut. Nama ganda dibiarkan kosong.
+UPDATE medical_records m
+SET doctor_id = match.id
+FROM (
+    SELECT 'dr. ' || u.name AS doctor_name, (array_agg(u.id))[1] AS id
+    FROM users u
+    JOIN roles r ON r.name = u.role
+    WHERE r.clinical_staff
+    GROUP BY u.name
+    HAVING COUNT(*) = 1
+) match
+WHERE m.doctor_id IS NULL AND m.doctor_name = match.doctor_name;
+
+ALTER TABLE medical_records ENABLE TRIGGER trg_medical_records_append_only;
+
+CREATE INDEX IF NOT EXISTS idx_medical_records_doctor_listing ON medical_records(doctor_id, created_at, id) WHERE superseded_at IS NULL;
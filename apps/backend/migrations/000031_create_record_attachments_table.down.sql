@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS uploaded_files;
+DROP TABLE IF EXISTS record_attachments;
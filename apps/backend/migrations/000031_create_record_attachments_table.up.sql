@@ -0,0 +1,38 @@
+-- Berkas lampiran dari satu versi rekam medis (hasil lab, gambar, dsb.). Isi
+-- berkas disimpan di IPFS; tabel ini mencatat metadata dan hash integritasnya.
+-- Nama berkas disimpan terenkripsi (crypto.Encrypt) karena dapat memuat
+-- informasi klinis. Kolom attachment_cid pada medical_records tetap dipakai
+-- untuk lampiran tunggal dari rekam medis lama.
+CREATE TABLE IF NOT EXISTS record_attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    record_id UUID NOT NULL REFERENCES medical_records(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    cid TEXT NOT NULL,
+    filename TEXT NOT NULL,         -- terenkripsi
+    mime_type VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256 CHAR(64) NOT NULL CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+    uploaded_by UUID NOT NULL,      -- ID pengguna atau akun layanan pengunggah
+    uploaded_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (record_id, position),
+    UNIQUE (record_id, cid)
+);
+
+-- Lampiran ikut di-hash ke blockchain bersama versinya, sehingga tidak boleh
+-- diubah atau dihapus setelah ditulis.
+CREATE TRIGGER trg_record_attachments_append_only BEFORE UPDATE OR DELETE ON record_attachments
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+
+-- Metadata berkas yang diunggah ke IPFS melalui POST /upload. Ukuran, tipe dan
+-- hash SHA-256 dihitung oleh server saat berkas diterima; lampiran rekam medis
+-- dan kunjungan mengambil nilainya dari sini, bukan dari klien. Berkas yang
+-- sama dapat diunggah oleh beberapa pengguna, masing-masing satu baris.
+CREATE TABLE IF NOT EXISTS uploaded_files (
+    cid TEXT NOT NULL,
+    uploaded_by UUID NOT NULL,      -- ID pengguna atau akun layanan pengunggah
+    mime_type VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256 CHAR(64) NOT NULL CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (cid, uploaded_by)
+);
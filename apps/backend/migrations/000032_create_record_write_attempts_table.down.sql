@@ -0,0 +1 @@
+DROP TABLE IF EXISTS record_write_attempts;
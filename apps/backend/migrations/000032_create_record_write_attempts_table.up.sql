@@ -0,0 +1,19 @@
+-- Setiap percobaan menulis rekam medis (berhasil, ditolak, tidak valid atau
+-- gagal) dicatat agar tampil di log audit pasien. actor_id dapat berupa ID
+-- pengguna atau akun layanan. Rekam medis yang sudah tersimpan tetapi gagal
+-- dicatat ke blockchain berstatus 'unanchored', bukan 'failed' yang berarti
+-- tidak ada yang tersimpan.
+CREATE TABLE IF NOT EXISTS record_write_attempts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    patient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id UUID NOT NULL,
+    actor_name VARCHAR(255) NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('create', 'amend')),
+    record_id UUID REFERENCES medical_records(id) ON DELETE SET NULL,
+    outcome VARCHAR(16) NOT NULL CHECK (outcome IN ('success', 'denied', 'rejected', 'failed', 'unanchored')),
+    detail TEXT,                     -- pesan penolakan atau kesalahan
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_write_attempts_patient ON record_write_attempts(patient_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_record_write_attempts_record ON record_write_attempts(record_id) WHERE record_id IS NOT NULL;
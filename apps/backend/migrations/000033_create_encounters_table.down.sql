@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS encounter_participants;
+
+-- Lampiran kunjungan dihapus di antara penggantian trigger append-only-nya.
+DROP TRIGGER IF EXISTS trg_record_attachments_append_only ON record_attachments;
+DELETE FROM record_attachments WHERE record_id IS NULL;
+ALTER TABLE record_attachments
+    DROP CONSTRAINT IF EXISTS uq_record_attachments_encounter_cid,
+    DROP CONSTRAINT IF EXISTS chk_record_attachments_anchor,
+    DROP CONSTRAINT IF EXISTS chk_record_attachments_owner,
+    DROP COLUMN IF EXISTS tx_hash,
+    DROP COLUMN IF EXISTS data_hash,
+    DROP COLUMN IF EXISTS encounter_id,
+    ALTER COLUMN record_id SET NOT NULL;
+CREATE TRIGGER trg_record_attachments_append_only BEFORE UPDATE OR DELETE ON record_attachments
+    FOR EACH ROW EXECUTE FUNCTION protect_record_content();
+
+DROP TABLE IF EXISTS prescription_items;
+DROP TABLE IF EXISTS prescriptions;
+DROP FUNCTION IF EXISTS protect_prescription_item();
+DROP FUNCTION IF EXISTS protect_anchored_content();
+
+DROP INDEX IF EXISTS idx_medical_records_encounter;
+ALTER TABLE medical_records DROP COLUMN IF EXISTS encounter_id;
+
+DROP TABLE IF EXISTS encounters;
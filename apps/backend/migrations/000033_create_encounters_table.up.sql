@@ -0,0 +1,114 @@
+-- Kunjungan (encounter): wadah data klinis dari satu rawat jalan, rawat inap
+-- atau telekonsultasi. Rekam medis, resep dan lampiran dapat ditautkan ke
+-- kunjungan. Alasan kunjungan disimpan terenkripsi (crypto.Encrypt).
+CREATE TABLE IF NOT EXISTS encounters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    patient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    facility_id UUID NOT NULL REFERENCES facilities(id),
+    attending_doctor_id UUID NOT NULL REFERENCES users(id),
+    encounter_type VARCHAR(16) NOT NULL CHECK (encounter_type IN ('outpatient', 'inpatient', 'teleconsult')),
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    reason TEXT,                    -- terenkripsi
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    opened_by UUID NOT NULL,        -- ID pengguna atau akun layanan
+    closed_by UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((status = 'closed') = (ended_at IS NOT NULL)),
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_encounters_patient_timeline ON encounters(patient_id, started_at, id);
+
+-- Versi amandemen mewarisi kunjungan dari versi sebelumnya.
+ALTER TABLE medical_records ADD COLUMN encounter_id UUID REFERENCES encounters(id);
+CREATE INDEX IF NOT EXISTS idx_medical_records_encounter ON medical_records(encounter_id) WHERE superseded_at IS NULL;
+
+-- Resep dari satu kunjungan. Kolom teks item resep terenkripsi seperti
+-- record_medications. Resep di-hash dan dicatat ke blockchain seperti versi
+-- rekam medis.
+CREATE TABLE IF NOT EXISTS prescriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    encounter_id UUID NOT NULL REFERENCES encounters(id) ON DELETE CASCADE,
+    patient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    prescriber_id UUID NOT NULL,    -- ID dokter atau akun layanan
+    prescriber_name VARCHAR(255) NOT NULL,
+    notes TEXT NOT NULL,            -- terenkripsi
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    data_hash VARCHAR(64),          -- hash yang dicatat ke blockchain
+    tx_hash VARCHAR(66)
+);
+
+CREATE INDEX IF NOT EXISTS idx_prescriptions_encounter ON prescriptions(encounter_id);
+CREATE INDEX IF NOT EXISTS idx_prescriptions_patient ON prescriptions(patient_id, created_at);
+
+CREATE TABLE IF NOT EXISTS prescription_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    prescription_id UUID NOT NULL REFERENCES prescriptions(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    name TEXT NOT NULL,             -- terenkripsi
+    dose TEXT NOT NULL,             -- terenkripsi
+    route VARCHAR(16) NOT NULL CHECK (route IN ('oral', 'sublingual', 'topical', 'inhalation', 'rectal', 'iv', 'im', 'sc', 'other')),
+    frequency TEXT NOT NULL,        -- terenkripsi
+    duration TEXT NOT NULL,         -- terenkripsi
+    UNIQUE (prescription_id, position)
+);
+
+-- Lampiran dapat ditautkan langsung ke kunjungan (mis. hasil lab sebelum
+-- rekam medis ditulis); lampiran rekam medis tetap memakai record_id.
+-- Lampiran rekam medis sudah ikut hash rekam medisnya, jadi data_hash hanya
+-- diisi untuk lampiran yang ditautkan ke kunjungan.
+ALTER TABLE record_attachments
+    ALTER COLUMN record_id DROP NOT NULL,
+    ADD COLUMN encounter_id UUID REFERENCES encounters(id) ON DELETE CASCADE,
+    ADD COLUMN data_hash VARCHAR(64),        -- sama untuk semua lampiran yang ditambahkan bersamaan
+    ADD COLUMN tx_hash VARCHAR(66),
+    ADD CONSTRAINT chk_record_attachments_owner CHECK ((record_id IS NULL) <> (encounter_id IS NULL)),
+    ADD CONSTRAINT chk_record_attachments_anchor CHECK (record_id IS NULL OR data_hash IS NULL),
+    ADD CONSTRAINT uq_record_attachments_encounter_cid UNIQUE (encounter_id, cid);
+
+-- Resep dan lampiran bersifat append-only seperti versi rekam medis: yang
+-- boleh diisi hanyalah data_hash dan tx_hash, sekali, saat dicatat ke blockchain.
+CREATE OR REPLACE FUNCTION protect_anchored_content() RETURNS trigger AS $$
+DECLARE
+    anchor_columns TEXT[] := ARRAY['data_hash', 'tx_hash'];
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        RAISE EXCEPTION '% % is append-only and cannot be deleted', TG_TABLE_NAME, OLD.id;
+    END IF;
+    IF to_jsonb(NEW) - anchor_columns IS DISTINCT FROM to_jsonb(OLD) - anchor_columns
+        OR (OLD.data_hash IS NOT NULL AND (NEW.data_hash IS DISTINCT FROM OLD.data_hash OR NEW.tx_hash IS DISTINCT FROM OLD.tx_hash)) THEN
+        RAISE EXCEPTION '% % is append-only and cannot be modified', TG_TABLE_NAME, OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_prescriptions_append_only BEFORE UPDATE OR DELETE ON prescriptions
+    FOR EACH ROW EXECUTE FUNCTION protect_anchored_content();
+
+-- Menggantikan trigger lampiran yang hanya mengenal lampiran rekam medis.
+DROP TRIGGER IF EXISTS trg_record_attachments_append_only ON record_attachments;
+CREATE TRIGGER trg_record_attachments_append_only BEFORE UPDATE OR DELETE ON record_attachments
+    FOR EACH ROW EXECUTE FUNCTION protect_anchored_content();
+
+-- Item resep ikut di-hash, jadi tidak boleh berubah sama sekali.
+CREATE OR REPLACE FUNCTION protect_prescription_item() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'items of prescription % are append-only', OLD.prescription_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_prescription_items_append_only BEFORE UPDATE OR DELETE ON prescription_items
+    FOR EACH ROW EXECUTE FUNCTION protect_prescription_item();
+
+-- Tenaga kesehatan yang ditambahkan dokter penanggung jawab ke kunjungan.
+-- Bersama dokter penanggung jawab dan pembuka kunjungan, hanya merekalah yang
+-- dapat menambah data ke kunjungan tanpa izin tulis dari pasien.
+CREATE TABLE IF NOT EXISTS encounter_participants (
+    encounter_id UUID NOT NULL REFERENCES encounters(id) ON DELETE CASCADE,
+    participant_id UUID NOT NULL REFERENCES users(id),
+    added_by UUID NOT NULL REFERENCES users(id),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (encounter_id, participant_id)
+);
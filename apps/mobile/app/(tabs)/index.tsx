@@ -45,7 +45,7 @@ export default function DashboardScreen() {
           // Ambil data rekam medis dan permintaan izin secara bersamaan
           const [userData, recordsResponse, consentsResponse] = await Promise.all([
               fetch(`${API_URL}/users/me`, { headers: { 'Authorization': `Bearer ${token}` } }),
-              fetch(`${API_URL}/records`, { headers: { 'Authorization': `Bearer ${token}` } }),
+              fetch(`${API_URL}/records?limit=1`, { headers: { 'Authorization': `Bearer ${token}` } }),
               fetch(`${API_URL}/consent/requests/me`, { headers: { 'Authorization': `Bearer ${token}` } })
           ]);
 
@@ -58,7 +58,7 @@ export default function DashboardScreen() {
           const consentsData = await consentsResponse.json();
 
           setUserName(user.name || 'Pengguna');
-          setRecords(recordsData || []);
+          setRecords(recordsData.items || []);
           // Saring hanya permintaan yang statusnya 'pending'
           setPendingConsents((consentsData || []).filter((req: ConsentRequest) => req.status === 'pending'));
 
@@ -5,9 +5,9 @@ import {
 } from 'react-native';
 import AsyncStorage from '@react-native-async-storage/async-storage';
 import { useFocusEffect, Stack } from 'expo-router';
-import { ethers } from 'ethers';
 import { Feather } from '@expo/vector-icons';
 import { Image } from 'react-native';
+import { FULL_READ_SCOPE, describeScope, signConsentAction, submitConsentAction } from '../../components/consentSigning';
 
 // Pastikan URL sesuai backend lo
 const API_URL = 'https://5a121f6a66ba.ngrok-free.app';
@@ -53,7 +53,8 @@ export default function IzinScreen() {
                 const updated: Record<string, number> = {};
                 for (const [id, timeLeft] of Object.entries(prev)) {
                     if (timeLeft > 0) updated[id] = timeLeft - 1;
-                    else handleRevoke(id); // otomatis revoke kalau 0
+                    // Izin 24 jam berakhir sendiri di server; cukup muat ulang daftar tanpa tanda tangan.
+                    else setTimeout(fetchRequests, 0);
                 }
                 return updated;
             });
@@ -80,7 +81,7 @@ export default function IzinScreen() {
         const combined = consentData.map(req => ({
             ...req,
             clinic_name: req.clinic_name || '—',
-            access_scope: req.data_scope || 'Rekam Medis dan Riwayat Kunjungan',
+            access_scope: describeScope(req.data_scope),
         }));
 
         setPendingRequests(combined.filter(r => r.status === 'pending'));
@@ -111,8 +112,8 @@ export default function IzinScreen() {
     }, []));
 
     // ✅ Approve request
-    const handleApprove = async (requestId: string, isTemporary: boolean = true) => {
-        setLoadingRequestId(requestId);
+    const handleApprove = async (req: ConsentRequest, isTemporary: boolean = true) => {
+        setLoadingRequestId(req.id);
         const token = await AsyncStorage.getItem('token');
         const privateKeyHex = await AsyncStorage.getItem('private_key');
 
@@ -123,24 +124,13 @@ export default function IzinScreen() {
         }
 
         try {
-            const wallet = new ethers.Wallet(privateKeyHex);
             const duration = isTemporary ? '24h' : 'permanent';
-            const messageToSign = requestId + '_' + duration;
-            const signature = await wallet.signMessage(messageToSign);
-
-            const response = await fetch(`${API_URL}/consent/sign/${requestId}`, {
-                method: 'POST',
-                headers: { 
-                    'Authorization': `Bearer ${token}`,
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({ signature, duration }),
-            });
-
-            const data = await response.json();
-            if (!response.ok) throw new Error(data.message || 'Gagal menyetujui permintaan.');
+            // Cakupan yang diminta dokter dipakai bila ada; selain itu akses baca penuh.
+            const dataScope = req.data_scope || FULL_READ_SCOPE;
+            const body = await signConsentAction(API_URL, token, privateKeyHex, req, 'grant', { dataScope, duration });
+            const message = await submitConsentAction(API_URL, token, 'sign', req.id, body, 'Gagal menyetujui permintaan.');
 
-            Alert.alert('Berhasil ✅', data.message || 'Permintaan berhasil disetujui.');
+            Alert.alert('Berhasil ✅', message || 'Permintaan berhasil disetujui.');
 
             fetchRequests();
         } catch (err) {
@@ -152,19 +142,19 @@ export default function IzinScreen() {
 
 
     // ✅ Deny request
-    const handleDeny = async (requestId: string) => {
-        setLoadingRequestId(requestId);
+    const handleDeny = async (req: ConsentRequest) => {
+        setLoadingRequestId(req.id);
         const token = await AsyncStorage.getItem('token');
-        if (!token) return Alert.alert('Error', 'Token tidak ditemukan.');
+        const privateKeyHex = await AsyncStorage.getItem('private_key');
+        if (!token || !privateKeyHex) {
+            setLoadingRequestId(null);
+            return Alert.alert('Error', 'Token atau private key tidak ditemukan.');
+        }
 
         try {
-        const response = await fetch(`${API_URL}/consent/deny/${requestId}`, {
-            method: 'POST',
-            headers: { Authorization: `Bearer ${token}` },
-        });
-        const data = await response.json();
-        if (!response.ok) throw new Error(data.message || 'Gagal menolak permintaan.');
-        Alert.alert('Ditolak 🚫', data.message || 'Permintaan berhasil ditolak.');
+        const body = await signConsentAction(API_URL, token, privateKeyHex, req, 'deny');
+        const message = await submitConsentAction(API_URL, token, 'deny', req.id, body, 'Gagal menolak permintaan.');
+        Alert.alert('Ditolak 🚫', message || 'Permintaan berhasil ditolak.');
         fetchRequests();
         } catch (err) {
         if (err instanceof Error) Alert.alert('Error', err.message);
@@ -174,19 +164,19 @@ export default function IzinScreen() {
     };
 
     // ✅ Revoke izin aktif
-    const handleRevoke = async (requestId: string) => {
-        setLoadingRequestId(requestId);
+    const handleRevoke = async (req: ConsentRequest) => {
+        setLoadingRequestId(req.id);
         const token = await AsyncStorage.getItem('token');
-        if (!token) return Alert.alert('Error', 'Token tidak ditemukan.');
+        const privateKeyHex = await AsyncStorage.getItem('private_key');
+        if (!token || !privateKeyHex) {
+            setLoadingRequestId(null);
+            return Alert.alert('Error', 'Token atau private key tidak ditemukan.');
+        }
 
         try {
-        const response = await fetch(`${API_URL}/consent/revoke/${requestId}`, {
-            method: 'POST',
-            headers: { Authorization: `Bearer ${token}` },
-        });
-        const data = await response.json();
-        if (!response.ok) throw new Error(data.message || 'Gagal mencabut izin.');
-        Alert.alert('Dicabut 🔒', data.message || 'Izin berhasil dicabut.');
+        const body = await signConsentAction(API_URL, token, privateKeyHex, req, 'revoke');
+        const message = await submitConsentAction(API_URL, token, 'revoke', req.id, body, 'Gagal mencabut izin.');
+        Alert.alert('Dicabut 🔒', message || 'Izin berhasil dicabut.');
         fetchRequests();
         } catch (err) {
         if (err instanceof Error) Alert.alert('Error', err.message);
@@ -244,21 +234,21 @@ export default function IzinScreen() {
                 <View style={styles.buttonGroup}>
                     <TouchableOpacity 
                         style={styles.primaryButton} 
-                        onPress={() => handleApprove(req.id, true)}
+                        onPress={() => handleApprove(req, true)}
                     >
                         <Feather name="check" size={16} color="white" />
                         <Text style={styles.primaryButtonText}>Setujui 24 Jam</Text>
                     </TouchableOpacity>
                     <TouchableOpacity 
                         style={styles.secondaryButton} 
-                        onPress={() => handleApprove(req.id, false)}
+                        onPress={() => handleApprove(req, false)}
                     >
                         <Feather name="check-circle" size={16} color="#007AFF" />
                         <Text style={styles.secondaryButtonText}>Setujui Selamanya</Text>
                     </TouchableOpacity>
                     <TouchableOpacity 
                         style={styles.denyButton}
-                        onPress={() => handleDeny(req.id)}
+                        onPress={() => handleDeny(req)}
                     >
                         <Feather name="x-circle" size={16} color="#EF4444" />
                         <Text style={styles.denyButtonText}>Tolak</Text>
@@ -297,7 +287,7 @@ export default function IzinScreen() {
                     </View>
                     <TouchableOpacity 
                         style={styles.revokeButton}
-                        onPress={() => handleRevoke(req.id)}
+                        onPress={() => handleRevoke(req)}
                     >
                         <Feather name="lock" size={14} color="#EF4444" />
                         <Text style={styles.revokeText}>Cabut Izin</Text>
@@ -17,6 +17,9 @@ import { Feather } from '@expo/vector-icons';
 // PASTIKAN URL NGROK INI SESUAI DENGAN YANG ADA DI TERMINAL LO
 const API_URL = 'https://5a121f6a66ba.ngrok-free.app'; // <-- GANTI DENGAN URL NGROK-MU
 
+// Jumlah rekam medis per halaman; halaman berikutnya dimuat saat daftar digulir ke bawah.
+const PAGE_SIZE = 20;
+
 interface MedicalRecord {
     id: string;
     doctor_name: string;
@@ -60,6 +63,23 @@ export default function RiwayatScreen() {
     const [records, setRecords] = useState<MedicalRecord[]>([]);
     const [isLoading, setIsLoading] = useState(true);
     const [error, setError] = useState('');
+    const [nextCursor, setNextCursor] = useState<string | null>(null);
+    const [isLoadingMore, setIsLoadingMore] = useState(false);
+
+    // Server sudah mengurutkan dari yang terbaru; cursor melanjutkan urutan yang sama.
+    const fetchPage = async (token: string, cursor?: string) => {
+        const params = new URLSearchParams({ limit: String(PAGE_SIZE) });
+        if (cursor) params.set('cursor', cursor);
+        const response = await fetch(`${API_URL}/records?${params.toString()}`, {
+            headers: { 'Authorization': `Bearer ${token}` },
+        });
+        if (!response.ok) {
+             const errorData = await response.json();
+             throw new Error(errorData.message || 'Gagal mengambil data riwayat medis.');
+        }
+        const data = await response.json();
+        return { items: (data.items || []) as MedicalRecord[], nextCursor: (data.next_cursor as string | undefined) ?? null };
+    };
 
     const fetchRecords = async () => {
         setIsLoading(true);
@@ -71,18 +91,9 @@ export default function RiwayatScreen() {
             return;
         }
         try {
-            const response = await fetch(`${API_URL}/records`, {
-                headers: { 'Authorization': `Bearer ${token}` },
-            });
-            if (!response.ok) {
-                 const errorData = await response.json();
-                 throw new Error(errorData.message || 'Gagal mengambil data riwayat medis.');
-            }
-            const data = await response.json();
-            const sortedData = (data || []).sort((a: MedicalRecord, b: MedicalRecord) => 
-                new Date(b.created_at).getTime() - new Date(a.created_at).getTime()
-            );
-            setRecords(sortedData);
+            const page = await fetchPage(token);
+            setRecords(page.items);
+            setNextCursor(page.nextCursor);
         } catch (err) {
             if (err instanceof Error) setError(err.message);
             else setError('Terjadi kesalahan tidak diketahui.');
@@ -91,6 +102,22 @@ export default function RiwayatScreen() {
         }
     };
 
+    const loadMore = async () => {
+        if (!nextCursor || isLoadingMore) return;
+        const token = await AsyncStorage.getItem('token');
+        if (!token) return;
+        setIsLoadingMore(true);
+        try {
+            const page = await fetchPage(token, nextCursor);
+            setRecords((prev) => [...prev, ...page.items]);
+            setNextCursor(page.nextCursor);
+        } catch (err) {
+            if (err instanceof Error) setError(err.message);
+        } finally {
+            setIsLoadingMore(false);
+        }
+    };
+
     useFocusEffect(
         useCallback(() => {
             fetchRecords();
@@ -161,6 +188,9 @@ export default function RiwayatScreen() {
                 renderItem={renderItem}
                 keyExtractor={(item) => item.id}
                 ListEmptyComponent={<EmptyState />}
+                onEndReached={loadMore}
+                onEndReachedThreshold={0.5}
+                ListFooterComponent={isLoadingMore ? <ActivityIndicator style={{ marginVertical: 20 }} color="#007AFF" /> : null}
                 contentContainerStyle={{ paddingHorizontal: 20, paddingTop: 20 }}
                 showsVerticalScrollIndicator={false}
             />
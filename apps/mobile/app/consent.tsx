@@ -4,7 +4,7 @@ import React, { useEffect, useState } from 'react';
 import { View, Text, StyleSheet, FlatList, ActivityIndicator, Button, Alert } from 'react-native';
 import AsyncStorage from '@react-native-async-storage/async-storage';
 import { useFocusEffect } from 'expo-router';
-import { ethers } from 'ethers';
+import { FULL_READ_SCOPE, describeScope, signConsentAction, submitConsentAction } from '../components/consentSigning';
 
 // PASTIKAN URL NGROK INI SESUAI DENGAN YANG ADA DI TERMINAL LO
 const API_URL = 'https://5a121f6a66ba.ngrok-free.app'; // <-- GANTI DENGAN URL NGROK-MU
@@ -12,6 +12,8 @@ const API_URL = 'https://5a121f6a66ba.ngrok-free.app'; // <-- GANTI DENGAN URL N
 interface ConsentRequest {
   id: string;
   doctor_id: string;
+  patient_id: string;
+  data_scope?: string;
   status: 'pending' | 'granted' | 'revoked' | 'denied';
   created_at: string;
 }
@@ -50,7 +52,7 @@ export default function ConsentScreen() {
     }, [])
   );
 
-  const handleApprove = async (requestId: string) => {
+  const handleApprove = async (request: ConsentRequest) => {
     const token = await AsyncStorage.getItem('token');
     const privateKeyHex = await AsyncStorage.getItem('private_key');
 
@@ -60,34 +62,16 @@ export default function ConsentScreen() {
     }
     
     try {
-      const wallet = new ethers.Wallet(privateKeyHex);
-      const messageToSign = requestId;
-      const signature = await wallet.signMessage(messageToSign);
-
-      const response = await fetch(`${API_URL}/consent/sign/${requestId}`, {
-        method: 'POST',
-        headers: { 
-          'Authorization': `Bearer ${token}`,
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({ signature: signature })
-      });
-
-      // --- DEBUGGER DIMULAI DI SINI ---
-      if (!response.ok) {
-        // Coba baca respon error dari server sebagai teks
-        const errorText = await response.text();
-        throw new Error(`Server merespon dengan status ${response.status}: ${errorText}`);
-      }
-      
-      const data = await response.json();
-      Alert.alert('Sukses', data.message || 'Permintaan berhasil disetujui!');
+      // Layar ini hanya memberi izin 24 jam; izin permanen diatur dari tab Izin.
+      const dataScope = request.data_scope || FULL_READ_SCOPE;
+      const body = await signConsentAction(API_URL, token, privateKeyHex, request, 'grant', { dataScope, duration: '24h' });
+      const message = await submitConsentAction(API_URL, token, 'sign', request.id, body, 'Gagal menyetujui permintaan.');
+      Alert.alert('Sukses', message || 'Permintaan berhasil disetujui!');
       fetchRequests();
 
     } catch (err) {
       if (err instanceof Error) {
-        // Tampilkan pesan error yang lebih detail
-        Alert.alert('DEBUG: Terjadi Error', err.message);
+        Alert.alert('Terjadi Error', err.message);
       }
     }
   };
@@ -97,9 +81,10 @@ export default function ConsentScreen() {
       <Text style={styles.cardTitle}>Permintaan dari Dokter</Text>
       <Text style={styles.cardText}>ID: {item.doctor_id}</Text>
       <Text style={styles.cardText}>Status: <Text style={{fontWeight: 'bold'}}>{item.status}</Text></Text>
+      <Text style={styles.cardText}>Akses ke: {describeScope(item.data_scope)}</Text>
       {item.status === 'pending' && (
         <View style={{marginTop: 10}}>
-            <Button title="Setujui Akses" onPress={() => handleApprove(item.id)} />
+            <Button title="Setujui Akses" onPress={() => handleApprove(item)} />
         </View>
       )}
     </View>
@@ -0,0 +1,187 @@
+import { ethers } from 'ethers';
+
+export type ConsentAction = 'grant' | 'deny' | 'revoke';
+
+// Cakupan bawaan saat pasien menyetujui tanpa mempersempit akses.
+export const FULL_READ_SCOPE = '{"all":true}';
+
+const SCOPE_CATEGORY_LABELS: Record<string, string> = {
+    diagnoses: 'diagnosis',
+    notes: 'catatan klinis',
+    vitals: 'tanda vital',
+    medications: 'obat',
+    allergies: 'alergi',
+    procedures: 'tindakan',
+};
+
+const formatScopeDate = (value: string) => new Date(value).toLocaleDateString('id-ID');
+
+// Menjelaskan data_scope (objek JSON cakupan izin) dalam bahasa yang dipahami pasien.
+export function describeScope(dataScope?: string): string {
+    if (!dataScope) return 'Seluruh rekam medis (hanya membaca)';
+    let scope: {
+        all?: boolean;
+        categories?: string[];
+        from?: string;
+        to?: string;
+        record_ids?: string[];
+        attachments?: boolean;
+        write?: boolean;
+        facility_systems?: boolean;
+    };
+    try {
+        scope = JSON.parse(dataScope);
+    } catch {
+        // Label bebas dari izin lama berarti akses baca ke seluruh rekam medis.
+        return 'Seluruh rekam medis (hanya membaca)';
+    }
+
+    const parts: string[] = [];
+    if (scope.categories?.length) {
+        parts.push(scope.categories.map(c => SCOPE_CATEGORY_LABELS[c] || c).join(', '));
+    } else if (scope.record_ids?.length) {
+        parts.push(`${scope.record_ids.length} rekam medis tertentu`);
+    } else {
+        parts.push('Seluruh rekam medis');
+    }
+    if (scope.from && scope.to) parts.push(`dari ${formatScopeDate(scope.from)} s.d. ${formatScopeDate(scope.to)}`);
+    else if (scope.from) parts.push(`sejak ${formatScopeDate(scope.from)}`);
+    else if (scope.to) parts.push(`sampai ${formatScopeDate(scope.to)}`);
+    if (scope.attachments === false) parts.push('tanpa lampiran');
+    parts.push(scope.write ? 'termasuk menulis rekam medis baru' : 'hanya membaca');
+    if (scope.facility_systems) parts.push('juga untuk sistem fasilitas dokter');
+    return parts.join(', ');
+}
+
+export interface SignableConsentRequest {
+    id: string;
+    patient_id: string;
+    doctor_id: string;
+}
+
+interface PreparedConsentMessage {
+    message: string;
+    nonce: string;
+    data_scope: string;
+    expires_at: string | null;
+}
+
+interface ConsentMessageFields {
+    action: ConsentAction;
+    requestId: string;
+    patientId: string;
+    doctorId: string;
+    scope: string;
+    expiresAt: string | null;
+    nonce: string;
+}
+
+// Waktu kedaluwarsa ditulis dalam UTC dengan presisi detik, sama seperti backend.
+function formatExpiry(expiresAt: string | null): string {
+    if (!expiresAt) return 'never';
+    return new Date(expiresAt).toISOString().replace(/\.\d{3}Z$/, 'Z');
+}
+
+// Harus identik byte per byte dengan auth.ConsentMessage di backend.
+export function buildConsentMessage(fields: ConsentMessageFields): string {
+    return [
+        'RekamedChain consent',
+        `action: ${fields.action}`,
+        `request_id: ${fields.requestId}`,
+        `patient_id: ${fields.patientId}`,
+        `doctor_id: ${fields.doctorId}`,
+        `scope: ${fields.scope}`,
+        `expires_at: ${formatExpiry(fields.expiresAt)}`,
+        `nonce: ${fields.nonce}`,
+    ].join('\n');
+}
+
+async function readError(response: Response, fallback: string): Promise<string> {
+    const text = (await response.text()).trim();
+    try {
+        const data = JSON.parse(text);
+        return data.message || fallback;
+    } catch {
+        return text || fallback;
+    }
+}
+
+/**
+ * Menyiapkan body POST untuk /consent/sign, /consent/deny atau /consent/revoke.
+ * Nonce (dan masa berlaku izin 24 jam) diambil dari server, lalu pesan kanonik
+ * dibangun ulang di perangkat dari data permintaan dan ditandatangani dengan
+ * kunci privat pasien. Pesan dari server hanya dipakai sebagai pembanding.
+ */
+export async function signConsentAction(
+    apiUrl: string,
+    token: string,
+    privateKeyHex: string,
+    request: SignableConsentRequest,
+    action: ConsentAction,
+    grant?: { dataScope: string; duration: '24h' | 'permanent' },
+): Promise<Record<string, unknown>> {
+    const params = new URLSearchParams({ action });
+    if (action === 'grant') {
+        if (!grant) throw new Error('Cakupan dan durasi izin wajib diisi.');
+        params.set('data_scope', grant.dataScope);
+        params.set('duration', grant.duration);
+    }
+
+    const response = await fetch(`${apiUrl}/consent/requests/${request.id}/message?${params.toString()}`, {
+        headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!response.ok) throw new Error(await readError(response, 'Gagal menyiapkan pesan persetujuan.'));
+    const prepared: PreparedConsentMessage = await response.json();
+
+    if (action === 'grant' && prepared.data_scope !== grant?.dataScope) {
+        throw new Error('Cakupan izin dari server tidak sesuai dengan yang dipilih.');
+    }
+
+    const message = buildConsentMessage({
+        action,
+        requestId: request.id,
+        patientId: request.patient_id,
+        doctorId: request.doctor_id,
+        scope: prepared.data_scope,
+        expiresAt: prepared.expires_at,
+        nonce: prepared.nonce,
+    });
+    if (message !== prepared.message) {
+        throw new Error('Pesan persetujuan dari server tidak sesuai dengan permintaan ini.');
+    }
+
+    const signature = await new ethers.Wallet(privateKeyHex).signMessage(message);
+
+    if (action === 'grant') {
+        return {
+            duration: grant!.duration,
+            data_scope: prepared.data_scope,
+            expires_at: prepared.expires_at,
+            nonce: prepared.nonce,
+            signature,
+        };
+    }
+    return { nonce: prepared.nonce, signature };
+}
+
+// Mengirim aksi yang sudah ditandatangani dan mengembalikan pesan sukses dari server.
+export async function submitConsentAction(
+    apiUrl: string,
+    token: string,
+    path: 'sign' | 'deny' | 'revoke',
+    requestId: string,
+    body: Record<string, unknown>,
+    fallbackError: string,
+): Promise<string | undefined> {
+    const response = await fetch(`${apiUrl}/consent/${path}/${requestId}`, {
+        method: 'POST',
+        headers: {
+            Authorization: `Bearer ${token}`,
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+    });
+    if (!response.ok) throw new Error(await readError(response, fallbackError));
+    const data = await response.json();
+    return data.message;
+}
@@ -5,6 +5,7 @@ import { useParams } from 'next/navigation';
 import { Card, CardContent, CardDescription, CardFooter, CardHeader, CardTitle } from '@/components/ui/card';
 import { Button } from '@/components/ui/button';
 import Link from 'next/link';
+import { TREATMENT_SCOPE } from '@/lib/consent';
 
 interface MedicalRecord {
     id: string;
@@ -12,9 +13,18 @@ interface MedicalRecord {
     diagnosis: string;
     notes: string;
     attachment_cid: string;
+    attachments?: RecordAttachment[];
     created_at: string;
 }
 
+interface RecordAttachment {
+    cid: string;
+    filename: string;
+    mime_type: string;
+    size: number;
+    sha256: string;
+}
+
 interface UserProfile {
   id: string;
   name: string;
@@ -63,11 +73,40 @@ const LinkIcon = (props: React.SVGProps<SVGSVGElement>) => (
     </svg>
 );
 
+// Jumlah rekam medis per halaman; halaman berikutnya diambil lewat next_cursor.
+const PAGE_SIZE = 20;
+
+interface RecordPage {
+    items?: MedicalRecord[];
+    next_cursor?: string;
+    total: number;
+}
+
+// Mengambil satu halaman rekam medis pasien, mulai dari cursor bila ada.
+async function fetchRecordPage(patientId: string, token: string, cursor?: string): Promise<RecordPage> {
+    const params = new URLSearchParams({ limit: String(PAGE_SIZE) });
+    if (cursor) params.set('cursor', cursor);
+    const response = await fetch(`http://localhost:8080/records/patient/${patientId}?${params.toString()}`, {
+        headers: { 'Authorization': `Bearer ${token}` },
+    });
+
+    if (response.status === 403) {
+        throw new Error('Akses ditolak. Anda tidak memiliki izin untuk melihat data pasien ini.');
+    }
+    if (!response.ok) {
+        throw new Error('Gagal mengambil data pasien.');
+    }
+    return response.json();
+}
+
 export default function PatientDetailPage() {
     const params = useParams();
     const patientId = params.patientId as string;
 
     const [records, setRecords] = useState<MedicalRecord[]>([]);
+    const [nextCursor, setNextCursor] = useState<string | null>(null);
+    const [totalRecords, setTotalRecords] = useState(0);
+    const [isLoadingMore, setIsLoadingMore] = useState(false);
     const [user, setUser] = useState<UserProfile | null>(null);
     const [isLoading, setIsLoading] = useState(true);
     const [error, setError] = useState('');
@@ -89,7 +128,7 @@ export default function PatientDetailPage() {
             'Content-Type': 'application/json',
             'Authorization': `Bearer ${token}`,
             },
-            body: JSON.stringify({ patient_id: patientIdForRequest }),
+            body: JSON.stringify({ patient_id: patientIdForRequest, data_scope: TREATMENT_SCOPE }),
         });
 
         if (!response.ok) {
@@ -109,6 +148,22 @@ export default function PatientDetailPage() {
         }
     };
 
+    const handleLoadMore = async () => {
+        const token = localStorage.getItem('token');
+        if (!token || !nextCursor) return;
+        setIsLoadingMore(true);
+        try {
+            const data = await fetchRecordPage(patientId, token, nextCursor);
+            setRecords((prev) => [...prev, ...(data.items ?? [])]);
+            setNextCursor(data.next_cursor ?? null);
+            setTotalRecords(data.total);
+        } catch (err) {
+            if (err instanceof Error) alert(err.message);
+        } finally {
+            setIsLoadingMore(false);
+        }
+    };
+
     useEffect(() => {
         if (!patientId) return;
 
@@ -120,19 +175,10 @@ export default function PatientDetailPage() {
                 return;
             }
             try {
-                const response = await fetch(`http://localhost:8080/records/patient/${patientId}`, {
-                headers: { 'Authorization': `Bearer ${token}` },
-                });
-
-                if (response.status === 403) {
-                throw new Error('Akses ditolak. Anda tidak memiliki izin untuk melihat data pasien ini.');
-                }
-                if (!response.ok) {
-                throw new Error('Gagal mengambil data pasien.');
-                }
-
-                const data = await response.json();
-                setRecords(data);
+                const data = await fetchRecordPage(patientId, token);
+                setRecords(data.items ?? []);
+                setNextCursor(data.next_cursor ?? null);
+                setTotalRecords(data.total);
 
                 const userResponse = await fetch(`http://localhost:8080/users/detail/${patientId}`, {
                 headers: { 'Authorization': `Bearer ${token}` },
@@ -283,6 +329,29 @@ export default function PatientDetailPage() {
                                     Lihat Lampiran
                                 </a>
                             )}
+
+                            {/* Lampiran berganda beserta nama berkasnya */}
+                            {record.attachments?.map((attachment) => (
+                                <a
+                                    key={attachment.cid}
+                                    href={`https://ipfs.io/ipfs/${attachment.cid}`}
+                                    target="_blank"
+                                    rel="noopener noreferrer"
+                                    title={`SHA-256: ${attachment.sha256}`}
+                                    className="
+                                        inline-flex items-center gap-1.5 
+                                        px-3 py-1 mt-3 mr-2 
+                                        bg-blue-50 text-blue-700 
+                                        rounded-full 
+                                        border border-blue-200 
+                                        text-xs
+                                        hover:bg-blue-100 transition-colors
+                                    "
+                                >
+                                    <LinkIcon className="w-3 h-3" />
+                                    {attachment.filename}
+                                </a>
+                            ))}
                         </div>
 
                         <p className="text-xs text-gray-500">Oleh: {record.doctor_name}</p>  
@@ -292,6 +361,15 @@ export default function PatientDetailPage() {
                 ) : (
                 <p>Pasien ini belum memiliki riwayat medis.</p>
                 )}
+
+                {nextCursor && (
+                <div className="flex flex-col items-center gap-2">
+                    <p className="text-xs text-gray-500">Menampilkan {records.length} dari {totalRecords} rekam medis</p>
+                    <Button variant="outline" style={{boxShadow: "none", borderRadius: "5px"}} onClick={handleLoadMore} disabled={isLoadingMore}>
+                        {isLoadingMore ? 'Memuat...' : 'Muat lebih banyak'}
+                    </Button>
+                </div>
+                )}
             </div>
             )}
         </div>
@@ -6,6 +6,7 @@ import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
 import Link from 'next/link';
+import { TREATMENT_SCOPE } from '@/lib/consent';
 
 interface PublicUser {
   id: string;
@@ -59,7 +60,7 @@ export default function PatientsPage() {
           'Content-Type': 'application/json',
           'Authorization': `Bearer ${token}`,
         },
-        body: JSON.stringify({ patient_id: patientId }),
+        body: JSON.stringify({ patient_id: patientId, data_scope: TREATMENT_SCOPE }),
       });
 
       if (!response.ok) {
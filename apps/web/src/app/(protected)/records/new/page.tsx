@@ -20,7 +20,7 @@ export default function NewRecordPage() {
     const [patientId, setPatientId] = useState('');
     const [diagnosis, setDiagnosis] = useState('');
     const [notes, setNotes] = useState('');
-    const [file, setFile] = useState<File | null>(null);
+    const [files, setFiles] = useState<File[]>([]);
     const [user, setUser] = useState<UserProfile | null>(null);
 
     const [message, setMessage] = useState('');
@@ -73,11 +73,11 @@ export default function NewRecordPage() {
         return;
         }
 
-        let attachmentCid = "";
-
         try {
-        // TAHAP 1: UPLOAD FILE JIKA ADA
-        if (file) {
+        // TAHAP 1: UPLOAD SETIAP LAMPIRAN. Ukuran, tipe dan SHA-256 dihitung
+        // server saat upload, jadi rekam medis cukup menyebut CID dan nama berkas.
+        const attachments: { cid: string; filename: string }[] = [];
+        for (const file of files) {
             const formData = new FormData();
             formData.append('file', file);
 
@@ -88,12 +88,12 @@ export default function NewRecordPage() {
             },
             body: formData,
             });
-            
-            const uploadData = await uploadResponse.json();
+
             if (!uploadResponse.ok) {
-            throw new Error(uploadData.message || 'Gagal upload file.');
+            throw new Error((await uploadResponse.text()) || `Gagal upload ${file.name}.`);
             }
-            attachmentCid = uploadData.cid;
+            const uploadData = await uploadResponse.json();
+            attachments.push({ cid: uploadData.cid, filename: file.name });
         }
 
         // TAHAP 2: KIRIM DATA REKAM MEDIS
@@ -107,13 +107,12 @@ export default function NewRecordPage() {
             patient_id: patientId,
             diagnosis,
             notes,
-            attachment_cid: attachmentCid,
+            attachments,
             }),
         });
 
-        const recordData = await recordResponse.json();
         if (!recordResponse.ok) {
-            throw new Error(recordData.message || 'Gagal menambahkan rekam medis.');
+            throw new Error((await recordResponse.text()) || 'Gagal menambahkan rekam medis.');
         }
         
         alert('Sukses! Rekam medis berhasil ditambahkan.');
@@ -204,12 +203,13 @@ export default function NewRecordPage() {
                     />
                 </div>
                 <div className="flex flex-col space-y-1.5">
-                    <Label htmlFor="attachment">Lampiran (Opsional)</Label>
+                    <Label htmlFor="attachment">Lampiran (Opsional, maks. 10 MB per berkas)</Label>
                     <Input
                     style={{borderRadius: 5, marginTop: "4px"}} 
                     id="attachment"
                     type="file"
-                    onChange={(e) => setFile(e.target.files ? e.target.files[0] : null)}
+                    multiple
+                    onChange={(e) => setFiles(e.target.files ? Array.from(e.target.files) : [])}
                     />
                 </div>
                 </div>
@@ -0,0 +1,3 @@
+// Cakupan izin yang diminta dokter: membaca seluruh rekam medis dan menulis
+// rekam medis baru. Pasien tetap dapat menyetujui cakupan yang lebih sempit.
+export const TREATMENT_SCOPE = '{"all":true,"write":true}';